@@ -2,9 +2,13 @@ package controller
 
 import (
 	"encoding/json"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/accesslog"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/circuitbreaker"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/slo"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/identity"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
 	"github.com/sony/gobreaker/v2"
 	"log/slog"
@@ -20,15 +24,22 @@ import (
 type Controller struct {
 	metrics        *metrics.Metrics
 	circuitBreaker *circuitbreaker.CircuitBreaker
+	sloTracker     *slo.Tracker
+	// proxies trusts the proxies in front of the gateway to assert the user, sent to the services with identityToken
+	proxies       accesslog.Options
+	identityToken string
 }
 
-// NewController creates a new controller with injected dependencies
-func NewController(m *metrics.Metrics) *Controller {
+// NewController creates a new controller with injected dependencies, its circuit breaker configured by cfg
+func NewController(cfg config.Config, m *metrics.Metrics, tracker *slo.Tracker) *Controller {
 	c := &Controller{
-		metrics: m,
+		metrics:       m,
+		sloTracker:    tracker,
+		proxies:       cfg.AccessLogOptions(),
+		identityToken: cfg.Identity.Token,
 	}
 
-	circuitBreakerSettings := getCircuitBreakerDefaultSettings(c)
+	circuitBreakerSettings := getCircuitBreakerSettings(c, cfg, cfg.Service)
 	c.circuitBreaker = circuitbreaker.NewCircuitBreaker(circuitBreakerSettings)
 	return c
 }
@@ -48,7 +59,7 @@ func (c *Controller) HealthCheckHandler(w http.ResponseWriter, r *http.Request)
 		c.recordHealthCheckData(startTime, "failure")
 
 		// send error response
-		response.Error(w, err)
+		response.Error(w, r, err)
 		slog.Error("health check failed, sent response", "content", err, "to", r.RemoteAddr)
 		return
 	}
@@ -56,7 +67,7 @@ func (c *Controller) HealthCheckHandler(w http.ResponseWriter, r *http.Request)
 	c.recordHealthCheckData(startTime, "success")
 
 	// send success response
-	response.Ok(w, msg)
+	response.Write(w, r, http.StatusOK, json.RawMessage(msg))
 	slog.Debug("successful health check, sent response", "content", msg, "content_as_string", string(msg), "to", r.RemoteAddr)
 }
 
@@ -72,7 +83,7 @@ func (c *Controller) RoutesHandler(w http.ResponseWriter, r *http.Request) {
 		c.recordRoutesRequestData(startTime, "failure")
 
 		// send error response
-		response.Error(w, err)
+		response.Error(w, r, err)
 		slog.Error("routes request failed, sent response", "content", err, "to", r.RemoteAddr)
 		return
 	}
@@ -80,7 +91,7 @@ func (c *Controller) RoutesHandler(w http.ResponseWriter, r *http.Request) {
 	c.recordRoutesRequestData(startTime, "success")
 
 	// send success response
-	response.Ok(w, msg)
+	response.Write(w, r, http.StatusOK, json.RawMessage(msg))
 	slog.Debug("successful requested routes, sent response", "content", msg, "content_as_string", string(msg), "to", r.RemoteAddr)
 }
 
@@ -89,10 +100,19 @@ func (c *Controller) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	c.metrics.Handler().ServeHTTP(w, r)
 }
 
+// SLOHandler reports the attainment, remaining error budget and burn rates of the gateway objectives
+func (c *Controller) SLOHandler(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("requested slo report", "from", r.RemoteAddr)
+	c.sloTracker.Handler().ServeHTTP(w, r)
+}
+
 func (c *Controller) RerouteHandler(service string, serviceProxy *httputil.ReverseProxy) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// remove prefix before forwarding
+		// remove prefix before forwarding, telling the service where it is mounted to build its links
 		removePrefix(r, service)
+		setForwardedHeaders(r, service)
+		c.forwardIdentity(r)
+		accesslog.SetUpstream(r, strings.TrimPrefix(service, "/"))
 		slog.Debug("Forwarding request to '"+service+"'", "endpoint", r.URL.Path)
 		serviceProxy.ServeHTTP(w, r)
 	}
@@ -119,13 +139,13 @@ func (c *Controller) generateRoutesMessageResponse() ([]byte, error) {
 func (c *Controller) recordHealthCheckData(startTime time.Time, status string) {
 	elapsedTimeSinceStart := time.Since(startTime)
 	c.metrics.RecordCircuitBreakerRequest("healthcheck", status)
-	c.metrics.RecordHealthCheck(status, elapsedTimeSinceStart)
+	c.metrics.Observe("healthcheck", status, elapsedTimeSinceStart)
 }
 
 func (c *Controller) recordRoutesRequestData(startTime time.Time, status string) {
 	elapsedTimeSinceStart := time.Since(startTime)
 	c.metrics.RecordCircuitBreakerRequest("routes", status)
-	c.metrics.RecordRoutesRequest(status, elapsedTimeSinceStart)
+	c.metrics.Observe("routes", status, elapsedTimeSinceStart)
 }
 
 func removePrefix(r *http.Request, service string) {
@@ -135,6 +155,32 @@ func removePrefix(r *http.Request, service string) {
 	}
 }
 
+// setForwardedHeaders tells the upstream the prefix, host and scheme the client used, keeping the host and
+// scheme forwarded by a proxy in front of the gateway
+func setForwardedHeaders(r *http.Request, service string) {
+	r.Header.Set("X-Forwarded-Prefix", service)
+	if r.Header.Get("X-Forwarded-Host") == "" {
+		r.Header.Set("X-Forwarded-Host", r.Host)
+	}
+	if r.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if r.TLS != nil {
+			proto = "https"
+		}
+		r.Header.Set("X-Forwarded-Proto", proto)
+	}
+}
+
+// forwardIdentity replaces the identity headers of r, which clients could forge, by the user asserted by a trusted
+// proxy in front of the gateway
+func (c *Controller) forwardIdentity(r *http.Request) {
+	user := ""
+	if c.proxies.Trusts(r.RemoteAddr) {
+		user = identity.ProxyUser(r)
+	}
+	identity.Forward(r, user, c.identityToken)
+}
+
 /* === Getters === */
 
 // GetMetricsMiddleware returns the metrics middleware
@@ -142,6 +188,13 @@ func (c *Controller) GetMetricsMiddleware() func(http.Handler) http.Handler {
 	return c.metrics.Middleware()
 }
 
+// GetProxyTransport returns the transport forwarding requests to the upstream of cfg, guarded by its own circuit
+// breaker and instrumented with upstream metrics
+func (c *Controller) GetProxyTransport(cfg config.Config) http.RoundTripper {
+	guarded := circuitbreaker.NewTransport(getCircuitBreakerSettings(c, cfg, cfg.Upstream.Name), http.DefaultTransport)
+	return c.metrics.InstrumentTransport(cfg.Upstream.Name, guarded)
+}
+
 // GetCircuitBreakerMetrics returns current circuit breaker statistics
 func (c *Controller) GetCircuitBreakerMetrics() map[string]interface{} {
 	counts := c.circuitBreaker.Counts()
@@ -155,19 +208,11 @@ func (c *Controller) GetCircuitBreakerMetrics() map[string]interface{} {
 	}
 }
 
-func getCircuitBreakerDefaultSettings(c *Controller) gobreaker.Settings {
-	circuitBreakerSettings := gobreaker.Settings{
-		Name:     "api-gateway",
-		Timeout:  time.Second * 30,
-		Interval: time.Second * 60,
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-			return counts.Requests >= 5 && failureRatio >= 0.8
-		},
-		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-			c.metrics.RecordCircuitBreakerStateChange(name, to)
-			slog.Info("circuit breaker state changed", "name", name, "from", from, "to", to)
-		},
+func getCircuitBreakerSettings(c *Controller, cfg config.Config, name string) gobreaker.Settings {
+	circuitBreakerSettings := cfg.CircuitBreakerSettings(name)
+	circuitBreakerSettings.OnStateChange = func(name string, from gobreaker.State, to gobreaker.State) {
+		c.metrics.RecordCircuitBreakerStateChange(name, to)
+		slog.Info("circuit breaker state changed", "name", name, "from", from, "to", to)
 	}
 	return circuitBreakerSettings
 }
@@ -1,15 +1,20 @@
 package controller
 
 import (
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/slo"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/dns"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/identity"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/port"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/prefix"
+	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -18,12 +23,19 @@ func createMockReverseProxy() *httputil.ReverseProxy {
 	return httputil.NewSingleHostReverseProxy(target)
 }
 
+func newTestController(t *testing.T) *Controller {
+	tracker, err := slo.NewTracker(slo.DefaultObjectives()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewController(config.Default("api-gateway"), metrics.New(metrics.WithObjectives(tracker)), tracker)
+}
+
 func TestRerouteHandler(t *testing.T) {
 	proxy := createMockReverseProxy()
 
 	// create the handler
-	metricsInstance := metrics.New()
-	ctrl := NewController(metricsInstance)
+	ctrl := newTestController(t)
 	handler := ctrl.RerouteHandler(endpoint.Service, proxy)
 
 	tests := []struct {
@@ -131,3 +143,87 @@ func TestRemovePrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestSetForwardedHeaders(t *testing.T) {
+	req := httptest.NewRequest("GET", "/service/Patient", nil)
+	setForwardedHeaders(req, endpoint.Service)
+	if req.Header.Get("X-Forwarded-Prefix") != endpoint.Service || req.Header.Get("X-Forwarded-Host") != "example.com" ||
+		req.Header.Get("X-Forwarded-Proto") != "http" {
+		t.Errorf("Expected the prefix, host and scheme of the request, got %v", req.Header)
+	}
+
+	// the values of a proxy in front of the gateway are kept
+	req = httptest.NewRequest("GET", "/service/Patient", nil)
+	req.Header.Set("X-Forwarded-Host", "cce.example.org")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	setForwardedHeaders(req, endpoint.Service)
+	if req.Header.Get("X-Forwarded-Host") != "cce.example.org" || req.Header.Get("X-Forwarded-Proto") != "https" {
+		t.Errorf("Expected the forwarded host and scheme to be kept, got %v", req.Header)
+	}
+}
+
+func TestRerouteHandlerForwardsIdentity(t *testing.T) {
+	forwarded := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Clone()
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	cfg := config.Default("api-gateway")
+	cfg.HTTP.TrustedProxies = []string{"10.0.0.1"}
+	cfg.Identity.Token = "gateway-secret"
+	ctrl := NewController(cfg, metrics.New(), nil)
+	handler := ctrl.RerouteHandler(endpoint.Service, httputil.NewSingleHostReverseProxy(target))
+
+	tests := []struct {
+		name      string
+		from      string
+		headers   map[string]string
+		wantUser  string
+		wantToken string
+	}{
+		{name: "user asserted by the trusted proxy", from: "10.0.0.1:4000",
+			headers:  map[string]string{identity.AuthRequestUserHeader: "alice"},
+			wantUser: "alice", wantToken: "gateway-secret"},
+		{name: "forged identity from a client", from: "10.0.0.7:4000",
+			headers: map[string]string{identity.UserHeader: "mallory", identity.TokenHeader: "guessed", identity.AuthRequestUserHeader: "mallory"}},
+		{name: "no user asserted", from: "10.0.0.1:4000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/service/Patient", nil)
+			req.RemoteAddr = tt.from
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			handler(httptest.NewRecorder(), req)
+
+			headers := <-forwarded
+			if got := headers.Get(identity.UserHeader); got != tt.wantUser {
+				t.Errorf("Expected the user %q to be forwarded, got %q", tt.wantUser, got)
+			}
+			if got := headers.Get(identity.TokenHeader); got != tt.wantToken {
+				t.Errorf("Expected the token %q to be forwarded, got %q", tt.wantToken, got)
+			}
+			if got := headers.Get(identity.AuthRequestUserHeader); got != "" {
+				t.Errorf("Expected the client identity headers to be removed, got %q", got)
+			}
+		})
+	}
+}
+
+func TestSLOHandler(t *testing.T) {
+	ctrl := newTestController(t)
+
+	rec := httptest.NewRecorder()
+	ctrl.SLOHandler(rec, httptest.NewRequest("GET", endpoint.SLO, nil))
+
+	if rec.Code != 200 {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"name":"gateway_availability"`) {
+		t.Errorf("Expected the gateway objectives in the report, got %s", rec.Body.String())
+	}
+}
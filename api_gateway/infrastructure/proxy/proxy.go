@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/proxyerror"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// StatusClientClosedRequest is answered, for the access log only, when the client went away before the upstream did
+const StatusClientClosedRequest = 499
+
+// maxDrain bounds how much of a replaced upstream body is read so that the connection can be reused
+const maxDrain = 64 << 10
+
+// Options configures the reverse proxy forwarding requests to one upstream
+type Options struct {
+	// Upstream names the upstream in logs
+	Upstream string
+	// Transport sends the requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+	// NormalizeErrors replaces the body of upstream 5xx responses with a problem of the same status
+	NormalizeErrors bool
+	// RetryAfter is advertised to clients rejected by an open circuit breaker, omitted when zero
+	RetryAfter time.Duration
+}
+
+// New returns a reverse proxy to target answering its own failures and, with NormalizeErrors, the upstream
+// server errors with problems, and logging through slog instead of the standard logger
+func New(target *url.URL, opts Options) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = opts.Transport
+	proxy.ErrorHandler = ErrorHandler(opts)
+	proxy.ErrorLog = slog.NewLogLogger(slog.Default().Handler(), slog.LevelError)
+	if opts.NormalizeErrors {
+		proxy.ModifyResponse = NormalizeErrors(opts.Upstream)
+	}
+	return proxy
+}
+
+// failure is how a class of proxy errors is answered, details name the failure without revealing the upstream
+type failure struct {
+	t      response.ProblemType
+	detail string
+	level  slog.Level
+}
+
+var failures = map[proxyerror.Type]failure{
+	proxyerror.Timeout:           {response.TypeGatewayTimeout, "the upstream service did not answer in time", slog.LevelError},
+	proxyerror.DNS:               {response.TypeBadGateway, "the upstream service could not be resolved", slog.LevelError},
+	proxyerror.ConnectionRefused: {response.TypeBadGateway, "the upstream service refused the connection", slog.LevelError},
+	proxyerror.ConnectionReset:   {response.TypeBadGateway, "the connection to the upstream service was interrupted", slog.LevelError},
+	proxyerror.UnexpectedEOF:     {response.TypeBadGateway, "the connection to the upstream service was interrupted", slog.LevelError},
+	proxyerror.TLS:               {response.TypeBadGateway, "the TLS handshake with the upstream service failed", slog.LevelError},
+	proxyerror.CircuitOpen:       {response.TypeUnavailable, "the upstream service is failing, requests are rejected until it recovers", slog.LevelWarn},
+}
+
+// ErrorHandler answers the requests the proxy could not forward with a problem matching the class of the
+// failure: 504 for timeouts, 503 while the circuit breaker is open and 502 otherwise
+func ErrorHandler(opts Options) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		class := proxyerror.Classify(err)
+		attrs := []any{"upstream", opts.Upstream, "error", err, "error_type", class, "method", r.Method,
+			"path", r.URL.Path, "request_id", requestid.FromRequest(r)}
+
+		if class == proxyerror.Canceled {
+			slog.Debug("client canceled the upstream request", attrs...)
+			w.WriteHeader(StatusClientClosedRequest)
+			return
+		}
+
+		f, ok := failures[class]
+		if !ok {
+			f = failure{t: response.TypeBadGateway, level: slog.LevelError}
+		}
+		if class == proxyerror.CircuitOpen && opts.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(opts.RetryAfter.Seconds())))
+		}
+		slog.Log(r.Context(), f.level, "upstream request failed", attrs...)
+		response.WriteProblem(w, r, response.NewProblem(f.t, f.detail))
+	}
+}
+
+// NormalizeErrors returns a ModifyResponse hook replacing the body of 5xx responses with a problem carrying
+// only the status, the upstream body being discarded
+func NormalizeErrors(upstream string) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if resp.StatusCode < http.StatusInternalServerError {
+			return nil
+		}
+
+		id := requestid.FromRequest(resp.Request)
+		slog.Warn("upstream answered with a server error", "upstream", upstream, "status", resp.StatusCode,
+			"method", resp.Request.Method, "path", resp.Request.URL.Path, "request_id", id)
+
+		problem := response.NewProblem(problemTypeFor(resp.StatusCode), "")
+		problem.RequestID = id
+		body, err := json.Marshal(problem)
+		if err != nil {
+			return err
+		}
+
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		resp.Header.Set("Content-Type", response.ProblemContentType)
+		resp.Header.Set("X-Content-Type-Options", "nosniff")
+		for _, header := range []string{"Content-Encoding", "Content-Language", "ETag", "Last-Modified"} {
+			resp.Header.Del(header)
+		}
+		return nil
+	}
+}
+
+// problemTypeFor keeps the status of the upstream response with its registered problem type, statuses
+// without one fall back to about:blank titled with the status text, as RFC 9457 suggests
+func problemTypeFor(status int) response.ProblemType {
+	switch status {
+	case http.StatusBadGateway:
+		return response.TypeBadGateway
+	case http.StatusServiceUnavailable:
+		return response.TypeUnavailable
+	case http.StatusGatewayTimeout:
+		return response.TypeGatewayTimeout
+	case http.StatusInternalServerError:
+		return response.TypeInternal
+	default:
+		return response.ProblemType{URI: "about:blank", Title: http.StatusText(status), Status: status}
+	}
+}
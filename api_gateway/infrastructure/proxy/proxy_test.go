@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"github.com/sony/gobreaker/v2"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestErrorHandler(t *testing.T) {
+	handler := ErrorHandler(Options{Upstream: "service", RetryAfter: 30 * time.Second})
+
+	tests := []struct {
+		name               string
+		err                error
+		expectedStatus     int
+		expectedType       string
+		expectedRetryAfter string
+	}{
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, http.StatusBadGateway, response.TypeBadGateway.URI, ""},
+		{"dns", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "service", IsNotFound: true}}, http.StatusBadGateway, response.TypeBadGateway.URI, ""},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout, response.TypeGatewayTimeout.URI, ""},
+		{"circuit open", gobreaker.ErrOpenState, http.StatusServiceUnavailable, response.TypeUnavailable.URI, "30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/patients", nil)
+			req.Header.Set(requestid.Header, "req-1")
+			rr := httptest.NewRecorder()
+
+			handler(rr, req, tt.err)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tt.expectedRetryAfter {
+				t.Errorf("Expected Retry-After %q, got %q", tt.expectedRetryAfter, retryAfter)
+			}
+			var problem response.Problem
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("Expected a problem, got %s", rr.Body.String())
+			}
+			if problem.Type != tt.expectedType || problem.RequestID != "req-1" {
+				t.Errorf("Unexpected problem %+v", problem)
+			}
+			if strings.Contains(problem.Detail, "dial") {
+				t.Errorf("Expected the upstream error to be hidden, got %q", problem.Detail)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerCanceled(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	ErrorHandler(Options{})(rr, httptest.NewRequest(http.MethodGet, "/patients", nil), context.Canceled)
+
+	if rr.Code != StatusClientClosedRequest || rr.Body.Len() != 0 {
+		t.Errorf("Expected an empty %d, got %d %s", StatusClientClosedRequest, rr.Code, rr.Body.String())
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		expectedType   string
+		expectedStatus int
+	}{
+		{"stack trace", http.StatusInternalServerError, "panic: runtime error\ngoroutine 1 [running]:", response.TypeInternal.URI, http.StatusInternalServerError},
+		{"unavailable", http.StatusServiceUnavailable, "db down", response.TypeUnavailable.URI, http.StatusServiceUnavailable},
+		{"unregistered status", http.StatusNotImplemented, "no such method", "about:blank", http.StatusNotImplemented},
+		{"client error untouched", http.StatusNotFound, "not found", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer upstream.Close()
+			target, _ := url.Parse(upstream.URL)
+			proxy := New(target, Options{Upstream: "service", NormalizeErrors: true})
+
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/patients", nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedType == "" {
+				if rr.Body.String() != tt.body {
+					t.Errorf("Expected the upstream body, got %q", rr.Body.String())
+				}
+				return
+			}
+			var problem response.Problem
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil || problem.Type != tt.expectedType {
+				t.Errorf("Expected a %s problem, got %s", tt.expectedType, rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), tt.body) {
+				t.Errorf("Expected the upstream body to be hidden, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewUnreachableUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(upstream.URL)
+	upstream.Close()
+	proxy := New(target, Options{Upstream: "service"})
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/patients", nil))
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != response.ProblemContentType {
+		t.Errorf("Expected Content-Type %s, got %s", response.ProblemContentType, contentType)
+	}
+}
+
+func TestStreamsLargeDownloads(t *testing.T) {
+	const size, chunk = 4 << 20, 64 << 10
+	// the upstream finishes the download on its own after a while, so that a gateway buffering it fails the test
+	release := make(chan struct{})
+	timer := time.AfterFunc(5*time.Second, func() { close(release) })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		_, _ = w.Write(make([]byte, chunk))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write(make([]byte, size-chunk))
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	gateway := httptest.NewServer(response.Conditional(New(target, Options{Upstream: "service"})))
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL + "/DocumentReference/d1/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if _, err := io.ReadFull(resp.Body, make([]byte, chunk)); err != nil {
+		t.Fatal(err)
+	}
+	if !timer.Stop() {
+		t.Fatal("Expected the start of the download before the upstream finished it")
+	}
+	close(release)
+	if n, err := io.Copy(io.Discard, resp.Body); err != nil || n != size-chunk {
+		t.Errorf("Expected the rest of the download, got %d bytes: %v", n, err)
+	}
+}
@@ -2,45 +2,96 @@ package server
 
 import (
 	"api_gateway/infrastructure/controller"
-	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/dns"
+	"api_gateway/infrastructure/proxy"
+	"context"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/accesslog"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/admin"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
-	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/port"
-	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/prefix"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
 	"github.com/gorilla/mux"
 	"log/slog"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
-	"strconv"
 )
 
-func StartServer(controller *controller.Controller) {
+// StartServer serves the gateway routes on the public listener and the operational ones on adminServer,
+// forwarding /service requests to the upstream configured in cfg, until ctx is done, returning once the listeners
+// are shut down
+func StartServer(ctx context.Context, cfg config.Config, controller *controller.Controller, adminServer *admin.Server) {
+	startAdmin(controller, adminServer)
+
 	r := mux.NewRouter()
 
+	r.Use(requestid.Middleware)
 	r.Use(controller.GetMetricsMiddleware())
+	r.Use(accesslog.Middleware(cfg.AccessLogOptions()))
+	if cfg.HTTP.Compression {
+		r.Use(response.Compress(cfg.CompressOptions()))
+	}
+	r.Use(response.Conditional)
 
 	/* API GATEWAY ENDPOINTS */
 	// health
 	r.HandleFunc(endpoint.Health, controller.HealthCheckHandler).Methods("GET")
 	// route
 	r.HandleFunc(endpoint.Route, controller.RoutesHandler).Methods("GET")
-	// metrics endpoint
-	r.HandleFunc(endpoint.Metrics, controller.MetricsHandler).Methods("GET")
 
 	/* REROUTES */
 	// service
-	serviceURL, _ := url.Parse(prefix.HttpPrefix + dns.Service + ":" + strconv.Itoa(port.Http))
-	serviceProxy := httputil.NewSingleHostReverseProxy(serviceURL)
+	// the upstream URL is validated when the configuration is loaded
+	serviceURL, _ := url.Parse(cfg.Upstream.URL)
+	serviceProxy := proxy.New(serviceURL, proxy.Options{
+		Upstream:        cfg.Upstream.Name,
+		Transport:       controller.GetProxyTransport(cfg),
+		NormalizeErrors: cfg.Upstream.NormalizeErrors,
+		RetryAfter:      cfg.CircuitBreaker.Timeout,
+	})
 	r.PathPrefix(endpoint.Service).HandlerFunc(controller.RerouteHandler(endpoint.Service, serviceProxy))
 
-	startServing(r)
+	startServing(ctx, cfg, r)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("failed to stop admin listener", "error", err)
+	}
 }
 
-func startServing(r *mux.Router) {
-	portString := ":" + strconv.Itoa(port.Http)
-	slog.Info("API Gateway listening on " + portString)
-	err := http.ListenAndServe(portString, r)
-	if err != nil {
+// startAdmin serves the operational endpoints on the admin port, they are not registered on the public router
+func startAdmin(controller *controller.Controller, adminServer *admin.Server) {
+	// metrics endpoint
+	adminServer.Handle("GET "+endpoint.Metrics, http.HandlerFunc(controller.MetricsHandler))
+	// service level objectives
+	adminServer.Handle("GET "+endpoint.SLO, http.HandlerFunc(controller.SLOHandler))
+	// runtime log level
+	adminServer.Handle(endpoint.LogLevel, log.LevelHandler())
+
+	adminServer.Start()
+}
+
+// startServing serves r until ctx is done, then stops accepting connections and waits for the requests in flight
+// up to the configured shutdown timeout
+func startServing(ctx context.Context, cfg config.Config, r *mux.Router) {
+	server := &http.Server{Addr: cfg.Addr(), Handler: r, ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout}
+	stopped := make(chan error, 1)
+	go func() {
+		slog.Info("API Gateway listening on " + cfg.Addr())
+		stopped <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-stopped:
+		slog.Error("API Gateway listener stopped", "error", err)
 		return
+	case <-ctx.Done():
+		slog.Info("shutting down, waiting for the requests in flight", "timeout", cfg.HTTP.ShutdownTimeout.String())
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still in flight at shutdown were interrupted", "error", err)
 	}
 }
@@ -3,18 +3,126 @@ package main
 import (
 	"api_gateway/infrastructure/controller"
 	"api_gateway/infrastructure/server"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/admin"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/diagnostics"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/slo"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/buildinfo"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
 	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	log.InitAsJson()
+	configFile := flag.String("config", os.Getenv(config.FileEnv), "YAML configuration file, its values are overridden by the environment")
+	printConfig := flag.Bool("print-config", false, "print the resolved configuration, the source of each value and the build information, then exit")
+	flag.Parse()
+
+	cfg, err := config.Load("api-gateway", *configFile)
+	if *printConfig {
+		_ = cfg.Effective().WriteText(os.Stdout)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		slog.Error("invalid configuration, refusing to start", "error", err)
+		os.Exit(1)
+	}
+	if err := log.InitWithFallback(cfg.LogConfig()); err != nil {
+		slog.Error("invalid logging configuration, logging to stdout", "error", err)
+	}
+	stopWatchingSignals := log.WatchSignals()
+	defer stopWatchingSignals()
 	slog.Debug("api_gateway module started", "module", "api_gateway")
 
-	metricsInstance := metrics.New()
+	sloTracker, err := newSLOTracker(cfg.SLO)
+	if err != nil {
+		slog.Error("invalid service level objectives, refusing to start", "error", err)
+		os.Exit(1)
+	}
+
+	metricsInstance := metrics.New(append(cfg.MetricsOptions(), metrics.WithRuntimeMetrics(), metrics.WithObjectives(sloTracker))...)
+	log.SetRedactionObserver(metricsInstance.RecordLogRedaction)
+
+	stopPushingMetrics, err := metricsInstance.StartPushWithConfig(cfg.PushConfig())
+	if err != nil {
+		slog.Error("invalid metrics push configuration, refusing to start", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := stopPushingMetrics(ctx); err != nil {
+			slog.Warn("failed to push final metrics", "error", err)
+		}
+	}()
+
+	ctrl := controller.NewController(cfg, metricsInstance, sloTracker)
+
+	adminServer := newAdminServer(cfg)
+	adminServer.SetConfig("slo", func() any { return sloTracker.Objectives() })
+
+	stopDiagnostics, err := startDiagnostics(cfg, adminServer)
+	if err != nil {
+		slog.Error("invalid diagnostics configuration, refusing to start", "error", err)
+		os.Exit(1)
+	}
+	defer stopDiagnostics()
+
+	// serve until SIGTERM or SIGINT, the deferred calls then push the last metrics and close the stores
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server.StartServer(ctx, cfg, ctrl, adminServer)
+}
+
+// newSLOTracker tracks the objectives defined in the JSON file of cfg, or the gateway defaults when unset
+func newSLOTracker(cfg config.SLO) (*slo.Tracker, error) {
+	objectives := slo.DefaultObjectives()
+	if cfg.File != "" {
+		loaded, err := slo.LoadFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		objectives = loaded
+	}
+	return slo.NewTracker(objectives...)
+}
+
+// newAdminServer configures the admin listener, exposing the effective configuration with secrets masked and the build information
+func newAdminServer(cfg config.Config) *admin.Server {
+	adminServer := admin.NewServer(cfg.AdminConfig())
+	adminServer.SetConfig("config", func() any { return cfg })
+	adminServer.SetConfig("build", func() any { return buildinfo.Get() })
+	adminServer.Handle("GET "+endpoint.Effective, cfg.Handler())
+	adminServer.SetConfig("log_level", func() any { return log.State() })
+	return adminServer
+}
 
-	ctrl := controller.NewController(metricsInstance)
+// startDiagnostics mounts the token-guarded profiling endpoints on the admin listener, or on their own address,
+// and starts continuous profiling when an interval is configured
+func startDiagnostics(cfg config.Config, adminServer *admin.Server) (stop func(), err error) {
+	diag := diagnostics.New(cfg.DiagnosticsConfig())
+	diag.Mount(adminServer.Handle)
+	if err := diag.StartProfiling(); err != nil {
+		return nil, err
+	}
 
-	server.StartServer(ctrl)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := diag.Stop(ctx); err != nil {
+			slog.Warn("failed to stop diagnostics", "error", err)
+		}
+	}, nil
 }
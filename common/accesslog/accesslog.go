@@ -0,0 +1,276 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/identity"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/gorilla/mux"
+)
+
+// Options configures the access log middleware
+type Options struct {
+	// Logger receives one record per request, slog.Default() is used when nil
+	Logger *slog.Logger
+	// SampleRate is the fraction (0..1] of successful requests that are logged, error responses are always logged
+	SampleRate float64
+	// RouteSampleRates overrides SampleRate for specific route templates
+	RouteSampleRates map[string]float64
+	// Suppress lists route templates that are never logged unless the response is a server error
+	Suppress []string
+	// TrustedProxies lists the networks whose forwarding headers are trusted to carry the client IP and principal
+	TrustedProxies []netip.Prefix
+	// Principal extracts the authenticated user from the request, DefaultPrincipal is used when nil
+	Principal func(r *http.Request, trusted bool) string
+}
+
+// DefaultOptions returns options that log every request and suppress the given routes. No proxy is trusted, the
+// peer address being the client IP and forwarding headers being ignored until TrustedProxies lists the networks of
+// the proxies in front of the listener, such as the ingress.
+func DefaultOptions(suppress ...string) Options {
+	return Options{
+		SampleRate: 1,
+		Suppress:   suppress,
+	}
+}
+
+// ParsePrefixes parses the networks of trusted proxies, given in CIDR notation or as single addresses
+func ParsePrefixes(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		if addr, err := netip.ParseAddr(network); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: must be a CIDR or an IP address", network)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Middleware returns a middleware that emits one structured record per request
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	suppressed := make(map[string]struct{}, len(opts.Suppress))
+	for _, route := range opts.Suppress {
+		suppressed[route] = struct{}{}
+	}
+	principal := opts.Principal
+	if principal == nil {
+		principal = DefaultPrincipal
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			// values captured before the handler runs, since proxies may rewrite the request in place
+			method := r.Method
+			path := r.URL.Path
+			trusted := opts.isTrusted(r.RemoteAddr)
+			clientIP := opts.clientIP(r, trusted)
+			user := principal(r, trusted)
+
+			body := &countingReader{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+
+			info := &requestInfo{}
+			r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+
+			ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(ww, r)
+
+			route := path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			if !opts.shouldLog(route, ww.statusCode, suppressed) {
+				return
+			}
+
+			logger := opts.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+
+			level := slog.LevelInfo
+			if ww.statusCode >= http.StatusInternalServerError {
+				level = slog.LevelWarn
+			}
+
+			logger.LogAttrs(r.Context(), level, "http request",
+				slog.String("method", method),
+				slog.String("route", route),
+				slog.String("path", path),
+				slog.Int("status", ww.statusCode),
+				slog.Int64("bytes_in", body.n),
+				slog.Int64("bytes_out", ww.bytes),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("upstream", info.upstream),
+				slog.String("client_ip", clientIP),
+				slog.String("user", user),
+				slog.String("request_id", requestid.FromRequest(r)),
+			)
+		})
+	}
+}
+
+// SetUpstream records the name of the upstream a request is forwarded to, so that it appears in the access log
+func SetUpstream(r *http.Request, upstream string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.upstream = upstream
+	}
+}
+
+// DefaultPrincipal returns the basic auth user name, or the user forwarded by a trusted authenticating proxy
+func DefaultPrincipal(r *http.Request, trusted bool) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	if trusted {
+		return identity.ProxyUser(r)
+	}
+	return ""
+}
+
+// Trusts tells whether a request from remoteAddr comes from one of the trusted proxies
+func (o Options) Trusts(remoteAddr string) bool {
+	return o.isTrusted(remoteAddr)
+}
+
+/* === Helper Methods === */
+
+func (o Options) shouldLog(route string, status int, suppressed map[string]struct{}) bool {
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+	if _, ok := suppressed[route]; ok {
+		return false
+	}
+
+	rate := o.SampleRate
+	if routeRate, ok := o.RouteSampleRates[route]; ok {
+		rate = routeRate
+	}
+	if status >= http.StatusBadRequest || rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
+
+func (o Options) isTrusted(remoteAddr string) bool {
+	addr, ok := parseAddr(remoteAddr)
+	if !ok {
+		return false
+	}
+	for _, prefix := range o.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP walks X-Forwarded-For from the right and returns the first address that is not a trusted proxy
+func (o Options) clientIP(r *http.Request, trusted bool) string {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !trusted {
+		return remote.String()
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, ok := parseAddr(strings.TrimSpace(hops[i]))
+			if !ok {
+				break
+			}
+			if !o.isTrusted(hop.String()) || i == 0 {
+				return hop.String()
+			}
+		}
+	}
+	if realIP, ok := parseAddr(r.Header.Get("X-Real-IP")); ok {
+		return realIP.String()
+	}
+	return remote.String()
+}
+
+func parseAddr(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+/* === Wrappers === */
+
+type requestInfoKey struct{}
+
+// requestInfo carries values that handlers report back to the middleware
+type requestInfo struct {
+	upstream string
+}
+
+// countingReader wraps the request body to count the bytes read by the handler
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code and response size
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController (flushing, deadlines)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
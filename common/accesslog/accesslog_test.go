@@ -0,0 +1,303 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestRouter(opts Options) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(Middleware(opts))
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}).Methods("GET", "POST")
+	r.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("metrics"))
+	})
+	r.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	r.PathPrefix("/proxy").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetUpstream(r, "service")
+		r.URL.Path = "/rewritten"
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return r
+}
+
+func captureLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&buf, nil)), &buf
+}
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON log line, got %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// trustedProxies are the networks of the proxies trusted by the tests
+var trustedProxies = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+}
+
+func TestMiddlewareLogsRequest(t *testing.T) {
+	logger, buf := captureLogger()
+	opts := DefaultOptions()
+	opts.Logger = logger
+	opts.TrustedProxies = trustedProxies
+	router := newTestRouter(opts)
+
+	req := httptest.NewRequest("POST", "/items/42", strings.NewReader("payload"))
+	req.RemoteAddr = "10.1.2.3:5555"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	req.SetBasicAuth("alice", "secret")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	records := decodeRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 access log record, got %d", len(records))
+	}
+	record := records[0]
+
+	expected := map[string]interface{}{
+		"msg":       "http request",
+		"method":    "POST",
+		"route":     "/items/{id}",
+		"path":      "/items/42",
+		"status":    float64(200),
+		"bytes_out": float64(5),
+		"client_ip": "203.0.113.7",
+		"user":      "alice",
+		"upstream":  "",
+	}
+	for key, want := range expected {
+		if record[key] != want {
+			t.Errorf("Expected %s=%v, got %v", key, want, record[key])
+		}
+	}
+	if _, ok := record["duration_ms"]; !ok {
+		t.Error("Expected duration_ms field")
+	}
+}
+
+func TestMiddlewareRecordsBytesIn(t *testing.T) {
+	logger, buf := captureLogger()
+	opts := DefaultOptions()
+	opts.Logger = logger
+
+	r := mux.NewRouter()
+	r.Use(Middleware(opts))
+	r.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 64)
+		for {
+			if _, err := r.Body.Read(b); err != nil {
+				break
+			}
+		}
+	})
+
+	req := httptest.NewRequest("PUT", "/upload", strings.NewReader("0123456789"))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := decodeRecords(t, buf)
+	if len(records) != 1 || records[0]["bytes_in"] != float64(10) {
+		t.Errorf("Expected bytes_in=10, got %v", records)
+	}
+}
+
+func TestMiddlewareUpstreamAndOriginalPath(t *testing.T) {
+	logger, buf := captureLogger()
+	opts := DefaultOptions()
+	opts.Logger = logger
+	router := newTestRouter(opts)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/proxy/health", nil))
+
+	records := decodeRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 access log record, got %d", len(records))
+	}
+	if records[0]["upstream"] != "service" {
+		t.Errorf("Expected upstream service, got %v", records[0]["upstream"])
+	}
+	if records[0]["path"] != "/proxy/health" {
+		t.Errorf("Expected original path to be logged, got %v", records[0]["path"])
+	}
+	if records[0]["status"] != float64(http.StatusNoContent) {
+		t.Errorf("Expected status 204, got %v", records[0]["status"])
+	}
+}
+
+func TestMiddlewareSuppression(t *testing.T) {
+	logger, buf := captureLogger()
+	opts := DefaultOptions("/metrics", "/fail")
+	opts.Logger = logger
+	router := newTestRouter(opts)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	if buf.Len() != 0 {
+		t.Errorf("Expected suppressed route not to be logged, got %s", buf.String())
+	}
+
+	// server errors are logged even on suppressed routes
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+	records := decodeRecords(t, buf)
+	if len(records) != 1 || records[0]["level"] != "WARN" {
+		t.Errorf("Expected one WARN record for server error, got %v", records)
+	}
+}
+
+func TestMiddlewareSampling(t *testing.T) {
+	logger, buf := captureLogger()
+	opts := DefaultOptions()
+	opts.Logger = logger
+	opts.SampleRate = 0
+	opts.RouteSampleRates = map[string]float64{"/metrics": 1}
+	router := newTestRouter(opts)
+
+	for i := 0; i < 10; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/1", nil))
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no records with sample rate 0, got %s", buf.String())
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	if len(decodeRecords(t, buf)) != 1 {
+		t.Error("Expected route sample rate to override the default rate")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	opts := DefaultOptions()
+	opts.TrustedProxies = trustedProxies
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		expectedIP string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "198.51.100.1:1234",
+			expectedIP: "198.51.100.1",
+		},
+		{
+			name:       "untrusted peer cannot spoof forwarded header",
+			remoteAddr: "198.51.100.1:1234",
+			forwarded:  "203.0.113.9",
+			expectedIP: "198.51.100.1",
+		},
+		{
+			name:       "trusted proxy chain",
+			remoteAddr: "10.0.0.2:1234",
+			forwarded:  "203.0.113.9, 192.168.1.1",
+			expectedIP: "203.0.113.9",
+		},
+		{
+			name:       "spoofed leftmost entry is ignored",
+			remoteAddr: "10.0.0.2:1234",
+			forwarded:  "1.1.1.1, 203.0.113.9",
+			expectedIP: "203.0.113.9",
+		},
+		{
+			name:       "real ip header",
+			remoteAddr: "127.0.0.1:1234",
+			realIP:     "203.0.113.10",
+			expectedIP: "203.0.113.10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			got := opts.clientIP(req, opts.isTrusted(req.RemoteAddr))
+			if got != tt.expectedIP {
+				t.Errorf("Expected client IP %s, got %s", tt.expectedIP, got)
+			}
+		})
+	}
+}
+
+func TestDefaultPrincipal(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-User", "bob")
+
+	if got := DefaultPrincipal(req, false); got != "" {
+		t.Errorf("Expected forwarded user to be ignored from untrusted peer, got %s", got)
+	}
+	if got := DefaultPrincipal(req, true); got != "bob" {
+		t.Errorf("Expected forwarded user bob, got %s", got)
+	}
+}
+
+func TestDefaultOptionsTrustNoProxy(t *testing.T) {
+	opts := DefaultOptions()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set("X-Forwarded-User", "bob")
+
+	trusted := opts.isTrusted(req.RemoteAddr)
+	if got := opts.clientIP(req, trusted); got != "10.0.0.2" {
+		t.Errorf("Expected the peer address from a cluster-internal caller, got %s", got)
+	}
+	if got := DefaultPrincipal(req, trusted); got != "" {
+		t.Errorf("Expected the forwarded user to be ignored, got %s", got)
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.42.0.0/16", "192.168.1.7", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.42.0.0/16", "192.168.1.7/32", "fd00::/8"}
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("Expected %s, got %s", want[i], prefix)
+		}
+	}
+	if _, err := ParsePrefixes([]string{"10.42.0.0/33"}); err == nil {
+		t.Error("Expected an invalid network to fail")
+	}
+}
+
+func TestTrustedProxiesEmpty(t *testing.T) {
+	opts := Options{TrustedProxies: []netip.Prefix{}}
+	if opts.isTrusted("127.0.0.1:80") {
+		t.Error("Expected no trusted proxies")
+	}
+}
@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+)
+
+// TokenPrincipal is the principal of the requests authenticated with the bearer token, which names no user
+const TokenPrincipal = "token"
+
+type principalKey struct{}
+
+// Principal returns who authenticated the admin request of ctx: the basic auth username or TokenPrincipal, empty
+// when the admin listener is not authenticated
+func Principal(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// Config configures the admin listener
+type Config struct {
+	// Addr is the address the admin listener binds, separate from the public one
+	Addr string `json:"addr"`
+	// Username and Password enable basic auth when both are set
+	Username string `json:"username,omitempty"`
+	Password string `json:"-"`
+	// Token enables bearer auth when set, either credential is accepted when both are configured
+	Token string `json:"-"`
+}
+
+// authEnabled reports whether requests must carry credentials
+func (c Config) authEnabled() bool {
+	return (c.Username != "" && c.Password != "") || c.Token != ""
+}
+
+// Server hosts the operational endpoints (metrics, diagnostics, log level, config inspection) on their own port,
+// so that they are never reachable through the public listener or the gateway proxy
+type Server struct {
+	cfg    Config
+	mux    *http.ServeMux
+	server *http.Server
+
+	mu       sync.Mutex
+	sections map[string]func() any
+}
+
+// NewServer returns an admin server serving the registered configuration under /config
+func NewServer(cfg Config) *Server {
+	s := &Server{cfg: cfg, mux: http.NewServeMux(), sections: map[string]func() any{}}
+
+	s.mux.HandleFunc("GET "+endpoint.Config, s.configHandler)
+
+	s.SetConfig("admin", func() any { return cfg })
+	return s
+}
+
+// Handle registers handler for pattern on the admin listener
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// SetConfig adds a section to the /config endpoint, value is called on each request so it reflects the
+// current state. Values are encoded as JSON: secrets must be excluded with `json:"-"` or redacted.
+func (s *Server) SetConfig(name string, value func() any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sections[name] = value
+}
+
+// Handler returns the admin routes behind the configured authentication
+func (s *Server) Handler() http.Handler {
+	if !s.cfg.authEnabled() {
+		return s.mux
+	}
+	return s.authenticate(s.mux)
+}
+
+// Start serves the admin listener in the background, failures are logged since the public listener keeps running
+func (s *Server) Start() {
+	if !s.cfg.authEnabled() {
+		slog.Warn("admin endpoints are not authenticated, set ADMIN_TOKEN or ADMIN_USERNAME and ADMIN_PASSWORD", "addr", s.cfg.Addr)
+	}
+	s.server = &http.Server{Addr: s.cfg.Addr, Handler: s.Handler()}
+	go func() {
+		slog.Info("admin endpoints listening on " + s.cfg.Addr)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin listener stopped", "error", err, "addr", s.cfg.Addr)
+		}
+	}()
+}
+
+// Shutdown gracefully stops the admin listener
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
+/* === Helper Methods === */
+
+func (s *Server) configHandler(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	snapshot := make(map[string]any, len(s.sections))
+	for name, value := range s.sections {
+		snapshot[name] = value()
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		slog.Error("failed to encode admin config", "error", err)
+	}
+}
+
+// authenticate accepts a valid bearer token or basic auth credentials, comparing digests in constant time
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Token != "" {
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && equal(token, s.cfg.Token) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, TokenPrincipal)))
+				return
+			}
+		}
+		if s.cfg.Username != "" && s.cfg.Password != "" {
+			if username, password, ok := r.BasicAuth(); ok && equal(username, s.cfg.Username) && equal(password, s.cfg.Password) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, username)))
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		}
+		slog.Warn("rejected unauthenticated admin request", "path", r.URL.Path, "from", r.RemoteAddr)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func equal(given, expected string) bool {
+	a, b := sha256.Sum256([]byte(given)), sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
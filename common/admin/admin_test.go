@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+)
+
+func TestAuthentication(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		prepare   func(r *http.Request)
+		expected  int
+		principal string
+	}{
+		{"open", Config{}, func(r *http.Request) {}, http.StatusOK, ""},
+		{"missing credentials", Config{Token: "secret"}, func(r *http.Request) {}, http.StatusUnauthorized, ""},
+		{"valid token", Config{Token: "secret"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusOK, TokenPrincipal},
+		{"invalid token", Config{Token: "secret"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized, ""},
+		{"valid basic auth", Config{Username: "ops", Password: "pw"}, func(r *http.Request) { r.SetBasicAuth("ops", "pw") }, http.StatusOK, "ops"},
+		{"invalid basic auth", Config{Username: "ops", Password: "pw"}, func(r *http.Request) { r.SetBasicAuth("ops", "nope") }, http.StatusUnauthorized, ""},
+		{"basic auth when both set", Config{Username: "ops", Password: "pw", Token: "secret"}, func(r *http.Request) { r.SetBasicAuth("ops", "pw") }, http.StatusOK, "ops"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(tt.cfg)
+			principal := ""
+			server.Handle("GET "+endpoint.Metrics, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { principal = Principal(r.Context()) }))
+
+			req := httptest.NewRequest(http.MethodGet, endpoint.Metrics, nil)
+			tt.prepare(req)
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rec.Code)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected a WWW-Authenticate challenge")
+			}
+			if principal != tt.principal {
+				t.Errorf("Expected principal %q, got %q", tt.principal, principal)
+			}
+		})
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	server := NewServer(Config{Addr: ":8081", Username: "ops", Password: "pw", Token: "secret"})
+	server.SetConfig("log", func() any { return map[string]string{"level": "debug"} })
+
+	req := httptest.NewRequest(http.MethodGet, endpoint.Config, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	var config map[string]map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatalf("Expected a JSON configuration: %v", err)
+	}
+	if config["log"]["level"] != "debug" || config["admin"]["addr"] != ":8081" {
+		t.Errorf("Unexpected configuration %v", config)
+	}
+	if strings.Contains(rec.Body.String(), "secret") || strings.Contains(rec.Body.String(), `"pw"`) {
+		t.Error("Expected credentials not to be exposed")
+	}
+}
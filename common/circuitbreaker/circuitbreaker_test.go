@@ -1,8 +1,11 @@
 package circuitbreaker
 
 import (
+	"context"
 	"errors"
 	"github.com/sony/gobreaker/v2"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -103,3 +106,47 @@ func TestCustomSettings(t *testing.T) {
 		t.Errorf("Expected circuit to be Open with custom settings, got %v", cb.State())
 	}
 }
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTransportOpensOnServerErrors(t *testing.T) {
+	calls := 0
+	next := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody}, nil
+	})
+	transport := NewTransport(DefaultSettings(), next)
+
+	for i := 0; i < 3; i++ {
+		resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/health", nil))
+		if err != nil || resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("Expected the upstream response while closed, got %v", err)
+		}
+	}
+
+	_, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/health", nil))
+	if !errors.Is(err, gobreaker.ErrOpenState) {
+		t.Errorf("Expected ErrOpenState once open, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected the open breaker not to reach the upstream, got %d calls", calls)
+	}
+}
+
+func TestTransportIgnoresCanceledRequests(t *testing.T) {
+	next := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, context.Canceled
+	})
+	transport := NewTransport(DefaultSettings(), next)
+
+	for i := 0; i < 3; i++ {
+		_, _ = transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/health", nil))
+	}
+
+	_, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/health", nil))
+	if errors.Is(err, gobreaker.ErrOpenState) {
+		t.Error("Expected canceled requests not to open the breaker")
+	}
+}
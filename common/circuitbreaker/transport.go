@@ -0,0 +1,36 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/sony/gobreaker/v2"
+)
+
+// NewTransport returns a transport guarded by a circuit breaker: transport errors and 5xx responses count as
+// failures, and while the breaker is open requests fail with gobreaker.ErrOpenState without reaching next
+func NewTransport(settings gobreaker.Settings, next http.RoundTripper) http.RoundTripper {
+	return &transport{breaker: gobreaker.NewTwoStepCircuitBreaker[*http.Response](settings), next: next}
+}
+
+type transport struct {
+	breaker *gobreaker.TwoStepCircuitBreaker[*http.Response]
+	next    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	done, err := t.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(r)
+	// a client giving up says nothing about the health of the upstream
+	if errors.Is(err, context.Canceled) {
+		done(true)
+		return resp, err
+	}
+	done(err == nil && resp.StatusCode < http.StatusInternalServerError)
+	return resp, err
+}
@@ -0,0 +1,428 @@
+package config
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/accesslog"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/admin"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/diagnostics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/buildinfo"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/dns"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/port"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/prefix"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
+	"github.com/sony/gobreaker/v2"
+)
+
+// Config is the configuration shared by the api_gateway and service modules. Each field is named by its yaml
+// tag in configuration files and by its env tag (prefixed by the env tags of the enclosing sections) in the
+// environment; fields tagged secret are masked whenever the configuration is printed or encoded.
+type Config struct {
+	// Service, Version and Instance identify the running process in logs, metrics and profiles
+	Service  string `yaml:"service" env:"SERVICE_NAME"`
+	Version  string `yaml:"version" env:"SERVICE_VERSION"`
+	Instance string `yaml:"instance" env:"POD_NAME"`
+
+	HTTP           HTTP           `yaml:"http" env:"HTTP_"`
+	Upstream       Upstream       `yaml:"upstream" env:"UPSTREAM_"`
+	Identity       Identity       `yaml:"identity" env:"IDENTITY_"`
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker" env:"CIRCUIT_BREAKER_"`
+	Log            Log            `yaml:"log" env:"LOG_"`
+	Metrics        Metrics        `yaml:"metrics" env:"METRICS_"`
+	Admin          Admin          `yaml:"admin" env:"ADMIN_"`
+	Diagnostics    Diagnostics    `yaml:"diagnostics" env:"DIAGNOSTICS_"`
+	SLO            SLO            `yaml:"slo" env:"SLO_"`
+	Audit          Audit          `yaml:"audit" env:"AUDIT_"`
+	Storage        Storage        `yaml:"storage" env:"STORAGE_"`
+	Documents      Documents      `yaml:"documents" env:"DOCUMENTS_"`
+	HL7            HL7            `yaml:"hl7" env:"HL7_"`
+
+	// sources records where each key was set by Load, keys missing are defaults
+	sources map[string]Source
+}
+
+// HTTP configures the public listener
+type HTTP struct {
+	Port              int           `yaml:"port" env:"PORT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	// ShutdownTimeout bounds the wait for the requests in flight once SIGTERM or SIGINT is received
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// Compression encodes the responses of at least CompressMinSize bytes with the first of CompressEncodings
+	// the client accepts
+	Compression       bool     `yaml:"compression" env:"COMPRESSION"`
+	CompressMinSize   int      `yaml:"compress_min_size" env:"COMPRESS_MIN_SIZE"`
+	CompressEncodings []string `yaml:"compress_encodings" env:"COMPRESS_ENCODINGS"`
+	// TrustedProxies lists the networks (CIDR or single addresses) of the proxies in front of the listener, such as
+	// the ingress, whose forwarding headers the access log trusts for the client IP and user; none by default
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// Upstream configures the service the API Gateway forwards /service requests to
+type Upstream struct {
+	// Name labels the upstream in metrics and access logs
+	Name string `yaml:"name" env:"NAME"`
+	URL  string `yaml:"url" env:"URL"`
+	// NormalizeErrors replaces the body of upstream 5xx responses with a generic problem, so that internal
+	// details such as stack traces never reach clients
+	NormalizeErrors bool `yaml:"normalize_errors" env:"NORMALIZE_ERRORS"`
+}
+
+// Identity configures how the user authenticated in front of the API Gateway reaches the service, which records
+// it as the actor of audit events
+type Identity struct {
+	// Token is shared by the API Gateway, which sends it with the users it forwards, and the service, which only
+	// accepts users sent with it
+	Token string `yaml:"token" env:"TOKEN" secret:"true"`
+}
+
+// CircuitBreaker configures the circuit breakers guarding the handlers
+type CircuitBreaker struct {
+	// Timeout is how long the breaker stays open before letting a request through
+	Timeout time.Duration `yaml:"timeout" env:"TIMEOUT"`
+	// Interval clears the counts of a closed breaker, they are never cleared when zero
+	Interval time.Duration `yaml:"interval" env:"INTERVAL"`
+	// MinRequests and FailureRatio trip the breaker once at least MinRequests failed at this ratio
+	MinRequests  int     `yaml:"min_requests" env:"MIN_REQUESTS"`
+	FailureRatio float64 `yaml:"failure_ratio" env:"FAILURE_RATIO"`
+}
+
+// Log configures logging, see log.Config
+type Log struct {
+	Level       string        `yaml:"level" env:"LEVEL"`
+	LevelTTL    time.Duration `yaml:"level_ttl" env:"LEVEL_TTL"`
+	AddSource   bool          `yaml:"add_source" env:"ADD_SOURCE"`
+	Format      string        `yaml:"format" env:"FORMAT"`
+	FieldNaming string        `yaml:"field_naming" env:"FIELD_NAMING"`
+	Redact      bool          `yaml:"redact" env:"REDACT"`
+	// Outputs lists the sinks records are written to: stdout, stderr, file and syslog
+	Outputs []string  `yaml:"outputs" env:"OUTPUTS"`
+	Stdout  LogOutput `yaml:"stdout" env:"STDOUT_"`
+	Stderr  LogOutput `yaml:"stderr" env:"STDERR_"`
+	File    LogFile   `yaml:"file" env:"FILE_"`
+	Syslog  LogSyslog `yaml:"syslog" env:"SYSLOG_"`
+}
+
+// LogOutput overrides the level and format of one log output
+type LogOutput struct {
+	Level  string `yaml:"level" env:"LEVEL"`
+	Format string `yaml:"format" env:"FORMAT"`
+}
+
+// LogFile configures the rotating file output
+type LogFile struct {
+	LogOutput  `yaml:",inline"`
+	Path       string        `yaml:"path" env:"PATH"`
+	MaxSizeMB  int           `yaml:"max_size_mb" env:"MAX_SIZE_MB"`
+	MaxAge     time.Duration `yaml:"max_age" env:"MAX_AGE"`
+	MaxBackups int           `yaml:"max_backups" env:"MAX_BACKUPS"`
+}
+
+// LogSyslog configures the syslog output
+type LogSyslog struct {
+	LogOutput `yaml:",inline"`
+	Network   string `yaml:"network" env:"NETWORK"`
+	Address   string `yaml:"address" env:"ADDRESS"`
+	Tag       string `yaml:"tag" env:"TAG"`
+}
+
+// Metrics configures the Prometheus metrics
+type Metrics struct {
+	// NativeHistogramBucketFactor enables native histograms when greater than 1, see metrics.WithNativeHistograms
+	NativeHistogramBucketFactor float64     `yaml:"native_histogram_bucket_factor" env:"NATIVE_HISTOGRAM_BUCKET_FACTOR"`
+	Push                        MetricsPush `yaml:"push" env:"PUSH_"`
+}
+
+// MetricsPush configures push mode, see metrics.PushConfig
+type MetricsPush struct {
+	Mode     string        `yaml:"mode" env:"MODE"`
+	URL      string        `yaml:"url" env:"URL"`
+	Job      string        `yaml:"job" env:"JOB"`
+	Interval time.Duration `yaml:"interval" env:"INTERVAL"`
+	Timeout  time.Duration `yaml:"timeout" env:"TIMEOUT"`
+}
+
+// Admin configures the admin listener, see admin.Config
+type Admin struct {
+	Addr     string `yaml:"addr" env:"ADDR"`
+	Username string `yaml:"username" env:"USERNAME"`
+	Password string `yaml:"password" env:"PASSWORD" secret:"true"`
+	Token    string `yaml:"token" env:"TOKEN" secret:"true"`
+}
+
+// Diagnostics configures the profiling endpoints and continuous profiling, see diagnostics.Config
+type Diagnostics struct {
+	Token     string    `yaml:"token" env:"TOKEN" secret:"true"`
+	Addr      string    `yaml:"addr" env:"ADDR"`
+	Profiling Profiling `yaml:"profiling" env:"PROFILE_"`
+}
+
+// Profiling configures continuous profiling, see diagnostics.ProfilingConfig
+type Profiling struct {
+	Interval    time.Duration `yaml:"interval" env:"INTERVAL"`
+	CPUDuration time.Duration `yaml:"cpu_duration" env:"CPU_DURATION"`
+	Dir         string        `yaml:"dir" env:"DIR"`
+	Keep        int           `yaml:"keep" env:"KEEP"`
+	URL         string        `yaml:"url" env:"URL"`
+}
+
+// SLO configures the API Gateway service level objectives
+type SLO struct {
+	// File is a JSON file of objectives (see slo.LoadFile), the gateway defaults are used when empty
+	File string `yaml:"file" env:"FILE"`
+}
+
+// Audit configures the audit trail of the service
+type Audit struct {
+	// Sink is "file" or "memory"
+	Sink     string `yaml:"sink" env:"SINK"`
+	FilePath string `yaml:"file_path" env:"FILE_PATH"`
+	// Key keys the hash chain of the events, it must not be readable by whoever can write the audit file
+	Key string `yaml:"key" env:"KEY" secret:"true"`
+}
+
+// Storage configures where the service keeps its resources
+type Storage struct {
+	// Backend is "sqlite", a database file at Path, "postgres", the database of DSN, or "memory"
+	Backend string `yaml:"backend" env:"BACKEND"`
+	Path    string `yaml:"path" env:"PATH"`
+	DSN     string `yaml:"dsn" env:"DSN" secret:"true"`
+	// MaxOpenConns, MaxIdleConns, ConnMaxLifetime and ConnMaxIdleTime size the connection pool, 0 meaning unlimited
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"CONN_MAX_IDLE_TIME"`
+	// HealthTimeout bounds the ping of the storage done by health checks
+	HealthTimeout time.Duration `yaml:"health_timeout" env:"HEALTH_TIMEOUT"`
+}
+
+// Documents configures where the service keeps the content of clinical documents and what it accepts
+type Documents struct {
+	// Backend is "filesystem", files under Path, or "s3", the objects of a bucket of an S3-compatible API
+	Backend string      `yaml:"backend" env:"BACKEND"`
+	Path    string      `yaml:"path" env:"PATH"`
+	S3      DocumentsS3 `yaml:"s3" env:"S3_"`
+	// MaxSizeMB bounds the content of an uploaded document
+	MaxSizeMB int `yaml:"max_size_mb" env:"MAX_SIZE_MB"`
+	// ContentTypes are the media types documents may have, the content uploaded being sniffed to match
+	ContentTypes []string `yaml:"content_types" env:"CONTENT_TYPES"`
+}
+
+// DocumentsS3 locates the bucket of the s3 document backend, addressed path-style so that local stand-ins such as
+// MinIO work as well as S3
+type DocumentsS3 struct {
+	Endpoint  string `yaml:"endpoint" env:"ENDPOINT"`
+	Region    string `yaml:"region" env:"REGION"`
+	Bucket    string `yaml:"bucket" env:"BUCKET"`
+	AccessKey string `yaml:"access_key" env:"ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"SECRET_KEY" secret:"true"`
+}
+
+// HL7 configures the ingestion of HL7 v2 messages, over MLLP and the HTTP endpoint
+type HL7 struct {
+	// MLLPAddr is the address of the MLLP listener, which is disabled when empty
+	MLLPAddr string `yaml:"mllp_addr" env:"MLLP_ADDR"`
+	// ReadTimeout bounds the wait for the next message of an MLLP connection, idle connections being closed
+	ReadTimeout time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	// MaxMessageKB bounds the size of a message
+	MaxMessageKB int `yaml:"max_message_kb" env:"MAX_MESSAGE_KB"`
+	// DedupTTL and DedupSize bound how long and how many accepted message control IDs are remembered to
+	// acknowledge retransmissions without processing them again: the store remembers them for DedupTTL across
+	// instances, each instance keeping DedupSize of them in memory
+	DedupTTL  time.Duration `yaml:"dedup_ttl" env:"DEDUP_TTL"`
+	DedupSize int           `yaml:"dedup_size" env:"DEDUP_SIZE"`
+}
+
+// Default returns the configuration used when neither a file nor the environment set a value
+func Default(service string) Config {
+	return Config{
+		Service: service,
+		Version: buildinfo.Get().Version,
+		HTTP: HTTP{
+			Port:              port.Http,
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+			Compression:       true,
+			CompressMinSize:   response.DefaultCompressOptions().MinSize,
+			CompressEncodings: response.DefaultCompressOptions().Encodings,
+		},
+		Upstream: Upstream{
+			Name:            dns.Service,
+			URL:             prefix.HttpPrefix + dns.Service + ":" + strconv.Itoa(port.Http),
+			NormalizeErrors: true,
+		},
+		CircuitBreaker: CircuitBreaker{
+			Timeout:      30 * time.Second,
+			Interval:     60 * time.Second,
+			MinRequests:  5,
+			FailureRatio: 0.8,
+		},
+		Log: Log{
+			Level:       "info",
+			Format:      string(log.FormatJSON),
+			FieldNaming: string(log.NamingDefault),
+			Redact:      true,
+			Outputs:     []string{string(log.SinkStdout)},
+			File:        LogFile{MaxSizeMB: 100, MaxAge: 7 * 24 * time.Hour, MaxBackups: 5},
+		},
+		Metrics: Metrics{
+			NativeHistogramBucketFactor: 1.1,
+			Push:                        MetricsPush{Interval: 15 * time.Second, Timeout: 10 * time.Second},
+		},
+		Admin: Admin{Addr: ":" + strconv.Itoa(port.Admin)},
+		Diagnostics: Diagnostics{
+			Profiling: Profiling{CPUDuration: 10 * time.Second, Keep: 24},
+		},
+		Audit: Audit{Sink: "file", FilePath: "audit/audit.log"},
+		Storage: Storage{
+			Backend:         "sqlite",
+			Path:            "data/service.db",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			HealthTimeout:   2 * time.Second,
+		},
+		Documents: Documents{
+			Backend:      "filesystem",
+			Path:         "data/documents",
+			S3:           DocumentsS3{Region: "us-east-1"},
+			MaxSizeMB:    50,
+			ContentTypes: []string{"application/pdf", "application/xml", "text/xml", "text/plain"},
+		},
+		HL7: HL7{
+			ReadTimeout:  5 * time.Minute,
+			MaxMessageKB: 1024,
+			DedupTTL:     24 * time.Hour,
+			DedupSize:    100000,
+		},
+	}
+}
+
+/* === Conversions === */
+
+// Addr is the address of the public listener
+func (c Config) Addr() string {
+	return ":" + strconv.Itoa(c.HTTP.Port)
+}
+
+// AccessLogOptions returns the options of the accesslog.Middleware, suppressing the given routes. The trusted
+// proxies are assumed valid, as Validate checks.
+func (c Config) AccessLogOptions(suppress ...string) accesslog.Options {
+	opts := accesslog.DefaultOptions(suppress...)
+	opts.TrustedProxies, _ = accesslog.ParsePrefixes(c.HTTP.TrustedProxies)
+	return opts
+}
+
+// CompressOptions returns the options of the response.Compress middleware
+func (c Config) CompressOptions() response.CompressOptions {
+	return response.CompressOptions{MinSize: c.HTTP.CompressMinSize, Encodings: c.HTTP.CompressEncodings}
+}
+
+// LogConfig returns the logging configuration to pass to log.Init
+func (c Config) LogConfig() log.Config {
+	level, _ := log.ParseLevel(c.Log.Level)
+	cfg := log.Config{
+		Level:       level,
+		LevelTTL:    c.Log.LevelTTL,
+		AddSource:   c.Log.AddSource,
+		Format:      log.Format(c.Log.Format),
+		FieldNaming: log.FieldNaming(c.Log.FieldNaming),
+		Redact:      c.Log.Redact,
+		Service:     c.Service,
+		Version:     c.Version,
+		Instance:    c.Instance,
+	}
+	for _, output := range c.Log.Outputs {
+		sink := log.SinkConfig{Type: log.SinkType(output)}
+		switch sink.Type {
+		case log.SinkStdout:
+			sink.Level, sink.Format = c.Log.Stdout.Level, log.Format(c.Log.Stdout.Format)
+		case log.SinkStderr:
+			sink.Level, sink.Format = c.Log.Stderr.Level, log.Format(c.Log.Stderr.Format)
+		case log.SinkFile:
+			sink.Level, sink.Format = c.Log.File.Level, log.Format(c.Log.File.Format)
+			sink.Path = c.Log.File.Path
+			sink.MaxSizeMB, sink.MaxAge, sink.MaxBackups = c.Log.File.MaxSizeMB, c.Log.File.MaxAge, c.Log.File.MaxBackups
+		case log.SinkSyslog:
+			sink.Level, sink.Format = c.Log.Syslog.Level, log.Format(c.Log.Syslog.Format)
+			sink.Network, sink.Address, sink.Tag = c.Log.Syslog.Network, c.Log.Syslog.Address, c.Log.Syslog.Tag
+		}
+		cfg.Sinks = append(cfg.Sinks, sink)
+	}
+	return cfg
+}
+
+// CircuitBreakerSettings returns the breaker settings named name, callers add their OnStateChange hook
+func (c Config) CircuitBreakerSettings(name string) gobreaker.Settings {
+	cb := c.CircuitBreaker
+	return gobreaker.Settings{
+		Name:     name,
+		Timeout:  cb.Timeout,
+		Interval: cb.Interval,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
+			return counts.Requests >= uint32(cb.MinRequests) && failureRatio >= cb.FailureRatio
+		},
+	}
+}
+
+// MetricsOptions returns the metrics options implied by the configuration: native histograms and the
+// service, version and pod const labels
+func (c Config) MetricsOptions() []metrics.Option {
+	opts := []metrics.Option{metrics.WithConstLabels(map[string]string{
+		"service": c.Service,
+		"version": c.Version,
+		"pod":     c.Instance,
+	})}
+	if c.Metrics.NativeHistogramBucketFactor > 1 {
+		opts = append(opts, metrics.WithNativeHistograms(c.Metrics.NativeHistogramBucketFactor))
+	}
+	return opts
+}
+
+// PushConfig returns the metrics push configuration, grouped by instance when known
+func (c Config) PushConfig() metrics.PushConfig {
+	cfg := metrics.PushConfig{
+		Mode:     metrics.PushMode(c.Metrics.Push.Mode),
+		URL:      c.Metrics.Push.URL,
+		Job:      c.Metrics.Push.Job,
+		Interval: c.Metrics.Push.Interval,
+		Timeout:  c.Metrics.Push.Timeout,
+	}
+	if cfg.Job == "" {
+		cfg.Job = c.Service
+	}
+	if c.Instance != "" {
+		cfg.Grouping = map[string]string{"instance": c.Instance}
+	}
+	return cfg
+}
+
+// AdminConfig returns the admin listener configuration
+func (c Config) AdminConfig() admin.Config {
+	return admin.Config{
+		Addr:     c.Admin.Addr,
+		Username: c.Admin.Username,
+		Password: c.Admin.Password,
+		Token:    c.Admin.Token,
+	}
+}
+
+// DiagnosticsConfig returns the diagnostics configuration
+func (c Config) DiagnosticsConfig() diagnostics.Config {
+	return diagnostics.Config{
+		Service: c.Service,
+		Token:   c.Diagnostics.Token,
+		Addr:    c.Diagnostics.Addr,
+		Profiling: diagnostics.ProfilingConfig{
+			Interval:    c.Diagnostics.Profiling.Interval,
+			CPUDuration: c.Diagnostics.Profiling.CPUDuration,
+			Dir:         c.Diagnostics.Profiling.Dir,
+			Keep:        c.Diagnostics.Profiling.Keep,
+			URL:         c.Diagnostics.Profiling.URL,
+		},
+	}
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
+	"github.com/sony/gobreaker/v2"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("HOSTNAME", "")
+	t.Setenv("IDENTITY_TOKEN", "test-identity-token")
+	cfg, err := Load("service", "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Addr() != ":8080" || cfg.Upstream.URL != "http://service:8080" || cfg.Admin.Addr != ":8081" {
+		t.Errorf("Unexpected defaults %+v", cfg)
+	}
+	if cfg.CircuitBreaker.Timeout != 30*time.Second || cfg.CircuitBreaker.MinRequests != 5 {
+		t.Errorf("Unexpected circuit breaker defaults %+v", cfg.CircuitBreaker)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+http:
+  port: 9090
+circuit_breaker:
+  timeout: 10s
+  failure_ratio: 0.5
+log:
+  level: debug
+  outputs: [stdout, file]
+  file:
+    path: /var/log/service.log
+`)
+	t.Setenv("HTTP_PORT", "7070")
+	t.Setenv("LOG_OUTPUTS", "STDOUT, stderr")
+	t.Setenv("CIRCUIT_BREAKER_MIN_REQUESTS", "10")
+	t.Setenv("IDENTITY_TOKEN", "test-identity-token")
+
+	cfg, err := Load("service", path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      any
+		expected any
+	}{
+		{"env over file", cfg.HTTP.Port, 7070},
+		{"file over default", cfg.CircuitBreaker.Timeout, 10 * time.Second},
+		{"file over default float", cfg.CircuitBreaker.FailureRatio, 0.5},
+		{"env over default", cfg.CircuitBreaker.MinRequests, 10},
+		{"default kept", cfg.CircuitBreaker.Interval, 60 * time.Second},
+		{"nested file value", cfg.Log.File.Path, "/var/log/service.log"},
+		{"env list normalized", strings.Join(cfg.Log.Outputs, ","), "stdout,stderr"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, tt.got)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "unknown key",
+			file:     "http:\n  prot: 80\n",
+			expected: []string{"field prot not found"},
+		},
+		{
+			name:     "unparsable env",
+			env:      map[string]string{"CIRCUIT_BREAKER_TIMEOUT": "soon"},
+			expected: []string{"circuit_breaker.timeout (CIRCUIT_BREAKER_TIMEOUT): invalid duration"},
+		},
+		{
+			name: "every invalid field reported",
+			env: map[string]string{"HTTP_PORT": "70000", "LOG_FORMAT": "xml", "UPSTREAM_URL": "service:8080", "HL7_DEDUP_SIZE": "0",
+				"HTTP_TRUSTED_PROXIES": "10.42.0.0/16,ingress"},
+			expected: []string{
+				"http.port (HTTP_PORT): must be between 1 and 65535, got 70000",
+				`log.format (LOG_FORMAT): must be json, text or logfmt, got "xml"`,
+				"upstream.url (UPSTREAM_URL)",
+				"hl7.dedup_size (HL7_DEDUP_SIZE): must be positive, got 0",
+				`http.trusted_proxies (HTTP_TRUSTED_PROXIES): must only list networks in CIDR notation or IP addresses, got "ingress"`,
+			},
+		},
+		{
+			name: "placeholder secrets",
+			env:  map[string]string{"IDENTITY_TOKEN": "change-me", "AUDIT_KEY": "Change-Me"},
+			expected: []string{
+				"identity.token (IDENTITY_TOKEN): must be set to a secret shared by the API Gateway and the service",
+				"audit.key (AUDIT_KEY): must be replaced by a secret",
+			},
+		},
+		{
+			name:     "missing identity token",
+			env:      map[string]string{"IDENTITY_TOKEN": ""},
+			expected: []string{"identity.token (IDENTITY_TOKEN)"},
+		},
+		{
+			name: "dependent fields",
+			env: map[string]string{"LOG_OUTPUTS": "file", "METRICS_PUSH_MODE": "otlp", "DIAGNOSTICS_PROFILE_INTERVAL": "1m", "STORAGE_BACKEND": "Postgres",
+				"DOCUMENTS_BACKEND": "S3", "DOCUMENTS_S3_ACCESS_KEY": "cce"},
+			expected: []string{"log.file.path (LOG_FILE_PATH)", "metrics.push.url (METRICS_PUSH_URL)", "diagnostics.profiling.dir (DIAGNOSTICS_PROFILE_DIR)", "storage.dsn (STORAGE_DSN)",
+				"documents.s3.endpoint (DOCUMENTS_S3_ENDPOINT)", "documents.s3.bucket (DOCUMENTS_S3_BUCKET)", "documents.s3.secret_key (DOCUMENTS_S3_SECRET_KEY)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, tt.file)
+			}
+
+			_, err := Load("service", path)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			for _, message := range tt.expected {
+				if !strings.Contains(err.Error(), message) {
+					t.Errorf("Expected %q in error:\n%v", message, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	cfg := Default("api-gateway")
+	cfg.Admin.Username = "ops"
+	cfg.Admin.Password = "pw"
+	cfg.Admin.Token = "admin-secret"
+	cfg.Storage.DSN = "postgres://cce:db-secret@db/cce"
+
+	printed := cfg.String()
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	for _, output := range []string{printed, string(encoded)} {
+		if strings.Contains(output, "admin-secret") || strings.Contains(output, "db-secret") || strings.Contains(output, `"pw"`) || strings.Contains(output, "password: pw") {
+			t.Errorf("Expected secrets to be masked:\n%s", output)
+		}
+	}
+	if !strings.Contains(printed, "admin.token: "+Mask) || !strings.Contains(printed, "diagnostics.token: \n") {
+		t.Errorf("Expected set secrets masked and unset ones empty:\n%s", printed)
+	}
+	if !strings.Contains(printed, "admin.username: ops") || !strings.Contains(printed, "circuit_breaker.timeout: 30s") {
+		t.Errorf("Expected other values printed:\n%s", printed)
+	}
+	if !strings.Contains(string(encoded), `"circuit_breaker":{"failure_ratio":0.8`) {
+		t.Errorf("Expected nested JSON keyed like the file:\n%s", encoded)
+	}
+	if cfg.Admin.Token != "admin-secret" {
+		t.Error("Expected redaction not to modify the original")
+	}
+}
+
+func TestLogConfig(t *testing.T) {
+	cfg := Default("service")
+	cfg.Log.Level = "debug"
+	cfg.Log.Outputs = []string{"stdout", "file"}
+	cfg.Log.File.Path = "service.log"
+	cfg.Log.File.Level = "warn"
+
+	logCfg := cfg.LogConfig()
+	if err := logCfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if logCfg.Service != "service" || len(logCfg.Sinks) != 2 {
+		t.Fatalf("Unexpected log configuration %+v", logCfg)
+	}
+	if file := logCfg.Sinks[1]; file.Type != log.SinkFile || file.Path != "service.log" || file.Level != "warn" || file.MaxBackups != 5 {
+		t.Errorf("Unexpected file output %+v", file)
+	}
+}
+
+func TestComponentConfigsFromEnv(t *testing.T) {
+	t.Setenv("IDENTITY_TOKEN", "test-identity-token")
+	t.Setenv("POD_NAME", "service-123")
+	t.Setenv("LOG_LEVEL", "WARN")
+	t.Setenv("LOG_ADD_SOURCE", "true")
+	t.Setenv("LOG_OUTPUTS", "stdout, file")
+	t.Setenv("LOG_FILE_PATH", "/var/log/cce/service.log")
+	t.Setenv("LOG_FILE_MAX_AGE", "24h")
+	t.Setenv("ADMIN_ADDR", "127.0.0.1:9000")
+	t.Setenv("ADMIN_TOKEN", "secret")
+	t.Setenv("DIAGNOSTICS_PROFILE_INTERVAL", "5m")
+	t.Setenv("DIAGNOSTICS_PROFILE_DIR", "/tmp/profiles")
+	t.Setenv("METRICS_PUSH_MODE", "OTLP")
+	t.Setenv("METRICS_PUSH_URL", "http://collector:4318/v1/metrics")
+	t.Setenv("METRICS_PUSH_INTERVAL", "1m")
+
+	cfg, err := Load("service", "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	logCfg := cfg.LogConfig()
+	if logCfg.Level != slog.LevelWarn || !logCfg.AddSource || logCfg.Instance != "service-123" || len(logCfg.Sinks) != 2 {
+		t.Errorf("Unexpected log configuration %+v", logCfg)
+	}
+	if file := logCfg.Sinks[1]; file.Path != "/var/log/cce/service.log" || file.MaxAge != 24*time.Hour || file.MaxBackups != 5 {
+		t.Errorf("Unexpected file output %+v", file)
+	}
+	if adminCfg := cfg.AdminConfig(); adminCfg.Addr != "127.0.0.1:9000" || adminCfg.Token != "secret" {
+		t.Errorf("Unexpected admin configuration %+v", adminCfg)
+	}
+	if profiling := cfg.DiagnosticsConfig().Profiling; profiling.Interval != 5*time.Minute || profiling.CPUDuration != 10*time.Second || profiling.Keep != 24 {
+		t.Errorf("Unexpected profiling configuration %+v", profiling)
+	}
+	if push := cfg.PushConfig(); push.Mode != metrics.PushOTLP || push.Job != "service" || push.Interval != time.Minute || push.Grouping["instance"] != "service-123" {
+		t.Errorf("Unexpected push configuration %+v", push)
+	}
+
+	// values that cannot be parsed are rejected instead of falling back to a default
+	t.Setenv("METRICS_PUSH_INTERVAL", "often")
+	t.Setenv("LOG_ADD_SOURCE", "maybe")
+	if _, err := Load("service", ""); err == nil {
+		t.Error("Expected invalid values to be rejected")
+	}
+}
+
+func TestCircuitBreakerSettings(t *testing.T) {
+	cfg := Default("service")
+	cfg.CircuitBreaker.MinRequests = 2
+	cfg.CircuitBreaker.FailureRatio = 0.5
+	settings := cfg.CircuitBreakerSettings("service")
+
+	tests := []struct {
+		counts   gobreaker.Counts
+		expected bool
+	}{
+		{gobreaker.Counts{Requests: 1, TotalFailures: 1}, false},
+		{gobreaker.Counts{Requests: 2, TotalFailures: 1}, true},
+		{gobreaker.Counts{Requests: 4, TotalFailures: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := settings.ReadyToTrip(tt.counts); got != tt.expected {
+			t.Errorf("Expected ReadyToTrip(%+v) = %v, got %v", tt.counts, tt.expected, got)
+		}
+	}
+	if settings.Name != "service" || settings.Timeout != 30*time.Second {
+		t.Errorf("Unexpected settings %+v", settings)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"text/tabwriter"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/buildinfo"
+)
+
+// Source tells where the value of a key comes from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+)
+
+// Value is one resolved key of the configuration, secrets are masked
+type Value struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+	// Env is the environment variable overriding the key
+	Env string `json:"env"`
+}
+
+// Effective is the fully resolved configuration of a running process with the binary it runs
+type Effective struct {
+	Build  buildinfo.Info `json:"build"`
+	Values []Value        `json:"values"`
+}
+
+// Source returns where key was set, SourceDefault when neither the file nor the environment set it
+func (c Config) Source(key string) Source {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// Effective returns every key in declaration order with its source and masked value, and the build information
+func (c Config) Effective() Effective {
+	redacted := c.Redacted()
+	list := fields(&redacted)
+	values := make([]Value, 0, len(list))
+	for _, f := range list {
+		values = append(values, Value{Key: f.key, Value: formatValue(f.value), Source: c.Source(f.key), Env: f.env})
+	}
+	return Effective{Build: buildinfo.Get(), Values: values}
+}
+
+// WriteText prints the build information followed by one aligned "key value source env" row per key
+func (e Effective) WriteText(w io.Writer) error {
+	modified := ""
+	if e.Build.Modified {
+		modified = " (modified)"
+	}
+	if _, err := fmt.Fprintf(w, "# version %s, commit %s%s, built %s with %s\n",
+		e.Build.Version, orUnknown(e.Build.Commit), modified, orUnknown(e.Build.BuildDate), e.Build.GoVersion); err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "KEY\tVALUE\tSOURCE\tENV")
+	for _, value := range e.Values {
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", value.Key, orEmpty(value.Value), value.Source, value.Env)
+	}
+	return table.Flush()
+}
+
+// Handler serves the effective configuration as JSON, or as text with ?format=text
+func (c Config) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		effective := c.Effective()
+		if r.URL.Query().Get("format") == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if err := effective.WriteText(w); err != nil {
+				slog.Error("failed to write effective configuration", "error", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(effective); err != nil {
+			slog.Error("failed to encode effective configuration", "error", err)
+		}
+	})
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// orEmpty keeps the table aligned for empty values
+func orEmpty(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
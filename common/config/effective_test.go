@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEffectiveSources(t *testing.T) {
+	path := writeFile(t, `
+http:
+  port: 9090
+log:
+  outputs: [stdout]
+  file:
+    max_backups: 3
+slo:
+`)
+	t.Setenv("HTTP_PORT", "7070")
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	t.Setenv("HOSTNAME", "")
+	t.Setenv("POD_NAME", "")
+	t.Setenv("IDENTITY_TOKEN", "test-identity-token")
+
+	cfg, err := Load("api-gateway", path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		source Source
+		env    string
+	}{
+		{"http.port", "7070", SourceEnv, "HTTP_PORT"},
+		{"log.outputs", "stdout", SourceFile, "LOG_OUTPUTS"},
+		{"log.file.max_backups", "3", SourceFile, "LOG_FILE_MAX_BACKUPS"},
+		{"log.file.max_age", "168h0m0s", SourceDefault, "LOG_FILE_MAX_AGE"},
+		{"slo.file", "", SourceDefault, "SLO_FILE"},
+		{"admin.token", Mask, SourceEnv, "ADMIN_TOKEN"},
+	}
+
+	values := map[string]Value{}
+	for _, value := range cfg.Effective().Values {
+		values[value.Key] = value
+	}
+	for _, tt := range tests {
+		got, ok := values[tt.key]
+		if !ok {
+			t.Errorf("Expected key %s in the effective configuration", tt.key)
+			continue
+		}
+		if got.Value != tt.value || got.Source != tt.source || got.Env != tt.env {
+			t.Errorf("Expected %s = %q from %s (%s), got %q from %s (%s)", tt.key, tt.value, tt.source, tt.env, got.Value, got.Source, got.Env)
+		}
+	}
+}
+
+func TestEffectiveOutputs(t *testing.T) {
+	cfg := Default("service")
+	cfg.Diagnostics.Token = "diag-secret"
+
+	var text bytes.Buffer
+	if err := cfg.Effective().WriteText(&text); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	if !strings.HasPrefix(text.String(), "# version ") || !strings.Contains(text.String(), "KEY") {
+		t.Errorf("Expected a build header and a table:\n%s", text.String())
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config/effective", nil))
+	var effective Effective
+	if err := json.Unmarshal(rec.Body.Bytes(), &effective); err != nil {
+		t.Fatalf("Expected JSON: %v", err)
+	}
+	if effective.Build.GoVersion == "" || len(effective.Values) == 0 {
+		t.Errorf("Expected build information and values, got %+v", effective)
+	}
+
+	rec = httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config/effective?format=text", nil))
+	for _, output := range []string{text.String(), rec.Body.String()} {
+		if strings.Contains(output, "diag-secret") {
+			t.Errorf("Expected the secret to be masked:\n%s", output)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the path of the configuration file
+const FileEnv = "CONFIG_FILE"
+
+// Load resolves the configuration of service: the defaults, overridden by the YAML file at path (skipped when
+// path is empty), overridden by the environment. The result is validated, errors name every invalid field.
+func Load(service, path string) (Config, error) {
+	cfg := Default(service)
+	cfg.sources = map[string]Source{}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	cfg.normalize()
+	return cfg, cfg.Validate()
+}
+
+// loadFile overrides the fields set in the YAML file at path, unknown keys are rejected to catch typos
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	for _, key := range yamlKeys(&document, "") {
+		c.sources[key] = SourceFile
+	}
+	return nil
+}
+
+// yamlKeys lists the dotted keys of the scalar and list values set in node
+func yamlKeys(node *yaml.Node, prefix string) []string {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			return yamlKeys(node.Content[0], prefix)
+		}
+	case yaml.MappingNode:
+		var keys []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keys = append(keys, yamlKeys(node.Content[i+1], prefix+node.Content[i].Value+".")...)
+		}
+		return keys
+	case yaml.ScalarNode:
+		// an empty section (e.g. "slo:" with its keys commented out) sets nothing
+		if node.Tag == "!!null" {
+			return nil
+		}
+		return []string{strings.TrimSuffix(prefix, ".")}
+	case yaml.SequenceNode, yaml.AliasNode:
+		return []string{strings.TrimSuffix(prefix, ".")}
+	}
+	return nil
+}
+
+// loadEnv overrides the fields whose environment variable is set and not empty
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, f := range fields(c) {
+		value, ok := lookup(f.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setString(f.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("config: %s (%s): %w", f.key, f.env, err))
+			continue
+		}
+		c.sources[f.key] = SourceEnv
+	}
+	// the pod name is not set outside kubernetes, docker sets the hostname to the container ID
+	if c.Instance == "" {
+		if hostname, ok := lookup("HOSTNAME"); ok && hostname != "" {
+			c.Instance = hostname
+			c.sources["instance"] = SourceEnv
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// normalize lowercases the enumerated values, which are accepted in any case
+func (c *Config) normalize() {
+	c.Log.Level = strings.ToLower(c.Log.Level)
+	c.Log.Format = strings.ToLower(c.Log.Format)
+	c.Log.FieldNaming = strings.ToLower(c.Log.FieldNaming)
+	for i, output := range c.Log.Outputs {
+		c.Log.Outputs[i] = strings.ToLower(output)
+	}
+	for _, output := range []*LogOutput{&c.Log.Stdout, &c.Log.Stderr, &c.Log.File.LogOutput, &c.Log.Syslog.LogOutput} {
+		output.Format = strings.ToLower(output.Format)
+	}
+	c.Metrics.Push.Mode = strings.ToLower(c.Metrics.Push.Mode)
+	c.Audit.Sink = strings.ToLower(c.Audit.Sink)
+	c.Storage.Backend = strings.ToLower(c.Storage.Backend)
+	c.Documents.Backend = strings.ToLower(c.Documents.Backend)
+	for i, contentType := range c.Documents.ContentTypes {
+		c.Documents.ContentTypes[i] = strings.ToLower(contentType)
+	}
+}
+
+/* === Fields === */
+
+// field is a leaf of the configuration, named by its dotted yaml key and its full environment variable
+type field struct {
+	key    string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// fields lists the leaves of cfg in declaration order, cfg must be a pointer for the values to be settable
+func fields(cfg any) []field {
+	return appendFields(nil, reflect.Indirect(reflect.ValueOf(cfg)), "", "")
+}
+
+func appendFields(list []field, v reflect.Value, keyPrefix, envPrefix string) []field {
+	t := v.Type()
+	for i := range t.NumField() {
+		structField := t.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		value := v.Field(i)
+		name, _, _ := strings.Cut(structField.Tag.Get("yaml"), ",")
+		env := envPrefix + structField.Tag.Get("env")
+
+		// embedded sections are inlined, sharing the key and environment prefixes of their parent
+		if structField.Anonymous {
+			list = appendFields(list, value, keyPrefix, envPrefix)
+			continue
+		}
+		if value.Kind() == reflect.Struct {
+			list = appendFields(list, value, keyPrefix+name+".", env)
+			continue
+		}
+		list = append(list, field{
+			key:    keyPrefix + name,
+			env:    env,
+			secret: structField.Tag.Get("secret") == "true",
+			value:  value,
+		})
+	}
+	return list
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// setString parses s into v according to its type, lists are comma separated
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (expected e.g. 30s or 5m)", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (expected true or false)", s)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// formatValue prints v the way it is written in files and the environment
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
+)
+
+// Mask replaces the value of secrets that are set, unset secrets are printed empty so that a missing
+// credential remains visible
+const Mask = log.DefaultMask
+
+// Redacted returns a copy of the configuration whose secrets are replaced by Mask
+func (c Config) Redacted() Config {
+	redacted := c
+	for _, f := range fields(&redacted) {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString(Mask)
+		}
+	}
+	return redacted
+}
+
+// String prints one "key: value" line per field, in declaration order, with secrets masked
+func (c Config) String() string {
+	var b strings.Builder
+	for _, f := range fields(ptr(c.Redacted())) {
+		b.WriteString(f.key)
+		b.WriteString(": ")
+		b.WriteString(formatValue(f.value))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// MarshalJSON encodes the configuration as nested objects keyed like the YAML file, durations as strings
+// and secrets masked, so that it can be logged or served without leaking credentials
+func (c Config) MarshalJSON() ([]byte, error) {
+	tree := map[string]any{}
+	for _, f := range fields(ptr(c.Redacted())) {
+		node := tree
+		keys := strings.Split(f.key, ".")
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[key] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = jsonValue(f.value)
+	}
+	return json.Marshal(tree)
+}
+
+func jsonValue(v reflect.Value) any {
+	if v.Type() == durationType {
+		return formatValue(v)
+	}
+	return v.Interface()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
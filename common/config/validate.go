@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/accesslog"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
+)
+
+var (
+	logFormats   = []string{string(log.FormatJSON), string(log.FormatText), string(log.FormatLogfmt)}
+	fieldNamings = []string{string(log.NamingDefault), string(log.NamingECS), string(log.NamingOTel)}
+	logOutputs   = []string{string(log.SinkStdout), string(log.SinkStderr), string(log.SinkFile), string(log.SinkSyslog)}
+	pushModes    = []string{string(metrics.PushDisabled), string(metrics.PushPushgateway), string(metrics.PushOTLP)}
+	auditSinks   = []string{"file", "memory"}
+	storages     = []string{"sqlite", "postgres", "memory"}
+	blobStores   = []string{"filesystem", "s3"}
+	encodings    = []string{response.EncodingZstd, response.EncodingBrotli, response.EncodingGzip}
+	// placeholders are the sample secrets of the shipped manifests, a deployment keeping one has no secret
+	placeholders = []string{"change-me", "changeme"}
+)
+
+// validator collects the invalid fields, naming each by its key and environment variable
+type validator struct {
+	envs map[string]string
+	errs []error
+}
+
+func (v *validator) check(ok bool, key, format string, args ...any) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("config: %s (%s): %s", key, v.envs[key], fmt.Sprintf(format, args...)))
+	}
+}
+
+// Validate reports every field that cannot be used, joined in a single error
+func (c Config) Validate() error {
+	v := &validator{envs: map[string]string{}}
+	for _, f := range fields(&c) {
+		v.envs[f.key] = f.env
+	}
+
+	v.check(c.Service != "", "service", "must not be empty")
+	v.check(c.HTTP.Port > 0 && c.HTTP.Port <= 65535, "http.port", "must be between 1 and 65535, got %d", c.HTTP.Port)
+	v.check(c.HTTP.ReadHeaderTimeout >= 0, "http.read_header_timeout", "must not be negative")
+	v.check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout", "must be positive, got %s", c.HTTP.ShutdownTimeout)
+	v.check(c.HTTP.CompressMinSize >= 0, "http.compress_min_size", "must not be negative")
+	for _, encoding := range c.HTTP.CompressEncodings {
+		v.check(slices.Contains(encodings, encoding), "http.compress_encodings", "must list zstd, br or gzip, got %q", encoding)
+	}
+	for _, network := range c.HTTP.TrustedProxies {
+		_, err := accesslog.ParsePrefixes([]string{network})
+		v.check(err == nil, "http.trusted_proxies", "must only list networks in CIDR notation or IP addresses, got %q", network)
+	}
+
+	v.check(c.Identity.Token != "" && !placeholder(c.Identity.Token), "identity.token",
+		"must be set to a secret shared by the API Gateway and the service")
+
+	v.check(c.Upstream.Name != "", "upstream.name", "must not be empty")
+	v.check(validURL(c.Upstream.URL), "upstream.url", "must be an absolute http or https URL, got %q", c.Upstream.URL)
+
+	v.check(c.CircuitBreaker.Timeout > 0, "circuit_breaker.timeout", "must be positive, got %s", c.CircuitBreaker.Timeout)
+	v.check(c.CircuitBreaker.Interval >= 0, "circuit_breaker.interval", "must not be negative")
+	v.check(c.CircuitBreaker.MinRequests > 0, "circuit_breaker.min_requests", "must be at least 1, got %d", c.CircuitBreaker.MinRequests)
+	v.check(c.CircuitBreaker.FailureRatio > 0 && c.CircuitBreaker.FailureRatio <= 1, "circuit_breaker.failure_ratio",
+		"must be greater than 0 and at most 1, got %g", c.CircuitBreaker.FailureRatio)
+
+	c.validateLog(v)
+
+	v.check(c.Metrics.NativeHistogramBucketFactor == 0 || c.Metrics.NativeHistogramBucketFactor > 1,
+		"metrics.native_histogram_bucket_factor", "must be 0 (disabled) or greater than 1, got %g", c.Metrics.NativeHistogramBucketFactor)
+	v.check(slices.Contains(pushModes, c.Metrics.Push.Mode), "metrics.push.mode", "must be empty, pushgateway or otlp, got %q", c.Metrics.Push.Mode)
+	if c.Metrics.Push.Mode != "" {
+		v.check(validURL(c.Metrics.Push.URL), "metrics.push.url", "must be an absolute http or https URL in push mode, got %q", c.Metrics.Push.URL)
+	}
+	v.check(c.Metrics.Push.Interval >= 0, "metrics.push.interval", "must not be negative")
+	v.check(c.Metrics.Push.Timeout > 0, "metrics.push.timeout", "must be positive, got %s", c.Metrics.Push.Timeout)
+
+	v.check(c.Admin.Addr != "", "admin.addr", "must not be empty")
+	v.check((c.Admin.Username == "") == (c.Admin.Password == ""), "admin.password", "must be set together with admin.username")
+
+	profiling := c.Diagnostics.Profiling
+	v.check(profiling.Interval >= 0, "diagnostics.profiling.interval", "must not be negative")
+	if profiling.Interval > 0 {
+		v.check(profiling.Dir != "" || profiling.URL != "", "diagnostics.profiling.dir", "must be set, or diagnostics.profiling.url, when profiling is enabled")
+		v.check(profiling.CPUDuration >= 0 && profiling.CPUDuration < profiling.Interval, "diagnostics.profiling.cpu_duration",
+			"must be shorter than the profiling interval %s, got %s", profiling.Interval, profiling.CPUDuration)
+	}
+	if profiling.URL != "" {
+		v.check(validURL(profiling.URL), "diagnostics.profiling.url", "must be an absolute http or https URL, got %q", profiling.URL)
+	}
+	v.check(profiling.Keep >= 0, "diagnostics.profiling.keep", "must not be negative")
+
+	v.check(slices.Contains(auditSinks, c.Audit.Sink), "audit.sink", "must be file or memory, got %q", c.Audit.Sink)
+	if c.Audit.Sink == "file" {
+		v.check(c.Audit.FilePath != "", "audit.file_path", "must be set for the file sink")
+	}
+	v.check(!placeholder(c.Audit.Key), "audit.key", "must be replaced by a secret")
+
+	v.check(slices.Contains(storages, c.Storage.Backend), "storage.backend", "must be sqlite, postgres or memory, got %q", c.Storage.Backend)
+	switch c.Storage.Backend {
+	case "sqlite":
+		v.check(c.Storage.Path != "", "storage.path", "must be set for the sqlite backend")
+	case "postgres":
+		v.check(c.Storage.DSN != "", "storage.dsn", "must be set for the postgres backend")
+	}
+	v.check(c.Storage.MaxOpenConns >= 0, "storage.max_open_conns", "must not be negative")
+	v.check(c.Storage.MaxIdleConns >= 0, "storage.max_idle_conns", "must not be negative")
+	v.check(c.Storage.ConnMaxLifetime >= 0, "storage.conn_max_lifetime", "must not be negative")
+	v.check(c.Storage.ConnMaxIdleTime >= 0, "storage.conn_max_idle_time", "must not be negative")
+	v.check(c.Storage.HealthTimeout > 0, "storage.health_timeout", "must be positive, got %s", c.Storage.HealthTimeout)
+
+	documents := c.Documents
+	v.check(slices.Contains(blobStores, documents.Backend), "documents.backend", "must be filesystem or s3, got %q", documents.Backend)
+	switch documents.Backend {
+	case "filesystem":
+		v.check(documents.Path != "", "documents.path", "must be set for the filesystem backend")
+	case "s3":
+		v.check(validURL(documents.S3.Endpoint), "documents.s3.endpoint", "must be an absolute http or https URL for the s3 backend, got %q", documents.S3.Endpoint)
+		v.check(documents.S3.Bucket != "", "documents.s3.bucket", "must be set for the s3 backend")
+		v.check(documents.S3.Region != "", "documents.s3.region", "must be set for the s3 backend")
+		v.check((documents.S3.AccessKey == "") == (documents.S3.SecretKey == ""), "documents.s3.secret_key", "must be set together with documents.s3.access_key")
+	}
+	v.check(documents.MaxSizeMB > 0, "documents.max_size_mb", "must be positive, got %d", documents.MaxSizeMB)
+	v.check(len(documents.ContentTypes) > 0, "documents.content_types", "must list at least one media type")
+	for _, contentType := range documents.ContentTypes {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		v.check(err == nil && strings.Contains(mediaType, "/"), "documents.content_types", "must only list media types, got %q", contentType)
+	}
+
+	v.check(c.HL7.ReadTimeout > 0, "hl7.read_timeout", "must be positive, got %s", c.HL7.ReadTimeout)
+	v.check(c.HL7.MaxMessageKB > 0, "hl7.max_message_kb", "must be positive, got %d", c.HL7.MaxMessageKB)
+	v.check(c.HL7.DedupTTL > 0, "hl7.dedup_ttl", "must be positive, got %s", c.HL7.DedupTTL)
+	v.check(c.HL7.DedupSize > 0, "hl7.dedup_size", "must be positive, got %d", c.HL7.DedupSize)
+
+	return errors.Join(v.errs...)
+}
+
+func (c Config) validateLog(v *validator) {
+	_, err := log.ParseLevel(c.Log.Level)
+	v.check(err == nil, "log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	v.check(c.Log.LevelTTL >= 0, "log.level_ttl", "must not be negative")
+	v.check(slices.Contains(logFormats, c.Log.Format), "log.format", "must be json, text or logfmt, got %q", c.Log.Format)
+	v.check(slices.Contains(fieldNamings, c.Log.FieldNaming), "log.field_naming", "must be default, ecs or otel, got %q", c.Log.FieldNaming)
+	v.check(len(c.Log.Outputs) > 0, "log.outputs", "must list at least one output")
+	for _, output := range c.Log.Outputs {
+		v.check(slices.Contains(logOutputs, output), "log.outputs", "must only list stdout, stderr, file or syslog, got %q", output)
+	}
+
+	outputs := []LogOutput{c.Log.Stdout, c.Log.Stderr, c.Log.File.LogOutput, c.Log.Syslog.LogOutput}
+	for i, output := range outputs {
+		name := logOutputs[i]
+		if output.Level != "" {
+			_, err := log.ParseLevel(output.Level)
+			v.check(err == nil, "log."+name+".level", "must be debug, info, warn or error, got %q", output.Level)
+		}
+		if output.Format != "" {
+			v.check(slices.Contains(logFormats, output.Format), "log."+name+".format", "must be json, text or logfmt, got %q", output.Format)
+		}
+	}
+
+	if slices.Contains(c.Log.Outputs, string(log.SinkFile)) {
+		v.check(c.Log.File.Path != "", "log.file.path", "must be set for the file output")
+	}
+	v.check(c.Log.File.MaxSizeMB >= 0, "log.file.max_size_mb", "must not be negative")
+	v.check(c.Log.File.MaxAge >= 0, "log.file.max_age", "must not be negative")
+	v.check(c.Log.File.MaxBackups >= 0, "log.file.max_backups", "must not be negative")
+}
+
+func placeholder(secret string) bool {
+	return slices.Contains(placeholders, strings.ToLower(strings.TrimSpace(secret)))
+}
+
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,211 @@
+package diagnostics
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+)
+
+// TokenHeader carries the diagnostics token, separate from Authorization so that it can be combined with admin auth
+const TokenHeader = "X-Diagnostics-Token"
+
+// maxCaptureDuration bounds the CPU profiles and execution traces captured on demand
+const maxCaptureDuration = 60 * time.Second
+
+// Config configures the diagnostics endpoints and continuous profiling
+type Config struct {
+	// Service names the profiles written or pushed by continuous profiling
+	Service string `json:"service"`
+	// Token guards the endpoints, which are disabled when it is empty
+	Token string `json:"-"`
+	// Addr serves the endpoints on their own listener (e.g. :6060) instead of the admin one when set
+	Addr string `json:"addr,omitempty"`
+	// Profiling configures continuous profiling, disabled when its interval is zero
+	Profiling ProfilingConfig `json:"profiling"`
+}
+
+// Diagnostics serves pprof, goroutine dumps, heap snapshots and execution traces, and runs continuous profiling
+type Diagnostics struct {
+	cfg      Config
+	server   *http.Server
+	profiler *Profiler
+
+	// tracing serializes execution traces, the runtime supports only one at a time
+	tracing sync.Mutex
+}
+
+// New returns the diagnostics described by cfg, nothing is served or profiled until Mount and StartProfiling
+func New(cfg Config) *Diagnostics {
+	return &Diagnostics{cfg: cfg}
+}
+
+// Handler returns the diagnostics routes, all under /debug/ and guarded by the token
+func (d *Diagnostics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpoint.Pprof, pprof.Index)
+	mux.HandleFunc(endpoint.Pprof+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(endpoint.Pprof+"profile", capped(pprof.Profile, 30*time.Second))
+	mux.HandleFunc(endpoint.Pprof+"symbol", pprof.Symbol)
+	mux.HandleFunc(endpoint.Pprof+"trace", capped(pprof.Trace, time.Second))
+	mux.HandleFunc("GET "+endpoint.Goroutines, goroutinesHandler)
+	mux.HandleFunc("GET "+endpoint.Heap, heapHandler)
+	mux.HandleFunc("GET "+endpoint.Trace, d.traceHandler)
+	return d.guard(mux)
+}
+
+// Mount registers the diagnostics routes with handle (e.g. the admin server), or serves them on their own
+// listener when an address is configured
+func (d *Diagnostics) Mount(handle func(pattern string, handler http.Handler)) {
+	if d.cfg.Token == "" {
+		slog.Info("diagnostics endpoints disabled, set DIAGNOSTICS_TOKEN to enable them")
+	}
+	if d.cfg.Addr == "" {
+		handle(endpoint.Debug, d.Handler())
+		return
+	}
+
+	d.server = &http.Server{Addr: d.cfg.Addr, Handler: d.Handler()}
+	go func() {
+		slog.Info("diagnostics endpoints listening on " + d.cfg.Addr)
+		if err := d.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("diagnostics listener stopped", "error", err, "addr", d.cfg.Addr)
+		}
+	}()
+}
+
+// StartProfiling starts continuous profiling when configured
+func (d *Diagnostics) StartProfiling() error {
+	if d.cfg.Profiling.Interval <= 0 {
+		return nil
+	}
+	sink, err := d.cfg.Profiling.sink(d.cfg.Service)
+	if err != nil {
+		return err
+	}
+	d.profiler = NewProfiler(d.cfg.Profiling, sink)
+	d.profiler.Start()
+	return nil
+}
+
+// Stop stops continuous profiling and the dedicated listener, if any
+func (d *Diagnostics) Stop(ctx context.Context) error {
+	if d.profiler != nil {
+		d.profiler.Stop()
+	}
+	if d.server != nil {
+		return d.server.Shutdown(ctx)
+	}
+	return nil
+}
+
+/* === Handlers === */
+
+// goroutinesHandler dumps the stack of every goroutine as text
+func goroutinesHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := runtimepprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		slog.Error("failed to dump goroutines", "error", err)
+	}
+}
+
+// heapHandler writes a heap profile, running a garbage collection first when gc=1
+func heapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("gc") == "1" {
+		runtime.GC()
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="heap.pb.gz"`)
+	if err := runtimepprof.Lookup("heap").WriteTo(w, 0); err != nil {
+		slog.Error("failed to write heap profile", "error", err)
+	}
+}
+
+// traceHandler captures an execution trace for the given seconds (default 5), to open with go tool trace
+func (d *Diagnostics) traceHandler(w http.ResponseWriter, r *http.Request) {
+	duration, err := captureDuration(r, 5*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !d.tracing.TryLock() {
+		http.Error(w, "an execution trace is already being captured", http.StatusConflict)
+		return
+	}
+	defer d.tracing.Unlock()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace.out"`)
+	if err := trace.Start(w); err != nil {
+		// the runtime refuses concurrent traces, e.g. one started through /debug/pprof/trace
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	select {
+	case <-time.After(duration):
+	case <-r.Context().Done():
+	}
+	trace.Stop()
+}
+
+/* === Helper Methods === */
+
+// guard rejects requests without the token, and every request when no token is configured
+func (d *Diagnostics) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.cfg.Token == "" {
+			http.Error(w, "diagnostics are disabled", http.StatusForbidden)
+			return
+		}
+		given, expected := sha256.Sum256([]byte(r.Header.Get(TokenHeader))), sha256.Sum256([]byte(d.cfg.Token))
+		if subtle.ConstantTimeCompare(given[:], expected[:]) != 1 {
+			slog.Warn("rejected diagnostics request without a valid token", "path", r.URL.Path, "from", r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		slog.Info("serving diagnostics request", "path", r.URL.Path, "from", r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// capped bounds the seconds of the pprof captures by maxCaptureDuration, like the other diagnostics captures;
+// fallback is the default of the pprof handler, used when no seconds are given
+func capped(next http.HandlerFunc, fallback time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		duration, err := captureDuration(r, fallback)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// pprof reads whole seconds, a shorter capture lasts one second
+		query := r.URL.Query()
+		query.Set("seconds", strconv.Itoa(max(int(math.Ceil(duration.Seconds())), 1)))
+		r.URL.RawQuery = query.Encode()
+		next(w, r)
+	}
+}
+
+func captureDuration(r *http.Request, fallback time.Duration) (time.Duration, error) {
+	value := r.URL.Query().Get("seconds")
+	if value == "" {
+		return fallback, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid seconds %q", value)
+	}
+	return min(time.Duration(seconds*float64(time.Second)), maxCaptureDuration), nil
+}
@@ -0,0 +1,138 @@
+package diagnostics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+)
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		header   string
+		expected int
+	}{
+		{"disabled without token", "", "", http.StatusForbidden},
+		{"disabled ignores header", "", "secret", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "wrong", http.StatusUnauthorized},
+		{"valid token", "secret", "secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(Config{Token: tt.token}).Handler()
+			req := httptest.NewRequest(http.MethodGet, endpoint.Goroutines, nil)
+			if tt.header != "" {
+				req.Header.Set(TokenHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	handler := New(Config{Token: "secret"}).Handler()
+
+	tests := []struct {
+		path     string
+		contains string
+	}{
+		{endpoint.Pprof, "goroutine"},
+		{endpoint.Goroutines, "goroutine "},
+		{endpoint.Heap + "?gc=1", ""},
+		{endpoint.Trace + "?seconds=0.05", "go 1."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(TokenHeader, "secret")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if rec.Body.Len() == 0 {
+				t.Error("Expected a non-empty body")
+			}
+			if !strings.Contains(rec.Body.String(), tt.contains) {
+				t.Errorf("Expected body to contain %q", tt.contains)
+			}
+		})
+	}
+}
+
+func TestTraceInvalidSeconds(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, endpoint.Trace+"?seconds=-1", nil)
+	req.Header.Set(TokenHeader, "secret")
+	rec := httptest.NewRecorder()
+	New(Config{Token: "secret"}).Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestPprofCapturesAreCapped(t *testing.T) {
+	var seconds []string
+	handler := capped(func(w http.ResponseWriter, r *http.Request) {
+		seconds = append(seconds, r.FormValue("seconds"))
+	}, 30*time.Second)
+
+	for _, query := range []string{"", "?seconds=3600", "?seconds=0.2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, endpoint.Pprof+"profile"+query, nil))
+	}
+	if strings.Join(seconds, ",") != "30,60,1" {
+		t.Errorf("Expected the pprof default, the cap and a whole second, got %v", seconds)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, endpoint.Pprof+"profile?seconds=forever", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid seconds to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestCaptureDuration(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected time.Duration
+	}{
+		{"", 5 * time.Second},
+		{"seconds=2", 2 * time.Second},
+		{"seconds=0.5", 500 * time.Millisecond},
+		{"seconds=3600", maxCaptureDuration},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, endpoint.Trace+"?"+tt.query, nil)
+		got, err := captureDuration(req, 5*time.Second)
+		if err != nil {
+			t.Fatalf("captureDuration(%q) error = %v", tt.query, err)
+		}
+		if got != tt.expected {
+			t.Errorf("Expected %v for %q, got %v", tt.expected, tt.query, got)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	var mounted string
+	New(Config{Token: "secret"}).Mount(func(pattern string, _ http.Handler) { mounted = pattern })
+
+	if mounted != endpoint.Debug {
+		t.Errorf("Expected the handler mounted on %s, got %q", endpoint.Debug, mounted)
+	}
+}
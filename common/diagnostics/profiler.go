@@ -0,0 +1,232 @@
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile kinds captured by continuous profiling
+const (
+	KindCPU       = "cpu"
+	KindHeap      = "heap"
+	KindGoroutine = "goroutine"
+)
+
+// ProfilingConfig configures continuous profiling
+type ProfilingConfig struct {
+	// Interval between captures, continuous profiling is disabled when zero
+	Interval time.Duration `json:"interval"`
+	// CPUDuration is how long each CPU profile samples, no CPU profile is captured when zero
+	CPUDuration time.Duration `json:"cpu_duration"`
+	// Dir receives the profiles as <service>-<kind>-<time>.pb.gz
+	Dir string `json:"dir,omitempty"`
+	// Keep is the number of profiles of each kind kept in Dir, all are kept when zero
+	Keep int `json:"keep,omitempty"`
+	// URL receives each profile with a POST, see HTTPSink
+	URL string `json:"url,omitempty"`
+}
+
+// sink returns where captured profiles go
+func (c ProfilingConfig) sink(service string) (Sink, error) {
+	switch {
+	case c.URL != "":
+		return NewHTTPSink(c.URL, service), nil
+	case c.Dir != "":
+		return NewDirSink(c.Dir, service, c.Keep)
+	default:
+		return nil, errors.New("diagnostics: continuous profiling requires DIAGNOSTICS_PROFILE_DIR or DIAGNOSTICS_PROFILE_URL")
+	}
+}
+
+// Profile is one captured pprof profile, gzip-compressed protobuf
+type Profile struct {
+	Kind  string
+	Start time.Time
+	End   time.Time
+	Data  []byte
+}
+
+// Sink stores or forwards captured profiles
+type Sink interface {
+	Write(ctx context.Context, profile Profile) error
+}
+
+/* === Profiler === */
+
+// Profiler periodically captures CPU, heap and goroutine profiles
+type Profiler struct {
+	cfg  ProfilingConfig
+	sink Sink
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewProfiler returns a profiler writing to sink, Start begins capturing
+func NewProfiler(cfg ProfilingConfig, sink Sink) *Profiler {
+	return &Profiler{cfg: cfg, sink: sink, stop: make(chan struct{})}
+}
+
+// Start captures profiles every interval in the background
+func (p *Profiler) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				if err := p.Collect(context.Background()); err != nil {
+					slog.Warn("continuous profiling failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends continuous profiling, interrupting a CPU profile being captured
+func (p *Profiler) Stop() {
+	p.once.Do(func() { close(p.stop) })
+	p.wg.Wait()
+}
+
+// Collect captures one profile of each kind and writes them to the sink
+func (p *Profiler) Collect(ctx context.Context) error {
+	var errs []error
+	if p.cfg.CPUDuration > 0 {
+		if profile, err := p.captureCPU(); err != nil {
+			errs = append(errs, err)
+		} else if err := p.sink.Write(ctx, profile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, kind := range []string{KindHeap, KindGoroutine} {
+		var buf bytes.Buffer
+		now := time.Now()
+		if err := pprof.Lookup(kind).WriteTo(&buf, 0); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := p.sink.Write(ctx, Profile{Kind: kind, Start: now, End: now, Data: buf.Bytes()}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Profiler) captureCPU() (Profile, error) {
+	var buf bytes.Buffer
+	start := time.Now()
+	// fails while another CPU profile runs, e.g. one requested on /debug/pprof/profile
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return Profile{}, fmt.Errorf("diagnostics: cpu profile: %w", err)
+	}
+	select {
+	case <-time.After(p.cfg.CPUDuration):
+	case <-p.stop:
+	}
+	pprof.StopCPUProfile()
+	return Profile{Kind: KindCPU, Start: start, End: time.Now(), Data: buf.Bytes()}, nil
+}
+
+/* === Sinks === */
+
+// profileTimeFormat is the timestamp in profile file names, it sorts chronologically
+const profileTimeFormat = "20060102T150405.000"
+
+// DirSink writes profiles to a local directory, keeping the most recent ones of each kind
+type DirSink struct {
+	dir     string
+	service string
+	keep    int
+}
+
+// NewDirSink creates dir if needed and returns a sink writing to it
+func NewDirSink(dir, service string, keep int) (*DirSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirSink{dir: dir, service: service, keep: keep}, nil
+}
+
+func (s *DirSink) Write(_ context.Context, profile Profile) error {
+	prefix := s.service + "-" + profile.Kind + "-"
+	name := filepath.Join(s.dir, prefix+profile.Start.UTC().Format(profileTimeFormat)+".pb.gz")
+	if err := os.WriteFile(name, profile.Data, 0o644); err != nil {
+		return err
+	}
+	if s.keep <= 0 {
+		return nil
+	}
+
+	existing, err := filepath.Glob(filepath.Join(s.dir, prefix+"*.pb.gz"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(existing)
+	for i := 0; i < len(existing)-s.keep; i++ {
+		_ = os.Remove(existing[i])
+	}
+	return nil
+}
+
+// HTTPSink POSTs each profile as application/octet-stream to a collector, with the service name,
+// profile kind and capture interval (unix seconds) as the name, kind, from and until query parameters
+type HTTPSink struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// NewHTTPSink returns a sink posting to the collector at url
+func NewHTTPSink(url, service string) *HTTPSink {
+	return &HTTPSink{url: url, service: service, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *HTTPSink) Write(ctx context.Context, profile Profile) error {
+	target, err := url.Parse(s.url)
+	if err != nil {
+		return err
+	}
+	query := target.Query()
+	query.Set("name", s.service)
+	query.Set("kind", profile.Kind)
+	query.Set("from", strconv.FormatInt(profile.Start.Unix(), 10))
+	query.Set("until", strconv.FormatInt(profile.End.Unix(), 10))
+	query.Set("format", "pprof")
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(profile.Data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("diagnostics: profile upload failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
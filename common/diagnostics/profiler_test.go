@@ -0,0 +1,130 @@
+package diagnostics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink keeps the profiles written to it
+type recordingSink struct {
+	mu       sync.Mutex
+	profiles []Profile
+}
+
+func (s *recordingSink) Write(_ context.Context, profile Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles = append(s.profiles, profile)
+	return nil
+}
+
+func TestCollect(t *testing.T) {
+	sink := &recordingSink{}
+	profiler := NewProfiler(ProfilingConfig{CPUDuration: 50 * time.Millisecond}, sink)
+
+	if err := profiler.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	kinds := map[string]bool{}
+	for _, profile := range sink.profiles {
+		if len(profile.Data) == 0 {
+			t.Errorf("Expected %s profile data", profile.Kind)
+		}
+		kinds[profile.Kind] = true
+	}
+	for _, kind := range []string{KindCPU, KindHeap, KindGoroutine} {
+		if !kinds[kind] {
+			t.Errorf("Expected a %s profile", kind)
+		}
+	}
+}
+
+func TestDirSinkKeepsMostRecent(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewDirSink(dir, "service", 2)
+	if err != nil {
+		t.Fatalf("NewDirSink() error = %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		profile := Profile{Kind: KindHeap, Start: start.Add(time.Duration(i) * time.Minute), Data: []byte{byte(i)}}
+		if err := sink.Write(context.Background(), profile); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := sink.Write(context.Background(), Profile{Kind: KindGoroutine, Start: start, Data: []byte{1}}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	heap, _ := filepath.Glob(filepath.Join(dir, "service-heap-*.pb.gz"))
+	if len(heap) != 2 {
+		t.Fatalf("Expected 2 heap profiles kept, got %d", len(heap))
+	}
+	latest, err := os.ReadFile(heap[1])
+	if err != nil || len(latest) != 1 || latest[0] != 3 {
+		t.Errorf("Expected the most recent heap profile kept, got %v (%v)", latest, err)
+	}
+	goroutine, _ := filepath.Glob(filepath.Join(dir, "service-goroutine-*.pb.gz"))
+	if len(goroutine) != 1 {
+		t.Errorf("Expected retention to apply per kind, got %d goroutine profiles", len(goroutine))
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var query map[string]string
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{}
+		for name := range r.URL.Query() {
+			query[name] = r.URL.Query().Get(name)
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	start := time.Unix(1700000000, 0)
+	profile := Profile{Kind: KindCPU, Start: start, End: start.Add(10 * time.Second), Data: []byte("pprof")}
+	if err := NewHTTPSink(collector.URL+"/ingest", "api-gateway").Write(context.Background(), profile); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	expected := map[string]string{"name": "api-gateway", "kind": "cpu", "from": "1700000000", "until": "1700000010", "format": "pprof"}
+	for name, value := range expected {
+		if query[name] != value {
+			t.Errorf("Expected query %s=%s, got %q", name, value, query[name])
+		}
+	}
+	if string(body) != "pprof" {
+		t.Errorf("Expected the profile as body, got %q", body)
+	}
+}
+
+func TestHTTPSinkRejected(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	if err := NewHTTPSink(collector.URL, "service").Write(context.Background(), Profile{Kind: KindHeap}); err == nil {
+		t.Error("Expected an error when the collector rejects the profile")
+	}
+}
+
+func TestStartProfilingRequiresSink(t *testing.T) {
+	d := New(Config{Profiling: ProfilingConfig{Interval: time.Minute}})
+	if err := d.StartProfiling(); err == nil {
+		t.Error("Expected an error without a directory or collector URL")
+	}
+	if err := New(Config{}).StartProfiling(); err != nil {
+		t.Errorf("Expected profiling disabled without an interval, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TraceParentHeader is the W3C Trace Context header carrying the trace ID of the request
+const TraceParentHeader = "traceparent"
+
+// observeWithTrace records value on observer, attaching the trace ID of the request as exemplar when present
+func observeWithTrace(observer prometheus.Observer, value float64, r *http.Request) {
+	if traceID := TraceID(r); traceID != "" {
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok {
+			exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{"trace_id": traceID})
+			return
+		}
+	}
+	observer.Observe(value)
+}
+
+// TraceID returns the trace ID of the W3C traceparent header ("00-<trace-id>-<parent-id>-<flags>"),
+// or an empty string when the header is missing or malformed
+func TraceID(r *http.Request) string {
+	parts := strings.Split(strings.TrimSpace(r.Header.Get(TraceParentHeader)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return ""
+	}
+	traceID := strings.ToLower(parts[1])
+	if _, err := hex.DecodeString(traceID); err != nil || traceID == strings.Repeat("0", 32) {
+		return ""
+	}
+	return traceID
+}
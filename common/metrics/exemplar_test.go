@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		expected    string
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"upper case", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"missing", "", ""},
+		{"all zeros", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"not hex", "00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+		{"short", "00-4bf92f35-00f067aa0ba902b7-01", ""},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.traceparent != "" {
+				req.Header.Set(TraceParentHeader, tt.traceparent)
+			}
+			if got := TraceID(req); got != tt.expected {
+				t.Errorf("Expected trace ID %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareExemplar(t *testing.T) {
+	m := New()
+	handler := m.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	scrapeReq := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	scrapeReq.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, scrapeReq)
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("Expected OpenMetrics content type, got %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `# {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"}`) {
+		t.Error("Expected the trace ID exemplar on the latency histogram")
+	}
+	if strings.Contains(scrape(t, m), "trace_id") {
+		t.Error("Expected no exemplars in the classic text format")
+	}
+}
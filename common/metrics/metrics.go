@@ -1,10 +1,13 @@
 package metrics
 
 import (
+	"fmt"
 	"net/http"
+	"reflect"
 	"strconv"
 	"time"
 
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/slo"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -12,6 +15,12 @@ import (
 	"github.com/sony/gobreaker/v2"
 )
 
+// Outcomes recorded by Time, handlers calling Observe are encouraged to use them too
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
 // Metrics holds all Prometheus metrics
 type Metrics struct {
 	httpRequestsTotal      *prometheus.CounterVec
@@ -19,65 +28,201 @@ type Metrics struct {
 	httpRequestsInFlight   prometheus.Gauge
 	circuitBreakerState    *prometheus.GaugeVec
 	circuitBreakerRequests *prometheus.CounterVec
-	healthCheckRequests    *prometheus.CounterVec
-	healthCheckDuration    prometheus.Histogram
-	routesRequests         *prometheus.CounterVec
-	routesDuration         prometheus.Histogram
+	operationsTotal        *prometheus.CounterVec
+	operationDuration      *prometheus.HistogramVec
+	logRedactions          *prometheus.CounterVec
+	upstreamRequests       *prometheus.CounterVec
+	upstreamDuration       *prometheus.HistogramVec
+	upstreamPhaseDuration  *prometheus.HistogramVec
+	upstreamConnections    *prometheus.CounterVec
+	upstreamErrors         *prometheus.CounterVec
+	upstreamRequestSize    *prometheus.HistogramVec
+	upstreamResponseSize   *prometheus.HistogramVec
+	sloEvents              *prometheus.CounterVec
+	sloGoodEvents          *prometheus.CounterVec
+	sloTracker             *slo.Tracker
+	gatherer               prometheus.Gatherer
+	handler                http.Handler
+	started                time.Time
 }
 
-// New creates a new Metrics instance with all Prometheus metrics initialized
-func New() *Metrics {
-	return &Metrics{
-		httpRequestsTotal: promauto.NewCounterVec(
+// New creates a new Metrics instance with all Prometheus metrics initialized and registered
+// on the registry selected by the options (a private registry by default)
+func New(opts ...Option) *Metrics {
+	o := newOptions(opts)
+	factory := promauto.With(o.registerer)
+
+	m := &Metrics{
+		httpRequestsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "http_requests_total",
-				Help: "Total number of HTTP requests by method, endpoint, and status code",
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "http_requests_total",
+				Help:      "Total number of HTTP requests by method, endpoint, and status code",
 			},
 			[]string{"method", "endpoint", "status_code"},
 		),
-		httpRequestDuration: promauto.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Name:    "http_request_duration_seconds",
-				Help:    "Duration of HTTP requests in seconds",
-				Buckets: prometheus.DefBuckets,
-			},
+		httpRequestDuration: factory.NewHistogramVec(
+			o.native.apply(prometheus.HistogramOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "http_request_duration_seconds",
+				Help:      "Duration of HTTP requests in seconds",
+				Buckets:   o.buckets,
+			}),
 			[]string{"method", "endpoint", "status_code"},
 		),
-		httpRequestsInFlight: promauto.NewGauge(
+		httpRequestsInFlight: factory.NewGauge(
 			prometheus.GaugeOpts{
-				Name: "http_requests_in_flight",
-				Help: "Current number of HTTP requests being processed",
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "http_requests_in_flight",
+				Help:      "Current number of HTTP requests being processed",
 			},
 		),
-		circuitBreakerState: promauto.NewGaugeVec(
+		circuitBreakerState: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: "circuit_breaker_state",
-				Help: "Circuit breaker state (0=closed, 1=half-open, 2=open)",
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "circuit_breaker_state",
+				Help:      "Circuit breaker state (0=closed, 1=half-open, 2=open)",
 			},
 			[]string{"name"},
 		),
-		circuitBreakerRequests: promauto.NewCounterVec(
+		circuitBreakerRequests: factory.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "circuit_breaker_requests_total",
-				Help: "Total number of requests through circuit breaker",
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "circuit_breaker_requests_total",
+				Help:      "Total number of requests through circuit breaker",
 			},
 			[]string{"name", "result"},
 		),
-		healthCheckRequests: promauto.NewCounterVec(
+		operationsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "operations_total",
+				Help:      "Total number of handler operations by operation and outcome",
+			},
+			[]string{"operation", "outcome"},
+		),
+		operationDuration: factory.NewHistogramVec(
+			o.native.apply(prometheus.HistogramOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "operation_duration_seconds",
+				Help:      "Duration of handler operations in seconds by operation and outcome",
+				Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			}),
+			[]string{"operation", "outcome"},
+		),
+		logRedactions: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "log_redactions_total",
+				Help:      "Total number of values masked in log records by redaction rule",
+			},
+			[]string{"rule"},
+		),
+		upstreamRequests: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "upstream_requests_total",
+				Help:      "Total number of requests forwarded to upstreams by upstream, method and upstream status code",
+			},
+			[]string{"upstream", "method", "status_code"},
+		),
+		upstreamDuration: factory.NewHistogramVec(
+			o.native.apply(prometheus.HistogramOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "upstream_request_duration_seconds",
+				Help:      "Duration of forwarded requests in seconds, from sending the request to reading the whole response",
+				Buckets:   o.buckets,
+			}),
+			[]string{"upstream", "status_code"},
+		),
+		upstreamPhaseDuration: factory.NewHistogramVec(
+			o.native.apply(prometheus.HistogramOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "upstream_phase_duration_seconds",
+				Help:      "Duration of the phases of forwarded requests in seconds (dns, connect, tls, ttfb)",
+				Buckets:   o.buckets,
+			}),
+			[]string{"upstream", "phase"},
+		),
+		upstreamConnections: factory.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "health_check_requests_total",
-				Help: "Total number of health check requests",
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "upstream_connections_total",
+				Help:      "Total number of connections used for forwarded requests by upstream and whether they were reused",
 			},
-			[]string{"status"},
+			[]string{"upstream", "reused"},
 		),
-		healthCheckDuration: promauto.NewHistogram(
+		upstreamErrors: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "upstream_errors_total",
+				Help:      "Total number of forwarded requests that failed without an upstream response, by upstream and error type",
+			},
+			[]string{"upstream", "type"},
+		),
+		upstreamRequestSize: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
-				Name:    "health_check_duration_seconds",
-				Help:    "Duration of health check requests in seconds",
-				Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "upstream_request_size_bytes",
+				Help:      "Size of the bodies of forwarded requests in bytes",
+				Buckets:   prometheus.ExponentialBuckets(100, 10, 7),
 			},
+			[]string{"upstream"},
 		),
+		upstreamResponseSize: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      "upstream_response_size_bytes",
+				Help:      "Size of the bodies of upstream responses in bytes",
+				Buckets:   prometheus.ExponentialBuckets(100, 10, 7),
+			},
+			[]string{"upstream"},
+		),
+		sloEvents: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      slo.EventsMetric,
+				Help:      "Total number of requests counting towards a service level objective",
+			},
+			[]string{"slo"},
+		),
+		sloGoodEvents: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: o.namespace,
+				Subsystem: o.subsystem,
+				Name:      slo.GoodEventsMetric,
+				Help:      "Total number of requests meeting a service level objective",
+			},
+			[]string{"slo"},
+		),
+		sloTracker: o.sloTracker,
+		gatherer:   o.gatherer,
+		started:    time.Now(),
+	}
+	m.handler = promhttp.InstrumentMetricHandler(o.registerer, promhttp.HandlerFor(o.gatherer, promhttp.HandlerOpts{
+		// exemplars are only part of the OpenMetrics format, negotiated through the Accept header
+		EnableOpenMetrics: true,
+	}))
+	if err := m.validate(); err != nil {
+		panic(err)
 	}
+	return m
 }
 
 // HTTPMiddleware wraps HTTP handlers to collect metrics
@@ -98,11 +243,12 @@ func (m *Metrics) HTTPMiddleware(endpoint string) func(http.Handler) http.Handle
 			ww := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
 			next.ServeHTTP(ww, r)
 
-			duration := time.Since(start).Seconds()
+			elapsed := time.Since(start)
 			statusCode := strconv.Itoa(ww.statusCode)
 
 			m.httpRequestsTotal.WithLabelValues(r.Method, endpointLabel, statusCode).Inc()
-			m.httpRequestDuration.WithLabelValues(r.Method, endpointLabel, statusCode).Observe(duration)
+			observeWithTrace(m.httpRequestDuration.WithLabelValues(r.Method, endpointLabel, statusCode), elapsed.Seconds(), r)
+			m.recordObjectives(endpointLabel, r.Method, ww.statusCode, elapsed)
 		})
 	}
 }
@@ -127,15 +273,29 @@ func (m *Metrics) Middleware() func(http.Handler) http.Handler {
 				}
 			}
 
-			duration := time.Since(start).Seconds()
+			elapsed := time.Since(start)
 			statusCode := strconv.Itoa(ww.statusCode)
 
 			m.httpRequestsTotal.WithLabelValues(r.Method, endpointLabel, statusCode).Inc()
-			m.httpRequestDuration.WithLabelValues(r.Method, endpointLabel, statusCode).Observe(duration)
+			observeWithTrace(m.httpRequestDuration.WithLabelValues(r.Method, endpointLabel, statusCode), elapsed.Seconds(), r)
+			m.recordObjectives(endpointLabel, r.Method, ww.statusCode, elapsed)
 		})
 	}
 }
 
+// recordObjectives counts the request towards the service level objectives it matches
+func (m *Metrics) recordObjectives(route, method string, status int, duration time.Duration) {
+	if m.sloTracker == nil {
+		return
+	}
+	for _, result := range m.sloTracker.Record(route, method, status, duration) {
+		m.sloEvents.WithLabelValues(result.Objective).Inc()
+		if result.Good {
+			m.sloGoodEvents.WithLabelValues(result.Objective).Inc()
+		}
+	}
+}
+
 // RecordCircuitBreakerStateChange updates circuit breaker state metric
 func (m *Metrics) RecordCircuitBreakerStateChange(name string, state gobreaker.State) {
 	var stateValue float64
@@ -155,20 +315,50 @@ func (m *Metrics) RecordCircuitBreakerRequest(name, result string) {
 	m.circuitBreakerRequests.WithLabelValues(name, result).Inc()
 }
 
-// RecordHealthCheck records health check metrics
-func (m *Metrics) RecordHealthCheck(status string, duration time.Duration) {
-	m.healthCheckRequests.WithLabelValues(status).Inc()
-	m.healthCheckDuration.Observe(duration.Seconds())
+// Observe records one execution of an operation (e.g. "healthcheck") with its outcome ("success", "failure")
+func (m *Metrics) Observe(operation, outcome string, duration time.Duration) {
+	m.operationsTotal.WithLabelValues(operation, outcome).Inc()
+	m.operationDuration.WithLabelValues(operation, outcome).Observe(duration.Seconds())
 }
 
-func (m *Metrics) RecordRoutesRequest(status string, duration time.Duration) {
-	m.routesRequests.WithLabelValues(status).Inc()
-	m.routesDuration.Observe(duration.Seconds())
+// Time runs fn and observes its duration under operation, with outcome "failure" when fn returns an error
+func (m *Metrics) Time(operation string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+	m.Observe(operation, outcome, time.Since(start))
+	return err
 }
 
-// Handler returns the Prometheus metrics HTTP handler
+// RecordLogRedaction counts a value masked by the log redaction rule
+func (m *Metrics) RecordLogRedaction(rule string) {
+	m.logRedactions.WithLabelValues(rule).Inc()
+}
+
+// Handler returns the Prometheus metrics HTTP handler serving the registry the metrics were registered on
 func (m *Metrics) Handler() http.Handler {
-	return promhttp.Handler()
+	return m.handler
+}
+
+var collectorType = reflect.TypeFor[prometheus.Collector]()
+
+// validate checks that New initialized every recorder, so that a field added without its
+// registration fails at startup instead of panicking on the first request that uses it
+func (m *Metrics) validate() error {
+	v := reflect.ValueOf(m).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.Type().Implements(collectorType) {
+			continue
+		}
+		if field.IsNil() {
+			return fmt.Errorf("metrics: %s is not initialized", v.Type().Field(i).Name)
+		}
+	}
+	return nil
 }
 
 // responseWriterWrapper wraps http.ResponseWriter to capture status code
@@ -181,3 +371,8 @@ func (rw *responseWriterWrapper) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap exposes the underlying writer to http.ResponseController, so that streamed responses are still flushed
+func (rw *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,276 @@
+package metrics
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/slo"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrape returns the exposition served by the metrics handler
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestNewTwice(t *testing.T) {
+	first := New()
+	second := New()
+
+	first.RecordLogRedaction("email")
+
+	if !strings.Contains(scrape(t, first), `log_redactions_total{rule="email"} 1`) {
+		t.Error("Expected the first instance to expose its own counter")
+	}
+	if strings.Contains(scrape(t, second), `log_redactions_total{rule="email"}`) {
+		t.Error("Expected the second instance not to share the first registry")
+	}
+	if !strings.Contains(scrape(t, second), "go_goroutines") {
+		t.Error("Expected the default registry to expose Go runtime metrics")
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(
+		WithRegistry(reg),
+		WithNamespace("cce"),
+		WithSubsystem("gateway"),
+		WithConstLabels(map[string]string{"service": "api-gateway", "pod": ""}),
+		WithBuckets([]float64{0.1, 1}),
+	)
+
+	handler := m.HTTPMiddleware("/health")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	body := scrape(t, m)
+	expected := []string{
+		`cce_gateway_http_requests_total{endpoint="/health",method="GET",service="api-gateway",status_code="200"} 1`,
+		`cce_gateway_http_request_duration_seconds_bucket{endpoint="/health",method="GET",service="api-gateway",status_code="200",le="0.1"}`,
+		`promhttp_metric_handler_requests_total{code="200",service="api-gateway"}`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in exposition:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `pod=""`) || strings.Contains(body, "go_goroutines") {
+		t.Error("Expected empty labels to be skipped and no default collectors on a caller registry")
+	}
+	if strings.Contains(body, `cce_gateway_http_request_duration_seconds_bucket{endpoint="/health",method="GET",service="api-gateway",status_code="200",le="0.25"}`) {
+		t.Error("Expected the configured buckets to replace the defaults")
+	}
+}
+
+func TestNewWithRuntimeMetrics(t *testing.T) {
+	body := scrape(t, New(WithRegistry(prometheus.NewRegistry()), WithRuntimeMetrics()))
+
+	for _, name := range []string{"go_goroutines", "go_sched_latencies_seconds", "go_gc_cycles_total_gc_cycles_total", "go_memory_classes_heap_objects_bytes"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("Expected runtime metric %s in exposition", name)
+		}
+	}
+}
+
+func TestRuntimeMetricsCarryConstLabels(t *testing.T) {
+	body := scrape(t, New(WithConstLabels(map[string]string{"service": "service", "env": "test"})))
+
+	for _, line := range []string{`go_goroutines{env="test",service="service"}`, `process_cpu_seconds_total{env="test",service="service"}`} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in exposition", line)
+		}
+	}
+}
+
+func TestNewWithRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(WithRegisterer(reg, reg))
+	m.RecordCircuitBreakerRequest("service", "success")
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	found := false
+	for _, family := range families {
+		if family.GetName() == "circuit_breaker_requests_total" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected metrics to be registered on the supplied registerer")
+	}
+}
+
+func TestObserve(t *testing.T) {
+	m := New()
+	m.Observe("healthcheck", OutcomeSuccess, 0)
+	err := m.Time("routes", func() error { return errors.New("boom") })
+
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("Expected Time to return the error of fn, got %v", err)
+	}
+	body := scrape(t, m)
+	expected := []string{
+		`operations_total{operation="healthcheck",outcome="success"} 1`,
+		`operations_total{operation="routes",outcome="failure"} 1`,
+		`operation_duration_seconds_count{operation="routes",outcome="failure"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in exposition", line)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m := New()
+	if err := m.validate(); err != nil {
+		t.Errorf("Expected New to initialize every recorder, got %v", err)
+	}
+
+	m.operationsTotal = nil
+	if err := m.validate(); err == nil || !strings.Contains(err.Error(), "operationsTotal") {
+		t.Errorf("Expected the uninitialized field to be reported, got %v", err)
+	}
+}
+
+func TestNewWithNativeHistograms(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(WithRegistry(reg), WithNativeHistograms(1.1))
+	m.Observe("healthcheck", OutcomeSuccess, 3*time.Millisecond)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "operation_duration_seconds" {
+			continue
+		}
+		histogram := family.GetMetric()[0].GetHistogram()
+		if histogram.Schema == nil || len(histogram.GetPositiveSpan()) == 0 {
+			t.Error("Expected a native histogram with populated spans")
+		}
+		if len(histogram.GetBucket()) == 0 {
+			t.Error("Expected classic buckets to be kept alongside the native ones")
+		}
+		return
+	}
+	t.Error("Expected operation_duration_seconds to be gathered")
+}
+
+func TestNewWithObjectives(t *testing.T) {
+	tracker, err := slo.NewTracker(slo.DefaultObjectives()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(WithObjectives(tracker))
+
+	router := mux.NewRouter()
+	router.Use(m.Middleware())
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {})
+	for _, path := range []string{"/health", "/metrics"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t, m)
+	expected := []string{
+		`slo_events_total{slo="gateway_availability"} 1`,
+		`slo_good_events_total{slo="gateway_availability"} 1`,
+		`slo_events_total{slo="gateway_latency"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in exposition", line)
+		}
+	}
+	if total := tracker.Report()[0].Total; total != 1 {
+		t.Errorf("Expected the tracker to record 1 event, got %d", total)
+	}
+}
+
+func TestMiddlewareKeepsStreamsFlushing(t *testing.T) {
+	m := New()
+	release := make(chan struct{}, 2)
+
+	r := mux.NewRouter()
+	r.Use(m.Middleware())
+	r.Use(response.Compress(response.DefaultCompressOptions()))
+	r.Use(response.Conditional)
+	r.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		response.Stream(w, r, http.StatusOK, func(encoder utils.StreamEncoder) error {
+			if err := encoder.Encode("first"); err != nil {
+				return err
+			}
+			// the client must read the first value before the second one is produced
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+			}
+			return encoder.Encode("second")
+		}, utils.WithFlushEvery(1))
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, encoding := range []string{"identity", "gzip"} {
+		t.Run(encoding, func(t *testing.T) {
+			defer func() { release <- struct{}{} }()
+
+			lines := make(chan string, 1)
+			go func() {
+				line, err := readFirstLine(server.URL+"/stream", encoding)
+				if err != nil {
+					line = err.Error()
+				}
+				lines <- line
+			}()
+			select {
+			case line := <-lines:
+				if line != "\"first\"\n" {
+					t.Errorf("Expected the first value, got %q", line)
+				}
+			case <-time.After(2 * time.Second):
+				t.Error("Expected the first value to be flushed before the stream ends")
+			}
+		})
+	}
+}
+
+// readFirstLine requests an NDJSON stream from url with the content coding encoding, returning its first line
+func readFirstLine(url, encoding string) (string, error) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Accept", response.MediaNDJSON)
+	req.Header.Set("Accept-Encoding", encoding)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body := io.Reader(resp.Body)
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		if body, err = gzip.NewReader(resp.Body); err != nil {
+			return "", err
+		}
+	}
+	return bufio.NewReader(body).ReadString('\n')
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/slo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// DefaultLatencyBuckets covers both the sub-millisecond overhead of the gateway and slow clinical queries, in seconds
+var DefaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Option configures how New builds and registers the metrics
+type Option func(*options)
+
+type options struct {
+	registerer  prometheus.Registerer
+	gatherer    prometheus.Gatherer
+	namespace   string
+	subsystem   string
+	constLabels prometheus.Labels
+	buckets     []float64
+	native      nativeHistograms
+	sloTracker  *slo.Tracker
+	runtime     bool
+}
+
+// nativeHistograms holds the settings of Prometheus native (sparse) histograms, disabled when bucketFactor is 0
+type nativeHistograms struct {
+	bucketFactor     float64
+	maxBuckets       uint32
+	minResetDuration time.Duration
+}
+
+// apply enables native histograms on opts, classic buckets are kept for scrapers that do not support them
+func (n nativeHistograms) apply(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if n.bucketFactor > 1 {
+		opts.NativeHistogramBucketFactor = n.bucketFactor
+		opts.NativeHistogramMaxBucketNumber = n.maxBuckets
+		opts.NativeHistogramMinResetDuration = n.minResetDuration
+	}
+	return opts
+}
+
+// WithRegistry registers the metrics on reg and serves reg from Handler
+func WithRegistry(reg *prometheus.Registry) Option {
+	return func(o *options) {
+		o.registerer, o.gatherer = reg, reg
+	}
+}
+
+// WithRegisterer registers the metrics on registerer and serves gatherer from Handler,
+// e.g. prometheus.DefaultRegisterer and prometheus.DefaultGatherer to share the global registry
+func WithRegisterer(registerer prometheus.Registerer, gatherer prometheus.Gatherer) Option {
+	return func(o *options) {
+		o.registerer, o.gatherer = registerer, gatherer
+	}
+}
+
+// WithNamespace prefixes every metric name with namespace (e.g. "cce" gives cce_http_requests_total)
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithSubsystem adds subsystem to every metric name, after the namespace
+func WithSubsystem(subsystem string) Option {
+	return func(o *options) {
+		o.subsystem = subsystem
+	}
+}
+
+// WithConstLabels adds labels with fixed values (e.g. service, version, pod) to every metric, empty values are skipped
+func WithConstLabels(labels map[string]string) Option {
+	return func(o *options) {
+		if o.constLabels == nil {
+			o.constLabels = prometheus.Labels{}
+		}
+		for name, value := range labels {
+			if value != "" {
+				o.constLabels[name] = value
+			}
+		}
+	}
+}
+
+// WithBuckets sets the histogram buckets of the HTTP request duration, in seconds
+func WithBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// WithNativeHistograms exposes the latency histograms also as native histograms, whose bucket boundaries
+// grow by at most bucketFactor (e.g. 1.1 for 10% resolution); they are only sent to scrapers negotiating protobuf
+func WithNativeHistograms(bucketFactor float64) Option {
+	return func(o *options) {
+		o.native = nativeHistograms{
+			bucketFactor:     bucketFactor,
+			maxBuckets:       160,
+			minResetDuration: time.Hour,
+		}
+	}
+}
+
+// WithObjectives makes the HTTP middlewares classify every request against the objectives of tracker,
+// counting good and total events per objective for the rules generated by slo.GenerateRules
+func WithObjectives(tracker *slo.Tracker) Option {
+	return func(o *options) {
+		o.sloTracker = tracker
+	}
+}
+
+// WithRuntimeMetrics registers the Go collector with the extended runtime/metrics (GC pauses and cycles, heap
+// classes, scheduler latencies) and the process collector, also on a registry given with WithRegistry or WithRegisterer
+func WithRuntimeMetrics() Option {
+	return func(o *options) {
+		o.runtime = true
+	}
+}
+
+// newOptions applies opts over the defaults: a private registry exposing the Go runtime and process
+// collectors, like the global default registry does, and DefaultLatencyBuckets
+func newOptions(opts []Option) options {
+	o := options{buckets: DefaultLatencyBuckets}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.registerer == nil {
+		reg := prometheus.NewRegistry()
+		o.registerer, o.gatherer, o.runtime = reg, reg, true
+	}
+	if o.gatherer == nil {
+		o.gatherer = prometheus.DefaultGatherer
+	}
+	registerer := o.registerer
+	if len(o.constLabels) > 0 {
+		o.registerer = prometheus.WrapRegistererWith(o.constLabels, registerer)
+	}
+	if o.runtime {
+		// the collectors go through the wrapped registerer so that their series carry the const labels too
+		if registerer == prometheus.DefaultRegisterer {
+			unregisterDefaultCollectors()
+		}
+		registerRuntimeCollectors(o.registerer)
+	}
+	return o
+}
+
+// unregisterDefaultCollectors removes the Go and process collectors of the global registry, which
+// registerRuntimeCollectors replaces with the extended Go collector
+func unregisterDefaultCollectors() {
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.Unregister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// registerRuntimeCollectors registers the Go runtime and process collectors on registerer
+func registerRuntimeCollectors(registerer prometheus.Registerer) {
+	goCollector := collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(
+		collectors.MetricsGC,
+		collectors.MetricsMemory,
+		collectors.MetricsScheduler,
+	))
+	processCollector := collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})
+	for _, collector := range []prometheus.Collector{goCollector, processCollector} {
+		if err := registerer.Register(collector); err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			panic(err)
+		}
+	}
+}
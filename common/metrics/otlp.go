@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	otelprometheus "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLPPusher exports the metrics to an OpenTelemetry collector with OTLP/HTTP. The gathered families are
+// converted by the OpenTelemetry Prometheus bridge: counters become cumulative monotonic sums, native
+// histograms exponential histograms, classic histograms keep their buckets and exemplars are carried over.
+type OTLPPusher struct {
+	url      string
+	exporter *otlpmetrichttp.Exporter
+	resource *resource.Resource
+}
+
+// NewOTLPPusher returns a pusher to the OTLP/HTTP metrics url (e.g. http://collector:4318/v1/metrics),
+// describing the process with service.name and the given resource attributes
+func NewOTLPPusher(url, service string, attributes map[string]string) (*OTLPPusher, error) {
+	// every push is a single attempt bounded by the push timeout, the next push sends the values again
+	exporter, err := otlpmetrichttp.New(context.Background(),
+		otlpmetrichttp.WithEndpointURL(url),
+		otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{Enabled: false}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: OTLP exporter for %s: %w", url, err)
+	}
+
+	resourceAttributes := []attribute.KeyValue{attribute.String("service.name", service)}
+	for name, value := range attributes {
+		resourceAttributes = append(resourceAttributes, attribute.String(name, value))
+	}
+	return &OTLPPusher{url: url, exporter: exporter, resource: resource.NewSchemaless(resourceAttributes...)}, nil
+}
+
+func (p *OTLPPusher) Push(ctx context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	producer := otelprometheus.NewMetricProducer(otelprometheus.WithGatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})))
+	scopes, err := producer.Produce(ctx)
+	if err != nil {
+		return fmt.Errorf("metrics: converting to OTLP: %w", err)
+	}
+	if err := p.exporter.Export(ctx, &metricdata.ResourceMetrics{Resource: p.resource, ScopeMetrics: scopes}); err != nil {
+		return fmt.Errorf("metrics: OTLP export to %s failed: %w", p.url, err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/proxyerror"
+)
+
+// InstrumentTransport wraps the transport of a reverse proxy to measure the upstream leg of forwarded requests:
+// status, connection reuse, DNS/connect/TLS/time-to-first-byte durations, errors by type and body sizes.
+// A nil next uses http.DefaultTransport.
+func (m *Metrics) InstrumentTransport(upstream string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedTransport{metrics: m, upstream: upstream, next: next}
+}
+
+type instrumentedTransport struct {
+	metrics  *Metrics
+	upstream string
+	next     http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt := &roundTrip{transport: t, request: r, start: time.Now()}
+
+	outgoing := r.Clone(httptrace.WithClientTrace(r.Context(), rt.clientTrace()))
+	if r.Body != nil && r.Body != http.NoBody {
+		rt.requestBody = &countingBody{ReadCloser: r.Body}
+		outgoing.Body = rt.requestBody
+	}
+
+	resp, err := t.next.RoundTrip(outgoing)
+	if err != nil {
+		t.metrics.upstreamErrors.WithLabelValues(t.upstream, string(proxyerror.Classify(err))).Inc()
+		rt.recordRequestSize()
+		return nil, err
+	}
+
+	rt.statusCode = strconv.Itoa(resp.StatusCode)
+	t.metrics.upstreamRequests.WithLabelValues(t.upstream, r.Method, rt.statusCode).Inc()
+	rt.recordRequestSize()
+
+	// the upstream leg ends when the proxy has copied the whole response body to the client
+	resp.Body = &countingBody{ReadCloser: resp.Body, done: rt.finish}
+	return resp, nil
+}
+
+/* === Round trip state === */
+
+// roundTrip collects the timings of one forwarded request
+type roundTrip struct {
+	transport   *instrumentedTransport
+	request     *http.Request
+	start       time.Time
+	statusCode  string
+	requestBody *countingBody
+
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+}
+
+func (rt *roundTrip) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			rt.mark(&rt.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			rt.observePhase("dns", &rt.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			rt.mark(&rt.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			rt.observePhase("connect", &rt.connectStart)
+		},
+		TLSHandshakeStart: func() {
+			rt.mark(&rt.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			rt.observePhase("tls", &rt.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			rt.transport.metrics.upstreamConnections.WithLabelValues(rt.transport.upstream, strconv.FormatBool(info.Reused)).Inc()
+		},
+		GotFirstResponseByte: func() {
+			duration := time.Since(rt.start).Seconds()
+			observeWithTrace(rt.transport.metrics.upstreamPhaseDuration.WithLabelValues(rt.transport.upstream, "ttfb"), duration, rt.request)
+		},
+	}
+}
+
+// mark records the start of a phase, trace hooks may run on other goroutines (e.g. parallel dials)
+func (rt *roundTrip) mark(start *time.Time) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	*start = time.Now()
+}
+
+func (rt *roundTrip) observePhase(phase string, start *time.Time) {
+	rt.mu.Lock()
+	began := *start
+	rt.mu.Unlock()
+	if began.IsZero() {
+		return
+	}
+	rt.transport.metrics.upstreamPhaseDuration.WithLabelValues(rt.transport.upstream, phase).Observe(time.Since(began).Seconds())
+}
+
+func (rt *roundTrip) recordRequestSize() {
+	var size int64
+	if rt.requestBody != nil {
+		size = rt.requestBody.bytes()
+	}
+	rt.transport.metrics.upstreamRequestSize.WithLabelValues(rt.transport.upstream).Observe(float64(size))
+}
+
+func (rt *roundTrip) finish(responseSize int64) {
+	m, upstream := rt.transport.metrics, rt.transport.upstream
+	m.upstreamResponseSize.WithLabelValues(upstream).Observe(float64(responseSize))
+	observeWithTrace(m.upstreamDuration.WithLabelValues(upstream, rt.statusCode), time.Since(rt.start).Seconds(), rt.request)
+}
+
+/* === Wrappers === */
+
+// countingBody counts the bytes read from a body and calls done once, at EOF or on Close
+type countingBody struct {
+	io.ReadCloser
+	mu   sync.Mutex
+	n    int64
+	done func(n int64)
+	once sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.n += int64(n)
+	b.mu.Unlock()
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *countingBody) bytes() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.n
+}
+
+func (b *countingBody) finish() {
+	if b.done != nil {
+		b.once.Do(func() { b.done(b.bytes()) })
+	}
+}
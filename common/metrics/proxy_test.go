@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newTestProxy(t *testing.T, m *Metrics, target string) *httputil.ReverseProxy {
+	t.Helper()
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.Transport = m.InstrumentTransport("service", nil)
+	return proxy
+}
+
+func TestInstrumentTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(strings.Repeat("x", 250)))
+	}))
+	defer upstream.Close()
+
+	m := New()
+	proxy := newTestProxy(t, m, upstream.URL)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/patients", strings.NewReader(`{"name":"Rossi"}`)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", rec.Code)
+		}
+	}
+
+	body := scrape(t, m)
+	expected := []string{
+		`upstream_requests_total{method="POST",status_code="201",upstream="service"} 2`,
+		`upstream_request_duration_seconds_count{status_code="201",upstream="service"} 2`,
+		`upstream_phase_duration_seconds_count{phase="connect",upstream="service"} 1`,
+		`upstream_phase_duration_seconds_count{phase="ttfb",upstream="service"} 2`,
+		`upstream_connections_total{reused="false",upstream="service"} 1`,
+		`upstream_connections_total{reused="true",upstream="service"} 1`,
+		`upstream_request_size_bytes_sum{upstream="service"} 32`,
+		`upstream_response_size_bytes_sum{upstream="service"} 500`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in exposition", line)
+		}
+	}
+}
+
+func TestInstrumentTransportError(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	address := upstream.URL
+	upstream.Close()
+
+	m := New()
+	proxy := newTestProxy(t, m, address)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/patients", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("Expected status 502, got %d", rec.Code)
+	}
+	body := scrape(t, m)
+	if !strings.Contains(body, `upstream_errors_total{type="connection_refused",upstream="service"} 1`) {
+		t.Errorf("Expected a connection refused error in exposition:\n%s", body)
+	}
+	if strings.Contains(body, "upstream_requests_total{") {
+		t.Error("Expected failed requests not to be counted as upstream responses")
+	}
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Pusher sends the current value of the metrics to a remote endpoint, for processes that exit before being scraped
+type Pusher interface {
+	Push(ctx context.Context, families []*dto.MetricFamily, started time.Time) error
+}
+
+// PushMode selects the protocol of the push endpoint
+type PushMode string
+
+const (
+	PushDisabled    PushMode = ""
+	PushPushgateway PushMode = "pushgateway"
+	PushOTLP        PushMode = "otlp"
+)
+
+// PushConfig configures push mode for a process
+type PushConfig struct {
+	Mode PushMode
+	// URL is the Pushgateway base URL or the OTLP/HTTP metrics URL (e.g. http://collector:4318/v1/metrics)
+	URL string
+	// Job is the Pushgateway job name and the OTLP service name
+	Job string
+	// Grouping adds Pushgateway grouping labels (e.g. instance) or OTLP resource attributes
+	Grouping map[string]string
+	// Interval between pushes, only the final push on stop is done when zero
+	Interval time.Duration
+	// Timeout of a single push
+	Timeout time.Duration
+}
+
+// NewPusher returns the pusher described by cfg, nil when push mode is disabled
+func NewPusher(cfg PushConfig) (Pusher, error) {
+	switch cfg.Mode {
+	case PushDisabled:
+		return nil, nil
+	case PushPushgateway, PushOTLP:
+		if cfg.URL == "" || cfg.Job == "" {
+			return nil, errors.New("metrics: push mode requires a URL and a job")
+		}
+		if cfg.Mode == PushOTLP {
+			return NewOTLPPusher(cfg.URL, cfg.Job, cfg.Grouping)
+		}
+		return NewPushgatewayPusher(cfg.URL, cfg.Job, cfg.Grouping), nil
+	default:
+		return nil, fmt.Errorf("metrics: unknown push mode %q", cfg.Mode)
+	}
+}
+
+// StartPush pushes the metrics every interval until the returned stop function is called, which pushes
+// a last time so that the final values of a job are not lost. A zero interval only pushes on stop.
+func (m *Metrics) StartPush(pusher Pusher, interval, timeout time.Duration) (stop func(ctx context.Context) error) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	if interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					ctx, cancel := context.WithTimeout(context.Background(), timeout)
+					if err := m.Push(ctx, pusher); err != nil {
+						slog.Warn("failed to push metrics", "error", err)
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+
+	var once sync.Once
+	return func(ctx context.Context) error {
+		var err error
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			err = m.Push(ctx, pusher)
+		})
+		return err
+	}
+}
+
+// StartPushWithConfig starts pushing as described by cfg, the returned stop function is a no-op when push mode is disabled
+func (m *Metrics) StartPushWithConfig(cfg PushConfig) (stop func(ctx context.Context) error, err error) {
+	pusher, err := NewPusher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if pusher == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	slog.Info("pushing metrics", "mode", cfg.Mode, "url", cfg.URL, "job", cfg.Job, "interval", cfg.Interval)
+	return m.StartPush(pusher, cfg.Interval, cfg.Timeout), nil
+}
+
+// Push gathers the metrics and sends them once with pusher
+func (m *Metrics) Push(ctx context.Context, pusher Pusher) error {
+	families, err := m.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	return pusher.Push(ctx, families, m.started)
+}
+
+/* === Pushgateway === */
+
+// PushgatewayPusher replaces the metrics of its job and grouping on a Prometheus Pushgateway
+type PushgatewayPusher struct {
+	url      string
+	job      string
+	grouping map[string]string
+}
+
+// NewPushgatewayPusher returns a pusher to the Pushgateway at url
+func NewPushgatewayPusher(url, job string, grouping map[string]string) *PushgatewayPusher {
+	return &PushgatewayPusher{url: url, job: job, grouping: grouping}
+}
+
+func (p *PushgatewayPusher) Push(ctx context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	pusher := push.New(p.url, p.job).Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	}))
+	for name, value := range p.grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher.PushContext(ctx)
+}
+
+/* === Test stand-in === */
+
+// MemoryPusher keeps the pushed metrics in memory, for tests of jobs using push mode
+type MemoryPusher struct {
+	mu     sync.Mutex
+	pushes [][]*dto.MetricFamily
+}
+
+// NewMemoryPusher returns an empty in-memory pusher
+func NewMemoryPusher() *MemoryPusher {
+	return &MemoryPusher{}
+}
+
+func (p *MemoryPusher) Push(_ context.Context, families []*dto.MetricFamily, _ time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pushes = append(p.pushes, families)
+	return nil
+}
+
+// Count returns the number of pushes received
+func (p *MemoryPusher) Count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pushes)
+}
+
+// Last returns the metric family called name in the last push, nil if absent
+func (p *MemoryPusher) Last(name string) *dto.MetricFamily {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pushes) == 0 {
+		return nil
+	}
+	for _, family := range p.pushes[len(p.pushes)-1] {
+		if family.GetName() == name {
+			return family
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStartPush(t *testing.T) {
+	m := New()
+	pusher := NewMemoryPusher()
+
+	stop := m.StartPush(pusher, 5*time.Millisecond, time.Second)
+	deadline := time.Now().Add(time.Second)
+	for pusher.Count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if pusher.Count() == 0 {
+		t.Fatal("Expected periodic pushes")
+	}
+
+	// the value recorded just before exiting must reach the final push
+	m.RecordLogRedaction("email")
+	if err := stop(context.Background()); err != nil {
+		t.Fatalf("stop() error = %v", err)
+	}
+	pushes := pusher.Count()
+	family := pusher.Last("log_redactions_total")
+	if family == nil || family.GetMetric()[0].GetCounter().GetValue() != 1 {
+		t.Errorf("Expected the final push to carry the last value, got %v", family)
+	}
+
+	if err := stop(context.Background()); err != nil || pusher.Count() != pushes {
+		t.Error("Expected stop to push only once")
+	}
+}
+
+func TestPushgatewayPusher(t *testing.T) {
+	var path, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, body = r.URL.Path, string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	m := New()
+	m.RecordCircuitBreakerRequest("import", "success")
+	pusher := NewPushgatewayPusher(gateway.URL, "patient_import", map[string]string{"instance": "job-1"})
+
+	if err := m.Push(context.Background(), pusher); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if path != "/metrics/job/patient_import/instance/job-1" {
+		t.Errorf("Unexpected push path %s", path)
+	}
+	if !strings.Contains(body, "circuit_breaker_requests_total") {
+		t.Error("Expected the pushed body to contain the metrics")
+	}
+}
+
+func TestOTLPPusher(t *testing.T) {
+	var request colmetricspb.ExportMetricsServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("Unexpected content type %s", r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, &request); err != nil {
+			t.Errorf("Expected a protobuf export request: %v", err)
+		}
+	}))
+	defer collector.Close()
+
+	m := New(WithBuckets([]float64{0.1, 1}), WithNativeHistograms(1.1))
+	handler := m.HTTPMiddleware("/import")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/import", nil))
+
+	pusher, err := NewOTLPPusher(collector.URL+"/v1/metrics", "patient-import", map[string]string{"k8s.pod.name": "job-1"})
+	if err != nil {
+		t.Fatalf("NewOTLPPusher() error = %v", err)
+	}
+	if err := m.Push(context.Background(), pusher); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	resource := map[string]string{}
+	for _, attribute := range request.GetResourceMetrics()[0].GetResource().GetAttributes() {
+		resource[attribute.GetKey()] = attribute.GetValue().GetStringValue()
+	}
+	if resource["service.name"] != "patient-import" || resource["k8s.pod.name"] != "job-1" {
+		t.Errorf("Unexpected resource attributes %+v", resource)
+	}
+	metrics := map[string]*metricspb.Metric{}
+	for _, metric := range request.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics() {
+		metrics[metric.GetName()] = metric
+	}
+
+	counter := metrics["http_requests_total"].GetSum()
+	if counter == nil || !counter.GetIsMonotonic() || counter.GetDataPoints()[0].GetAsDouble() != 1 {
+		t.Errorf("Expected a monotonic sum for the counter, got %+v", metrics["http_requests_total"])
+	}
+	histogram := metrics["http_request_duration_seconds"].GetExponentialHistogram()
+	if histogram == nil || histogram.GetDataPoints()[0].GetCount() != 1 {
+		t.Errorf("Expected the native histogram as an exponential histogram, got %+v", metrics["http_request_duration_seconds"])
+	}
+	if metrics["http_requests_in_flight"].GetGauge() == nil || metrics["go_gc_duration_seconds"].GetSummary() == nil {
+		t.Error("Expected gauges and summaries to be exported")
+	}
+}
+
+func TestOTLPPusherError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer collector.Close()
+
+	pusher, err := NewOTLPPusher(collector.URL, "job", nil)
+	if err != nil {
+		t.Fatalf("NewOTLPPusher() error = %v", err)
+	}
+	err = New().Push(context.Background(), pusher)
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("Expected the rejected export to be reported, got %v", err)
+	}
+}
+
+func TestNewPusher(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      PushConfig
+		expected string
+		wantErr  bool
+	}{
+		{"disabled", PushConfig{}, "<nil>", false},
+		{"pushgateway", PushConfig{Mode: PushPushgateway, URL: "http://pushgateway:9091", Job: "import"}, "*metrics.PushgatewayPusher", false},
+		{"otlp", PushConfig{Mode: PushOTLP, URL: "http://collector:4318/v1/metrics", Job: "import"}, "*metrics.OTLPPusher", false},
+		{"missing url", PushConfig{Mode: PushOTLP, Job: "import"}, "", true},
+		{"unknown mode", PushConfig{Mode: "statsd", URL: "udp://statsd", Job: "import"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pusher, err := NewPusher(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPusher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && typeName(pusher) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, typeName(pusher))
+			}
+		})
+	}
+}
+
+func typeName(v any) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%T", v)
+}
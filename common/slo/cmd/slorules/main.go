@@ -0,0 +1,51 @@
+// Command slorules generates the Prometheus recording and alerting rules of the service level objectives.
+//
+// Usage:
+//
+//	go run ./slo/cmd/slorules [-file objectives.json] [-namespace cce] [-out ../slo_rules.yml]
+//
+// Without -file the default objectives of the API gateway are used.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/slo"
+)
+
+func main() {
+	file := flag.String("file", "", "JSON file with the objectives, the gateway defaults when empty")
+	namespace := flag.String("namespace", "", "metrics namespace, as passed to metrics.WithNamespace")
+	subsystem := flag.String("subsystem", "", "metrics subsystem, as passed to metrics.WithSubsystem")
+	out := flag.String("out", "", "output file, standard output when empty")
+	flag.Parse()
+
+	objectives := slo.DefaultObjectives()
+	if *file != "" {
+		loaded, err := slo.LoadFile(*file)
+		if err != nil {
+			fail(err)
+		}
+		objectives = loaded
+	}
+
+	rules, err := slo.GenerateRules(objectives, slo.RuleOptions{Namespace: *namespace, Subsystem: *subsystem})
+	if err != nil {
+		fail(err)
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(rules)
+	} else {
+		err = os.WriteFile(*out, rules, 0o644)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "slorules:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,111 @@
+package slo
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the counters recorded by common/metrics for every objective, labeled by "slo"
+const (
+	EventsMetric     = "slo_events_total"
+	GoodEventsMetric = "slo_good_events_total"
+)
+
+// RuleOptions configures the generated rules, Namespace and Subsystem must match the metrics options
+type RuleOptions struct {
+	Namespace string
+	Subsystem string
+	// For is how long an alert condition must hold before firing
+	For time.Duration
+}
+
+// GenerateRules returns a Prometheus rule file with, for every objective, error ratio recording rules over
+// the burn rate windows, an attainment recording rule over the compliance window and multi-window burn rate alerts
+func GenerateRules(objectives []Objective, opts RuleOptions) ([]byte, error) {
+	if err := validateAll(objectives); err != nil {
+		return nil, err
+	}
+	if opts.For == 0 {
+		opts.For = 2 * time.Minute
+	}
+	events := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, EventsMetric)
+	goodEvents := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, GoodEventsMetric)
+
+	var b strings.Builder
+	b.WriteString("# Code generated by common/slo/cmd/slorules. DO NOT EDIT.\n")
+	b.WriteString("groups:\n")
+	for _, objective := range objectives {
+		selector := fmt.Sprintf(`{slo=%q}`, objective.Name)
+		fmt.Fprintf(&b, "  - name: slo_%s\n", objective.Name)
+		b.WriteString("    rules:\n")
+
+		for _, window := range ruleWindows() {
+			fmt.Fprintf(&b, "      - record: slo:error_ratio:rate%s\n", promDuration(window))
+			fmt.Fprintf(&b, "        expr: 1 - (sum(rate(%s%s[%s])) / sum(rate(%s%s[%s])))\n",
+				goodEvents, selector, promDuration(window), events, selector, promDuration(window))
+			b.WriteString("        labels:\n")
+			fmt.Fprintf(&b, "          slo: %s\n", objective.Name)
+		}
+
+		window := promDuration(objective.window())
+		b.WriteString("      - record: slo:attainment:ratio\n")
+		fmt.Fprintf(&b, "        expr: sum(increase(%s%s[%s])) / sum(increase(%s%s[%s]))\n",
+			goodEvents, selector, window, events, selector, window)
+		b.WriteString("        labels:\n")
+		fmt.Fprintf(&b, "          slo: %s\n", objective.Name)
+		fmt.Fprintf(&b, "          target: %q\n", strconv.FormatFloat(objective.Target, 'f', -1, 64))
+		fmt.Fprintf(&b, "          window: %s\n", window)
+
+		for _, w := range BurnRateWindows {
+			threshold := strconv.FormatFloat(w.Factor*objective.ErrorBudget(), 'g', 6, 64)
+			fmt.Fprintf(&b, "      - alert: SLOErrorBudgetBurn\n")
+			fmt.Fprintf(&b, "        expr: slo:error_ratio:rate%s%s > %s and slo:error_ratio:rate%s%s > %s\n",
+				promDuration(w.Long), selector, threshold, promDuration(w.Short), selector, threshold)
+			fmt.Fprintf(&b, "        for: %s\n", promDuration(opts.For))
+			b.WriteString("        labels:\n")
+			fmt.Fprintf(&b, "          slo: %s\n", objective.Name)
+			fmt.Fprintf(&b, "          severity: %s\n", w.Severity)
+			fmt.Fprintf(&b, "          long_window: %s\n", promDuration(w.Long))
+			b.WriteString("        annotations:\n")
+			fmt.Fprintf(&b, "          summary: %q\n", fmt.Sprintf(
+				"SLO %s is burning its error budget %gx faster than sustainable over %s and %s",
+				objective.Name, w.Factor, promDuration(w.Long), promDuration(w.Short)))
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// ruleWindows returns the distinct windows used by the burn rate alerts, shortest first
+func ruleWindows() []time.Duration {
+	var windows []time.Duration
+	seen := map[time.Duration]bool{}
+	for _, w := range BurnRateWindows {
+		for _, d := range []time.Duration{w.Short, w.Long} {
+			if !seen[d] {
+				seen[d] = true
+				windows = append(windows, d)
+			}
+		}
+	}
+	slices.Sort(windows)
+	return windows
+}
+
+// promDuration formats d in the largest Prometheus unit dividing it (e.g. 30d, 6h, 5m)
+func promDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+}
@@ -0,0 +1,53 @@
+package slo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateRules(t *testing.T) {
+	rules, err := GenerateRules(DefaultObjectives(), RuleOptions{Namespace: "cce"})
+	if err != nil {
+		t.Fatalf("GenerateRules() error = %v", err)
+	}
+	output := string(rules)
+
+	expected := []string{
+		"  - name: slo_gateway_availability\n",
+		"      - record: slo:error_ratio:rate5m\n",
+		"      - record: slo:error_ratio:rate3d\n",
+		`expr: 1 - (sum(rate(cce_slo_good_events_total{slo="gateway_latency"}[1h])) / sum(rate(cce_slo_events_total{slo="gateway_latency"}[1h])))`,
+		`expr: sum(increase(cce_slo_good_events_total{slo="gateway_availability"}[30d])) / sum(increase(cce_slo_events_total{slo="gateway_availability"}[30d]))`,
+		`expr: slo:error_ratio:rate1h{slo="gateway_availability"} > 0.0144 and slo:error_ratio:rate5m{slo="gateway_availability"} > 0.0144`,
+		`expr: slo:error_ratio:rate3d{slo="gateway_latency"} > 0.01 and slo:error_ratio:rate6h{slo="gateway_latency"} > 0.01`,
+		"          severity: page\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected %q in rules:\n%s", line, output)
+		}
+	}
+	if count := strings.Count(output, "alert: SLOErrorBudgetBurn"); count != 2*len(BurnRateWindows) {
+		t.Errorf("Expected %d alerts, got %d", 2*len(BurnRateWindows), count)
+	}
+}
+
+func TestPromDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{5 * time.Minute, "5m"},
+		{90 * time.Minute, "90m"},
+		{6 * time.Hour, "6h"},
+		{72 * time.Hour, "3d"},
+		{30 * time.Second, "30s"},
+	}
+
+	for _, tt := range tests {
+		if got := promDuration(tt.duration); got != tt.expected {
+			t.Errorf("promDuration(%v): expected %s, got %s", tt.duration, tt.expected, got)
+		}
+	}
+}
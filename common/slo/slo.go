@@ -0,0 +1,187 @@
+package slo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// DefaultWindow is the compliance period of objectives that do not set one
+const DefaultWindow = 30 * 24 * time.Hour
+
+// validName restricts names to what is safe as a Prometheus label value and rule name suffix
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Objective is a service level objective over the requests served by the process
+type Objective struct {
+	// Name identifies the objective in metrics, rules and reports (lower case, digits and underscores)
+	Name string `json:"name"`
+	// Routes lists the route templates the objective applies to, every route when empty
+	Routes []string `json:"routes,omitempty"`
+	// ExcludeRoutes lists route templates that never count towards the objective (e.g. /metrics)
+	ExcludeRoutes []string `json:"exclude_routes,omitempty"`
+	// Methods restricts the objective to the given HTTP methods, every method when empty
+	Methods []string `json:"methods,omitempty"`
+	// SuccessBelow is the status code from which a response counts as bad, 500 when zero
+	SuccessBelow int `json:"success_below,omitempty"`
+	// LatencyThreshold makes slower responses count as bad, latency is ignored when zero
+	LatencyThreshold time.Duration `json:"latency_threshold,omitempty"`
+	// Target is the fraction of good events to attain over the window, e.g. 0.999
+	Target float64 `json:"target"`
+	// Window is the compliance period, DefaultWindow when zero
+	Window time.Duration `json:"window,omitempty"`
+}
+
+// DefaultObjectives returns the objectives of the API gateway: 99.9% of requests answered without a
+// server error and 99% of them within 300ms, over 30 days
+func DefaultObjectives() []Objective {
+	return []Objective{
+		{
+			Name:          "gateway_availability",
+			ExcludeRoutes: []string{"/metrics"},
+			Target:        0.999,
+			Window:        DefaultWindow,
+		},
+		{
+			Name:             "gateway_latency",
+			ExcludeRoutes:    []string{"/metrics"},
+			LatencyThreshold: 300 * time.Millisecond,
+			Target:           0.99,
+			Window:           DefaultWindow,
+		},
+	}
+}
+
+// Validate checks that the objective can be tracked and turned into rules
+func (o Objective) Validate() error {
+	if !validName.MatchString(o.Name) {
+		return fmt.Errorf("slo: invalid name %q, use lower case letters, digits and underscores", o.Name)
+	}
+	if o.Target <= 0 || o.Target >= 1 {
+		return fmt.Errorf("slo %s: target must be between 0 and 1 (exclusive), got %v", o.Name, o.Target)
+	}
+	if o.Window < 0 || o.LatencyThreshold < 0 {
+		return fmt.Errorf("slo %s: window and latency threshold cannot be negative", o.Name)
+	}
+	if o.SuccessBelow != 0 && (o.SuccessBelow < 100 || o.SuccessBelow > 600) {
+		return fmt.Errorf("slo %s: success_below must be an HTTP status code, got %d", o.Name, o.SuccessBelow)
+	}
+	return nil
+}
+
+// Matches reports whether a request to route with method counts towards the objective
+func (o Objective) Matches(route, method string) bool {
+	if slices.Contains(o.ExcludeRoutes, route) {
+		return false
+	}
+	if len(o.Routes) > 0 && !slices.Contains(o.Routes, route) {
+		return false
+	}
+	return len(o.Methods) == 0 || slices.Contains(o.Methods, method)
+}
+
+// IsGood reports whether a response with status served in duration meets the objective
+func (o Objective) IsGood(status int, duration time.Duration) bool {
+	if status >= o.successBelow() {
+		return false
+	}
+	return o.LatencyThreshold == 0 || duration <= o.LatencyThreshold
+}
+
+// ErrorBudget is the fraction of events allowed to be bad
+func (o Objective) ErrorBudget() float64 {
+	return 1 - o.Target
+}
+
+func (o Objective) successBelow() int {
+	if o.SuccessBelow == 0 {
+		return http.StatusInternalServerError
+	}
+	return o.SuccessBelow
+}
+
+func (o Objective) latencyThreshold() string {
+	if o.LatencyThreshold == 0 {
+		return ""
+	}
+	return o.LatencyThreshold.String()
+}
+
+func (o Objective) window() time.Duration {
+	if o.Window == 0 {
+		return DefaultWindow
+	}
+	return o.Window
+}
+
+/* === Definition files === */
+
+// objectiveJSON is the JSON form of Objective, with durations written as Go duration strings ("300ms", "720h0m0s")
+type objectiveJSON struct {
+	objectiveFields
+	LatencyThreshold string `json:"latency_threshold,omitempty"`
+	Window           string `json:"window,omitempty"`
+}
+
+// objectiveFields has the fields of Objective without its methods, its duration fields are shadowed by objectiveJSON
+type objectiveFields Objective
+
+// MarshalJSON writes the durations as strings, the window being the effective one
+func (o Objective) MarshalJSON() ([]byte, error) {
+	return json.Marshal(objectiveJSON{objectiveFields: objectiveFields(o), LatencyThreshold: o.latencyThreshold(), Window: o.window().String()})
+}
+
+// UnmarshalJSON reads the durations from Go duration strings
+func (o *Objective) UnmarshalJSON(data []byte) error {
+	var decoded objectiveJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	objective := Objective(decoded.objectiveFields)
+	var err error
+	if decoded.LatencyThreshold != "" {
+		if objective.LatencyThreshold, err = time.ParseDuration(decoded.LatencyThreshold); err != nil {
+			return fmt.Errorf("slo %s: latency_threshold: %w", objective.Name, err)
+		}
+	}
+	if decoded.Window != "" {
+		if objective.Window, err = time.ParseDuration(decoded.Window); err != nil {
+			return fmt.Errorf("slo %s: window: %w", objective.Name, err)
+		}
+	}
+	*o = objective
+	return nil
+}
+
+// LoadFile reads a JSON array of objectives and validates them
+func LoadFile(path string) ([]Objective, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var objectives []Objective
+	if err := json.Unmarshal(data, &objectives); err != nil {
+		return nil, fmt.Errorf("slo: parsing %s: %w", path, err)
+	}
+	return objectives, validateAll(objectives)
+}
+
+func validateAll(objectives []Objective) error {
+	var errs []error
+	names := make(map[string]struct{}, len(objectives))
+	for _, objective := range objectives {
+		if err := objective.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if _, ok := names[objective.Name]; ok {
+			errs = append(errs, fmt.Errorf("slo: duplicate name %q", objective.Name))
+		}
+		names[objective.Name] = struct{}{}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,142 @@
+package slo
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectiveMatches(t *testing.T) {
+	objective := Objective{
+		Name:          "patients",
+		Routes:        []string{"/patients", "/patients/{id}"},
+		ExcludeRoutes: []string{"/patients/{id}"},
+		Methods:       []string{"GET"},
+		Target:        0.99,
+	}
+
+	tests := []struct {
+		route    string
+		method   string
+		expected bool
+	}{
+		{"/patients", "GET", true},
+		{"/patients", "POST", false},
+		{"/patients/{id}", "GET", false},
+		{"/health", "GET", false},
+	}
+
+	for _, tt := range tests {
+		if got := objective.Matches(tt.route, tt.method); got != tt.expected {
+			t.Errorf("Matches(%s, %s): expected %v, got %v", tt.route, tt.method, tt.expected, got)
+		}
+	}
+}
+
+func TestObjectiveIsGood(t *testing.T) {
+	tests := []struct {
+		name      string
+		objective Objective
+		status    int
+		duration  time.Duration
+		expected  bool
+	}{
+		{"success", Objective{}, 200, time.Second, true},
+		{"client error", Objective{}, 404, 0, true},
+		{"server error", Objective{}, 503, 0, false},
+		{"custom success status", Objective{SuccessBelow: 400}, 404, 0, false},
+		{"within threshold", Objective{LatencyThreshold: 300 * time.Millisecond}, 200, 300 * time.Millisecond, true},
+		{"too slow", Objective{LatencyThreshold: 300 * time.Millisecond}, 200, 301 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.objective.IsGood(tt.status, tt.duration); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestObjectiveValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		objective Objective
+	}{
+		{"invalid name", Objective{Name: "Gateway-SLO", Target: 0.99}},
+		{"target too high", Objective{Name: "gateway", Target: 1}},
+		{"missing target", Objective{Name: "gateway"}},
+		{"negative window", Objective{Name: "gateway", Target: 0.99, Window: -time.Hour}},
+		{"invalid status", Objective{Name: "gateway", Target: 0.99, SuccessBelow: 42}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.objective.Validate(); err == nil {
+				t.Error("Expected Validate() to reject the objective")
+			}
+		})
+	}
+	for _, objective := range DefaultObjectives() {
+		if err := objective.Validate(); err != nil {
+			t.Errorf("Expected default objective %s to be valid, got %v", objective.Name, err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "objectives.json")
+	definitions := `[
+		{"name": "gateway_latency", "exclude_routes": ["/metrics"], "latency_threshold": "250ms", "target": 0.995, "window": "168h"}
+	]`
+	if err := os.WriteFile(path, []byte(definitions), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	objectives, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if len(objectives) != 1 {
+		t.Fatalf("Expected 1 objective, got %d", len(objectives))
+	}
+	objective := objectives[0]
+	if objective.LatencyThreshold != 250*time.Millisecond || objective.Window != 7*24*time.Hour || objective.Target != 0.995 {
+		t.Errorf("Unexpected objective: %+v", objective)
+	}
+}
+
+func TestObjectiveJSON(t *testing.T) {
+	encoded, err := json.Marshal(DefaultObjectives()[1])
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, field := range []string{`"latency_threshold":"300ms"`, `"window":"720h0m0s"`} {
+		if !strings.Contains(string(encoded), field) {
+			t.Errorf("Expected %s in %s", field, encoded)
+		}
+	}
+
+	var decoded Objective
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.LatencyThreshold != 300*time.Millisecond || decoded.Window != DefaultWindow || decoded.Name != "gateway_latency" {
+		t.Errorf("Expected the objective to round trip, got %+v", decoded)
+	}
+}
+
+func TestLoadFileDuplicate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "objectives.json")
+	definitions := `[{"name": "gateway", "target": 0.99}, {"name": "gateway", "target": 0.9}]`
+	if err := os.WriteFile(path, []byte(definitions), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("Expected a duplicate name error, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package slo
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// resolution is the width of the buckets events are counted in, the shortest burn rate window is 5 minutes
+const resolution = time.Minute
+
+// BurnRateWindow is a multi-window burn rate alert condition: the error budget is burning Factor times
+// faster than sustainable over both the Long and the Short window
+type BurnRateWindow struct {
+	Long     time.Duration
+	Short    time.Duration
+	Factor   float64
+	Severity string
+}
+
+// BurnRateWindows are the multi-window, multi-burn-rate conditions of the SRE workbook for a 30 day budget
+var BurnRateWindows = []BurnRateWindow{
+	{Long: time.Hour, Short: 5 * time.Minute, Factor: 14.4, Severity: "page"},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, Factor: 6, Severity: "page"},
+	{Long: 24 * time.Hour, Short: 2 * time.Hour, Factor: 3, Severity: "ticket"},
+	{Long: 72 * time.Hour, Short: 6 * time.Hour, Factor: 1, Severity: "ticket"},
+}
+
+// Result is the classification of one request against one objective
+type Result struct {
+	Objective string
+	Good      bool
+}
+
+// Tracker counts good and total events per objective in memory, to report attainment and burn rates
+type Tracker struct {
+	objectives []Objective
+	series     []*series
+	now        func() time.Time
+}
+
+// NewTracker validates the objectives and returns a tracker for them
+func NewTracker(objectives ...Objective) (*Tracker, error) {
+	if err := validateAll(objectives); err != nil {
+		return nil, err
+	}
+	t := &Tracker{objectives: objectives, now: time.Now}
+	for _, objective := range objectives {
+		// keep enough history for both the compliance window and the longest burn rate window
+		history := objective.window()
+		for _, w := range BurnRateWindows {
+			history = max(history, w.Long)
+		}
+		t.series = append(t.series, newSeries(int(history/resolution)))
+	}
+	return t, nil
+}
+
+// Objectives returns the tracked objectives
+func (t *Tracker) Objectives() []Objective {
+	return t.objectives
+}
+
+// Record classifies a served request against every matching objective and returns the results
+func (t *Tracker) Record(route, method string, status int, duration time.Duration) []Result {
+	var results []Result
+	now := t.now()
+	for i, objective := range t.objectives {
+		if !objective.Matches(route, method) {
+			continue
+		}
+		good := objective.IsGood(status, duration)
+		t.series[i].add(now, good)
+		results = append(results, Result{Objective: objective.Name, Good: good})
+	}
+	return results
+}
+
+/* === Reports === */
+
+// Status is the current state of an objective
+type Status struct {
+	Name   string  `json:"name"`
+	Target float64 `json:"target"`
+	Window string  `json:"window"`
+	// LatencyThreshold is the duration above which a response counts as bad, empty when latency is ignored
+	LatencyThreshold string `json:"latency_threshold,omitempty"`
+	Total            uint64 `json:"total"`
+	Good             uint64 `json:"good"`
+	// Attainment is the fraction of good events over the window, 1 when there were no events
+	Attainment float64 `json:"attainment"`
+	// ErrorBudgetRemaining is the fraction of the error budget left, negative once exhausted
+	ErrorBudgetRemaining float64    `json:"error_budget_remaining"`
+	BurnRates            []BurnRate `json:"burn_rates"`
+}
+
+// BurnRate is the budget consumption speed over the windows of a BurnRateWindow, 1 meaning the
+// budget would be exactly spent at the end of the compliance window
+type BurnRate struct {
+	LongWindow  string  `json:"long_window"`
+	ShortWindow string  `json:"short_window"`
+	Long        float64 `json:"long"`
+	Short       float64 `json:"short"`
+	Threshold   float64 `json:"threshold"`
+	Severity    string  `json:"severity"`
+	Firing      bool    `json:"firing"`
+}
+
+// Report returns the status of every objective
+func (t *Tracker) Report() []Status {
+	now := t.now()
+	statuses := make([]Status, 0, len(t.objectives))
+	for i, objective := range t.objectives {
+		total, good := t.series[i].sum(now, objective.window())
+		status := Status{
+			Name:                 objective.Name,
+			Target:               objective.Target,
+			Window:               objective.window().String(),
+			LatencyThreshold:     objective.latencyThreshold(),
+			Total:                total,
+			Good:                 good,
+			Attainment:           ratio(good, total),
+			ErrorBudgetRemaining: 1 - errorRatio(total, good)/objective.ErrorBudget(),
+		}
+		for _, w := range BurnRateWindows {
+			burnRate := BurnRate{
+				LongWindow:  w.Long.String(),
+				ShortWindow: w.Short.String(),
+				Long:        t.burnRate(i, now, w.Long),
+				Short:       t.burnRate(i, now, w.Short),
+				Threshold:   w.Factor,
+				Severity:    w.Severity,
+			}
+			burnRate.Firing = burnRate.Long > w.Factor && burnRate.Short > w.Factor
+			status.BurnRates = append(status.BurnRates, burnRate)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Handler serves the report as JSON
+func (t *Tracker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(t.Report()); err != nil {
+			slog.Error("failed to encode slo report", "error", err)
+		}
+	})
+}
+
+func (t *Tracker) burnRate(i int, now time.Time, window time.Duration) float64 {
+	total, good := t.series[i].sum(now, window)
+	return errorRatio(total, good) / t.objectives[i].ErrorBudget()
+}
+
+func ratio(good, total uint64) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(good) / float64(total)
+}
+
+func errorRatio(total, good uint64) float64 {
+	return 1 - ratio(good, total)
+}
+
+/* === Event series === */
+
+// series is a ring of per-minute event counts
+type series struct {
+	mu      sync.Mutex
+	buckets []bucket
+}
+
+type bucket struct {
+	minute int64
+	total  uint64
+	good   uint64
+}
+
+func newSeries(size int) *series {
+	return &series{buckets: make([]bucket, size)}
+}
+
+func (s *series) add(now time.Time, good bool) {
+	minute := now.Unix() / int64(resolution.Seconds())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := &s.buckets[minute%int64(len(s.buckets))]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.total++
+	if good {
+		b.good++
+	}
+}
+
+// sum returns the events of the last window, including the current minute
+func (s *series) sum(now time.Time, window time.Duration) (total, good uint64) {
+	current := now.Unix() / int64(resolution.Seconds())
+	oldest := current - int64(window/resolution) + 1
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.buckets {
+		if b.minute >= oldest && b.minute <= current {
+			total += b.total
+			good += b.good
+		}
+	}
+	return total, good
+}
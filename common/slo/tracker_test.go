@@ -0,0 +1,100 @@
+package slo
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestTracker(t *testing.T, objectives ...Objective) (*Tracker, *time.Time) {
+	t.Helper()
+	tracker, err := NewTracker(objectives...)
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+	now := time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	return tracker, &now
+}
+
+func TestTrackerRecord(t *testing.T) {
+	tracker, _ := newTestTracker(t, DefaultObjectives()...)
+
+	results := tracker.Record("/service", "GET", 200, time.Second)
+	if len(results) != 2 || !results[0].Good || results[1].Good {
+		t.Errorf("Expected an available but slow request, got %+v", results)
+	}
+	if results := tracker.Record("/metrics", "GET", 500, 0); len(results) != 0 {
+		t.Errorf("Expected excluded routes not to be recorded, got %+v", results)
+	}
+}
+
+func TestTrackerReport(t *testing.T) {
+	tracker, now := newTestTracker(t, Objective{Name: "availability", Target: 0.99, Window: 7 * 24 * time.Hour})
+
+	// 2 days ago: 100 good requests, outside every burn rate window but within the compliance window
+	*now = now.Add(-48 * time.Hour)
+	for i := 0; i < 100; i++ {
+		tracker.Record("/health", "GET", 200, 0)
+	}
+	// now: 10 requests of which 1 failed, a 10% error ratio burning the 1% budget 10 times too fast
+	*now = now.Add(48 * time.Hour)
+	for i := 0; i < 9; i++ {
+		tracker.Record("/health", "GET", 200, 0)
+	}
+	tracker.Record("/health", "GET", 503, 0)
+
+	status := tracker.Report()[0]
+	if status.Total != 110 || status.Good != 109 {
+		t.Fatalf("Expected 109/110 events over the window, got %d/%d", status.Good, status.Total)
+	}
+	if math.Abs(status.ErrorBudgetRemaining-(1-(1.0/110)/0.01)) > 1e-9 {
+		t.Errorf("Unexpected error budget remaining %v", status.ErrorBudgetRemaining)
+	}
+
+	fastest := status.BurnRates[0]
+	if math.Abs(fastest.Long-10) > 1e-9 || math.Abs(fastest.Short-10) > 1e-9 || fastest.Firing {
+		t.Errorf("Expected a burn rate of 10 below the 14.4 threshold, got %+v", fastest)
+	}
+	slowest := status.BurnRates[len(status.BurnRates)-1]
+	if math.Abs(slowest.Long-(1.0/110)/0.01) > 1e-9 || slowest.Firing {
+		t.Errorf("Expected the old requests to dilute the 3 day burn rate below 1, got %+v", slowest)
+	}
+}
+
+func TestTrackerReportExpiresEvents(t *testing.T) {
+	tracker, now := newTestTracker(t, Objective{Name: "availability", Target: 0.99, Window: 24 * time.Hour})
+
+	tracker.Record("/health", "GET", 503, 0)
+	*now = now.Add(73 * time.Hour)
+
+	status := tracker.Report()[0]
+	if status.Total != 0 || status.Attainment != 1 || status.ErrorBudgetRemaining != 1 {
+		t.Errorf("Expected events older than every window to be forgotten, got %+v", status)
+	}
+}
+
+func TestTrackerHandler(t *testing.T) {
+	tracker, _ := newTestTracker(t, DefaultObjectives()...)
+	tracker.Record("/route", "GET", 200, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	tracker.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slo", nil))
+
+	var statuses []Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Expected a JSON report: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Name != "gateway_availability" || statuses[0].Total != 1 {
+		t.Errorf("Unexpected report: %+v", statuses)
+	}
+	if len(statuses[0].BurnRates) != len(BurnRateWindows) {
+		t.Errorf("Expected %d burn rates, got %d", len(BurnRateWindows), len(statuses[0].BurnRates))
+	}
+	if statuses[0].Window != "720h0m0s" || statuses[0].LatencyThreshold != "" || statuses[1].LatencyThreshold != "300ms" {
+		t.Errorf("Expected the window and latency threshold of each objective, got %+v", statuses)
+	}
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Action is what an actor did to a resource
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionRead   Action = "read"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	ActionSearch Action = "search"
+)
+
+// Outcome tells whether the action succeeded
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomeDenied  Outcome = "denied"
+)
+
+// GenesisHash is the previous hash of the first event of a trail
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Event is one append-only audit record, chained to the previous record by PrevHash
+type Event struct {
+	Sequence     uint64    `json:"sequence"`
+	Timestamp    time.Time `json:"timestamp"`
+	Actor        string    `json:"actor"`
+	Action       Action    `json:"action"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id,omitempty"`
+	Outcome      Outcome   `json:"outcome"`
+	RequestID    string    `json:"request_id,omitempty"`
+	// Source is where the event claims to come from, such as the sending application of an HL7 message, as told
+	// by the client and not verified
+	Source   string `json:"source,omitempty"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// ComputeHash returns the HMAC-SHA256, keyed by key, of every field of the event except Hash itself.
+// Without the key nobody can rebuild a valid chain after editing the trail.
+func (e Event) ComputeHash(key []byte) string {
+	e.Hash = ""
+	e.Timestamp = e.Timestamp.UTC()
+	// struct fields are always marshaled in declaration order, which makes the encoding canonical
+	encoded, _ := json.Marshal(e)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Filter selects audit events, zero fields match everything
+type Filter struct {
+	Actor        string
+	ResourceType string
+	ResourceID   string
+	From         time.Time
+	To           time.Time
+	// Limit caps the number of returned events (0 means no limit), the most recent events are kept
+	Limit int
+}
+
+// Matches reports whether the event satisfies the filter
+func (f Filter) Matches(e Event) bool {
+	switch {
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.ResourceType != "" && e.ResourceType != f.ResourceType:
+		return false
+	case f.ResourceID != "" && e.ResourceID != f.ResourceID:
+		return false
+	case !f.From.IsZero() && e.Timestamp.Before(f.From):
+		return false
+	case !f.To.IsZero() && e.Timestamp.After(f.To):
+		return false
+	default:
+		return true
+	}
+}
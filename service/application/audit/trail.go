@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+)
+
+// Sink stores audit events, implementations must only ever append
+type Sink interface {
+	// Append durably stores the event after the previous ones
+	Append(event Event) error
+	// Events iterates over every stored event in append order
+	Events() iter.Seq2[Event, error]
+	// Close releases the underlying storage
+	Close() error
+}
+
+// Trail records hash-chained audit events to a sink
+type Trail struct {
+	mu       sync.Mutex
+	sink     Sink
+	key      []byte
+	sequence uint64
+	lastHash string
+	now      func() time.Time
+}
+
+// ErrNoKey is returned by NewTrail when the key chaining the events is empty
+var ErrNoKey = errors.New("audit: the key chaining the events must not be empty")
+
+// NewTrail resumes the chain stored in the sink, verifying it first with key so that new events are never
+// appended to a tampered trail. The key must be kept out of reach of whoever can write the sink.
+func NewTrail(sink Sink, key []byte) (*Trail, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	head, err := Verify(sink.Events(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &Trail{sink: sink, key: key, sequence: head.Sequence, lastHash: head.Hash, now: time.Now}, nil
+}
+
+// Record completes the event (sequence, timestamp, chain hashes) and appends it to the sink
+func (t *Trail) Record(_ context.Context, event Event) (Event, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	event.Sequence = t.sequence + 1
+	if event.Timestamp.IsZero() {
+		event.Timestamp = t.now()
+	}
+	event.Timestamp = event.Timestamp.UTC()
+	event.PrevHash = t.lastHash
+	event.Hash = event.ComputeHash(t.key)
+
+	if err := t.sink.Append(event); err != nil {
+		return Event{}, fmt.Errorf("audit: append event: %w", err)
+	}
+	t.sequence, t.lastHash = event.Sequence, event.Hash
+	return event, nil
+}
+
+// Query returns the events matching the filter in append order
+func (t *Trail) Query(_ context.Context, filter Filter) ([]Event, error) {
+	var events []Event
+	for event, err := range t.sink.Events() {
+		if err != nil {
+			return nil, err
+		}
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events, nil
+}
+
+// Close closes the sink
+func (t *Trail) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sink.Close()
+}
+
+// Head identifies the last event of a verified trail, it can be stored elsewhere to also detect truncation
+type Head struct {
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// VerificationError reports the first event that breaks the chain
+type VerificationError struct {
+	Sequence uint64
+	Reason   string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("audit: chain broken at event %d: %s", e.Sequence, e.Reason)
+}
+
+// ErrTampered is matched by every VerificationError
+var ErrTampered = errors.New("audit: trail has been tampered with")
+
+func (e *VerificationError) Is(target error) bool {
+	return target == ErrTampered
+}
+
+// Verify walks the events and checks sequence numbers, hash links and event hashes computed with key, returning
+// the head of the chain
+func Verify(events iter.Seq2[Event, error], key []byte) (Head, error) {
+	head := Head{Hash: GenesisHash}
+	for event, err := range events {
+		if err != nil {
+			return head, err
+		}
+		switch {
+		case event.Sequence != head.Sequence+1:
+			return head, &VerificationError{Sequence: event.Sequence, Reason: fmt.Sprintf("expected sequence %d", head.Sequence+1)}
+		case event.PrevHash != head.Hash:
+			return head, &VerificationError{Sequence: event.Sequence, Reason: "previous hash does not match"}
+		case !hmac.Equal([]byte(event.Hash), []byte(event.ComputeHash(key))):
+			return head, &VerificationError{Sequence: event.Sequence, Reason: "event hash does not match its content"}
+		}
+		head = Head{Sequence: event.Sequence, Hash: event.Hash}
+	}
+	return head, nil
+}
@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+	"time"
+)
+
+// sliceSink is a minimal in-package sink used to tamper with stored events
+type sliceSink struct {
+	events []Event
+}
+
+func (s *sliceSink) Append(event Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *sliceSink) Events() iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		for _, event := range s.events {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *sliceSink) Close() error {
+	return nil
+}
+
+var testKey = []byte("test-audit-key")
+
+func newTestTrail(t *testing.T, sink *sliceSink, count int) *Trail {
+	t.Helper()
+	trail, err := NewTrail(sink, testKey)
+	if err != nil {
+		t.Fatalf("NewTrail() error = %v", err)
+	}
+	start := time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < count; i++ {
+		_, err := trail.Record(context.Background(), Event{
+			Timestamp:    start.Add(time.Duration(i) * time.Minute),
+			Actor:        []string{"alice", "bob"}[i%2],
+			Action:       ActionRead,
+			ResourceType: "Patient",
+			ResourceID:   []string{"p1", "p2", "p3"}[i%3],
+			Outcome:      OutcomeSuccess,
+		})
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	return trail
+}
+
+func TestRecordChainsEvents(t *testing.T) {
+	sink := &sliceSink{}
+	newTestTrail(t, sink, 3)
+
+	if sink.events[0].PrevHash != GenesisHash {
+		t.Errorf("Expected first event to link to the genesis hash, got %s", sink.events[0].PrevHash)
+	}
+	for i := 1; i < len(sink.events); i++ {
+		if sink.events[i].PrevHash != sink.events[i-1].Hash {
+			t.Errorf("Expected event %d to link to the previous hash", i+1)
+		}
+		if sink.events[i].Sequence != uint64(i+1) {
+			t.Errorf("Expected sequence %d, got %d", i+1, sink.events[i].Sequence)
+		}
+	}
+
+	head, err := Verify(sink.Events(), testKey)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if head.Sequence != 3 || head.Hash != sink.events[2].Hash {
+		t.Errorf("Unexpected head %+v", head)
+	}
+}
+
+func TestNewTrailResumesChain(t *testing.T) {
+	sink := &sliceSink{}
+	newTestTrail(t, sink, 2)
+
+	trail, err := NewTrail(sink, testKey)
+	if err != nil {
+		t.Fatalf("NewTrail() error = %v", err)
+	}
+	event, err := trail.Record(context.Background(), Event{Actor: "carol", Action: ActionUpdate, ResourceType: "Patient", Outcome: OutcomeSuccess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Sequence != 3 || event.PrevHash != sink.events[1].Hash {
+		t.Errorf("Expected resumed chain, got %+v", event)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(events []Event) []Event
+	}{
+		{
+			name: "modified field",
+			tamper: func(events []Event) []Event {
+				events[1].Actor = "mallory"
+				return events
+			},
+		},
+		{
+			name: "modified field with recomputed hash",
+			tamper: func(events []Event) []Event {
+				events[1].Outcome = OutcomeDenied
+				events[1].Hash = events[1].ComputeHash(testKey)
+				return events
+			},
+		},
+		{
+			name: "chain rebuilt without the key",
+			tamper: func(events []Event) []Event {
+				prev := GenesisHash
+				for i := range events {
+					events[i].Actor = "mallory"
+					events[i].PrevHash = prev
+					events[i].Hash = events[i].ComputeHash(nil)
+					prev = events[i].Hash
+				}
+				return events
+			},
+		},
+		{
+			name: "removed event",
+			tamper: func(events []Event) []Event {
+				return append(events[:1], events[2:]...)
+			},
+		},
+		{
+			name: "reordered events",
+			tamper: func(events []Event) []Event {
+				events[1], events[2] = events[2], events[1]
+				return events
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &sliceSink{}
+			newTestTrail(t, sink, 4)
+			sink.events = tt.tamper(sink.events)
+
+			_, err := Verify(sink.Events(), testKey)
+			if !errors.Is(err, ErrTampered) {
+				t.Errorf("Expected tampering to be detected, got %v", err)
+			}
+			if _, err := NewTrail(sink, testKey); err == nil {
+				t.Error("Expected NewTrail to refuse a tampered trail")
+			}
+		})
+	}
+}
+
+func TestNewTrailRequiresKey(t *testing.T) {
+	if _, err := NewTrail(&sliceSink{}, nil); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected a trail without a key to be refused, got %v", err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	trail := newTestTrail(t, &sliceSink{}, 6)
+	start := time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected int
+	}{
+		{name: "everything", filter: Filter{}, expected: 6},
+		{name: "by actor", filter: Filter{Actor: "alice"}, expected: 3},
+		{name: "by resource", filter: Filter{ResourceType: "Patient", ResourceID: "p1"}, expected: 2},
+		{name: "by time range", filter: Filter{From: start.Add(time.Minute), To: start.Add(3 * time.Minute)}, expected: 3},
+		{name: "limit keeps latest", filter: Filter{Limit: 2}, expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := trail.Query(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != tt.expected {
+				t.Errorf("Expected %d events, got %d", tt.expected, len(events))
+			}
+		})
+	}
+
+	latest, _ := trail.Query(context.Background(), Filter{Limit: 1})
+	if latest[0].Sequence != 6 {
+		t.Errorf("Expected limit to keep the most recent event, got %d", latest[0].Sequence)
+	}
+}
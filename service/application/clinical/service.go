@@ -0,0 +1,372 @@
+// Package clinical writes the clinical resources whose rules span several resources: their references to
+// patients, episodes and encounters must resolve, and their status follows its lifecycle.
+package clinical
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"service/application/fhir"
+	"service/application/storage"
+)
+
+// Service writes clinical resources, checking their rules and writing them in the same storage transaction
+type Service struct {
+	store storage.Store
+}
+
+// NewService returns a service writing to store
+func NewService(store storage.Store) *Service {
+	return &Service{store: store}
+}
+
+// checkFunc checks the rules of a resource against the other resources of the transaction
+type checkFunc[T fhir.Resource] func(ctx context.Context, tx storage.Repositories, resource T) error
+
+// CreateEncounter stores a new encounter of an existing patient
+func (s *Service) CreateEncounter(ctx context.Context, encounter *fhir.Encounter) (*fhir.Encounter, error) {
+	return create(ctx, s.store, storage.Repositories.Encounters, checkEncounter, encounter)
+}
+
+// UpdateEncounter stores the next version of an encounter, its status moving as EncounterLifecycle allows
+func (s *Service) UpdateEncounter(ctx context.Context, encounter *fhir.Encounter, ifMatch string) (*fhir.Encounter, bool, error) {
+	return update(ctx, s.store, storage.Repositories.Encounters, checkEncounter, encounter, ifMatch)
+}
+
+// CreateEpisodeOfCare stores a new episode of care of an existing patient
+func (s *Service) CreateEpisodeOfCare(ctx context.Context, episode *fhir.EpisodeOfCare) (*fhir.EpisodeOfCare, error) {
+	return create(ctx, s.store, storage.Repositories.EpisodesOfCare, checkEpisodeOfCare, episode)
+}
+
+// UpdateEpisodeOfCare stores the next version of an episode of care, its status moving as EpisodeOfCareLifecycle
+// allows
+func (s *Service) UpdateEpisodeOfCare(ctx context.Context, episode *fhir.EpisodeOfCare, ifMatch string) (*fhir.EpisodeOfCare, bool, error) {
+	return update(ctx, s.store, storage.Repositories.EpisodesOfCare, checkEpisodeOfCare, episode, ifMatch)
+}
+
+// CreateObservation stores a new observation of an existing patient, flagging its quantities against their
+// reference ranges when it carries no interpretation (see fhir.Observation.Interpret)
+func (s *Service) CreateObservation(ctx context.Context, observation *fhir.Observation) (*fhir.Observation, error) {
+	observation.Interpret()
+	return create(ctx, s.store, storage.Repositories.Observations, checkObservation, observation)
+}
+
+// UpdateObservation stores the next version of an observation, its status moving as ObservationLifecycle allows
+func (s *Service) UpdateObservation(ctx context.Context, observation *fhir.Observation, ifMatch string) (*fhir.Observation, bool, error) {
+	observation.Interpret()
+	return update(ctx, s.store, storage.Repositories.Observations, checkObservation, observation, ifMatch)
+}
+
+// CreateDocumentReference stores a new document of an existing patient under the id it has, assigned by the
+// caller which stored its content under that id. The documents it replaces, which must be current, are marked as
+// superseded in the same transaction.
+func (s *Service) CreateDocumentReference(ctx context.Context, document *fhir.DocumentReference) (*fhir.DocumentReference, error) {
+	var created *fhir.DocumentReference
+	err := s.store.Transact(ctx, func(tx storage.Repositories) error {
+		if err := checkDocumentReference(ctx, tx, document); err != nil {
+			return err
+		}
+		if err := supersede(ctx, tx, document); err != nil {
+			return err
+		}
+		var isNew bool
+		var err error
+		created, isNew, err = tx.DocumentReferences().Update(ctx, document, "")
+		if err == nil && !isNew {
+			err = fmt.Errorf("%s/%s already exists: %w", fhir.DocumentReferenceType, document.ID, fhir.ErrVersionConflict)
+		}
+		return err
+	})
+	return created, err
+}
+
+// UpdateDocumentReference stores the next version of an existing document, its status moving as
+// DocumentReferenceLifecycle allows; its content and relations cannot change, a new document replacing it is
+// uploaded instead
+func (s *Service) UpdateDocumentReference(ctx context.Context, document *fhir.DocumentReference, ifMatch string) (*fhir.DocumentReference, bool, error) {
+	return update(ctx, s.store, storage.Repositories.DocumentReferences, checkDocumentRevision, document, ifMatch)
+}
+
+/* === Transactions === */
+
+// Tx writes clinical resources within the storage transaction of Transact, checking the same rules as Service.
+// Its repositories read and write within the transaction as well.
+type Tx struct {
+	storage.Repositories
+}
+
+// Transact runs fn in one storage transaction, so that the resources it writes are committed together when it
+// returns nil and discarded when it returns an error. fn must write through the Tx it is given, not the Service.
+func (s *Service) Transact(ctx context.Context, fn func(tx *Tx) error) error {
+	return s.store.Transact(ctx, func(tx storage.Repositories) error {
+		return fn(&Tx{Repositories: tx})
+	})
+}
+
+// CreateEncounter stores a new encounter of an existing patient
+func (tx *Tx) CreateEncounter(ctx context.Context, encounter *fhir.Encounter) (*fhir.Encounter, error) {
+	return createIn(ctx, tx.Repositories, storage.Repositories.Encounters, checkEncounter, encounter)
+}
+
+// UpdateEncounter stores the next version of an encounter, its status moving as EncounterLifecycle allows
+func (tx *Tx) UpdateEncounter(ctx context.Context, encounter *fhir.Encounter, ifMatch string) (*fhir.Encounter, bool, error) {
+	return updateIn(ctx, tx.Repositories, storage.Repositories.Encounters, checkEncounter, encounter, ifMatch)
+}
+
+// CreateObservation stores a new observation of an existing patient, flagging it as Service.CreateObservation does
+func (tx *Tx) CreateObservation(ctx context.Context, observation *fhir.Observation) (*fhir.Observation, error) {
+	observation.Interpret()
+	return createIn(ctx, tx.Repositories, storage.Repositories.Observations, checkObservation, observation)
+}
+
+// UpdateObservation stores the next version of an observation, its status moving as ObservationLifecycle allows
+func (tx *Tx) UpdateObservation(ctx context.Context, observation *fhir.Observation, ifMatch string) (*fhir.Observation, bool, error) {
+	observation.Interpret()
+	return updateIn(ctx, tx.Repositories, storage.Repositories.Observations, checkObservation, observation, ifMatch)
+}
+
+/* === Rules === */
+
+// checkEncounter checks that the subject of the encounter exists, and that its episodes of care and the encounter
+// it is part of exist and concern the same patient
+func checkEncounter(ctx context.Context, tx storage.Repositories, encounter *fhir.Encounter) error {
+	outcome := &fhir.OperationOutcome{}
+	patient, err := resolve(ctx, outcome, tx.Patients(), "Encounter.subject", encounter.Subject)
+	if err != nil {
+		return err
+	}
+	for i, reference := range encounter.EpisodeOfCare {
+		path := fmt.Sprintf("Encounter.episodeOfCare[%d]", i)
+		episode, err := resolve(ctx, outcome, tx.EpisodesOfCare(), path, &reference)
+		if err != nil {
+			return err
+		}
+		if episode != nil && patient != nil && !sameTarget(episode.Patient, encounter.Subject) {
+			outcome.Add(fhir.IssueBusinessRule, path, "references %s, which concerns another patient", reference.Reference)
+		}
+	}
+	parent, err := resolve(ctx, outcome, tx.Encounters(), "Encounter.partOf", encounter.PartOf)
+	if err != nil {
+		return err
+	}
+	if parent != nil && patient != nil && !sameTarget(parent.Subject, encounter.Subject) {
+		outcome.Add(fhir.IssueBusinessRule, "Encounter.partOf", "references %s, which concerns another patient", encounter.PartOf.Reference)
+	}
+	return outcome.OrNil()
+}
+
+// checkEpisodeOfCare checks that the patient of the episode exists
+func checkEpisodeOfCare(ctx context.Context, tx storage.Repositories, episode *fhir.EpisodeOfCare) error {
+	outcome := &fhir.OperationOutcome{}
+	if _, err := resolve(ctx, outcome, tx.Patients(), "EpisodeOfCare.patient", episode.Patient); err != nil {
+		return err
+	}
+	return outcome.OrNil()
+}
+
+// checkObservation checks that the subject of the observation exists, and that the encounter it was made in
+// exists and concerns the same patient
+func checkObservation(ctx context.Context, tx storage.Repositories, observation *fhir.Observation) error {
+	outcome := &fhir.OperationOutcome{}
+	patient, err := resolve(ctx, outcome, tx.Patients(), "Observation.subject", observation.Subject)
+	if err != nil {
+		return err
+	}
+	encounter, err := resolve(ctx, outcome, tx.Encounters(), "Observation.encounter", observation.Encounter)
+	if err != nil {
+		return err
+	}
+	if encounter != nil && patient != nil && !sameTarget(encounter.Subject, observation.Subject) {
+		outcome.Add(fhir.IssueBusinessRule, "Observation.encounter", "references %s, which concerns another patient", observation.Encounter.Reference)
+	}
+	return outcome.OrNil()
+}
+
+// checkDocumentReference checks that the subject of the document exists, and that the encounters and episodes of
+// care of its context and the documents it relates to exist and concern the same patient
+func checkDocumentReference(ctx context.Context, tx storage.Repositories, document *fhir.DocumentReference) error {
+	outcome := &fhir.OperationOutcome{}
+	patient, err := resolve(ctx, outcome, tx.Patients(), "DocumentReference.subject", document.Subject)
+	if err != nil {
+		return err
+	}
+	if document.Context != nil {
+		for i, reference := range document.Context.Encounter {
+			path := fmt.Sprintf("DocumentReference.context.encounter[%d]", i)
+			var subject *fhir.Reference
+			if resourceType, _, _ := reference.Target(); resourceType == fhir.EpisodeOfCareType {
+				episode, err := resolve(ctx, outcome, tx.EpisodesOfCare(), path, &reference)
+				if err != nil {
+					return err
+				}
+				if episode != nil {
+					subject = episode.Patient
+				}
+			} else {
+				encounter, err := resolve(ctx, outcome, tx.Encounters(), path, &reference)
+				if err != nil {
+					return err
+				}
+				if encounter != nil {
+					subject = encounter.Subject
+				}
+			}
+			if subject != nil && patient != nil && !sameTarget(subject, document.Subject) {
+				outcome.Add(fhir.IssueBusinessRule, path, "references %s, which concerns another patient", reference.Reference)
+			}
+		}
+	}
+	for i, relation := range document.RelatesTo {
+		path := fmt.Sprintf("DocumentReference.relatesTo[%d].target", i)
+		related, err := resolve(ctx, outcome, tx.DocumentReferences(), path, &relation.Target)
+		if err != nil {
+			return err
+		}
+		if related != nil && patient != nil && !sameTarget(related.Subject, document.Subject) {
+			outcome.Add(fhir.IssueBusinessRule, path, "references %s, which concerns another patient", relation.Target.Reference)
+		}
+	}
+	return outcome.OrNil()
+}
+
+// checkDocumentRevision checks a new version of a document like checkDocumentReference, and that it exists with
+// the same content and relations
+func checkDocumentRevision(ctx context.Context, tx storage.Repositories, document *fhir.DocumentReference) error {
+	current, err := tx.DocumentReferences().Read(ctx, document.ID)
+	switch {
+	case errors.Is(err, fhir.ErrNotFound), errors.Is(err, fhir.ErrDeleted):
+		return fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueBusinessRule,
+			fmt.Sprintf("%s/%s does not exist, documents are created by uploading their content", fhir.DocumentReferenceType, document.ID))
+	case err != nil:
+		return err
+	}
+	if !reflect.DeepEqual(current.Content, document.Content) {
+		return fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueBusinessRule,
+			"the content of a document cannot change, upload a new document replacing it", "DocumentReference.content")
+	}
+	if !reflect.DeepEqual(current.RelatesTo, document.RelatesTo) {
+		return fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueBusinessRule,
+			"the relations of a document cannot change, upload a new document replacing it", "DocumentReference.relatesTo")
+	}
+	return checkDocumentReference(ctx, tx, document)
+}
+
+// supersede marks the documents of this server a new current document replaces as superseded
+func supersede(ctx context.Context, tx storage.Repositories, document *fhir.DocumentReference) error {
+	outcome := &fhir.OperationOutcome{}
+	if document.Status != "current" {
+		outcome.Add(fhir.IssueBusinessRule, "DocumentReference.status", "must be current for a new document, got %q", document.Status)
+	}
+	for i, relation := range document.RelatesTo {
+		if relation.Code != fhir.RelationReplaces || strings.Contains(relation.Target.Reference, "://") {
+			continue
+		}
+		path := fmt.Sprintf("DocumentReference.relatesTo[%d].target", i)
+		_, id, _ := relation.Target.Target()
+		replaced, err := tx.DocumentReferences().Read(ctx, id)
+		if err != nil {
+			return err
+		}
+		if replaced.Status != "current" {
+			outcome.Add(fhir.IssueBusinessRule, path, "references %s, which is %s and cannot be replaced", relation.Target.Reference, replaced.Status)
+			continue
+		}
+		replaced.Status = "superseded"
+		if _, _, err := tx.DocumentReferences().Update(ctx, replaced, ""); err != nil {
+			return err
+		}
+	}
+	return outcome.OrNil()
+}
+
+// resolve reads the resource a local reference points to, adding an issue to outcome when it does not exist or
+// was deleted. Absent, contained and absolute references, which may point to other servers, resolve to nil.
+func resolve[T fhir.Resource](ctx context.Context, outcome *fhir.OperationOutcome, repository fhir.Repository[T], path string, reference *fhir.Reference) (T, error) {
+	var zero T
+	if reference == nil || strings.Contains(reference.Reference, "://") {
+		return zero, nil
+	}
+	_, id, ok := reference.Target()
+	if !ok {
+		return zero, nil
+	}
+	resource, err := repository.Read(ctx, id)
+	switch {
+	case errors.Is(err, fhir.ErrNotFound):
+		outcome.Add(fhir.IssueBusinessRule, path, "references %s, which does not exist", reference.Reference)
+	case errors.Is(err, fhir.ErrDeleted):
+		outcome.Add(fhir.IssueBusinessRule, path, "references %s, which was deleted", reference.Reference)
+	case err != nil:
+		return zero, err
+	}
+	return resource, nil
+}
+
+// sameTarget tells whether two references point to the same resource
+func sameTarget(a, b *fhir.Reference) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	aType, aID, aOK := a.Target()
+	bType, bID, bOK := b.Target()
+	return aOK && bOK && aType == bType && aID == bID
+}
+
+/* === Writes === */
+
+// create checks and stores a new resource in one transaction
+func create[T fhir.Stateful](ctx context.Context, store storage.Store, repository func(storage.Repositories) fhir.Repository[T], check checkFunc[T], resource T) (T, error) {
+	var created T
+	err := store.Transact(ctx, func(tx storage.Repositories) error {
+		var err error
+		created, err = createIn(ctx, tx, repository, check, resource)
+		return err
+	})
+	return created, err
+}
+
+// update checks a resource and the transition from its current status, then stores it as the next version, in one
+// transaction. A resource that does not exist or was deleted may be written with any status.
+func update[T fhir.Stateful](ctx context.Context, store storage.Store, repository func(storage.Repositories) fhir.Repository[T], check checkFunc[T], resource T, ifMatch string) (T, bool, error) {
+	var updated T
+	var created bool
+	err := store.Transact(ctx, func(tx storage.Repositories) error {
+		var err error
+		updated, created, err = updateIn(ctx, tx, repository, check, resource, ifMatch)
+		return err
+	})
+	return updated, created, err
+}
+
+// createIn checks and stores a new resource within the transaction tx
+func createIn[T fhir.Stateful](ctx context.Context, tx storage.Repositories, repository func(storage.Repositories) fhir.Repository[T], check checkFunc[T], resource T) (T, error) {
+	if err := check(ctx, tx, resource); err != nil {
+		var zero T
+		return zero, err
+	}
+	return repository(tx).Create(ctx, resource)
+}
+
+// updateIn checks a resource and the transition from its current status, then stores it as the next version,
+// within the transaction tx
+func updateIn[T fhir.Stateful](ctx context.Context, tx storage.Repositories, repository func(storage.Repositories) fhir.Repository[T], check checkFunc[T], resource T, ifMatch string) (T, bool, error) {
+	var zero T
+	if err := check(ctx, tx, resource); err != nil {
+		return zero, false, err
+	}
+	id := resource.GetBase().ID
+	current, err := repository(tx).Read(ctx, id)
+	if err != nil && !errors.Is(err, fhir.ErrNotFound) && !errors.Is(err, fhir.ErrDeleted) {
+		return zero, false, err
+	}
+	// a stale If-Match is reported as such by Update rather than as a transition from an outdated status
+	if err == nil && (ifMatch == "" || ifMatch == current.GetBase().Meta.VersionID) {
+		if err := resource.Lifecycle().Transition(current.GetStatus(), resource.GetStatus()); err != nil {
+			return zero, false, fmt.Errorf("%s/%s: %w", resource.TypeName(), id, err)
+		}
+	}
+	return repository(tx).Update(ctx, resource, ifMatch)
+}
@@ -7,4 +7,11 @@ import (
 type ServiceController interface {
 	HealthCheckHandler(w http.ResponseWriter, r *http.Request)
 	MetricsHandler(w http.ResponseWriter, r *http.Request)
+	AuditQueryHandler(w http.ResponseWriter, r *http.Request)
+	CreatePatientHandler(w http.ResponseWriter, r *http.Request)
+	ReadPatientHandler(w http.ResponseWriter, r *http.Request)
+	VReadPatientHandler(w http.ResponseWriter, r *http.Request)
+	UpdatePatientHandler(w http.ResponseWriter, r *http.Request)
+	DeletePatientHandler(w http.ResponseWriter, r *http.Request)
+	SearchPatientHandler(w http.ResponseWriter, r *http.Request)
 }
@@ -0,0 +1,210 @@
+// Package documents stores clinical documents: the DocumentReference of each document in the FHIR repository and
+// its content, verified as it is uploaded, in a storage.BlobStore under the id of the DocumentReference.
+package documents
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"service/application/clinical"
+	"service/application/fhir"
+	"service/application/storage"
+)
+
+var (
+	// ErrUnsupportedContent is returned for content of a type that is not allowed, or that does not match its
+	// declared type
+	ErrUnsupportedContent = errors.New("unsupported document content")
+	// ErrTooLarge is returned for content exceeding the maximum size
+	ErrTooLarge = errors.New("document content too large")
+	// ErrContentCorrupted is returned when the stored content of a document no longer matches its hash
+	ErrContentCorrupted = errors.New("document content does not match its hash")
+)
+
+// sniffLen is how much of the content http.DetectContentType looks at
+const sniffLen = 512
+
+// Options bound the content of the documents
+type Options struct {
+	// MaxSize is the maximum size of a content in bytes
+	MaxSize int64
+	// ContentTypes are the media types of the content accepted, such as application/pdf
+	ContentTypes []string
+}
+
+// Service uploads and opens documents, writing their DocumentReference through the clinical rules
+type Service struct {
+	blobs    storage.BlobStore
+	clinical *clinical.Service
+	opts     Options
+}
+
+// NewService returns a service keeping the content of documents in blobs
+func NewService(blobs storage.BlobStore, clinicalService *clinical.Service, opts Options) *Service {
+	return &Service{blobs: blobs, clinical: clinicalService, opts: opts}
+}
+
+// ContentURL is the URL of the content of the document of id, relative to the FHIR base URL
+func ContentURL(id string) string {
+	return fhir.DocumentReferenceType + "/" + id + "/content"
+}
+
+// Upload stores a new document whose single attachment is read from content. The content type is sniffed and must
+// match the declared one, when there is one, and be allowed; the declared size and SHA-1 hash, when given, must
+// match the content. The attachment is completed with the type, size, hash and URL of the content, and the
+// documents the new one replaces are marked as superseded.
+func (s *Service) Upload(ctx context.Context, document *fhir.DocumentReference, content io.Reader) (*fhir.DocumentReference, error) {
+	if len(document.Content) != 1 {
+		return nil, fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueInvalid,
+			"an uploaded document must have exactly one content", "DocumentReference.content")
+	}
+	attachment := &document.Content[0].Attachment
+	if attachment.URL != "" || len(attachment.Data) > 0 {
+		return nil, fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueInvalid,
+			"the attachment of an uploaded document must not have a url nor data, its content is uploaded",
+			"DocumentReference.content[0].attachment")
+	}
+
+	buffered := bufio.NewReaderSize(content, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	contentType, err := s.contentType(attachment.ContentType, http.DetectContentType(head))
+	if err != nil {
+		return nil, err
+	}
+
+	document.ID = fhir.NewID()
+	verified := &contentReader{r: buffered, digest: sha1.New(), max: s.opts.MaxSize, hash: attachment.Hash, size: attachment.Size}
+	if err := s.blobs.Put(ctx, document.ID, verified); err != nil {
+		return nil, err
+	}
+	size := verified.n
+	attachment.ContentType = contentType
+	attachment.Size = &size
+	attachment.Hash = verified.digest.Sum(nil)
+	attachment.URL = ContentURL(document.ID)
+
+	created, err := s.clinical.CreateDocumentReference(ctx, document)
+	if err != nil {
+		if deleteErr := s.blobs.Delete(context.WithoutCancel(ctx), document.ID); deleteErr != nil {
+			slog.Error("failed to delete the content of a refused document", "error", deleteErr, "id", document.ID)
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+// Open returns the content of a version of a document, whose reading fails with ErrContentCorrupted at its end
+// when it does not match the hash of the attachment
+func (s *Service) Open(ctx context.Context, document *fhir.DocumentReference) (io.ReadCloser, error) {
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("%s/%s has no content: %w", fhir.DocumentReferenceType, document.ID, fhir.ErrNotFound)
+	}
+	blob, err := s.blobs.Get(ctx, document.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &verifiedBlob{ReadCloser: blob, digest: sha1.New(), want: document.Content[0].Attachment.Hash}, nil
+}
+
+// Ping checks that the blob store can be reached
+func (s *Service) Ping(ctx context.Context) error {
+	return s.blobs.Ping(ctx)
+}
+
+/* === Content checks === */
+
+// contentType returns the type the content is stored as: the declared one, or the sniffed one when none was
+// declared. The two must be compatible and the type allowed.
+func (s *Service) contentType(declared, sniffed string) (string, error) {
+	sniffedType, _, _ := mime.ParseMediaType(sniffed)
+	if declared == "" {
+		declared = sniffed
+	}
+	declaredType, _, err := mime.ParseMediaType(declared)
+	if err != nil || !strings.Contains(declaredType, "/") {
+		return "", fmt.Errorf("%w: %q is not a media type", ErrUnsupportedContent, declared)
+	}
+	if !compatible(declaredType, sniffedType) {
+		return "", fmt.Errorf("%w: declared as %s but the content is %s", ErrUnsupportedContent, declaredType, sniffedType)
+	}
+	if !slices.Contains(s.opts.ContentTypes, declaredType) {
+		return "", fmt.Errorf("%w: %s is not one of %s", ErrUnsupportedContent, declaredType, strings.Join(s.opts.ContentTypes, ", "))
+	}
+	return declared, nil
+}
+
+// compatible tells whether content sniffed as sniffed may be of the declared type. Sniffing only recognises XML
+// by its declaration and tells text from binary, so XML without declaration is sniffed as text.
+func compatible(declared, sniffed string) bool {
+	isXML := declared == "text/xml" || declared == "application/xml" || strings.HasSuffix(declared, "+xml")
+	switch {
+	case declared == sniffed:
+		return true
+	case sniffed == "text/xml":
+		return isXML
+	case sniffed == "text/plain":
+		return isXML || (strings.HasPrefix(declared, "text/") && declared != "text/html")
+	}
+	return false
+}
+
+// contentReader reads the content of an upload, failing with ErrTooLarge past max bytes and, at its end, when it
+// does not match the declared hash or size
+type contentReader struct {
+	r      io.Reader
+	digest hash.Hash
+	n      int64
+	max    int64
+	hash   []byte
+	size   *int64
+}
+
+func (c *contentReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.digest.Write(p[:n])
+	if c.n > c.max {
+		return n, fmt.Errorf("%w: the maximum is %d bytes", ErrTooLarge, c.max)
+	}
+	if errors.Is(err, io.EOF) {
+		if c.size != nil && *c.size != c.n {
+			return n, fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueValue,
+				fmt.Sprintf("the content is %d bytes, not %d", c.n, *c.size), "DocumentReference.content[0].attachment.size")
+		}
+		if c.hash != nil && !bytes.Equal(c.hash, c.digest.Sum(nil)) {
+			return n, fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueValue,
+				"the SHA-1 of the content does not match the hash", "DocumentReference.content[0].attachment.hash")
+		}
+	}
+	return n, err
+}
+
+// verifiedBlob reads a stored content, failing with ErrContentCorrupted at its end when it does not match want
+type verifiedBlob struct {
+	io.ReadCloser
+	digest hash.Hash
+	want   []byte
+}
+
+func (v *verifiedBlob) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.digest.Write(p[:n])
+	if errors.Is(err, io.EOF) && v.want != nil && !bytes.Equal(v.want, v.digest.Sum(nil)) {
+		return n, ErrContentCorrupted
+	}
+	return n, err
+}
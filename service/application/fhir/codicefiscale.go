@@ -0,0 +1,61 @@
+package fhir
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CodiceFiscaleSystem is the identifier system of the Italian tax code, as defined by HL7 Italia
+const CodiceFiscaleSystem = "http://hl7.it/sid/codiceFiscale"
+
+// codiceFiscalePattern accepts the omocodia variants, where the digits are replaced by LMNPQRSTUV
+var codiceFiscalePattern = regexp.MustCompile(`^[A-Z]{6}[0-9LMNPQRSTUV]{2}[ABCDEHLMPRST][0-9LMNPQRSTUV]{2}[A-Z][0-9LMNPQRSTUV]{3}[A-Z]$`)
+
+// codiceFiscaleOdd is the value of the characters at odd positions (1st, 3rd...) in the check character sum,
+// indexed by digit or by letter
+var codiceFiscaleOdd = [26]int{1, 0, 5, 7, 9, 13, 15, 17, 19, 21, 2, 4, 18, 20, 11, 3, 6, 8, 12, 14, 16, 10, 22, 25, 24, 23}
+
+// NormalizeCodiceFiscale upper-cases the code and drops the spaces, as it is often written
+func NormalizeCodiceFiscale(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(code, " ", ""))
+}
+
+// ValidateCodiceFiscale checks the format, the day of birth and the check character of a personal codice fiscale
+func ValidateCodiceFiscale(code string) error {
+	if !codiceFiscalePattern.MatchString(code) {
+		return fmt.Errorf("must be a codice fiscale of 16 upper-case letters and digits, got %q", code)
+	}
+
+	day := strings.Map(func(c rune) rune {
+		if i := strings.IndexRune("LMNPQRSTUV", c); i >= 0 {
+			return '0' + rune(i)
+		}
+		return c
+	}, code[9:11])
+	// women have 40 added to their day of birth
+	if n := int(day[0]-'0')*10 + int(day[1]-'0'); n < 1 || n > 31 && n < 41 || n > 71 {
+		return fmt.Errorf("codice fiscale %q has an invalid day of birth", code)
+	}
+
+	if check := codiceFiscaleCheck(code[:15]); code[15] != check {
+		return fmt.Errorf("codice fiscale %q has check character %c, expected %c", code, code[15], check)
+	}
+	return nil
+}
+
+func codiceFiscaleCheck(code string) byte {
+	sum := 0
+	for i := 0; i < len(code); i++ {
+		value := int(code[i] - 'A')
+		if code[i] >= '0' && code[i] <= '9' {
+			value = int(code[i] - '0')
+		}
+		if i%2 == 0 {
+			sum += codiceFiscaleOdd[value]
+		} else {
+			sum += value
+		}
+	}
+	return byte('A' + sum%26)
+}
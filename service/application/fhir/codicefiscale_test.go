@@ -0,0 +1,34 @@
+package fhir
+
+import "testing"
+
+func TestValidateCodiceFiscale(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		wantErr bool
+	}{
+		{name: "valid", code: "RSSMRA85T10A562S"},
+		{name: "valid woman", code: "BNCLRA90A41H501F"},
+		{name: "valid omocodia", code: "RSSMRA85T10A56NH"},
+		{name: "wrong check character", code: "RSSMRA85T10A562T", wantErr: true},
+		{name: "lower case", code: "rssmra85t10a562s", wantErr: true},
+		{name: "too short", code: "RSSMRA85T10A562", wantErr: true},
+		{name: "invalid month", code: "RSSMRA85Z10A562S", wantErr: true},
+		{name: "invalid day", code: "RSSMRA85T35A562S", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCodiceFiscale(tt.code); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCodiceFiscale(%q) error = %v, wantErr %v", tt.code, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeCodiceFiscale(t *testing.T) {
+	if got := NormalizeCodiceFiscale("rssmra 85t10 a562s"); got != "RSSMRA85T10A562S" {
+		t.Errorf("NormalizeCodiceFiscale() = %q", got)
+	}
+}
@@ -0,0 +1,85 @@
+package fhir
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// DateRange is the time range a FHIR date or dateTime of limited precision covers, End being exclusive:
+// "1985" covers the whole year
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+var (
+	datePattern     = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+	dateTimePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`)
+)
+
+// ParseDate parses a FHIR date: YYYY, YYYY-MM or YYYY-MM-DD, without time zone
+func ParseDate(value string) (DateRange, error) {
+	if !datePattern.MatchString(value) {
+		return DateRange{}, fmt.Errorf("must be a date as YYYY, YYYY-MM or YYYY-MM-DD, got %q", value)
+	}
+	layout, step := "2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	switch len(value) {
+	case len("2006-01"):
+		layout, step = "2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	case len("2006-01-02"):
+		layout, step = time.DateOnly, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	}
+	start, err := time.Parse(layout, value)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("must be a valid date, got %q", value)
+	}
+	return DateRange{Start: start, End: step(start)}, nil
+}
+
+// ParseDateTime parses a FHIR dateTime: a date, or a time to the second or finer with its time zone
+func ParseDateTime(value string) (DateRange, error) {
+	if datePattern.MatchString(value) {
+		return ParseDate(value)
+	}
+	if !dateTimePattern.MatchString(value) {
+		return DateRange{}, fmt.Errorf("must be a date or an RFC 3339 time with its zone, got %q", value)
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("must be a valid time, got %q", value)
+	}
+	return DateRange{Start: t, End: t.Add(time.Second).Truncate(time.Second)}, nil
+}
+
+// Contains tells whether other lies entirely within r
+func (r DateRange) Contains(other DateRange) bool {
+	return !other.Start.Before(r.Start) && !other.End.After(r.End)
+}
+
+// Unbounded ends of the time ranges of open periods
+var (
+	minTime = time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxTime = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// Range returns the time range the period covers, unbounded on the sides it leaves open; ok is false when a bound
+// is not a valid dateTime
+func (p Period) Range() (r DateRange, ok bool) {
+	r = DateRange{Start: minTime, End: maxTime}
+	if p.Start != "" {
+		start, err := ParseDateTime(p.Start)
+		if err != nil {
+			return DateRange{}, false
+		}
+		r.Start = start.Start
+	}
+	if p.End != "" {
+		end, err := ParseDateTime(p.End)
+		if err != nil {
+			return DateRange{}, false
+		}
+		r.End = end.End
+	}
+	return r, true
+}
@@ -0,0 +1,193 @@
+package fhir
+
+// DocumentReferenceType is the resourceType of DocumentReference
+const DocumentReferenceType = "DocumentReference"
+
+// DocumentReferenceLifecycle is the status state machine of document references: a current document is superseded
+// by the one replacing it, and a current or superseded document may be marked as entered in error
+var DocumentReferenceLifecycle = Lifecycle{
+	"current":          {"superseded", "entered-in-error"},
+	"superseded":       {"entered-in-error"},
+	"entered-in-error": nil,
+}
+
+// RelationReplaces is the relatesTo code of a document replacing the one it targets, a new version of it
+const RelationReplaces = "replaces"
+
+// documentRelations are the codes of DocumentReference.relatesTo
+var documentRelations = []string{RelationReplaces, "transforms", "signs", "appends"}
+
+// DocumentReference is the FHIR R4 DocumentReference resource: a clinical document of a patient, such as a
+// discharge letter or a report, whose content is an attachment
+type DocumentReference struct {
+	Base
+	MasterIdentifier *Identifier                  `json:"masterIdentifier,omitempty"`
+	Identifier       []Identifier                 `json:"identifier,omitempty"`
+	Status           string                       `json:"status,omitempty"`
+	DocStatus        string                       `json:"docStatus,omitempty"`
+	Type             *CodeableConcept             `json:"type,omitempty"`
+	Category         []CodeableConcept            `json:"category,omitempty"`
+	Subject          *Reference                   `json:"subject,omitempty"`
+	Date             string                       `json:"date,omitempty"`
+	Author           []Reference                  `json:"author,omitempty"`
+	Authenticator    *Reference                   `json:"authenticator,omitempty"`
+	Custodian        *Reference                   `json:"custodian,omitempty"`
+	RelatesTo        []DocumentReferenceRelatesTo `json:"relatesTo,omitempty"`
+	Description      string                       `json:"description,omitempty"`
+	SecurityLabel    []CodeableConcept            `json:"securityLabel,omitempty"`
+	Content          []DocumentReferenceContent   `json:"content,omitempty"`
+	Context          *DocumentReferenceContext    `json:"context,omitempty"`
+}
+
+// DocumentReferenceRelatesTo is a relationship of the document to another one, which it may replace
+type DocumentReferenceRelatesTo struct {
+	Code   string    `json:"code"`
+	Target Reference `json:"target"`
+}
+
+// DocumentReferenceContent is the content of the document, in one format
+type DocumentReferenceContent struct {
+	Attachment Attachment `json:"attachment"`
+	Format     *Coding    `json:"format,omitempty"`
+}
+
+// DocumentReferenceContext is the clinical context the document was written in
+type DocumentReferenceContext struct {
+	Encounter         []Reference       `json:"encounter,omitempty"`
+	Event             []CodeableConcept `json:"event,omitempty"`
+	Period            *Period           `json:"period,omitempty"`
+	FacilityType      *CodeableConcept  `json:"facilityType,omitempty"`
+	PracticeSetting   *CodeableConcept  `json:"practiceSetting,omitempty"`
+	SourcePatientInfo *Reference        `json:"sourcePatientInfo,omitempty"`
+	Related           []Reference       `json:"related,omitempty"`
+}
+
+// TypeName returns "DocumentReference"
+func (*DocumentReference) TypeName() string {
+	return DocumentReferenceType
+}
+
+// GetStatus returns the status of the document
+func (d *DocumentReference) GetStatus() string {
+	return d.Status
+}
+
+// Lifecycle returns DocumentReferenceLifecycle
+func (*DocumentReference) Lifecycle() Lifecycle {
+	return DocumentReferenceLifecycle
+}
+
+// Replaces returns the references to the documents this one replaces
+func (d *DocumentReference) Replaces() []Reference {
+	var targets []Reference
+	for _, relation := range d.RelatesTo {
+		if relation.Code == RelationReplaces {
+			targets = append(targets, relation.Target)
+		}
+	}
+	return targets
+}
+
+// Validate checks the elements of the document against the R4 definition, the subject being a required reference
+// to a Patient and the content a required attachment
+func (d *DocumentReference) Validate() error {
+	outcome := &OperationOutcome{}
+	d.Base.validate(outcome, DocumentReferenceType)
+
+	if d.MasterIdentifier != nil {
+		validateIdentifier(outcome, "DocumentReference.masterIdentifier", *d.MasterIdentifier)
+	}
+	for i, identifier := range d.Identifier {
+		validateIdentifier(outcome, indexed("DocumentReference.identifier", i), identifier)
+	}
+	validateStatus(outcome, "DocumentReference.status", d.Status, DocumentReferenceLifecycle)
+	if !oneOf(d.DocStatus, "", "preliminary", "final", "amended", "entered-in-error") {
+		outcome.Add(IssueCodeInvalid, "DocumentReference.docStatus", "must be preliminary, final, amended or entered-in-error, got %q", d.DocStatus)
+	}
+	requireReferenceTo(outcome, "DocumentReference.subject", d.Subject, PatientType)
+	validateInstant(outcome, "DocumentReference.date", d.Date)
+	for i, author := range d.Author {
+		validateReferenceTo(outcome, indexed("DocumentReference.author", i), &author,
+			"Practitioner", "PractitionerRole", "Organization", "Device", "Patient", "RelatedPerson")
+	}
+	validateReferenceTo(outcome, "DocumentReference.authenticator", d.Authenticator, "Practitioner", "PractitionerRole", "Organization")
+	validateReferenceTo(outcome, "DocumentReference.custodian", d.Custodian, "Organization")
+	for i, relation := range d.RelatesTo {
+		path := indexed("DocumentReference.relatesTo", i)
+		if !oneOf(relation.Code, documentRelations...) {
+			outcome.Add(IssueCodeInvalid, path+".code", "must be replaces, transforms, signs or appends, got %q", relation.Code)
+		}
+		requireReferenceTo(outcome, path+".target", &relation.Target, DocumentReferenceType)
+	}
+
+	if len(d.Content) == 0 {
+		outcome.Add(IssueRequired, "DocumentReference.content", "is required")
+	}
+	for i, content := range d.Content {
+		validateAttachment(outcome, indexed("DocumentReference.content", i)+".attachment", content.Attachment)
+	}
+	if d.Context != nil {
+		for i, encounter := range d.Context.Encounter {
+			validateReferenceTo(outcome, indexed("DocumentReference.context.encounter", i), &encounter, EncounterType, EpisodeOfCareType)
+		}
+		validatePeriod(outcome, "DocumentReference.context.period", d.Context.Period)
+		validateReferenceTo(outcome, "DocumentReference.context.sourcePatientInfo", d.Context.SourcePatientInfo, PatientType)
+	}
+	return outcome.OrNil()
+}
+
+/* === Search === */
+
+// DocumentReferenceSearchParams are the search parameters of DocumentReference; relatesto finds the documents
+// replacing a given one
+var DocumentReferenceSearchParams = []SearchParam[*DocumentReference]{
+	TokenParam("_id", func(d *DocumentReference) []Token { return []Token{{Code: d.ID}} }),
+	TokenParam("identifier", func(d *DocumentReference) []Token {
+		return identifierTokens(append(optional(d.MasterIdentifier), d.Identifier...))
+	}),
+	ReferenceParam("patient", []string{PatientType}, func(d *DocumentReference) []Reference { return optional(d.Subject) }),
+	ReferenceParam("subject", []string{PatientType}, func(d *DocumentReference) []Reference { return optional(d.Subject) }),
+	TokenParam("status", func(d *DocumentReference) []Token {
+		return []Token{{System: "http://hl7.org/fhir/document-reference-status", Code: d.Status}}
+	}),
+	TokenParam("type", func(d *DocumentReference) []Token { return conceptTokens(optional(d.Type)) }),
+	TokenParam("category", func(d *DocumentReference) []Token { return conceptTokens(d.Category) }),
+	DateParam("date", func(d *DocumentReference) []string { return []string{d.Date} }),
+	PeriodParam("period", func(d *DocumentReference) []Period {
+		if d.Context == nil {
+			return nil
+		}
+		return optional(d.Context.Period)
+	}),
+	ReferenceParam("encounter", []string{EncounterType, EpisodeOfCareType}, func(d *DocumentReference) []Reference {
+		if d.Context == nil {
+			return nil
+		}
+		return d.Context.Encounter
+	}),
+	ReferenceParam("author", []string{"Practitioner", "PractitionerRole", "Organization", "Device", "Patient", "RelatedPerson"},
+		func(d *DocumentReference) []Reference { return d.Author }),
+	ReferenceParam("relatesto", []string{DocumentReferenceType}, func(d *DocumentReference) []Reference {
+		targets := make([]Reference, 0, len(d.RelatesTo))
+		for _, relation := range d.RelatesTo {
+			targets = append(targets, relation.Target)
+		}
+		return targets
+	}),
+	TokenParam("relation", func(d *DocumentReference) []Token {
+		tokens := make([]Token, 0, len(d.RelatesTo))
+		for _, relation := range d.RelatesTo {
+			tokens = append(tokens, Token{System: "http://hl7.org/fhir/document-relationship-type", Code: relation.Code})
+		}
+		return tokens
+	}),
+	TokenParam("contenttype", func(d *DocumentReference) []Token {
+		tokens := make([]Token, 0, len(d.Content))
+		for _, content := range d.Content {
+			tokens = append(tokens, Token{System: "urn:ietf:bcp:13", Code: content.Attachment.ContentType})
+		}
+		return tokens
+	}),
+	TokenParam("security-label", func(d *DocumentReference) []Token { return conceptTokens(d.SecurityLabel) }),
+	StringParam("description", func(d *DocumentReference) []string { return []string{d.Description} }),
+}
@@ -0,0 +1,89 @@
+package fhir
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDocumentReference(t *testing.T) {
+	const subject = `"subject":{"reference":"Patient/p1"}`
+	tests := []struct {
+		name           string
+		body           string
+		wantExpression string
+	}{
+		{
+			name: "discharge letter replacing another",
+			body: `{"resourceType":"DocumentReference","status":"current","docStatus":"final",` + subject + `,
+				"type":{"coding":[{"system":"http://loinc.org","code":"18842-5"}]},"date":"2024-05-03T10:00:00+02:00",
+				"relatesTo":[{"code":"replaces","target":{"reference":"DocumentReference/d1"}}],
+				"content":[{"attachment":{"contentType":"application/pdf","size":2048,"hash":"2jmj7l5rSw0yVb/vlWAYkK/YBwk=","title":"lettera.pdf"}}],
+				"context":{"encounter":[{"reference":"Encounter/e1"}],"period":{"start":"2024-05-01","end":"2024-05-03"}}}`,
+		},
+		{name: "missing content", body: `{"resourceType":"DocumentReference","status":"current",` + subject + `}`,
+			wantExpression: "DocumentReference.content"},
+		{name: "subject not a patient", body: `{"resourceType":"DocumentReference","status":"current","subject":{"reference":"Group/g1"},"content":[{"attachment":{}}]}`,
+			wantExpression: "DocumentReference.subject.reference"},
+		{name: "date without time", body: `{"resourceType":"DocumentReference","status":"current",` + subject + `,"date":"2024-05-03","content":[{"attachment":{}}]}`,
+			wantExpression: "DocumentReference.date"},
+		{name: "hash of another digest", body: `{"resourceType":"DocumentReference","status":"current",` + subject + `,"content":[{"attachment":{"hash":"AAAA"}}]}`,
+			wantExpression: "DocumentReference.content[0].attachment.hash"},
+		{name: "invalid content type", body: `{"resourceType":"DocumentReference","status":"current",` + subject + `,"content":[{"attachment":{"contentType":"pdf"}}]}`,
+			wantExpression: "DocumentReference.content[0].attachment.contentType"},
+		{name: "negative size", body: `{"resourceType":"DocumentReference","status":"current",` + subject + `,"content":[{"attachment":{"size":-1}}]}`,
+			wantExpression: "DocumentReference.content[0].attachment.size"},
+		{name: "relation to another type", body: `{"resourceType":"DocumentReference","status":"current",` + subject + `,
+				"relatesTo":[{"code":"replaces","target":{"reference":"Observation/o1"}}],"content":[{"attachment":{}}]}`,
+			wantExpression: "DocumentReference.relatesTo[0].target.reference"},
+		{name: "unknown relation", body: `{"resourceType":"DocumentReference","status":"current",` + subject + `,
+				"relatesTo":[{"code":"copies","target":{"reference":"DocumentReference/d1"}}],"content":[{"attachment":{}}]}`,
+			wantExpression: "DocumentReference.relatesTo[0].code"},
+		{name: "unknown status", body: `{"resourceType":"DocumentReference","status":"draft",` + subject + `,"content":[{"attachment":{}}]}`,
+			wantExpression: "DocumentReference.status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode[DocumentReference](strings.NewReader(tt.body))
+			if tt.wantExpression == "" {
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				return
+			}
+
+			var outcome *OperationOutcome
+			if !errors.As(err, &outcome) {
+				t.Fatalf("Decode() error = %v, want an OperationOutcome", err)
+			}
+			for _, issue := range outcome.Issue {
+				if len(issue.Expression) > 0 && issue.Expression[0] == tt.wantExpression {
+					return
+				}
+			}
+			t.Errorf("Decode() issues = %+v, want one at %s", outcome.Issue, tt.wantExpression)
+		})
+	}
+}
+
+func TestDocumentReferenceLifecycle(t *testing.T) {
+	tests := []struct {
+		from, to string
+		wantErr  bool
+	}{
+		{from: "current", to: "superseded"},
+		{from: "superseded", to: "entered-in-error"},
+		{from: "superseded", to: "current", wantErr: true},
+		{from: "entered-in-error", to: "current", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			err := DocumentReferenceLifecycle.Transition(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Transition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package fhir
+
+// EncounterType is the resourceType of Encounter
+const EncounterType = "Encounter"
+
+// EncounterLifecycle is the status state machine of encounters: planned visits may be checked in (arrived) or
+// started directly, both may be cancelled before they start, and only a started encounter can finish
+var EncounterLifecycle = Lifecycle{
+	"planned":     {"arrived", "in-progress", "cancelled"},
+	"arrived":     {"in-progress", "cancelled"},
+	"in-progress": {"finished"},
+	"finished":    nil,
+	"cancelled":   nil,
+}
+
+// Encounter is the FHIR R4 Encounter resource: an interaction between a patient and healthcare providers, such as
+// a hospital admission or an outpatient visit
+type Encounter struct {
+	Base
+	Identifier      []Identifier              `json:"identifier,omitempty"`
+	Status          string                    `json:"status,omitempty"`
+	StatusHistory   []EncounterStatusHistory  `json:"statusHistory,omitempty"`
+	Class           *Coding                   `json:"class,omitempty"`
+	Type            []CodeableConcept         `json:"type,omitempty"`
+	ServiceType     *CodeableConcept          `json:"serviceType,omitempty"`
+	Priority        *CodeableConcept          `json:"priority,omitempty"`
+	Subject         *Reference                `json:"subject,omitempty"`
+	EpisodeOfCare   []Reference               `json:"episodeOfCare,omitempty"`
+	BasedOn         []Reference               `json:"basedOn,omitempty"`
+	Participant     []EncounterParticipant    `json:"participant,omitempty"`
+	Appointment     []Reference               `json:"appointment,omitempty"`
+	Period          *Period                   `json:"period,omitempty"`
+	ReasonCode      []CodeableConcept         `json:"reasonCode,omitempty"`
+	ReasonReference []Reference               `json:"reasonReference,omitempty"`
+	Diagnosis       []EncounterDiagnosis      `json:"diagnosis,omitempty"`
+	Hospitalization *EncounterHospitalization `json:"hospitalization,omitempty"`
+	Location        []EncounterLocation       `json:"location,omitempty"`
+	ServiceProvider *Reference                `json:"serviceProvider,omitempty"`
+	PartOf          *Reference                `json:"partOf,omitempty"`
+}
+
+// EncounterStatusHistory is a status the encounter had in the past
+type EncounterStatusHistory struct {
+	Status string `json:"status"`
+	Period Period `json:"period"`
+}
+
+// EncounterParticipant is a practitioner or other person involved in the encounter
+type EncounterParticipant struct {
+	Type       []CodeableConcept `json:"type,omitempty"`
+	Period     *Period           `json:"period,omitempty"`
+	Individual *Reference        `json:"individual,omitempty"`
+}
+
+// EncounterDiagnosis is a condition or procedure relevant to the encounter
+type EncounterDiagnosis struct {
+	Condition Reference        `json:"condition"`
+	Use       *CodeableConcept `json:"use,omitempty"`
+	Rank      *int             `json:"rank,omitempty"`
+}
+
+// EncounterHospitalization holds the details of an admission
+type EncounterHospitalization struct {
+	PreAdmissionIdentifier *Identifier       `json:"preAdmissionIdentifier,omitempty"`
+	Origin                 *Reference        `json:"origin,omitempty"`
+	AdmitSource            *CodeableConcept  `json:"admitSource,omitempty"`
+	ReAdmission            *CodeableConcept  `json:"reAdmission,omitempty"`
+	DietPreference         []CodeableConcept `json:"dietPreference,omitempty"`
+	SpecialCourtesy        []CodeableConcept `json:"specialCourtesy,omitempty"`
+	SpecialArrangement     []CodeableConcept `json:"specialArrangement,omitempty"`
+	Destination            *Reference        `json:"destination,omitempty"`
+	DischargeDisposition   *CodeableConcept  `json:"dischargeDisposition,omitempty"`
+}
+
+// EncounterLocation is a location the patient was at during the encounter
+type EncounterLocation struct {
+	Location     Reference        `json:"location"`
+	Status       string           `json:"status,omitempty"`
+	PhysicalType *CodeableConcept `json:"physicalType,omitempty"`
+	Period       *Period          `json:"period,omitempty"`
+}
+
+// participantTypes are the resources an encounter or episode participant may be
+var participantTypes = []string{"Practitioner", "PractitionerRole", "RelatedPerson"}
+
+// TypeName returns "Encounter"
+func (*Encounter) TypeName() string {
+	return EncounterType
+}
+
+// GetStatus returns the status of the encounter
+func (e *Encounter) GetStatus() string {
+	return e.Status
+}
+
+// Lifecycle returns EncounterLifecycle
+func (*Encounter) Lifecycle() Lifecycle {
+	return EncounterLifecycle
+}
+
+// Validate checks the elements of the encounter against the R4 definition, the subject being a required
+// reference to a Patient
+func (e *Encounter) Validate() error {
+	outcome := &OperationOutcome{}
+	e.Base.validate(outcome, EncounterType)
+
+	for i, identifier := range e.Identifier {
+		validateIdentifier(outcome, indexed("Encounter.identifier", i), identifier)
+	}
+	validateStatus(outcome, "Encounter.status", e.Status, EncounterLifecycle)
+	for i, history := range e.StatusHistory {
+		path := indexed("Encounter.statusHistory", i)
+		validateStatus(outcome, path+".status", history.Status, EncounterLifecycle)
+		validatePeriod(outcome, path+".period", &history.Period)
+	}
+	if e.Class == nil || e.Class.Code == "" {
+		outcome.Add(IssueRequired, "Encounter.class", "is required, as a code such as AMB or IMP")
+	}
+	requireReferenceTo(outcome, "Encounter.subject", e.Subject, PatientType)
+	for i, episode := range e.EpisodeOfCare {
+		validateReferenceTo(outcome, indexed("Encounter.episodeOfCare", i), &episode, EpisodeOfCareType)
+	}
+	for i, basedOn := range e.BasedOn {
+		validateReferenceTo(outcome, indexed("Encounter.basedOn", i), &basedOn, "ServiceRequest")
+	}
+	for i, participant := range e.Participant {
+		path := indexed("Encounter.participant", i)
+		validateReferenceTo(outcome, path+".individual", participant.Individual, participantTypes...)
+		validatePeriod(outcome, path+".period", participant.Period)
+	}
+	for i, appointment := range e.Appointment {
+		validateReferenceTo(outcome, indexed("Encounter.appointment", i), &appointment, "Appointment")
+	}
+	validatePeriod(outcome, "Encounter.period", e.Period)
+	for i, reason := range e.ReasonReference {
+		validateReferenceTo(outcome, indexed("Encounter.reasonReference", i), &reason,
+			"Condition", "Procedure", "Observation", "ImmunizationRecommendation")
+	}
+	for i, diagnosis := range e.Diagnosis {
+		path := indexed("Encounter.diagnosis", i)
+		validateReferenceTo(outcome, path+".condition", &diagnosis.Condition, "Condition", "Procedure")
+		if diagnosis.Rank != nil && *diagnosis.Rank < 1 {
+			outcome.Add(IssueValue, path+".rank", "must be a positive integer")
+		}
+	}
+	if h := e.Hospitalization; h != nil {
+		if h.PreAdmissionIdentifier != nil {
+			validateIdentifier(outcome, "Encounter.hospitalization.preAdmissionIdentifier", *h.PreAdmissionIdentifier)
+		}
+		validateReferenceTo(outcome, "Encounter.hospitalization.origin", h.Origin, "Location", "Organization")
+		validateReferenceTo(outcome, "Encounter.hospitalization.destination", h.Destination, "Location", "Organization")
+	}
+	for i, location := range e.Location {
+		path := indexed("Encounter.location", i)
+		validateReferenceTo(outcome, path+".location", &location.Location, "Location")
+		if !oneOf(location.Status, "", "planned", "active", "reserved", "completed") {
+			outcome.Add(IssueCodeInvalid, path+".status", "unknown location status %q", location.Status)
+		}
+		validatePeriod(outcome, path+".period", location.Period)
+	}
+	validateReferenceTo(outcome, "Encounter.serviceProvider", e.ServiceProvider, "Organization")
+	validateReferenceTo(outcome, "Encounter.partOf", e.PartOf, EncounterType)
+	if e.PartOf != nil && e.ID != "" {
+		if _, id, ok := e.PartOf.Target(); ok && id == e.ID {
+			outcome.Add(IssueInvariant, "Encounter.partOf", "must not reference the encounter itself")
+		}
+	}
+	return outcome.OrNil()
+}
+
+/* === Search === */
+
+// EncounterSearchParams are the search parameters of Encounter
+var EncounterSearchParams = []SearchParam[*Encounter]{
+	TokenParam("_id", func(e *Encounter) []Token { return []Token{{Code: e.ID}} }),
+	TokenParam("identifier", func(e *Encounter) []Token { return identifierTokens(e.Identifier) }),
+	ReferenceParam("patient", []string{PatientType}, func(e *Encounter) []Reference { return optional(e.Subject) }),
+	ReferenceParam("subject", []string{PatientType}, func(e *Encounter) []Reference { return optional(e.Subject) }),
+	TokenParam("status", func(e *Encounter) []Token {
+		return []Token{{System: "http://hl7.org/fhir/encounter-status", Code: e.Status}}
+	}),
+	TokenParam("class", func(e *Encounter) []Token {
+		if e.Class == nil {
+			return nil
+		}
+		return []Token{{System: e.Class.System, Code: e.Class.Code}}
+	}),
+	TokenParam("type", func(e *Encounter) []Token { return conceptTokens(e.Type) }),
+	PeriodParam("date", func(e *Encounter) []Period { return optional(e.Period) }),
+	ReferenceParam("participant", participantTypes, func(e *Encounter) []Reference { return participants(e) }),
+	ReferenceParam("practitioner", []string{"Practitioner"}, func(e *Encounter) []Reference {
+		var practitioners []Reference
+		for _, individual := range participants(e) {
+			if resourceType, _, ok := individual.Target(); ok && resourceType == "Practitioner" {
+				practitioners = append(practitioners, individual)
+			}
+		}
+		return practitioners
+	}),
+	ReferenceParam("episode-of-care", []string{EpisodeOfCareType}, func(e *Encounter) []Reference { return e.EpisodeOfCare }),
+	ReferenceParam("part-of", []string{EncounterType}, func(e *Encounter) []Reference { return optional(e.PartOf) }),
+}
+
+// participants returns the individuals taking part in the encounter
+func participants(e *Encounter) []Reference {
+	var individuals []Reference
+	for _, participant := range e.Participant {
+		individuals = append(individuals, optional(participant.Individual)...)
+	}
+	return individuals
+}
@@ -0,0 +1,143 @@
+package fhir
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDecodeEncounter(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		wantExpression string
+	}{
+		{
+			name: "valid",
+			body: `{"resourceType":"Encounter","status":"in-progress","class":{"system":"http://terminology.hl7.org/CodeSystem/v3-ActCode","code":"IMP"},
+				"subject":{"reference":"Patient/p1"},"episodeOfCare":[{"reference":"EpisodeOfCare/e1"}],
+				"participant":[{"individual":{"reference":"Practitioner/dr1"}}],"period":{"start":"2024-05-01T10:00:00+02:00"}}`,
+		},
+		{name: "unknown status", body: `{"resourceType":"Encounter","status":"triaged","class":{"code":"AMB"},"subject":{"reference":"Patient/p1"}}`,
+			wantExpression: "Encounter.status"},
+		{name: "missing class", body: `{"resourceType":"Encounter","status":"planned","subject":{"reference":"Patient/p1"}}`,
+			wantExpression: "Encounter.class"},
+		{name: "missing subject", body: `{"resourceType":"Encounter","status":"planned","class":{"code":"AMB"}}`,
+			wantExpression: "Encounter.subject.reference"},
+		{name: "subject not a patient", body: `{"resourceType":"Encounter","status":"planned","class":{"code":"AMB"},"subject":{"reference":"Group/g1"}}`,
+			wantExpression: "Encounter.subject.reference"},
+		{
+			name: "participant not a person",
+			body: `{"resourceType":"Encounter","status":"planned","class":{"code":"AMB"},"subject":{"reference":"Patient/p1"},
+				"participant":[{"individual":{"reference":"Organization/o1"}}]}`,
+			wantExpression: "Encounter.participant[0].individual.reference",
+		},
+		{
+			name: "period ending before it starts",
+			body: `{"resourceType":"Encounter","status":"finished","class":{"code":"AMB"},"subject":{"reference":"Patient/p1"},
+				"period":{"start":"2024-05-03","end":"2024-05-01"}}`,
+			wantExpression: "Encounter.period",
+		},
+		{
+			name:           "episode without patient",
+			body:           `{"resourceType":"EpisodeOfCare","status":"active"}`,
+			wantExpression: "EpisodeOfCare.patient.reference",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if strings.Contains(tt.body, `"EpisodeOfCare"`) {
+				_, err = Decode[EpisodeOfCare](strings.NewReader(tt.body))
+			} else {
+				_, err = Decode[Encounter](strings.NewReader(tt.body))
+			}
+			if tt.wantExpression == "" {
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				return
+			}
+
+			var outcome *OperationOutcome
+			if !errors.As(err, &outcome) {
+				t.Fatalf("Decode() error = %v, want an OperationOutcome", err)
+			}
+			for _, issue := range outcome.Issue {
+				if len(issue.Expression) > 0 && issue.Expression[0] == tt.wantExpression {
+					return
+				}
+			}
+			t.Errorf("Decode() issues = %+v, want one at %s", outcome.Issue, tt.wantExpression)
+		})
+	}
+}
+
+func searchEncounters() []*Encounter {
+	encounter := func(id, patient, status, start, end, practitioner string) *Encounter {
+		e := &Encounter{
+			Base:    Base{ResourceType: EncounterType, ID: id},
+			Status:  status,
+			Class:   &Coding{Code: "AMB"},
+			Subject: &Reference{Reference: "Patient/" + patient},
+			Period:  &Period{Start: start, End: end},
+		}
+		if practitioner != "" {
+			e.Participant = []EncounterParticipant{{Individual: &Reference{Reference: "Practitioner/" + practitioner}}}
+		}
+		return e
+	}
+	return []*Encounter{
+		encounter("e1", "p1", "finished", "2024-01-10T09:00:00Z", "2024-01-10T10:00:00Z", "dr1"),
+		encounter("e2", "p1", "in-progress", "2024-03-01T08:00:00Z", "", "dr2"),
+		encounter("e3", "p2", "planned", "2024-06-01", "2024-06-01", ""),
+	}
+}
+
+func TestSearchEncounters(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "patient id", query: "patient=p1", want: []string{"e1", "e2"}},
+		{name: "patient reference", query: "patient=Patient/p2", want: []string{"e3"}},
+		{name: "subject with type modifier", query: "subject:Patient=p2", want: []string{"e3"}},
+		{name: "status", query: "status=planned,in-progress", want: []string{"e2", "e3"}},
+		{name: "date within", query: "date=2024-01", want: []string{"e1"}},
+		{name: "date range", query: "date=ge2024-02-01&date=lt2024-05-01", want: []string{"e2"}},
+		{name: "ongoing encounter", query: "date=ge2025-01-01", want: []string{"e2"}},
+		{name: "practitioner", query: "practitioner=dr1", want: []string{"e1"}},
+		{name: "participant", query: "participant=Practitioner/dr2", want: []string{"e2"}},
+		{name: "class", query: "class=AMB&patient=p2", want: []string{"e3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			search, err := ParseSearch(query, EncounterSearchParams)
+			if err != nil {
+				t.Fatalf("ParseSearch() error = %v", err)
+			}
+			page, _, err := search.Page(seqOf(searchEncounters()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, encounter := range page {
+				ids = append(ids, encounter.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+
+	query, _ := url.ParseQuery("patient:Group=g1")
+	if _, err := ParseSearch(query, EncounterSearchParams); err == nil {
+		t.Error("ParseSearch() with a type modifier the parameter does not target, want an error")
+	}
+}
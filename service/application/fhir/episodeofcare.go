@@ -0,0 +1,118 @@
+package fhir
+
+// EpisodeOfCareType is the resourceType of EpisodeOfCare
+const EpisodeOfCareType = "EpisodeOfCare"
+
+// EpisodeOfCareLifecycle is the status state machine of episodes of care, with the R4 statuses: a planned or
+// waitlisted episode becomes active or is cancelled, an active one may be put on hold until it finishes
+var EpisodeOfCareLifecycle = Lifecycle{
+	"planned":   {"waitlist", "active", "cancelled"},
+	"waitlist":  {"active", "cancelled"},
+	"active":    {"onhold", "finished"},
+	"onhold":    {"active", "finished"},
+	"finished":  nil,
+	"cancelled": nil,
+}
+
+// EpisodeOfCare is the FHIR R4 EpisodeOfCare resource: the period during which an organization is responsible
+// for the care of a patient for a condition, grouping the encounters of that care
+type EpisodeOfCare struct {
+	Base
+	Identifier           []Identifier                 `json:"identifier,omitempty"`
+	Status               string                       `json:"status,omitempty"`
+	StatusHistory        []EpisodeOfCareStatusHistory `json:"statusHistory,omitempty"`
+	Type                 []CodeableConcept            `json:"type,omitempty"`
+	Diagnosis            []EpisodeOfCareDiagnosis     `json:"diagnosis,omitempty"`
+	Patient              *Reference                   `json:"patient,omitempty"`
+	ManagingOrganization *Reference                   `json:"managingOrganization,omitempty"`
+	Period               *Period                      `json:"period,omitempty"`
+	ReferralRequest      []Reference                  `json:"referralRequest,omitempty"`
+	CareManager          *Reference                   `json:"careManager,omitempty"`
+	Team                 []Reference                  `json:"team,omitempty"`
+	Account              []Reference                  `json:"account,omitempty"`
+}
+
+// EpisodeOfCareStatusHistory is a status the episode had in the past
+type EpisodeOfCareStatusHistory struct {
+	Status string `json:"status"`
+	Period Period `json:"period"`
+}
+
+// EpisodeOfCareDiagnosis is a condition the episode of care is for
+type EpisodeOfCareDiagnosis struct {
+	Condition Reference        `json:"condition"`
+	Role      *CodeableConcept `json:"role,omitempty"`
+	Rank      *int             `json:"rank,omitempty"`
+}
+
+// TypeName returns "EpisodeOfCare"
+func (*EpisodeOfCare) TypeName() string {
+	return EpisodeOfCareType
+}
+
+// GetStatus returns the status of the episode
+func (e *EpisodeOfCare) GetStatus() string {
+	return e.Status
+}
+
+// Lifecycle returns EpisodeOfCareLifecycle
+func (*EpisodeOfCare) Lifecycle() Lifecycle {
+	return EpisodeOfCareLifecycle
+}
+
+// Validate checks the elements of the episode against the R4 definition, the patient being a required reference
+func (e *EpisodeOfCare) Validate() error {
+	outcome := &OperationOutcome{}
+	e.Base.validate(outcome, EpisodeOfCareType)
+
+	for i, identifier := range e.Identifier {
+		validateIdentifier(outcome, indexed("EpisodeOfCare.identifier", i), identifier)
+	}
+	validateStatus(outcome, "EpisodeOfCare.status", e.Status, EpisodeOfCareLifecycle)
+	for i, history := range e.StatusHistory {
+		path := indexed("EpisodeOfCare.statusHistory", i)
+		validateStatus(outcome, path+".status", history.Status, EpisodeOfCareLifecycle)
+		validatePeriod(outcome, path+".period", &history.Period)
+	}
+	for i, diagnosis := range e.Diagnosis {
+		path := indexed("EpisodeOfCare.diagnosis", i)
+		validateReferenceTo(outcome, path+".condition", &diagnosis.Condition, "Condition")
+		if diagnosis.Rank != nil && *diagnosis.Rank < 1 {
+			outcome.Add(IssueValue, path+".rank", "must be a positive integer")
+		}
+	}
+	requireReferenceTo(outcome, "EpisodeOfCare.patient", e.Patient, PatientType)
+	validateReferenceTo(outcome, "EpisodeOfCare.managingOrganization", e.ManagingOrganization, "Organization")
+	validatePeriod(outcome, "EpisodeOfCare.period", e.Period)
+	for i, referral := range e.ReferralRequest {
+		validateReferenceTo(outcome, indexed("EpisodeOfCare.referralRequest", i), &referral, "ServiceRequest")
+	}
+	validateReferenceTo(outcome, "EpisodeOfCare.careManager", e.CareManager, "Practitioner", "PractitionerRole")
+	for i, team := range e.Team {
+		validateReferenceTo(outcome, indexed("EpisodeOfCare.team", i), &team, "CareTeam")
+	}
+	for i, account := range e.Account {
+		validateReferenceTo(outcome, indexed("EpisodeOfCare.account", i), &account, "Account")
+	}
+	return outcome.OrNil()
+}
+
+/* === Search === */
+
+// EpisodeOfCareSearchParams are the search parameters of EpisodeOfCare
+var EpisodeOfCareSearchParams = []SearchParam[*EpisodeOfCare]{
+	TokenParam("_id", func(e *EpisodeOfCare) []Token { return []Token{{Code: e.ID}} }),
+	TokenParam("identifier", func(e *EpisodeOfCare) []Token { return identifierTokens(e.Identifier) }),
+	ReferenceParam("patient", []string{PatientType}, func(e *EpisodeOfCare) []Reference { return optional(e.Patient) }),
+	TokenParam("status", func(e *EpisodeOfCare) []Token {
+		return []Token{{System: "http://hl7.org/fhir/episode-of-care-status", Code: e.Status}}
+	}),
+	TokenParam("type", func(e *EpisodeOfCare) []Token { return conceptTokens(e.Type) }),
+	PeriodParam("date", func(e *EpisodeOfCare) []Period { return optional(e.Period) }),
+	ReferenceParam("care-manager", []string{"Practitioner", "PractitionerRole"}, func(e *EpisodeOfCare) []Reference {
+		return optional(e.CareManager)
+	}),
+	ReferenceParam("organization", []string{"Organization"}, func(e *EpisodeOfCare) []Reference {
+		return optional(e.ManagingOrganization)
+	}),
+}
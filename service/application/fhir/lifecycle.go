@@ -0,0 +1,59 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidTransition is returned when an update moves a resource to a status its lifecycle does not allow
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// Lifecycle is the state machine the status of a resource follows, mapping each status to those it may move to.
+// Statuses without transitions are final.
+type Lifecycle map[string][]string
+
+// Stateful is a resource whose status follows a Lifecycle
+type Stateful interface {
+	Resource
+	// GetStatus returns the status of the resource
+	GetStatus() string
+	// Lifecycle returns the lifecycle of the resource type, it must not read the receiver
+	Lifecycle() Lifecycle
+}
+
+// Valid tells whether status belongs to the lifecycle
+func (l Lifecycle) Valid(status string) bool {
+	_, ok := l[status]
+	return ok
+}
+
+// Statuses lists the statuses of the lifecycle, sorted
+func (l Lifecycle) Statuses() []string {
+	return slices.Sorted(maps.Keys(l))
+}
+
+// Transition checks that a resource may move from status from to status to, keeping its status being always
+// allowed; otherwise the error wraps ErrInvalidTransition
+func (l Lifecycle) Transition(from, to string) error {
+	next := l[from]
+	switch {
+	case from == to || slices.Contains(next, to):
+		return nil
+	case len(next) == 0:
+		return fmt.Errorf("status %s is final, it cannot move to %s: %w", from, to, ErrInvalidTransition)
+	default:
+		return fmt.Errorf("status %s can only move to %s, not to %s: %w", from, strings.Join(next, ", "), to, ErrInvalidTransition)
+	}
+}
+
+// validateStatus checks that status is one of the lifecycle
+func validateStatus(outcome *OperationOutcome, path, status string, lifecycle Lifecycle) {
+	if status == "" {
+		outcome.Add(IssueRequired, path, "is required")
+	} else if !lifecycle.Valid(status) {
+		outcome.Add(IssueCodeInvalid, path, "must be %s, got %q", strings.Join(lifecycle.Statuses(), ", "), status)
+	}
+}
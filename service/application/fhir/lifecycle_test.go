@@ -0,0 +1,67 @@
+package fhir
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLifecycleTransition(t *testing.T) {
+	tests := []struct {
+		lifecycle Lifecycle
+		from      string
+		to        string
+		wantErr   bool
+	}{
+		{lifecycle: EncounterLifecycle, from: "planned", to: "arrived"},
+		{lifecycle: EncounterLifecycle, from: "planned", to: "in-progress"},
+		{lifecycle: EncounterLifecycle, from: "arrived", to: "in-progress"},
+		{lifecycle: EncounterLifecycle, from: "arrived", to: "cancelled"},
+		{lifecycle: EncounterLifecycle, from: "in-progress", to: "finished"},
+		{lifecycle: EncounterLifecycle, from: "finished", to: "finished"},
+		{lifecycle: EncounterLifecycle, from: "planned", to: "finished", wantErr: true},
+		{lifecycle: EncounterLifecycle, from: "in-progress", to: "planned", wantErr: true},
+		{lifecycle: EncounterLifecycle, from: "in-progress", to: "cancelled", wantErr: true},
+		{lifecycle: EncounterLifecycle, from: "finished", to: "in-progress", wantErr: true},
+		{lifecycle: EncounterLifecycle, from: "cancelled", to: "planned", wantErr: true},
+		{lifecycle: EpisodeOfCareLifecycle, from: "active", to: "onhold"},
+		{lifecycle: EpisodeOfCareLifecycle, from: "onhold", to: "active"},
+		{lifecycle: EpisodeOfCareLifecycle, from: "waitlist", to: "finished", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			err := tt.lifecycle.Transition(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("Transition() error = %v, want ErrInvalidTransition", err)
+			}
+		})
+	}
+}
+
+func TestReferenceTarget(t *testing.T) {
+	tests := []struct {
+		reference string
+		wantType  string
+		wantID    string
+	}{
+		{reference: "Patient/123", wantType: "Patient", wantID: "123"},
+		{reference: "Patient/123/_history/2", wantType: "Patient", wantID: "123"},
+		{reference: "https://fhir.example.org/r4/Patient/abc", wantType: "Patient", wantID: "abc"},
+		{reference: "123"},
+		{reference: "fhir/Patient/123"},
+		{reference: "patient/123"},
+		{reference: "#contained"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reference, func(t *testing.T) {
+			resourceType, id, ok := Reference{Reference: tt.reference}.Target()
+			if ok != (tt.wantType != "") || resourceType != tt.wantType || id != tt.wantID {
+				t.Errorf("Target() = %q, %q, %v, want %q, %q", resourceType, id, ok, tt.wantType, tt.wantID)
+			}
+		})
+	}
+}
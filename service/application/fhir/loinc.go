@@ -0,0 +1,94 @@
+package fhir
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LOINCSystem is the code system of LOINC, naming laboratory tests and clinical measurements
+const LOINCSystem = "http://loinc.org"
+
+// Codes of the blood pressure panel and its components, as recorded by the vital signs profile
+const (
+	LOINCBloodPressure = "85354-9"
+	LOINCSystolic      = "8480-6"
+	LOINCDiastolic     = "8462-4"
+)
+
+var loincPattern = regexp.MustCompile(`^(\d{1,7})-(\d)$`)
+
+// loincTerm is a LOINC code whose quantities must be in units commensurable with unit
+type loincTerm struct {
+	display string
+	unit    string
+}
+
+// loincTerms are the vital signs and common laboratory tests recorded in wards
+var loincTerms = map[string]loincTerm{
+	LOINCSystolic:  {display: "Systolic blood pressure", unit: "mm[Hg]"},
+	LOINCDiastolic: {display: "Diastolic blood pressure", unit: "mm[Hg]"},
+	"8867-4":       {display: "Heart rate", unit: "/min"},
+	"9279-1":       {display: "Respiratory rate", unit: "/min"},
+	"8310-5":       {display: "Body temperature", unit: "Cel"},
+	"29463-7":      {display: "Body weight", unit: "kg"},
+	"8302-2":       {display: "Body height", unit: "cm"},
+	"9843-4":       {display: "Head Occipital-frontal circumference", unit: "cm"},
+	"39156-5":      {display: "Body mass index (BMI) [Ratio]", unit: "kg/m2"},
+	"59408-5":      {display: "Oxygen saturation in Arterial blood by Pulse oximetry", unit: "%"},
+	"2708-6":       {display: "Oxygen saturation in Arterial blood", unit: "%"},
+	"2339-0":       {display: "Glucose [Mass/volume] in Blood", unit: "mg/dL"},
+	"2345-7":       {display: "Glucose [Mass/volume] in Serum or Plasma", unit: "mg/dL"},
+	"718-7":        {display: "Hemoglobin [Mass/volume] in Blood", unit: "g/dL"},
+	"4548-4":       {display: "Hemoglobin A1c/Hemoglobin.total in Blood", unit: "%"},
+	"2160-0":       {display: "Creatinine [Mass/volume] in Serum or Plasma", unit: "mg/dL"},
+	"2823-3":       {display: "Potassium [Moles/volume] in Serum or Plasma", unit: "mmol/L"},
+	"2951-2":       {display: "Sodium [Moles/volume] in Serum or Plasma", unit: "mmol/L"},
+	"6690-2":       {display: "Leukocytes [#/volume] in Blood by Automated count", unit: "10*3/uL"},
+}
+
+// ValidateLOINC checks the format and the mod 10 check digit of a LOINC code, such as 8480-6
+func ValidateLOINC(code string) error {
+	match := loincPattern.FindStringSubmatch(code)
+	if match == nil {
+		return fmt.Errorf("must be a LOINC code as digits, '-' and a check digit, got %q", code)
+	}
+	if check := loincCheckDigit(match[1]); int(match[2][0]-'0') != check {
+		return fmt.Errorf("LOINC code %q has check digit %s, expected %d", code, match[2], check)
+	}
+	return nil
+}
+
+// loincCheckDigit computes the mod 10 check digit of the digits of a LOINC code, doubling every other digit from
+// the rightmost one
+func loincCheckDigit(digits string) int {
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+// validateLOINCCodings checks the LOINC codings of concept, returning the known term of the first one
+func validateLOINCCodings(outcome *OperationOutcome, path string, concept CodeableConcept) (loincTerm, bool) {
+	var term loincTerm
+	var known bool
+	for i, coding := range concept.Coding {
+		if coding.System != LOINCSystem {
+			continue
+		}
+		if err := ValidateLOINC(coding.Code); err != nil {
+			outcome.Add(IssueCodeInvalid, indexed(path+".coding", i)+".code", "%v", err)
+			continue
+		}
+		if t, ok := loincTerms[coding.Code]; ok && !known {
+			term, known = t, true
+		}
+	}
+	return term, known
+}
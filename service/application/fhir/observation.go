@@ -0,0 +1,504 @@
+package fhir
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+// ObservationType is the resourceType of Observation
+const ObservationType = "Observation"
+
+// Code systems of observations
+const (
+	ObservationCategorySystem       = "http://terminology.hl7.org/CodeSystem/observation-category"
+	ObservationInterpretationSystem = "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation"
+	ReferenceRangeMeaningSystem     = "http://terminology.hl7.org/CodeSystem/referencerange-meaning"
+)
+
+// ObservationLifecycle is the status state machine of observations: a registered result becomes preliminary or
+// final, a final one may only be amended or corrected, and any result may be marked as entered in error
+var ObservationLifecycle = Lifecycle{
+	"registered":       {"preliminary", "final", "cancelled", "entered-in-error"},
+	"preliminary":      {"final", "cancelled", "entered-in-error"},
+	"final":            {"amended", "corrected", "entered-in-error"},
+	"amended":          {"corrected", "entered-in-error"},
+	"corrected":        {"amended", "entered-in-error"},
+	"cancelled":        {"entered-in-error"},
+	"entered-in-error": nil,
+	"unknown":          {"registered", "preliminary", "final", "amended", "corrected", "cancelled", "entered-in-error"},
+}
+
+// interpretationCodes are the codes of ObservationInterpretationSystem accepted as flags
+var interpretationCodes = map[string]string{
+	"N": "Normal", "A": "Abnormal", "AA": "Critical abnormal",
+	"L": "Low", "LL": "Critical low", "LU": "Significantly low",
+	"H": "High", "HH": "Critical high", "HU": "Significantly high",
+	"<": "Off scale low", ">": "Off scale high",
+	"POS": "Positive", "NEG": "Negative", "IND": "Indeterminate", "DET": "Detected", "ND": "Not detected",
+}
+
+// Observation is the FHIR R4 Observation resource: a measurement such as a vital sign or a laboratory result,
+// made on a patient
+type Observation struct {
+	Base
+	Identifier        []Identifier      `json:"identifier,omitempty"`
+	BasedOn           []Reference       `json:"basedOn,omitempty"`
+	PartOf            []Reference       `json:"partOf,omitempty"`
+	Status            string            `json:"status,omitempty"`
+	Category          []CodeableConcept `json:"category,omitempty"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           *Reference        `json:"subject,omitempty"`
+	Encounter         *Reference        `json:"encounter,omitempty"`
+	EffectiveDateTime string            `json:"effectiveDateTime,omitempty"`
+	EffectivePeriod   *Period           `json:"effectivePeriod,omitempty"`
+	EffectiveInstant  string            `json:"effectiveInstant,omitempty"`
+	Issued            string            `json:"issued,omitempty"`
+	Performer         []Reference       `json:"performer,omitempty"`
+	ObservationValue
+	DataAbsentReason *CodeableConcept            `json:"dataAbsentReason,omitempty"`
+	Interpretation   []CodeableConcept           `json:"interpretation,omitempty"`
+	Note             []Annotation                `json:"note,omitempty"`
+	BodySite         *CodeableConcept            `json:"bodySite,omitempty"`
+	Method           *CodeableConcept            `json:"method,omitempty"`
+	Specimen         *Reference                  `json:"specimen,omitempty"`
+	Device           *Reference                  `json:"device,omitempty"`
+	ReferenceRange   []ObservationReferenceRange `json:"referenceRange,omitempty"`
+	HasMember        []Reference                 `json:"hasMember,omitempty"`
+	DerivedFrom      []Reference                 `json:"derivedFrom,omitempty"`
+	Component        []ObservationComponent      `json:"component,omitempty"`
+}
+
+// ObservationValue is the value[x] of an observation or of its components, at most one being set
+type ObservationValue struct {
+	ValueQuantity        *Quantity        `json:"valueQuantity,omitempty"`
+	ValueCodeableConcept *CodeableConcept `json:"valueCodeableConcept,omitempty"`
+	ValueString          string           `json:"valueString,omitempty"`
+	ValueBoolean         *bool            `json:"valueBoolean,omitempty"`
+	ValueInteger         *int             `json:"valueInteger,omitempty"`
+	ValueRange           *Range           `json:"valueRange,omitempty"`
+	ValueDateTime        string           `json:"valueDateTime,omitempty"`
+	ValuePeriod          *Period          `json:"valuePeriod,omitempty"`
+}
+
+// ObservationReferenceRange is the range of values to interpret an observation against, normal by default
+type ObservationReferenceRange struct {
+	Low       *Quantity         `json:"low,omitempty"`
+	High      *Quantity         `json:"high,omitempty"`
+	Type      *CodeableConcept  `json:"type,omitempty"`
+	AppliesTo []CodeableConcept `json:"appliesTo,omitempty"`
+	Age       *Range            `json:"age,omitempty"`
+	Text      string            `json:"text,omitempty"`
+}
+
+// ObservationComponent is one of the values measured together, such as the systolic and diastolic pressures of
+// a blood pressure reading
+type ObservationComponent struct {
+	Code CodeableConcept `json:"code"`
+	ObservationValue
+	DataAbsentReason *CodeableConcept            `json:"dataAbsentReason,omitempty"`
+	Interpretation   []CodeableConcept           `json:"interpretation,omitempty"`
+	ReferenceRange   []ObservationReferenceRange `json:"referenceRange,omitempty"`
+}
+
+// TypeName returns "Observation"
+func (*Observation) TypeName() string {
+	return ObservationType
+}
+
+// GetStatus returns the status of the observation
+func (o *Observation) GetStatus() string {
+	return o.Status
+}
+
+// Lifecycle returns ObservationLifecycle
+func (*Observation) Lifecycle() Lifecycle {
+	return ObservationLifecycle
+}
+
+// Effective returns the time range the observation was made in, ok being false when it is not given
+func (o *Observation) Effective() (r DateRange, ok bool) {
+	switch {
+	case o.EffectiveDateTime != "":
+		r, err := ParseDateTime(o.EffectiveDateTime)
+		return r, err == nil
+	case o.EffectiveInstant != "":
+		r, err := ParseDateTime(o.EffectiveInstant)
+		return r, err == nil
+	case o.EffectivePeriod != nil:
+		return o.EffectivePeriod.Range()
+	}
+	return DateRange{}, false
+}
+
+// Validate checks the elements of the observation against the R4 definition, the subject being a required
+// reference to a Patient. The quantities of known LOINC codes must be in units commensurable with theirs, and
+// the bounds of the reference ranges in units the value converts to.
+func (o *Observation) Validate() error {
+	outcome := &OperationOutcome{}
+	o.Base.validate(outcome, ObservationType)
+
+	for i, identifier := range o.Identifier {
+		validateIdentifier(outcome, indexed("Observation.identifier", i), identifier)
+	}
+	for i, basedOn := range o.BasedOn {
+		validateReferenceTo(outcome, indexed("Observation.basedOn", i), &basedOn,
+			"CarePlan", "DeviceRequest", "ImmunizationRecommendation", "MedicationRequest", "NutritionOrder", "ServiceRequest")
+	}
+	for i, partOf := range o.PartOf {
+		validateReferenceTo(outcome, indexed("Observation.partOf", i), &partOf,
+			"MedicationAdministration", "MedicationDispense", "MedicationStatement", "Procedure", "Immunization", "ImagingStudy")
+	}
+	validateStatus(outcome, "Observation.status", o.Status, ObservationLifecycle)
+	requireReferenceTo(outcome, "Observation.subject", o.Subject, PatientType)
+	validateReferenceTo(outcome, "Observation.encounter", o.Encounter, EncounterType)
+
+	if o.EffectiveDateTime != "" {
+		if _, err := ParseDateTime(o.EffectiveDateTime); err != nil {
+			outcome.Add(IssueValue, "Observation.effectiveDateTime", "%v", err)
+		}
+	}
+	validatePeriod(outcome, "Observation.effectivePeriod", o.EffectivePeriod)
+	validateInstant(outcome, "Observation.effectiveInstant", o.EffectiveInstant)
+	if countSet(o.EffectiveDateTime != "", o.EffectivePeriod != nil, o.EffectiveInstant != "") > 1 {
+		outcome.Add(IssueInvariant, "Observation.effective[x]", "only one of effectiveDateTime, effectivePeriod and effectiveInstant may be given")
+	}
+	validateInstant(outcome, "Observation.issued", o.Issued)
+	for i, performer := range o.Performer {
+		validateReferenceTo(outcome, indexed("Observation.performer", i), &performer,
+			"Practitioner", "PractitionerRole", "Organization", "CareTeam", "Patient", "RelatedPerson")
+	}
+
+	validateMeasurement(outcome, "Observation", measurement{
+		code: o.Code, value: o.ObservationValue, dataAbsentReason: o.DataAbsentReason,
+		interpretation: o.Interpretation, referenceRange: o.ReferenceRange,
+	})
+	for i, note := range o.Note {
+		validateAnnotation(outcome, indexed("Observation.note", i), note)
+	}
+	validateReferenceTo(outcome, "Observation.specimen", o.Specimen, "Specimen")
+	validateReferenceTo(outcome, "Observation.device", o.Device, "Device", "DeviceMetric")
+	for i, member := range o.HasMember {
+		validateReferenceTo(outcome, indexed("Observation.hasMember", i), &member, ObservationType, "QuestionnaireResponse", "MolecularSequence")
+	}
+	for i, derivedFrom := range o.DerivedFrom {
+		validateReferenceTo(outcome, indexed("Observation.derivedFrom", i), &derivedFrom,
+			ObservationType, "DocumentReference", "ImagingStudy", "Media", "QuestionnaireResponse", "MolecularSequence")
+	}
+	for i, component := range o.Component {
+		validateMeasurement(outcome, indexed("Observation.component", i), measurement{
+			code: component.Code, value: component.ObservationValue, dataAbsentReason: component.DataAbsentReason,
+			interpretation: component.Interpretation, referenceRange: component.ReferenceRange,
+		})
+	}
+	return outcome.OrNil()
+}
+
+// measurement holds the elements an observation shares with its components
+type measurement struct {
+	code             CodeableConcept
+	value            ObservationValue
+	dataAbsentReason *CodeableConcept
+	interpretation   []CodeableConcept
+	referenceRange   []ObservationReferenceRange
+}
+
+// validateMeasurement checks the code, value, interpretation and reference ranges of an observation or component
+func validateMeasurement(outcome *OperationOutcome, path string, m measurement) {
+	if len(m.code.Coding) == 0 && m.code.Text == "" {
+		outcome.Add(IssueRequired, path+".code", "is required, as codings or text")
+	}
+	term, known := validateLOINCCodings(outcome, path+".code", m.code)
+
+	values := m.value.present()
+	if values > 1 {
+		outcome.Add(IssueInvariant, path+".value[x]", "only one value may be given")
+	}
+	if values > 0 && m.dataAbsentReason != nil {
+		outcome.Add(IssueInvariant, path+".dataAbsentReason", "must only be given when there is no value")
+	}
+
+	quantityPath := path + ".valueQuantity"
+	unit, hasUnit := validateQuantity(outcome, quantityPath, m.value.ValueQuantity)
+	if q := m.value.ValueQuantity; q != nil {
+		if q.Value == nil {
+			outcome.Add(IssueRequired, quantityPath+".value", "is required")
+		}
+		if known {
+			expected, _ := ParseUnit(term.unit)
+			switch {
+			case q.System != UCUMSystem || q.Code == "":
+				outcome.Add(IssueValue, quantityPath+".code", "%s must be coded in UCUM (%s), in units such as %s",
+					term.display, UCUMSystem, term.unit)
+			case hasUnit && !unit.Commensurable(expected):
+				outcome.Add(IssueValue, quantityPath+".code", "%s is measured in units commensurable with %s, got %q",
+					term.display, term.unit, q.Code)
+			}
+		}
+	}
+	if r := m.value.ValueRange; r != nil {
+		validateRange(outcome, path+".valueRange", r.Low, r.High)
+	}
+	if m.value.ValueDateTime != "" {
+		if _, err := ParseDateTime(m.value.ValueDateTime); err != nil {
+			outcome.Add(IssueValue, path+".valueDateTime", "%v", err)
+		}
+	}
+	validatePeriod(outcome, path+".valuePeriod", m.value.ValuePeriod)
+
+	for i, interpretation := range m.interpretation {
+		for j, coding := range interpretation.Coding {
+			if _, ok := interpretationCodes[coding.Code]; coding.System == ObservationInterpretationSystem && !ok {
+				outcome.Add(IssueCodeInvalid, indexed(indexed(path+".interpretation", i)+".coding", j)+".code",
+					"unknown interpretation %q", coding.Code)
+			}
+		}
+	}
+
+	for i, referenceRange := range m.referenceRange {
+		rangePath := indexed(path+".referenceRange", i)
+		if referenceRange.Low == nil && referenceRange.High == nil && referenceRange.Text == "" {
+			outcome.Add(IssueInvariant, rangePath, "must have at least a low, a high or a text")
+		}
+		validateRange(outcome, rangePath, referenceRange.Low, referenceRange.High)
+		if !hasUnit {
+			continue
+		}
+		for _, bound := range []struct {
+			name     string
+			quantity *Quantity
+		}{{"low", referenceRange.Low}, {"high", referenceRange.High}} {
+			if bound.quantity == nil || bound.quantity.System != UCUMSystem {
+				continue
+			}
+			if boundUnit, err := ParseUnit(bound.quantity.Code); err == nil && !boundUnit.Commensurable(unit) {
+				outcome.Add(IssueValue, rangePath+"."+bound.name+".code", "must be a unit %s converts to, got %q",
+					unit.Code, bound.quantity.Code)
+			}
+		}
+	}
+}
+
+// validateRange checks the bounds of a range and that low is not above high, converting their units
+func validateRange(outcome *OperationOutcome, path string, low, high *Quantity) {
+	lowUnit, lowUCUM := validateQuantity(outcome, path+".low", low)
+	highUnit, highUCUM := validateQuantity(outcome, path+".high", high)
+	if low == nil || high == nil || low.Value == nil || high.Value == nil {
+		return
+	}
+	lowValue := *low.Value
+	switch {
+	case lowUCUM && highUCUM:
+		converted, err := lowUnit.Convert(lowValue, highUnit)
+		if err != nil {
+			outcome.Add(IssueValue, path, "low and high must have commensurable units: %v", err)
+			return
+		}
+		lowValue = converted
+	case low.Code != high.Code:
+		return
+	}
+	if lowValue > *high.Value {
+		outcome.Add(IssueInvariant, path, "low must not be above high")
+	}
+}
+
+// validateInstant checks an optional instant: a time to the second or finer with its zone
+func validateInstant(outcome *OperationOutcome, path, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := ParseDateTime(value); err != nil || !dateTimePattern.MatchString(value) {
+		outcome.Add(IssueValue, path, "must be an RFC 3339 time with its zone, got %q", value)
+	}
+}
+
+// present counts the values that are set
+func (v ObservationValue) present() int {
+	return countSet(v.ValueQuantity != nil, v.ValueCodeableConcept != nil, v.ValueString != "", v.ValueBoolean != nil,
+		v.ValueInteger != nil, v.ValueRange != nil, v.ValueDateTime != "", v.ValuePeriod != nil)
+}
+
+// countSet counts the elements of a choice that are set
+func countSet(set ...bool) int {
+	n := 0
+	for _, s := range set {
+		if s {
+			n++
+		}
+	}
+	return n
+}
+
+/* === Interpretation === */
+
+// Interpret flags the quantities of the observation and of its components as low (L), high (H) or normal (N)
+// against their normal reference range, converting units, unless they already carry an interpretation
+func (o *Observation) Interpret() {
+	if len(o.Interpretation) == 0 {
+		o.Interpretation = interpret(o.ValueQuantity, o.ReferenceRange)
+	}
+	for i := range o.Component {
+		component := &o.Component[i]
+		if len(component.Interpretation) == 0 {
+			component.Interpretation = interpret(component.ValueQuantity, component.ReferenceRange)
+		}
+	}
+}
+
+// interpret compares value to the first normal range that applies to any patient, returning no flag when there
+// is none or the units cannot be compared
+func interpret(value *Quantity, ranges []ObservationReferenceRange) []CodeableConcept {
+	if value == nil || value.Value == nil || value.Comparator != "" {
+		return nil
+	}
+	for _, referenceRange := range ranges {
+		if !normalRange(referenceRange) || (referenceRange.Low == nil && referenceRange.High == nil) {
+			continue
+		}
+		code := "N"
+		if below, ok := compareQuantity(value, referenceRange.Low); !ok {
+			return nil
+		} else if below < 0 {
+			code = "L"
+		}
+		if above, ok := compareQuantity(value, referenceRange.High); !ok {
+			return nil
+		} else if above > 0 {
+			code = "H"
+		}
+		return []CodeableConcept{{Coding: []Coding{{
+			System: ObservationInterpretationSystem, Code: code, Display: interpretationCodes[code],
+		}}}}
+	}
+	return nil
+}
+
+// normalRange tells whether a reference range is a normal range for every patient
+func normalRange(r ObservationReferenceRange) bool {
+	if len(r.AppliesTo) > 0 || r.Age != nil {
+		return false
+	}
+	if r.Type == nil {
+		return true
+	}
+	for _, coding := range r.Type.Coding {
+		if coding.System == ReferenceRangeMeaningSystem && coding.Code == "normal" {
+			return true
+		}
+	}
+	return false
+}
+
+// compareQuantity compares value to bound in the unit of bound, a missing bound comparing equal; ok is false when
+// the units cannot be compared
+func compareQuantity(value, bound *Quantity) (int, bool) {
+	if bound == nil || bound.Value == nil {
+		return 0, true
+	}
+	v := *value.Value
+	if value.Code != bound.Code || value.System != bound.System {
+		if value.System != UCUMSystem || bound.System != UCUMSystem {
+			return 0, false
+		}
+		converted, err := ConvertUnit(v, value.Code, bound.Code)
+		if err != nil {
+			return 0, false
+		}
+		v = converted
+	}
+	return cmp.Compare(v, *bound.Value), true
+}
+
+/* === Time series === */
+
+// LastN returns the n most recent observations of each code among observations, grouped by code (their first
+// coding, or text) and from the most recent within each code; those without an effective time come last
+func LastN(observations []*Observation, n int) []*Observation {
+	groups := make(map[string][]*Observation)
+	for _, observation := range observations {
+		key := codeKey(observation.Code)
+		groups[key] = append(groups[key], observation)
+	}
+
+	var last []*Observation
+	for _, key := range slices.Sorted(maps.Keys(groups)) {
+		group := groups[key]
+		slices.SortStableFunc(group, func(a, b *Observation) int { return -compareEffective(a, b) })
+		last = append(last, group[:min(n, len(group))]...)
+	}
+	return last
+}
+
+// codeKey identifies the code of an observation by its first coding, or its text
+func codeKey(code CodeableConcept) string {
+	if len(code.Coding) > 0 {
+		return code.Coding[0].System + "|" + code.Coding[0].Code
+	}
+	return code.Text
+}
+
+// compareEffective orders observations by the start of their effective time, those without one first
+func compareEffective(a, b *Observation) int {
+	aRange, aOK := a.Effective()
+	bRange, bOK := b.Effective()
+	switch {
+	case aOK && bOK:
+		return aRange.Start.Compare(bRange.Start)
+	case aOK:
+		return 1
+	case bOK:
+		return -1
+	}
+	return 0
+}
+
+/* === Search === */
+
+// ObservationSearchParams are the search parameters of Observation; with _sort=-date and _count they give the last
+// readings of a patient, with two date parameters those in a time range
+var ObservationSearchParams = []SearchParam[*Observation]{
+	TokenParam("_id", func(o *Observation) []Token { return []Token{{Code: o.ID}} }),
+	TokenParam("identifier", func(o *Observation) []Token { return identifierTokens(o.Identifier) }),
+	ReferenceParam("patient", []string{PatientType}, func(o *Observation) []Reference { return optional(o.Subject) }),
+	ReferenceParam("subject", []string{PatientType}, func(o *Observation) []Reference { return optional(o.Subject) }),
+	ReferenceParam("encounter", []string{EncounterType}, func(o *Observation) []Reference { return optional(o.Encounter) }),
+	ReferenceParam("performer", []string{"Practitioner", "PractitionerRole", "Organization", "CareTeam", "Patient", "RelatedPerson"},
+		func(o *Observation) []Reference { return o.Performer }),
+	TokenParam("status", func(o *Observation) []Token {
+		return []Token{{System: "http://hl7.org/fhir/observation-status", Code: o.Status}}
+	}),
+	TokenParam("category", func(o *Observation) []Token { return conceptTokens(o.Category) }),
+	TokenParam("code", func(o *Observation) []Token { return conceptTokens([]CodeableConcept{o.Code}) }),
+	TokenParam("component-code", func(o *Observation) []Token { return conceptTokens(componentCodes(o)) }),
+	TokenParam("combo-code", func(o *Observation) []Token {
+		return conceptTokens(append([]CodeableConcept{o.Code}, componentCodes(o)...))
+	}),
+	rangeParam("date", func(o *Observation) []DateRange {
+		effective, ok := o.Effective()
+		if !ok {
+			return nil
+		}
+		return []DateRange{effective}
+	}),
+	QuantityParam("value-quantity", func(o *Observation) []Quantity { return optional(o.ValueQuantity) }),
+	QuantityParam("component-value-quantity", func(o *Observation) []Quantity {
+		var quantities []Quantity
+		for _, component := range o.Component {
+			quantities = append(quantities, optional(component.ValueQuantity)...)
+		}
+		return quantities
+	}),
+	TokenParam("value-concept", func(o *Observation) []Token {
+		return conceptTokens(optional(o.ValueCodeableConcept))
+	}),
+}
+
+// componentCodes returns the codes of the components of an observation
+func componentCodes(o *Observation) []CodeableConcept {
+	codes := make([]CodeableConcept, 0, len(o.Component))
+	for _, component := range o.Component {
+		codes = append(codes, component.Code)
+	}
+	return codes
+}
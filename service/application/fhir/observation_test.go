@@ -0,0 +1,239 @@
+package fhir
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDecodeObservation(t *testing.T) {
+	const vitalSigns = `"category":[{"coding":[{"system":"http://terminology.hl7.org/CodeSystem/observation-category","code":"vital-signs"}]}]`
+	tests := []struct {
+		name           string
+		body           string
+		wantExpression string
+	}{
+		{
+			name: "blood pressure panel",
+			body: `{"resourceType":"Observation","status":"final",` + vitalSigns + `,
+				"code":{"coding":[{"system":"http://loinc.org","code":"85354-9"}]},"subject":{"reference":"Patient/p1"},
+				"effectiveDateTime":"2024-05-01T08:00:00+02:00",
+				"component":[
+					{"code":{"coding":[{"system":"http://loinc.org","code":"8480-6"}]},"valueQuantity":{"value":128,"unit":"mmHg","system":"http://unitsofmeasure.org","code":"mm[Hg]"}},
+					{"code":{"coding":[{"system":"http://loinc.org","code":"8462-4"}]},"valueQuantity":{"value":84,"unit":"mmHg","system":"http://unitsofmeasure.org","code":"mm[Hg]"}}]}`,
+		},
+		{
+			name: "weight in pounds",
+			body: `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"29463-7"}]},
+				"subject":{"reference":"Patient/p1"},"valueQuantity":{"value":154,"system":"http://unitsofmeasure.org","code":"[lb_av]"}}`,
+		},
+		{
+			name: "invalid LOINC check digit",
+			body: `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"8867-5"}]},
+				"subject":{"reference":"Patient/p1"}}`,
+			wantExpression: "Observation.code.coding[0].code",
+		},
+		{
+			name: "unit of another dimension",
+			body: `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"8310-5"}]},
+				"subject":{"reference":"Patient/p1"},"valueQuantity":{"value":37,"system":"http://unitsofmeasure.org","code":"kg"}}`,
+			wantExpression: "Observation.valueQuantity.code",
+		},
+		{
+			name: "vital sign without UCUM unit",
+			body: `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"8867-4"}]},
+				"subject":{"reference":"Patient/p1"},"valueQuantity":{"value":72,"unit":"bpm"}}`,
+			wantExpression: "Observation.valueQuantity.code",
+		},
+		{
+			name: "component unit of another dimension",
+			body: `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"85354-9"}]},
+				"subject":{"reference":"Patient/p1"},
+				"component":[{"code":{"coding":[{"system":"http://loinc.org","code":"8480-6"}]},"valueQuantity":{"value":128,"system":"http://unitsofmeasure.org","code":"/min"}}]}`,
+			wantExpression: "Observation.component[0].valueQuantity.code",
+		},
+		{
+			name: "unknown UCUM unit",
+			body: `{"resourceType":"Observation","status":"final","code":{"text":"Weight"},"subject":{"reference":"Patient/p1"},
+				"valueQuantity":{"value":11,"system":"http://unitsofmeasure.org","code":"stone"}}`,
+			wantExpression: "Observation.valueQuantity.code",
+		},
+		{
+			name: "reference range in another dimension",
+			body: `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"2339-0"}]},
+				"subject":{"reference":"Patient/p1"},"valueQuantity":{"value":90,"system":"http://unitsofmeasure.org","code":"mg/dL"},
+				"referenceRange":[{"low":{"value":3.9,"system":"http://unitsofmeasure.org","code":"mmol/L"}}]}`,
+			wantExpression: "Observation.referenceRange[0].low.code",
+		},
+		{
+			name: "reference range low above high",
+			body: `{"resourceType":"Observation","status":"final","code":{"text":"Glucose"},"subject":{"reference":"Patient/p1"},
+				"referenceRange":[{"low":{"value":1,"system":"http://unitsofmeasure.org","code":"g/L"},"high":{"value":99,"system":"http://unitsofmeasure.org","code":"mg/dL"}}]}`,
+			wantExpression: "Observation.referenceRange[0]",
+		},
+		{
+			name: "value and data absent reason",
+			body: `{"resourceType":"Observation","status":"final","code":{"text":"Pain"},"subject":{"reference":"Patient/p1"},
+				"valueInteger":3,"dataAbsentReason":{"text":"asked"}}`,
+			wantExpression: "Observation.dataAbsentReason",
+		},
+		{
+			name: "two effective times",
+			body: `{"resourceType":"Observation","status":"final","code":{"text":"Pain"},"subject":{"reference":"Patient/p1"},
+				"effectiveDateTime":"2024-05-01","effectiveInstant":"2024-05-01T08:00:00Z"}`,
+			wantExpression: "Observation.effective[x]",
+		},
+		{
+			name:           "issued without time",
+			body:           `{"resourceType":"Observation","status":"final","code":{"text":"Pain"},"subject":{"reference":"Patient/p1"},"issued":"2024-05-01"}`,
+			wantExpression: "Observation.issued",
+		},
+		{
+			name: "unknown interpretation",
+			body: `{"resourceType":"Observation","status":"final","code":{"text":"Pain"},"subject":{"reference":"Patient/p1"},
+				"interpretation":[{"coding":[{"system":"http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation","code":"HIGH"}]}]}`,
+			wantExpression: "Observation.interpretation[0].coding[0].code",
+		},
+		{name: "missing code", body: `{"resourceType":"Observation","status":"final","subject":{"reference":"Patient/p1"}}`,
+			wantExpression: "Observation.code"},
+		{name: "unknown status", body: `{"resourceType":"Observation","status":"done","code":{"text":"Pain"},"subject":{"reference":"Patient/p1"}}`,
+			wantExpression: "Observation.status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode[Observation](strings.NewReader(tt.body))
+			if tt.wantExpression == "" {
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				return
+			}
+
+			var outcome *OperationOutcome
+			if !errors.As(err, &outcome) {
+				t.Fatalf("Decode() error = %v, want an OperationOutcome", err)
+			}
+			for _, issue := range outcome.Issue {
+				if len(issue.Expression) > 0 && issue.Expression[0] == tt.wantExpression {
+					return
+				}
+			}
+			t.Errorf("Decode() issues = %+v, want one at %s", outcome.Issue, tt.wantExpression)
+		})
+	}
+}
+
+func ucum(value float64, code string) *Quantity {
+	return &Quantity{Value: &value, System: UCUMSystem, Code: code}
+}
+
+func TestObservationInterpret(t *testing.T) {
+	normal := []ObservationReferenceRange{{Low: ucum(70, "mg/dL"), High: ucum(99, "mg/dL")}}
+	tests := []struct {
+		name   string
+		value  *Quantity
+		ranges []ObservationReferenceRange
+		want   string
+	}{
+		{name: "normal", value: ucum(90, "mg/dL"), ranges: normal, want: "N"},
+		{name: "high", value: ucum(126, "mg/dL"), ranges: normal, want: "H"},
+		{name: "low after conversion", value: ucum(0.6, "g/L"), ranges: normal, want: "L"},
+		{name: "only a high bound", value: ucum(38.5, "Cel"), ranges: []ObservationReferenceRange{{High: ucum(37.5, "Cel")}}, want: "H"},
+		{name: "no range", value: ucum(90, "mg/dL")},
+		{name: "range of a population", value: ucum(126, "mg/dL"),
+			ranges: []ObservationReferenceRange{{Low: ucum(70, "mg/dL"), High: ucum(99, "mg/dL"), Age: &Range{Low: ucum(65, "a")}}}},
+		{name: "incommensurable units", value: ucum(5, "mmol/L"), ranges: normal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observation := Observation{ObservationValue: ObservationValue{ValueQuantity: tt.value}, ReferenceRange: tt.ranges}
+			observation.Interpret()
+			var got string
+			if len(observation.Interpretation) > 0 {
+				got = observation.Interpretation[0].Coding[0].Code
+			}
+			if got != tt.want {
+				t.Errorf("Interpret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func searchObservations() []*Observation {
+	reading := func(id, code, effective string, value *Quantity) *Observation {
+		return &Observation{
+			Base:              Base{ResourceType: ObservationType, ID: id},
+			Status:            "final",
+			Code:              CodeableConcept{Coding: []Coding{{System: LOINCSystem, Code: code}}},
+			Subject:           &Reference{Reference: "Patient/p1"},
+			EffectiveDateTime: effective,
+			ObservationValue:  ObservationValue{ValueQuantity: value},
+		}
+	}
+	bloodPressure := func(id, effective string, systolic float64) *Observation {
+		observation := reading(id, LOINCBloodPressure, effective, nil)
+		observation.Component = []ObservationComponent{
+			{Code: CodeableConcept{Coding: []Coding{{System: LOINCSystem, Code: LOINCSystolic}}}, ObservationValue: ObservationValue{ValueQuantity: ucum(systolic, "mm[Hg]")}},
+		}
+		return observation
+	}
+	return []*Observation{
+		reading("w1", "29463-7", "2024-05-01T08:00:00Z", ucum(70.5, "kg")),
+		reading("w2", "29463-7", "2024-05-08T08:00:00Z", ucum(158, "[lb_av]")),
+		bloodPressure("bp1", "2024-05-01T08:00:00Z", 120),
+		bloodPressure("bp2", "2024-05-02T08:00:00Z", 145),
+		bloodPressure("bp3", "2024-05-03T08:00:00Z", 130),
+	}
+}
+
+func TestSearchObservations(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "by code", query: "code=" + url.QueryEscape(LOINCSystem+"|29463-7"), want: []string{"w1", "w2"}},
+		{name: "last readings", query: "code=" + LOINCBloodPressure + "&_sort=-date&_count=2", want: []string{"bp3", "bp2"}},
+		{name: "between dates", query: "date=ge2024-05-02&date=lt2024-05-08", want: []string{"bp2", "bp3"}},
+		{name: "quantity converted to the searched unit", query: "value-quantity=" + url.QueryEscape("gt70|"+UCUMSystem+"|kg"), want: []string{"w1", "w2"}},
+		{name: "quantity in another unit", query: "value-quantity=" + url.QueryEscape("ge156|"+UCUMSystem+"|[lb_av]"), want: []string{"w2"}},
+		{name: "quantity within precision", query: "value-quantity=70.5", want: []string{"w1"}},
+		{name: "component quantity", query: "component-code=" + LOINCSystolic + "&component-value-quantity=ge140", want: []string{"bp2"}},
+		{name: "combo code", query: "combo-code=" + LOINCSystolic, want: []string{"bp1", "bp2", "bp3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			search, err := ParseSearch(query, ObservationSearchParams)
+			if err != nil {
+				t.Fatalf("ParseSearch() error = %v", err)
+			}
+			page, _, err := search.Page(seqOf(searchObservations()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, observation := range page {
+				ids = append(ids, observation.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastN(t *testing.T) {
+	var ids []string
+	for _, observation := range LastN(searchObservations(), 2) {
+		ids = append(ids, observation.ID)
+	}
+	if want := []string{"w2", "w1", "bp3", "bp2"}; !slices.Equal(ids, want) {
+		t.Errorf("LastN() = %v, want %v", ids, want)
+	}
+}
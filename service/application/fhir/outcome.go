@@ -0,0 +1,95 @@
+package fhir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IssueSeverity tells how serious an issue is
+type IssueSeverity string
+
+const (
+	SeverityFatal       IssueSeverity = "fatal"
+	SeverityError       IssueSeverity = "error"
+	SeverityWarning     IssueSeverity = "warning"
+	SeverityInformation IssueSeverity = "information"
+)
+
+// IssueType is the code of an issue, from the FHIR issue-type value set
+type IssueType string
+
+const (
+	IssueInvalid      IssueType = "invalid"
+	IssueStructure    IssueType = "structure"
+	IssueRequired     IssueType = "required"
+	IssueValue        IssueType = "value"
+	IssueInvariant    IssueType = "invariant"
+	IssueBusinessRule IssueType = "business-rule"
+	IssueCodeInvalid  IssueType = "code-invalid"
+	IssueSecurity     IssueType = "security"
+	IssueNotSupported IssueType = "not-supported"
+	IssueNotFound     IssueType = "not-found"
+	IssueDeleted      IssueType = "deleted"
+	IssueConflict     IssueType = "conflict"
+	IssueTooLong      IssueType = "too-long"
+	IssueProcessing   IssueType = "processing"
+	IssueTransient    IssueType = "transient"
+	IssueException    IssueType = "exception"
+)
+
+// Issue is one error, warning or information about an interaction
+type Issue struct {
+	Severity    IssueSeverity `json:"severity"`
+	Code        IssueType     `json:"code"`
+	Diagnostics string        `json:"diagnostics,omitempty"`
+	Expression  []string      `json:"expression,omitempty"`
+}
+
+// OperationOutcome is the FHIR error body, it also serves as the error collecting the issues of a validation
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+// NewOperationOutcome returns an outcome with a single issue, expression locating it when given
+func NewOperationOutcome(severity IssueSeverity, code IssueType, diagnostics string, expression ...string) *OperationOutcome {
+	return &OperationOutcome{ResourceType: "OperationOutcome", Issue: []Issue{{
+		Severity:    severity,
+		Code:        code,
+		Diagnostics: diagnostics,
+		Expression:  expression,
+	}}}
+}
+
+// Add appends an error issue on the element at expression, which may be empty
+func (o *OperationOutcome) Add(code IssueType, expression, format string, args ...any) {
+	o.ResourceType = "OperationOutcome"
+	issue := Issue{Severity: SeverityError, Code: code, Diagnostics: fmt.Sprintf(format, args...)}
+	if expression != "" {
+		issue.Expression = []string{expression}
+		issue.Diagnostics = expression + " " + issue.Diagnostics
+	}
+	o.Issue = append(o.Issue, issue)
+}
+
+// OrNil returns the outcome when it holds issues, nil otherwise, so it can be returned as an error
+func (o *OperationOutcome) OrNil() error {
+	if o == nil || len(o.Issue) == 0 {
+		return nil
+	}
+	return o
+}
+
+func (o *OperationOutcome) Error() string {
+	diagnostics := make([]string, 0, len(o.Issue))
+	for _, issue := range o.Issue {
+		diagnostics = append(diagnostics, issue.Diagnostics)
+	}
+	return "invalid resource: " + strings.Join(diagnostics, "; ")
+}
+
+// indexed returns the FHIRPath of the i-th repetition of the element at path
+func indexed(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,245 @@
+package fhir
+
+// PatientType is the resourceType of Patient
+const PatientType = "Patient"
+
+// Patient is the FHIR R4 Patient resource: demographics of a person receiving care
+type Patient struct {
+	Base
+	Identifier           []Identifier           `json:"identifier,omitempty"`
+	Active               *bool                  `json:"active,omitempty"`
+	Name                 []HumanName            `json:"name,omitempty"`
+	Telecom              []ContactPoint         `json:"telecom,omitempty"`
+	Gender               string                 `json:"gender,omitempty"`
+	BirthDate            string                 `json:"birthDate,omitempty"`
+	DeceasedBoolean      *bool                  `json:"deceasedBoolean,omitempty"`
+	DeceasedDateTime     string                 `json:"deceasedDateTime,omitempty"`
+	Address              []Address              `json:"address,omitempty"`
+	MaritalStatus        *CodeableConcept       `json:"maritalStatus,omitempty"`
+	MultipleBirthBoolean *bool                  `json:"multipleBirthBoolean,omitempty"`
+	MultipleBirthInteger *int                   `json:"multipleBirthInteger,omitempty"`
+	Photo                []Attachment           `json:"photo,omitempty"`
+	Contact              []PatientContact       `json:"contact,omitempty"`
+	Communication        []PatientCommunication `json:"communication,omitempty"`
+	GeneralPractitioner  []Reference            `json:"generalPractitioner,omitempty"`
+	ManagingOrganization *Reference             `json:"managingOrganization,omitempty"`
+	Link                 []PatientLink          `json:"link,omitempty"`
+}
+
+// PatientContact is a guardian, partner or other contact of the patient
+type PatientContact struct {
+	Relationship []CodeableConcept `json:"relationship,omitempty"`
+	Name         *HumanName        `json:"name,omitempty"`
+	Telecom      []ContactPoint    `json:"telecom,omitempty"`
+	Address      *Address          `json:"address,omitempty"`
+	Gender       string            `json:"gender,omitempty"`
+	Organization *Reference        `json:"organization,omitempty"`
+	Period       *Period           `json:"period,omitempty"`
+}
+
+// PatientCommunication is a language the patient can be spoken to in
+type PatientCommunication struct {
+	Language  CodeableConcept `json:"language"`
+	Preferred *bool           `json:"preferred,omitempty"`
+}
+
+// PatientLink links the patient to another record of the same person
+type PatientLink struct {
+	Other Reference `json:"other"`
+	Type  string    `json:"type"`
+}
+
+// TypeName returns "Patient"
+func (*Patient) TypeName() string {
+	return PatientType
+}
+
+// Validate checks the elements of the patient against the R4 definition and the codice fiscale identifiers
+func (p *Patient) Validate() error {
+	outcome := &OperationOutcome{}
+	p.Base.validate(outcome, PatientType)
+
+	for i, identifier := range p.Identifier {
+		path := indexed("Patient.identifier", i)
+		validateIdentifier(outcome, path, identifier)
+		if identifier.System == CodiceFiscaleSystem && identifier.Value != "" {
+			if err := ValidateCodiceFiscale(identifier.Value); err != nil {
+				outcome.Add(IssueValue, path+".value", "%v", err)
+			}
+		}
+	}
+	for i, name := range p.Name {
+		validateHumanName(outcome, indexed("Patient.name", i), name)
+	}
+	for i, telecom := range p.Telecom {
+		validateContactPoint(outcome, indexed("Patient.telecom", i), telecom)
+	}
+	validateGender(outcome, "Patient.gender", p.Gender)
+	if p.BirthDate != "" {
+		if _, err := ParseDate(p.BirthDate); err != nil {
+			outcome.Add(IssueValue, "Patient.birthDate", "%v", err)
+		}
+	}
+	if p.DeceasedBoolean != nil && p.DeceasedDateTime != "" {
+		outcome.Add(IssueInvariant, "Patient.deceased", "must be either deceasedBoolean or deceasedDateTime")
+	}
+	if p.DeceasedDateTime != "" {
+		if _, err := ParseDateTime(p.DeceasedDateTime); err != nil {
+			outcome.Add(IssueValue, "Patient.deceasedDateTime", "%v", err)
+		}
+	}
+	for i, address := range p.Address {
+		validateAddress(outcome, indexed("Patient.address", i), address)
+	}
+	if p.MultipleBirthBoolean != nil && p.MultipleBirthInteger != nil {
+		outcome.Add(IssueInvariant, "Patient.multipleBirth", "must be either multipleBirthBoolean or multipleBirthInteger")
+	}
+	for i, contact := range p.Contact {
+		validateContact(outcome, indexed("Patient.contact", i), contact)
+	}
+	for i, communication := range p.Communication {
+		if len(communication.Language.Coding) == 0 && communication.Language.Text == "" {
+			outcome.Add(IssueRequired, indexed("Patient.communication", i)+".language", "is required")
+		}
+	}
+	for i, practitioner := range p.GeneralPractitioner {
+		validateReference(outcome, indexed("Patient.generalPractitioner", i), &practitioner)
+	}
+	validateReference(outcome, "Patient.managingOrganization", p.ManagingOrganization)
+	for i, link := range p.Link {
+		path := indexed("Patient.link", i)
+		validateReference(outcome, path+".other", &link.Other)
+		if !oneOf(link.Type, "replaced-by", "replaces", "refer", "seealso") {
+			outcome.Add(IssueCodeInvalid, path+".type", "unknown link type %q", link.Type)
+		}
+	}
+	return outcome.OrNil()
+}
+
+func validateGender(outcome *OperationOutcome, path, gender string) {
+	if !oneOf(gender, "", "male", "female", "other", "unknown") {
+		outcome.Add(IssueCodeInvalid, path, "must be male, female, other or unknown, got %q", gender)
+	}
+}
+
+func validateHumanName(outcome *OperationOutcome, path string, name HumanName) {
+	if !oneOf(name.Use, "", "usual", "official", "temp", "nickname", "anonymous", "old", "maiden") {
+		outcome.Add(IssueCodeInvalid, path+".use", "unknown name use %q", name.Use)
+	}
+	validatePeriod(outcome, path+".period", name.Period)
+}
+
+func validateContactPoint(outcome *OperationOutcome, path string, telecom ContactPoint) {
+	if !oneOf(telecom.System, "", "phone", "fax", "email", "pager", "url", "sms", "other") {
+		outcome.Add(IssueCodeInvalid, path+".system", "unknown contact point system %q", telecom.System)
+	}
+	if telecom.Value != "" && telecom.System == "" {
+		outcome.Add(IssueInvariant, path+".system", "is required when a value is given")
+	}
+	if !oneOf(telecom.Use, "", "home", "work", "temp", "old", "mobile") {
+		outcome.Add(IssueCodeInvalid, path+".use", "unknown contact point use %q", telecom.Use)
+	}
+	if telecom.Rank != nil && *telecom.Rank < 1 {
+		outcome.Add(IssueValue, path+".rank", "must be a positive integer")
+	}
+	validatePeriod(outcome, path+".period", telecom.Period)
+}
+
+func validateAddress(outcome *OperationOutcome, path string, address Address) {
+	if !oneOf(address.Use, "", "home", "work", "temp", "old", "billing") {
+		outcome.Add(IssueCodeInvalid, path+".use", "unknown address use %q", address.Use)
+	}
+	if !oneOf(address.Type, "", "postal", "physical", "both") {
+		outcome.Add(IssueCodeInvalid, path+".type", "unknown address type %q", address.Type)
+	}
+	validatePeriod(outcome, path+".period", address.Period)
+}
+
+func validateContact(outcome *OperationOutcome, path string, contact PatientContact) {
+	if contact.Name == nil && len(contact.Telecom) == 0 && contact.Address == nil && contact.Organization == nil {
+		outcome.Add(IssueInvariant, path, "must have a name, telecom, address or organization")
+	}
+	if contact.Name != nil {
+		validateHumanName(outcome, path+".name", *contact.Name)
+	}
+	for i, telecom := range contact.Telecom {
+		validateContactPoint(outcome, indexed(path+".telecom", i), telecom)
+	}
+	if contact.Address != nil {
+		validateAddress(outcome, path+".address", *contact.Address)
+	}
+	validateGender(outcome, path+".gender", contact.Gender)
+	validateReference(outcome, path+".organization", contact.Organization)
+	validatePeriod(outcome, path+".period", contact.Period)
+}
+
+/* === Search === */
+
+// PatientSearchParams are the search parameters of Patient
+var PatientSearchParams = []SearchParam[*Patient]{
+	TokenParam("_id", func(p *Patient) []Token { return []Token{{Code: p.ID}} }),
+	TokenParam("identifier", func(p *Patient) []Token { return identifierTokens(p.Identifier) }),
+	StringParam("name", func(p *Patient) []string {
+		var names []string
+		for _, name := range p.Name {
+			names = append(names, name.Text, name.Family)
+			names = append(names, name.Given...)
+			names = append(names, name.Prefix...)
+			names = append(names, name.Suffix...)
+		}
+		return names
+	}),
+	StringParam("family", func(p *Patient) []string {
+		families := make([]string, 0, len(p.Name))
+		for _, name := range p.Name {
+			families = append(families, name.Family)
+		}
+		return families
+	}),
+	StringParam("given", func(p *Patient) []string {
+		var given []string
+		for _, name := range p.Name {
+			given = append(given, name.Given...)
+		}
+		return given
+	}),
+	DateParam("birthdate", func(p *Patient) []string { return []string{p.BirthDate} }),
+	TokenParam("gender", func(p *Patient) []Token {
+		return []Token{{System: "http://hl7.org/fhir/administrative-gender", Code: p.Gender}}
+	}),
+	codiceFiscaleParam,
+}
+
+// codiceFiscaleParam matches the codici fiscali of the patients in any writing, indexing them normalized
+var codiceFiscaleParam = SearchParam[*Patient]{
+	Name: "codice-fiscale",
+	Parse: func(modifier, value string) (func(*Patient) bool, error) {
+		if modifier != "" {
+			return nil, errUnsupportedModifier(modifier)
+		}
+		code := NormalizeCodiceFiscale(value)
+		return func(p *Patient) bool {
+			for _, identifier := range p.Identifier {
+				if identifier.System == CodiceFiscaleSystem && NormalizeCodiceFiscale(identifier.Value) == code {
+					return true
+				}
+			}
+			return false
+		}, nil
+	},
+	Index: codiceFiscaleEntries,
+	Term: func(modifier, value string) (IndexTerm, bool) {
+		return IndexTerm{Param: "codice-fiscale", Token: Token{System: CodiceFiscaleSystem, Code: NormalizeCodiceFiscale(value)}, Exact: true}, modifier == ""
+	},
+}
+
+// codiceFiscaleEntries indexes the codici fiscali of p normalized, as the codice-fiscale parameter matches them
+func codiceFiscaleEntries(p *Patient) []IndexEntry {
+	var entries []IndexEntry
+	for _, identifier := range p.Identifier {
+		if identifier.System == CodiceFiscaleSystem {
+			entries = append(entries, IndexEntry{Param: "codice-fiscale", Token: Token{System: CodiceFiscaleSystem, Code: NormalizeCodiceFiscale(identifier.Value)}})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,104 @@
+package fhir
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodePatient(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		wantExpression string
+		wantErr        bool
+	}{
+		{
+			name: "valid",
+			body: `{"resourceType":"Patient","identifier":[{"system":"http://hl7.it/sid/codiceFiscale","value":"RSSMRA85T10A562S"}],
+				"name":[{"family":"Rossi","given":["Mario"]}],"gender":"male","birthDate":"1985-12-10",
+				"telecom":[{"system":"phone","value":"+39 0541 123456","use":"home"}],
+				"extension":[{"url":"http://example.org/ext","valueString":"x"}]}`,
+		},
+		{name: "partial birth date", body: `{"resourceType":"Patient","birthDate":"1985-12"}`},
+		{name: "wrong resource type", body: `{"resourceType":"Observation"}`, wantExpression: "Patient.resourceType", wantErr: true},
+		{name: "unknown element", body: `{"resourceType":"Patient","nickname":"Super Mario"}`, wantErr: true},
+		{name: "wrong JSON type", body: `{"resourceType":"Patient","gender":1}`, wantExpression: "Patient.gender", wantErr: true},
+		{name: "invalid gender", body: `{"resourceType":"Patient","gender":"M"}`, wantExpression: "Patient.gender", wantErr: true},
+		{name: "invalid birth date", body: `{"resourceType":"Patient","birthDate":"10/12/1985"}`, wantExpression: "Patient.birthDate", wantErr: true},
+		{
+			name:           "invalid codice fiscale",
+			body:           `{"resourceType":"Patient","identifier":[{"system":"http://hl7.it/sid/codiceFiscale","value":"RSSMRA85T10A562X"}]}`,
+			wantExpression: "Patient.identifier[0].value",
+			wantErr:        true,
+		},
+		{
+			name:           "both deceased elements",
+			body:           `{"resourceType":"Patient","deceasedBoolean":true,"deceasedDateTime":"2020-01-01"}`,
+			wantExpression: "Patient.deceased",
+			wantErr:        true,
+		},
+		{name: "telecom without system", body: `{"resourceType":"Patient","telecom":[{"value":"123"}]}`, wantExpression: "Patient.telecom[0].system", wantErr: true},
+		{name: "extension without url", body: `{"resourceType":"Patient","extension":[{"valueString":"x"}]}`, wantExpression: "Patient.extension[0].url", wantErr: true},
+		{name: "empty contact", body: `{"resourceType":"Patient","contact":[{"gender":"female"}]}`, wantExpression: "Patient.contact[0]", wantErr: true},
+		{name: "trailing data", body: `{"resourceType":"Patient"} {}`, wantErr: true},
+		{name: "empty body", body: ``, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patient, err := Decode[Patient](strings.NewReader(tt.body))
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				if patient.ResourceType != PatientType {
+					t.Errorf("Decode() = %+v", patient)
+				}
+				return
+			}
+
+			var outcome *OperationOutcome
+			if !errors.As(err, &outcome) {
+				t.Fatalf("Decode() error = %v, want an OperationOutcome", err)
+			}
+			if tt.wantExpression == "" {
+				return
+			}
+			for _, issue := range outcome.Issue {
+				if len(issue.Expression) > 0 && issue.Expression[0] == tt.wantExpression {
+					return
+				}
+			}
+			t.Errorf("Decode() issues = %+v, want one at %s", outcome.Issue, tt.wantExpression)
+		})
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "1985", want: "1985-01-01T00:00:00Z/1986-01-01T00:00:00Z"},
+		{value: "1985-02", want: "1985-02-01T00:00:00Z/1985-03-01T00:00:00Z"},
+		{value: "1985-12-31", want: "1985-12-31T00:00:00Z/1986-01-01T00:00:00Z"},
+		{value: "2024-05-01T10:30:00+02:00", want: "2024-05-01T10:30:00+02:00/2024-05-01T10:30:01+02:00"},
+		{value: "1985-02-30", wantErr: true},
+		{value: "2024-05-01T10:30:00", wantErr: true},
+		{value: "85", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDateTime(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDateTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Start.Format("2006-01-02T15:04:05Z07:00")+"/"+got.End.Format("2006-01-02T15:04:05Z07:00") != tt.want {
+				t.Errorf("ParseDateTime() = %v/%v, want %s", got.Start, got.End, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package fhir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repository stores the versions of the resources of one type. Every create, update and delete adds a version,
+// numbered from "1" in meta.versionId and stamped in meta.lastUpdated; the resources passed in are not modified.
+type Repository[T Resource] interface {
+	// Create stores resource under a new id as version 1, ignoring the id and meta it has
+	Create(ctx context.Context, resource T) (T, error)
+	// Read returns the current version, ErrNotFound when the id is unknown and ErrDeleted when it was deleted
+	Read(ctx context.Context, id string) (T, error)
+	// VRead returns a version of the resource, ErrDeleted when it is the version recording the deletion
+	VRead(ctx context.Context, id, versionID string) (T, error)
+	// Update stores resource as the next version of its id, creating it when the id is unknown (created is then
+	// true). A non-empty ifMatch must be the current version, otherwise ErrVersionConflict is returned.
+	Update(ctx context.Context, resource T, ifMatch string) (updated T, created bool, err error)
+	// Delete records the deletion of the resource as a new version, deleting it again does nothing
+	Delete(ctx context.Context, id string) error
+	// Search iterates over the current versions of the resources that are not deleted and that match. The
+	// conditions, which every match satisfies, let the stores indexing the search parameters read only candidates.
+	Search(ctx context.Context, match func(T) bool, conditions ...IndexCondition) iter.Seq2[T, error]
+	// Page returns the page of the current versions selected by search and how many matched, as Search.Page does
+	Page(ctx context.Context, search Search[T]) (page []T, total int, err error)
+}
+
+// Clone returns a deep copy of resource, T being a pointer type
+func Clone[T Resource](resource T) (T, error) {
+	var clone T
+	encoded, err := json.Marshal(resource)
+	if err != nil {
+		return clone, err
+	}
+	err = json.Unmarshal(encoded, &clone)
+	return clone, err
+}
+
+// SetVersion stamps resource with its id, version and update time, as repositories do on every write
+func SetVersion(resource Resource, id string, version int, lastUpdated time.Time) {
+	base := resource.GetBase()
+	base.ID = id
+	if base.Meta == nil {
+		base.Meta = &Meta{}
+	}
+	lastUpdated = lastUpdated.UTC()
+	base.Meta.VersionID = strconv.Itoa(version)
+	base.Meta.LastUpdated = &lastUpdated
+}
+
+// Decode reads a resource in FHIR JSON and validates it. Unknown elements, trailing data and a resourceType
+// other than the one of T are rejected with an *OperationOutcome, as are the issues found by Validate.
+func Decode[T any, PT interface {
+	*T
+	Resource
+}](r io.Reader) (PT, error) {
+	resource := PT(new(T))
+	typeName := resource.TypeName()
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(resource); err != nil {
+		return nil, decodeError(typeName, err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, NewOperationOutcome(SeverityError, IssueStructure, "the body must hold a single "+typeName)
+	}
+	if err := resource.Validate(); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// decodeError turns a JSON decoding error into an outcome locating the offending element when possible. Errors
+// reading the body, such as a body over the size limit, are returned as they are.
+func decodeError(typeName string, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		path := typeName
+		if typeErr.Field != "" {
+			path += "." + typeErr.Field
+		}
+		return NewOperationOutcome(SeverityError, IssueStructure, fmt.Sprintf("%s must not be a JSON %s", path, typeErr.Value), path)
+	case errors.As(err, &syntaxErr):
+		return NewOperationOutcome(SeverityError, IssueStructure, fmt.Sprintf("invalid JSON at offset %d: %v", syntaxErr.Offset, err))
+	case errors.Is(err, io.EOF):
+		return NewOperationOutcome(SeverityError, IssueRequired, "the body must hold a "+typeName)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewOperationOutcome(SeverityError, IssueStructure, "the body ends before the "+typeName+" does")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return NewOperationOutcome(SeverityError, IssueStructure, fmt.Sprintf("unknown element %q", field))
+	case strings.HasPrefix(err.Error(), "json: "):
+		return NewOperationOutcome(SeverityError, IssueStructure, err.Error())
+	default:
+		return err
+	}
+}
@@ -0,0 +1,386 @@
+package fhir
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"mime"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Errors returned by repositories, the controllers map them to HTTP statuses
+var (
+	ErrNotFound        = errors.New("resource not found")
+	ErrDeleted         = errors.New("resource deleted")
+	ErrVersionConflict = errors.New("resource version conflict")
+)
+
+// Resource is a FHIR resource the server stores and versions
+type Resource interface {
+	// GetBase returns the elements every resource has
+	GetBase() *Base
+	// TypeName is the resourceType of the resources of this Go type, it does not read the receiver
+	TypeName() string
+	// Validate reports every invalid element as an *OperationOutcome
+	Validate() error
+}
+
+// Base holds the elements shared by the domain resources
+type Base struct {
+	ResourceType string      `json:"resourceType"`
+	ID           string      `json:"id,omitempty"`
+	Meta         *Meta       `json:"meta,omitempty"`
+	Language     string      `json:"language,omitempty"`
+	Text         *Narrative  `json:"text,omitempty"`
+	Extension    []Extension `json:"extension,omitempty"`
+}
+
+// GetBase returns b, the resources embedding Base implement Resource through it
+func (b *Base) GetBase() *Base {
+	return b
+}
+
+// Meta is maintained by the server: versionId and lastUpdated sent by clients are overwritten
+type Meta struct {
+	VersionID   string     `json:"versionId,omitempty"`
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+	Profile     []string   `json:"profile,omitempty"`
+	Security    []Coding   `json:"security,omitempty"`
+	Tag         []Coding   `json:"tag,omitempty"`
+}
+
+// Narrative is the human readable summary of a resource
+type Narrative struct {
+	Status string `json:"status"`
+	Div    string `json:"div"`
+}
+
+// Extension is kept as received, its value[x] can be of any datatype
+type Extension map[string]json.RawMessage
+
+// URL returns the url identifying the extension, "" when missing
+func (e Extension) URL() string {
+	var url string
+	_ = json.Unmarshal(e["url"], &url)
+	return url
+}
+
+/* === Datatypes === */
+
+// Coding is a code defined by a terminology system
+type Coding struct {
+	System       string `json:"system,omitempty"`
+	Version      string `json:"version,omitempty"`
+	Code         string `json:"code,omitempty"`
+	Display      string `json:"display,omitempty"`
+	UserSelected *bool  `json:"userSelected,omitempty"`
+}
+
+// CodeableConcept is a concept given by codings and/or text
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Period is a time range, either end may be open; both are FHIR dateTimes
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// Reference points to another resource, by relative or absolute URL or by identifier
+type Reference struct {
+	Reference  string      `json:"reference,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+	Display    string      `json:"display,omitempty"`
+}
+
+// Target returns the type and id of the resource a literal reference points to, given relative (Patient/123) or
+// as an absolute URL, possibly to a version (Patient/123/_history/2)
+func (r Reference) Target() (resourceType, id string, ok bool) {
+	reference, _, _ := strings.Cut(r.Reference, "/_history/")
+	segments := strings.Split(reference, "/")
+	if len(segments) < 2 || (len(segments) > 2 && !strings.Contains(reference, "://")) {
+		return "", "", false
+	}
+	resourceType, id = segments[len(segments)-2], segments[len(segments)-1]
+	if !resourceTypePattern.MatchString(resourceType) || !ValidID(id) {
+		return "", "", false
+	}
+	return resourceType, id, true
+}
+
+// Identifier is a business identifier, its value unique within system
+type Identifier struct {
+	Use      string           `json:"use,omitempty"`
+	Type     *CodeableConcept `json:"type,omitempty"`
+	System   string           `json:"system,omitempty"`
+	Value    string           `json:"value,omitempty"`
+	Period   *Period          `json:"period,omitempty"`
+	Assigner *Reference       `json:"assigner,omitempty"`
+}
+
+// HumanName is the name of a person
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Prefix []string `json:"prefix,omitempty"`
+	Suffix []string `json:"suffix,omitempty"`
+	Period *Period  `json:"period,omitempty"`
+}
+
+// ContactPoint is a phone number, email address or other telecommunication contact
+type ContactPoint struct {
+	System string  `json:"system,omitempty"`
+	Value  string  `json:"value,omitempty"`
+	Use    string  `json:"use,omitempty"`
+	Rank   *int    `json:"rank,omitempty"`
+	Period *Period `json:"period,omitempty"`
+}
+
+// Address is a postal or physical address
+type Address struct {
+	Use        string   `json:"use,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+	Period     *Period  `json:"period,omitempty"`
+}
+
+// Attachment is content inline (base64 data) or referenced by url
+type Attachment struct {
+	ContentType string `json:"contentType,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Size        *int64 `json:"size,omitempty"`
+	Hash        []byte `json:"hash,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Creation    string `json:"creation,omitempty"`
+}
+
+// Quantity is a measured amount, its code being a UCUM unit when system is UCUMSystem
+type Quantity struct {
+	Value      *float64 `json:"value,omitempty"`
+	Comparator string   `json:"comparator,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+	System     string   `json:"system,omitempty"`
+	Code       string   `json:"code,omitempty"`
+}
+
+// Range is a range of quantities, either bound may be missing
+type Range struct {
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+}
+
+// Annotation is a note, with its author and when it was made
+type Annotation struct {
+	AuthorReference *Reference `json:"authorReference,omitempty"`
+	AuthorString    string     `json:"authorString,omitempty"`
+	Time            string     `json:"time,omitempty"`
+	Text            string     `json:"text"`
+}
+
+/* === Identifiers === */
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9\-.]{1,64}$`)
+
+// resourceTypePattern matches the names of FHIR resource types
+var resourceTypePattern = regexp.MustCompile(`^[A-Z][A-Za-z]+$`)
+
+// ValidID tells whether id is a valid logical id: 1 to 64 letters, digits, '-' and '.'
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// NewID returns a random version 4 UUID, the logical id assigned to created resources
+func NewID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+/* === Validation of shared elements === */
+
+// validate checks the elements of the base, typeName being the expected resourceType
+func (b *Base) validate(outcome *OperationOutcome, typeName string) {
+	if b.ResourceType != typeName {
+		outcome.Add(IssueInvalid, typeName+".resourceType", "must be %q, got %q", typeName, b.ResourceType)
+	}
+	if b.ID != "" && !ValidID(b.ID) {
+		outcome.Add(IssueValue, typeName+".id", "must be 1 to 64 letters, digits, '-' or '.', got %q", b.ID)
+	}
+	if b.Text != nil {
+		if !oneOf(b.Text.Status, "generated", "extensions", "additional", "empty") {
+			outcome.Add(IssueCodeInvalid, typeName+".text.status", "unknown narrative status %q", b.Text.Status)
+		}
+		if b.Text.Div == "" {
+			outcome.Add(IssueRequired, typeName+".text.div", "is required")
+		}
+	}
+	validateExtensions(outcome, typeName+".extension", b.Extension)
+}
+
+func validateExtensions(outcome *OperationOutcome, path string, extensions []Extension) {
+	for i, extension := range extensions {
+		if extension.URL() == "" {
+			outcome.Add(IssueRequired, indexed(path, i)+".url", "is required")
+		}
+	}
+}
+
+func validatePeriod(outcome *OperationOutcome, path string, period *Period) {
+	if period == nil {
+		return
+	}
+	start, startErr := ParseDateTime(period.Start)
+	if period.Start != "" && startErr != nil {
+		outcome.Add(IssueValue, path+".start", "%v", startErr)
+	}
+	end, endErr := ParseDateTime(period.End)
+	if period.End != "" && endErr != nil {
+		outcome.Add(IssueValue, path+".end", "%v", endErr)
+	}
+	if period.Start != "" && period.End != "" && startErr == nil && endErr == nil && end.End.Before(start.Start) {
+		outcome.Add(IssueInvariant, path, "start must not be after end")
+	}
+}
+
+// validateQuantity checks a quantity, parsing its UCUM unit; the unit is returned when it could be parsed
+func validateQuantity(outcome *OperationOutcome, path string, quantity *Quantity) (Unit, bool) {
+	if quantity == nil {
+		return Unit{}, false
+	}
+	if !oneOf(quantity.Comparator, "", "<", "<=", ">=", ">") {
+		outcome.Add(IssueCodeInvalid, path+".comparator", "must be <, <=, >= or >, got %q", quantity.Comparator)
+	}
+	if quantity.Value != nil && (math.IsNaN(*quantity.Value) || math.IsInf(*quantity.Value, 0)) {
+		outcome.Add(IssueValue, path+".value", "must be a finite decimal")
+	}
+	if quantity.Code != "" && quantity.System == "" {
+		outcome.Add(IssueInvariant, path+".system", "is required when a code is given")
+	}
+	if quantity.System != UCUMSystem {
+		return Unit{}, false
+	}
+	unit, err := ParseUnit(quantity.Code)
+	if err != nil {
+		outcome.Add(IssueCodeInvalid, path+".code", "%v", err)
+		return Unit{}, false
+	}
+	return unit, true
+}
+
+func validateAnnotation(outcome *OperationOutcome, path string, annotation Annotation) {
+	if annotation.Text == "" {
+		outcome.Add(IssueRequired, path+".text", "is required")
+	}
+	if annotation.Time != "" {
+		if _, err := ParseDateTime(annotation.Time); err != nil {
+			outcome.Add(IssueValue, path+".time", "%v", err)
+		}
+	}
+	if annotation.AuthorReference != nil && annotation.AuthorString != "" {
+		outcome.Add(IssueInvariant, path, "must have authorReference or authorString, not both")
+	}
+	validateReferenceTo(outcome, path+".authorReference", annotation.AuthorReference,
+		"Practitioner", "PractitionerRole", "Patient", "RelatedPerson", "Organization")
+}
+
+// validateAttachment checks an attachment, its hash being the SHA-1 of the data as FHIR defines it
+func validateAttachment(outcome *OperationOutcome, path string, attachment Attachment) {
+	if attachment.ContentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(attachment.ContentType); err != nil || !strings.Contains(mediaType, "/") {
+			outcome.Add(IssueCodeInvalid, path+".contentType", "must be a media type, got %q", attachment.ContentType)
+		}
+	} else if len(attachment.Data) > 0 {
+		outcome.Add(IssueInvariant, path+".contentType", "is required when data is given")
+	}
+	if attachment.Size != nil && *attachment.Size < 0 {
+		outcome.Add(IssueValue, path+".size", "must not be negative")
+	}
+	if attachment.Hash != nil && len(attachment.Hash) != sha1.Size {
+		outcome.Add(IssueValue, path+".hash", "must be a base64 SHA-1 digest of %d bytes, got %d bytes", sha1.Size, len(attachment.Hash))
+	}
+	if attachment.Creation != "" {
+		if _, err := ParseDateTime(attachment.Creation); err != nil {
+			outcome.Add(IssueValue, path+".creation", "%v", err)
+		}
+	}
+}
+
+func validateIdentifier(outcome *OperationOutcome, path string, identifier Identifier) {
+	if !oneOf(identifier.Use, "", "usual", "official", "temp", "secondary", "old") {
+		outcome.Add(IssueCodeInvalid, path+".use", "unknown identifier use %q", identifier.Use)
+	}
+	if identifier.Value == "" {
+		outcome.Add(IssueRequired, path+".value", "is required")
+	}
+	validatePeriod(outcome, path+".period", identifier.Period)
+}
+
+func validateReference(outcome *OperationOutcome, path string, reference *Reference) {
+	if reference == nil {
+		return
+	}
+	if reference.Reference == "" && reference.Identifier == nil && reference.Display == "" {
+		outcome.Add(IssueInvariant, path, "must have a reference, an identifier or a display")
+	}
+}
+
+// validateReferenceTo checks a reference like validateReference and that it targets one of types; a literal
+// reference must then be Type/id or an absolute URL ending so, contained references (#id) are not checked
+func validateReferenceTo(outcome *OperationOutcome, path string, reference *Reference, types ...string) {
+	if reference == nil {
+		return
+	}
+	validateReference(outcome, path, reference)
+	if reference.Type != "" && !slices.Contains(types, reference.Type) {
+		outcome.Add(IssueValue, path+".type", "must be %s, got %q", strings.Join(types, " or "), reference.Type)
+	}
+	if reference.Reference == "" || strings.HasPrefix(reference.Reference, "#") {
+		return
+	}
+	resourceType, _, ok := reference.Target()
+	if !ok {
+		outcome.Add(IssueValue, path+".reference", "must be a reference as Type/id, got %q", reference.Reference)
+	} else if !slices.Contains(types, resourceType) {
+		outcome.Add(IssueValue, path+".reference", "must reference a %s, got %q", strings.Join(types, " or "), reference.Reference)
+	}
+}
+
+// requireReferenceTo checks that a required reference is a literal reference to one of types
+func requireReferenceTo(outcome *OperationOutcome, path string, reference *Reference, types ...string) {
+	if reference == nil || reference.Reference == "" {
+		outcome.Add(IssueRequired, path+".reference", "is required, as a reference to a %s", strings.Join(types, " or "))
+		return
+	}
+	validateReferenceTo(outcome, path, reference, types...)
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
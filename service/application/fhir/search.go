@@ -0,0 +1,735 @@
+package fhir
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Paging of search results. Past the requested page, searches count the matches up to MaxTotal, a total over
+// MaxTotal only telling that more matched.
+const (
+	DefaultCount = 20
+	MaxCount     = 100
+	MaxTotal     = 1000
+)
+
+// Token is a coded value, matched by token search parameters as system|code
+type Token struct {
+	System string
+	Code   string
+}
+
+// SearchParam is a search parameter over the resources of type T
+type SearchParam[T any] struct {
+	Name string
+	// Parse returns the predicate of one value, modifier being what follows ':' in the parameter name
+	Parse func(modifier, value string) (func(T) bool, error)
+	// Order compares two resources on the parameter for _sort, nil when the parameter cannot sort
+	Order func(a, b T) int
+	// Index returns the values of the parameter that stores may index, nil when the parameter is not indexed
+	Index func(T) []IndexEntry
+	// Term returns what a resource matching one value requires of the indexed values, ok being false when the
+	// index cannot tell, as for :not
+	Term func(modifier, value string) (term IndexTerm, ok bool)
+}
+
+// Search is a parsed search: the resources matching every parameter, in the order of Sort when set, paged by Count
+// and Offset. Index holds what the matching resources require of the indexed values, for the stores to read only
+// the candidates; when Indexed is set the candidates are the matches, so that stores may page them in the index.
+type Search[T any] struct {
+	Count   int
+	Offset  int
+	Match   func(T) bool
+	Sort    func(a, b T) int
+	Index   []IndexCondition
+	Indexed bool
+}
+
+// IndexEntry is an indexed value of the search parameter Param: a token, references being indexed as Type|id, the
+// time range of a date when Range is set, or the folded value of a string parameter when Text is set
+type IndexEntry struct {
+	Param string
+	Token Token
+	Range *DateRange
+	Text  string
+}
+
+// IndexTerm is satisfied by the entries of Param having Token, any code when Token.Code is empty and any system
+// when AnySystem is set, for date parameters a range within Bounds, and for string parameters a text starting with
+// Text, or containing it when Contains is set. Exact tells that the resources having such an entry are exactly
+// those matching the searched value.
+type IndexTerm struct {
+	Param     string
+	Token     Token
+	AnySystem bool
+	Bounds    *RangeBounds
+	Text      string
+	Contains  bool
+	Exact     bool
+}
+
+// RangeBounds bound the start and end of a time range, inclusively; a zero time leaves its side unbounded
+type RangeBounds struct {
+	MinStart time.Time
+	MaxStart time.Time
+	MinEnd   time.Time
+	MaxEnd   time.Time
+}
+
+// IndexCondition is satisfied by a resource having an entry that satisfies one of its terms. It is only a
+// necessary condition: the resources satisfying it must still be matched.
+type IndexCondition []IndexTerm
+
+// IndexEntries returns the values of resource indexed by params
+func IndexEntries[T any](resource T, params []SearchParam[T]) []IndexEntry {
+	var entries []IndexEntry
+	for _, param := range params {
+		if param.Index != nil {
+			entries = append(entries, param.Index(resource)...)
+		}
+	}
+	return entries
+}
+
+// ParseSearch parses query against params. Repeated parameters must all match, the comma separated values of one
+// parameter are alternatives. _count and _offset page the results and _sort orders them by parameters, descending
+// when prefixed by '-'; other parameters are rejected, as is any invalid value, with an *OperationOutcome listing
+// every issue.
+func ParseSearch[T any](query url.Values, params []SearchParam[T]) (Search[T], error) {
+	search := Search[T]{Count: DefaultCount, Indexed: true}
+	outcome := &OperationOutcome{}
+	var predicates []func(T) bool
+
+	// sorted so that the issues come in a stable order
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		values := query[key]
+		name, modifier, _ := strings.Cut(key, ":")
+		switch name {
+		case "_count":
+			search.Count = parsePaging(outcome, key, values, MaxCount)
+			continue
+		case "_offset":
+			search.Offset = parsePaging(outcome, key, values, -1)
+			continue
+		case "_sort":
+			search.Sort = parseSort(outcome, values[len(values)-1], params)
+			continue
+		}
+
+		param, ok := findParam(params, name)
+		if !ok {
+			outcome.Add(IssueNotSupported, "", "search parameter %q is not supported", name)
+			continue
+		}
+		for _, value := range values {
+			// an empty value does not restrict the search
+			if value == "" {
+				continue
+			}
+			var alternatives []func(T) bool
+			var terms IndexCondition
+			indexed, exact := param.Term != nil, param.Term != nil
+			for _, alternative := range splitValues(value) {
+				predicate, err := param.Parse(modifier, alternative)
+				if err != nil {
+					outcome.Add(IssueValue, "", "search parameter %q: %v", key, err)
+					continue
+				}
+				alternatives = append(alternatives, predicate)
+				if indexed {
+					term, ok := param.Term(modifier, alternative)
+					terms, indexed, exact = append(terms, term), ok, exact && ok && term.Exact
+				}
+			}
+			predicates = append(predicates, anyOf(alternatives))
+			// every alternative must be answered from the index for the condition to be necessary
+			if indexed && len(terms) > 0 {
+				search.Index = append(search.Index, terms)
+			}
+			search.Indexed = search.Indexed && exact
+		}
+	}
+
+	search.Match = func(resource T) bool {
+		for _, predicate := range predicates {
+			if !predicate(resource) {
+				return false
+			}
+		}
+		return true
+	}
+	return search, outcome.OrNil()
+}
+
+// Page returns the page of the resources of seq selected by the search, and how many matched, reading seq only
+// until TotalLimit matches were counted. Sorted searches read every match, holding the Offset+Count first ones.
+func (s Search[T]) Page(seq iter.Seq2[T, error]) (page []T, total int, err error) {
+	if s.Sort != nil {
+		return s.sortedPage(seq)
+	}
+	for resource, err := range seq {
+		if err != nil {
+			return nil, 0, err
+		}
+		if !s.Match(resource) {
+			continue
+		}
+		if total >= s.Offset && len(page) < s.Count {
+			page = append(page, resource)
+		}
+		if total++; total == s.TotalLimit() {
+			break
+		}
+	}
+	return page, total, nil
+}
+
+// TotalLimit is how many matches a search counts at most: one more than MaxTotal or than the matches up to the
+// end of the page, so that a next page is known to exist
+func (s Search[T]) TotalLimit() int {
+	return max(MaxTotal, s.Offset+s.Count) + 1
+}
+
+// sortedPage returns the page of the resources of seq selected by a sorted search, and how many matched
+func (s Search[T]) sortedPage(seq iter.Seq2[T, error]) ([]T, int, error) {
+	// the first matches in the order of Sort, each inserted after its equals to keep the sort stable
+	var first []T
+	keep := s.Offset + s.Count
+	total := 0
+	for resource, err := range seq {
+		if err != nil {
+			return nil, 0, err
+		}
+		if !s.Match(resource) {
+			continue
+		}
+		total++
+		i := sort.Search(len(first), func(i int) bool { return s.Sort(first[i], resource) > 0 })
+		if i < keep {
+			first = slices.Insert(first, i, resource)
+			if len(first) > keep {
+				clear(first[keep:])
+				first = first[:keep]
+			}
+		}
+	}
+	return first[min(s.Offset, len(first)):], total, nil
+}
+
+// parseSort parses the comma separated parameters of _sort, each descending when prefixed by '-', into a comparison
+// applying them in turn
+func parseSort[T any](outcome *OperationOutcome, value string, params []SearchParam[T]) func(a, b T) int {
+	var orders []func(a, b T) int
+	for _, name := range strings.Split(value, ",") {
+		descending := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		param, ok := findParam(params, name)
+		if !ok || param.Order == nil {
+			outcome.Add(IssueNotSupported, "", "search results cannot be sorted by %q", name)
+			continue
+		}
+		order := param.Order
+		if descending {
+			order = func(a, b T) int { return param.Order(b, a) }
+		}
+		orders = append(orders, order)
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+	return func(a, b T) int {
+		for _, order := range orders {
+			if c := order(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
+
+// parsePaging parses a non-negative paging parameter, capped by limit unless it is negative
+func parsePaging(outcome *OperationOutcome, key string, values []string, limit int) int {
+	n, err := strconv.Atoi(values[len(values)-1])
+	if err != nil || n < 0 {
+		outcome.Add(IssueValue, "", "search parameter %q must be a non-negative integer, got %q", key, values[len(values)-1])
+		return 0
+	}
+	if limit >= 0 && n > limit {
+		return limit
+	}
+	return n
+}
+
+func findParam[T any](params []SearchParam[T], name string) (SearchParam[T], bool) {
+	for _, param := range params {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return SearchParam[T]{}, false
+}
+
+// splitValues splits a parameter value on the commas not escaped by a backslash, unescaping them
+func splitValues(value string) []string {
+	var values []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && (value[i+1] == ',' || value[i+1] == '\\'):
+			current.WriteByte(value[i+1])
+			i++
+		case value[i] == ',':
+			values = append(values, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(values, current.String())
+}
+
+func anyOf[T any](predicates []func(T) bool) func(T) bool {
+	return func(resource T) bool {
+		for _, predicate := range predicates {
+			if predicate(resource) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+/* === Parameter types === */
+
+// StringParam matches the values returned by values: by default those starting with the searched value ignoring
+// case and accents, with :exact those equal to it and with :contains those containing it
+func StringParam[T any](name string, values func(T) []string) SearchParam[T] {
+	index := func(resource T) []IndexEntry {
+		var entries []IndexEntry
+		for _, value := range values(resource) {
+			if value != "" {
+				entries = append(entries, IndexEntry{Param: name, Text: fold(value)})
+			}
+		}
+		return entries
+	}
+	// :exact compares the values as they are, the folded prefix only narrowing the candidates
+	term := func(modifier, value string) (IndexTerm, bool) {
+		switch modifier {
+		case "", "exact":
+			return IndexTerm{Param: name, Text: fold(value), Exact: modifier == ""}, true
+		case "contains":
+			return IndexTerm{Param: name, Text: fold(value), Contains: true, Exact: true}, true
+		}
+		return IndexTerm{}, false
+	}
+	return SearchParam[T]{Name: name, Index: index, Term: term, Parse: func(modifier, value string) (func(T) bool, error) {
+		var matches func(candidate string) bool
+		switch modifier {
+		case "":
+			value = fold(value)
+			matches = func(candidate string) bool { return strings.HasPrefix(fold(candidate), value) }
+		case "exact":
+			matches = func(candidate string) bool { return candidate == value }
+		case "contains":
+			value = fold(value)
+			matches = func(candidate string) bool { return strings.Contains(fold(candidate), value) }
+		default:
+			return nil, errUnsupportedModifier(modifier)
+		}
+		return func(resource T) bool {
+			for _, candidate := range values(resource) {
+				if matches(candidate) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}}
+}
+
+// TokenParam matches the tokens returned by tokens against code, system|code, |code (no system) or system|
+// (any code of the system); :not negates the match
+func TokenParam[T any](name string, tokens func(T) []Token) SearchParam[T] {
+	index := func(resource T) []IndexEntry {
+		var entries []IndexEntry
+		for _, token := range tokens(resource) {
+			entries = append(entries, IndexEntry{Param: name, Token: token})
+		}
+		return entries
+	}
+	term := func(modifier, value string) (IndexTerm, bool) {
+		system, code, hasSystem := strings.Cut(value, "|")
+		if !hasSystem {
+			return IndexTerm{Param: name, Token: Token{Code: value}, AnySystem: true, Exact: true}, modifier == ""
+		}
+		return IndexTerm{Param: name, Token: Token{System: system, Code: code}, Exact: true}, modifier == ""
+	}
+	return SearchParam[T]{Name: name, Index: index, Term: term, Parse: func(modifier, value string) (func(T) bool, error) {
+		if modifier != "" && modifier != "not" {
+			return nil, errUnsupportedModifier(modifier)
+		}
+		system, code, hasSystem := strings.Cut(value, "|")
+		if !hasSystem {
+			system, code = "", value
+		}
+		matches := func(token Token) bool {
+			switch {
+			case !hasSystem:
+				return token.Code == code
+			case code == "":
+				return token.System == system
+			default:
+				return token.System == system && token.Code == code
+			}
+		}
+		return func(resource T) bool {
+			for _, token := range tokens(resource) {
+				if matches(token) {
+					return modifier != "not"
+				}
+			}
+			return modifier == "not"
+		}, nil
+	}}
+}
+
+// DateParam matches the FHIR dates or dateTimes returned by dates against a date prefixed by eq (the default),
+// ne, lt, gt, le, ge, sa (starts after) or eb (ends before), comparing the ranges their precision covers
+func DateParam[T any](name string, dates func(T) []string) SearchParam[T] {
+	return rangeParam(name, func(resource T) []DateRange {
+		var ranges []DateRange
+		for _, date := range dates(resource) {
+			if r, err := ParseDateTime(date); err == nil {
+				ranges = append(ranges, r)
+			}
+		}
+		return ranges
+	})
+}
+
+// PeriodParam matches the periods returned by periods like DateParam, an open period extending without bound on
+// its open side: an ongoing encounter matches ge with any date after its start
+func PeriodParam[T any](name string, periods func(T) []Period) SearchParam[T] {
+	return rangeParam(name, func(resource T) []DateRange {
+		var ranges []DateRange
+		for _, period := range periods(resource) {
+			if r, ok := period.Range(); ok {
+				ranges = append(ranges, r)
+			}
+		}
+		return ranges
+	})
+}
+
+// rangeParam implements the date parameters over the time ranges returned by ranges, sorting by the start of the
+// first one; resources without a range sort first
+func rangeParam[T any](name string, ranges func(T) []DateRange) SearchParam[T] {
+	order := func(a, b T) int {
+		aRanges, bRanges := ranges(a), ranges(b)
+		switch {
+		case len(aRanges) > 0 && len(bRanges) > 0:
+			return aRanges[0].Start.Compare(bRanges[0].Start)
+		case len(aRanges) > 0:
+			return 1
+		case len(bRanges) > 0:
+			return -1
+		}
+		return 0
+	}
+	index := func(resource T) []IndexEntry {
+		var entries []IndexEntry
+		for _, r := range ranges(resource) {
+			entries = append(entries, IndexEntry{Param: name, Range: &r})
+		}
+		return entries
+	}
+	term := func(modifier, value string) (IndexTerm, bool) {
+		prefix, value := datePrefix(value)
+		bounds, ok := dateBounds[prefix]
+		searched, err := ParseDateTime(value)
+		if modifier != "" || !ok || err != nil {
+			return IndexTerm{}, false
+		}
+		return IndexTerm{Param: name, Bounds: bounds(searched)}, true
+	}
+	return SearchParam[T]{Name: name, Order: order, Index: index, Term: term, Parse: func(modifier, value string) (func(T) bool, error) {
+		if modifier != "" {
+			return nil, errUnsupportedModifier(modifier)
+		}
+		prefix, value := datePrefix(value)
+		compare, ok := dateComparisons[prefix]
+		if !ok {
+			return nil, &unsupportedError{what: "prefix", value: prefix}
+		}
+		searched, err := ParseDateTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(resource T) bool {
+			for _, target := range ranges(resource) {
+				if compare(searched, target) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}}
+}
+
+// ReferenceParam matches the references returned by references against an id, Type/id or an absolute URL; the
+// :Type modifier restricts an id to one of targetTypes
+func ReferenceParam[T any](name string, targetTypes []string, references func(T) []Reference) SearchParam[T] {
+	// the target of a value: an id, of any type unless wantType is set
+	target := func(modifier, value string) (wantType, wantID string, err error) {
+		if modifier != "" && !slices.Contains(targetTypes, modifier) {
+			return "", "", errUnsupportedModifier(modifier)
+		}
+		wantType, wantID = modifier, value
+		if strings.Contains(value, "/") {
+			resourceType, id, ok := Reference{Reference: value}.Target()
+			if !ok || (modifier != "" && resourceType != modifier) {
+				return "", "", fmt.Errorf("must be an id or a reference as Type/id, got %q", value)
+			}
+			wantType, wantID = resourceType, id
+		}
+		return wantType, wantID, nil
+	}
+	index := func(resource T) []IndexEntry {
+		var entries []IndexEntry
+		for _, reference := range references(resource) {
+			if resourceType, id, ok := reference.Target(); ok {
+				entries = append(entries, IndexEntry{Param: name, Token: Token{System: resourceType, Code: id}})
+			}
+		}
+		return entries
+	}
+	term := func(modifier, value string) (IndexTerm, bool) {
+		wantType, wantID, err := target(modifier, value)
+		return IndexTerm{Param: name, Token: Token{System: wantType, Code: wantID}, AnySystem: wantType == "", Exact: true}, err == nil
+	}
+	return SearchParam[T]{Name: name, Index: index, Term: term, Parse: func(modifier, value string) (func(T) bool, error) {
+		wantType, wantID, err := target(modifier, value)
+		if err != nil {
+			return nil, err
+		}
+		return func(resource T) bool {
+			for _, reference := range references(resource) {
+				resourceType, id, ok := reference.Target()
+				if ok && id == wantID && (wantType == "" || resourceType == wantType) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}}
+}
+
+// QuantityParam matches the quantities returned by quantities against [prefix]number[|system|code], prefixed by eq
+// (the default, within the precision of number), ne, lt, gt, le, ge or ap (within 10%). A UCUM unit also matches
+// the quantities in commensurable units, converted to it: gt100|http://unitsofmeasure.org|[lb_av] matches 50 kg.
+func QuantityParam[T any](name string, quantities func(T) []Quantity) SearchParam[T] {
+	return SearchParam[T]{Name: name, Parse: func(modifier, value string) (func(T) bool, error) {
+		if modifier != "" {
+			return nil, errUnsupportedModifier(modifier)
+		}
+		number, unit, _ := strings.Cut(value, "|")
+		system, code, _ := strings.Cut(unit, "|")
+		prefix := "eq"
+		if len(number) > 2 && number[0] >= 'a' && number[0] <= 'z' {
+			prefix, number = number[:2], number[2:]
+		}
+		compare, ok := quantityComparisons[prefix]
+		if !ok {
+			return nil, &unsupportedError{what: "prefix", value: prefix}
+		}
+		if !decimalPattern.MatchString(number) {
+			return nil, fmt.Errorf("must be a number, optionally followed by |system|code, got %q", value)
+		}
+		searched, _ := strconv.ParseFloat(number, 64)
+		// the precision of a number is half its last digit: 100 covers [99.5, 100.5)
+		precision := 0.5
+		if _, decimals, ok := strings.Cut(number, "."); ok {
+			precision = 0.5 * math.Pow10(-len(decimals))
+		}
+
+		var searchedUnit Unit
+		var convert bool
+		if code != "" && (system == UCUMSystem || system == "") {
+			parsed, err := ParseUnit(code)
+			if err != nil && system == UCUMSystem {
+				return nil, err
+			}
+			searchedUnit, convert = parsed, err == nil
+		}
+		// inUnit returns the value of a quantity in the searched unit, ok being false when it is not in one
+		inUnit := func(q Quantity) (float64, bool) {
+			switch {
+			case q.Value == nil:
+				return 0, false
+			case code == "":
+				return *q.Value, true
+			case convert && q.System == UCUMSystem:
+				from, err := ParseUnit(q.Code)
+				if err != nil {
+					return 0, false
+				}
+				converted, err := from.Convert(*q.Value, searchedUnit)
+				return converted, err == nil
+			}
+			return *q.Value, q.Code == code && (system == "" || q.System == system)
+		}
+		return func(resource T) bool {
+			for _, quantity := range quantities(resource) {
+				if target, ok := inUnit(quantity); ok && compare(target, searched, precision) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}}
+}
+
+var decimalPattern = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// quantityComparisons implements the prefixes of quantity parameters
+var quantityComparisons = map[string]func(target, searched, precision float64) bool{
+	"eq": func(target, searched, precision float64) bool {
+		return target >= searched-precision && target < searched+precision
+	},
+	"ne": func(target, searched, precision float64) bool {
+		return target < searched-precision || target >= searched+precision
+	},
+	"lt": func(target, searched, _ float64) bool { return target < searched },
+	"gt": func(target, searched, _ float64) bool { return target > searched },
+	"le": func(target, searched, _ float64) bool { return target <= searched },
+	"ge": func(target, searched, _ float64) bool { return target >= searched },
+	"ap": func(target, searched, _ float64) bool { return math.Abs(target-searched) <= math.Abs(searched)/10 },
+}
+
+// dateComparisons implements the prefixes of date parameters, as in the FHIR search specification
+var dateComparisons = map[string]func(searched, target DateRange) bool{
+	"eq": func(searched, target DateRange) bool { return searched.Contains(target) },
+	"ne": func(searched, target DateRange) bool { return !searched.Contains(target) },
+	"gt": func(searched, target DateRange) bool { return target.End.After(searched.End) },
+	"lt": func(searched, target DateRange) bool { return target.Start.Before(searched.Start) },
+	"ge": func(searched, target DateRange) bool { return target.End.After(searched.Start) },
+	"le": func(searched, target DateRange) bool { return target.Start.Before(searched.End) },
+	"sa": func(searched, target DateRange) bool { return !target.Start.Before(searched.End) },
+	"eb": func(searched, target DateRange) bool { return !target.End.After(searched.Start) },
+}
+
+// dateBounds returns, for each prefix of dateComparisons but ne, the bounds of the ranges it may match
+var dateBounds = map[string]func(searched DateRange) *RangeBounds{
+	"eq": func(searched DateRange) *RangeBounds {
+		return &RangeBounds{MinStart: searched.Start, MaxEnd: searched.End}
+	},
+	"gt": func(searched DateRange) *RangeBounds { return &RangeBounds{MinEnd: searched.End} },
+	"lt": func(searched DateRange) *RangeBounds { return &RangeBounds{MaxStart: searched.Start} },
+	"ge": func(searched DateRange) *RangeBounds { return &RangeBounds{MinEnd: searched.Start} },
+	"le": func(searched DateRange) *RangeBounds { return &RangeBounds{MaxStart: searched.End} },
+	"sa": func(searched DateRange) *RangeBounds { return &RangeBounds{MinStart: searched.End} },
+	"eb": func(searched DateRange) *RangeBounds { return &RangeBounds{MaxEnd: searched.Start} },
+}
+
+// datePrefix splits the comparison prefix of a date parameter value, eq by default
+func datePrefix(value string) (prefix, date string) {
+	if len(value) > 2 && value[0] >= 'a' && value[0] <= 'z' {
+		return value[:2], value[2:]
+	}
+	return "eq", value
+}
+
+// identifierTokens returns identifiers as tokens, their system and value
+func identifierTokens(identifiers []Identifier) []Token {
+	tokens := make([]Token, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		tokens = append(tokens, Token{System: identifier.System, Code: identifier.Value})
+	}
+	return tokens
+}
+
+// conceptTokens returns the codings of concepts as tokens
+func conceptTokens(concepts []CodeableConcept) []Token {
+	var tokens []Token
+	for _, concept := range concepts {
+		for _, coding := range concept.Coding {
+			tokens = append(tokens, Token{System: coding.System, Code: coding.Code})
+		}
+	}
+	return tokens
+}
+
+// optional returns the value of an optional element as a slice, empty when it is absent
+func optional[T any](value *T) []T {
+	if value == nil {
+		return nil
+	}
+	return []T{*value}
+}
+
+type unsupportedError struct {
+	what  string
+	value string
+}
+
+func (e *unsupportedError) Error() string {
+	return e.what + " " + strconv.Quote(e.value) + " is not supported"
+}
+
+func errUnsupportedModifier(modifier string) error {
+	return &unsupportedError{what: "modifier", value: modifier}
+}
+
+// accents maps the accented letters of the Latin alphabets to their base letter
+var accents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o", "õ", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n", "ý", "y", "ÿ", "y",
+)
+
+// fold normalizes a string for case and accent insensitive matching
+func fold(s string) string {
+	return accents.Replace(strings.ToLower(s))
+}
+
+/* === Bundle === */
+
+// Bundle is a searchset of resources, Total being nil when the matches were not all counted
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        *int          `json:"total,omitempty"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+// BundleLink is a link of a bundle, such as the next page of a searchset
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+// BundleEntry is a resource of a bundle
+type BundleEntry struct {
+	FullURL  string       `json:"fullUrl,omitempty"`
+	Resource any          `json:"resource"`
+	Search   *EntrySearch `json:"search,omitempty"`
+}
+
+// EntrySearch tells why an entry is in a searchset
+type EntrySearch struct {
+	Mode string `json:"mode"`
+}
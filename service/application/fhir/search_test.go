@@ -0,0 +1,286 @@
+package fhir
+
+import (
+	"errors"
+	"iter"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func searchPatients() []*Patient {
+	return []*Patient{
+		{
+			Base:       Base{ResourceType: PatientType, ID: "p1"},
+			Identifier: []Identifier{{System: CodiceFiscaleSystem, Value: "RSSMRA85T10A562S"}, {System: "urn:mrn", Value: "123"}},
+			Name:       []HumanName{{Family: "Rossi", Given: []string{"Mario"}}},
+			Gender:     "male",
+			BirthDate:  "1985-12-10",
+		},
+		{
+			Base:       Base{ResourceType: PatientType, ID: "p2"},
+			Identifier: []Identifier{{System: CodiceFiscaleSystem, Value: "BNCLRA90A41H501F"}},
+			Name:       []HumanName{{Family: "Bianchi", Given: []string{"Laura", "Niccolò"}}},
+			Gender:     "female",
+			BirthDate:  "1990-01-01",
+		},
+		{
+			Base:      Base{ResourceType: PatientType, ID: "p3"},
+			Name:      []HumanName{{Family: "Rossetti", Given: []string{"Anna"}}},
+			Gender:    "female",
+			BirthDate: "1990",
+		},
+	}
+}
+
+func seqOf[T any](resources []T) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for _, resource := range resources {
+			if !yield(resource, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "no parameters", query: "", want: []string{"p1", "p2", "p3"}},
+		{name: "name prefix ignoring case", query: "name=ros", want: []string{"p1", "p3"}},
+		{name: "name ignoring accents", query: "given=niccolo", want: []string{"p2"}},
+		{name: "exact family", query: "family:exact=Ross", want: nil},
+		{name: "contains", query: "family:contains=SSE", want: []string{"p3"}},
+		{name: "alternatives", query: "family=bianchi,rossetti", want: []string{"p2", "p3"}},
+		{name: "repeated parameters", query: "name=ros&name=anna", want: []string{"p3"}},
+		{name: "gender", query: "gender=female", want: []string{"p2", "p3"}},
+		{name: "gender not", query: "gender:not=female", want: []string{"p1"}},
+		{name: "identifier with system", query: "identifier=urn:mrn|123", want: []string{"p1"}},
+		{name: "identifier of a system", query: "identifier=" + url.QueryEscape(CodiceFiscaleSystem+"|"), want: []string{"p1", "p2"}},
+		{name: "identifier without system", query: "identifier=123", want: []string{"p1"}},
+		{name: "codice fiscale", query: "codice-fiscale=bnclra90a41h501f", want: []string{"p2"}},
+		{name: "birthdate year", query: "birthdate=1990", want: []string{"p2", "p3"}},
+		{name: "birthdate day", query: "birthdate=1990-01-01", want: []string{"p2"}},
+		{name: "birthdate before", query: "birthdate=lt1990-01-01", want: []string{"p1"}},
+		{name: "birthdate range", query: "birthdate=ge1985-01-01&birthdate=le1989-12-31", want: []string{"p1"}},
+		{name: "id", query: "_id=p3", want: []string{"p3"}},
+		{name: "count and offset", query: "_count=1&_offset=1", want: []string{"p2"}},
+		{name: "sorted descending", query: "_sort=-birthdate", want: []string{"p2", "p3", "p1"}},
+		{name: "sorted page", query: "_sort=birthdate&_count=1&_offset=1", want: []string{"p2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			search, err := ParseSearch(query, PatientSearchParams)
+			if err != nil {
+				t.Fatalf("ParseSearch() error = %v", err)
+			}
+			page, _, err := search.Page(seqOf(searchPatients()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, patient := range page {
+				ids = append(ids, patient.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		issues int
+	}{
+		{name: "unknown parameter", query: "telecom=123", issues: 1},
+		{name: "unknown modifier", query: "gender:missing=true", issues: 1},
+		{name: "invalid date", query: "birthdate=yesterday", issues: 1},
+		{name: "invalid prefix", query: "birthdate=xx1990", issues: 1},
+		{name: "invalid count", query: "_count=-1", issues: 1},
+		{name: "sort by a token", query: "_sort=gender", issues: 1},
+		{name: "every issue", query: "_count=x&birthdate=1990-13&color=red", issues: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			_, err := ParseSearch(query, PatientSearchParams)
+			var outcome *OperationOutcome
+			if !errors.As(err, &outcome) || len(outcome.Issue) != tt.issues {
+				t.Errorf("ParseSearch(%q) error = %v, want %d issues", tt.query, err, tt.issues)
+			}
+		})
+	}
+}
+
+func TestSearchPageTotal(t *testing.T) {
+	search, _ := ParseSearch(url.Values{"_count": {"500"}}, PatientSearchParams)
+	if search.Count != MaxCount {
+		t.Errorf("Count = %d, want it capped to %d", search.Count, MaxCount)
+	}
+	search.Count = 0
+	page, total, _ := search.Page(seqOf(searchPatients()))
+	if len(page) != 0 || total != 3 {
+		t.Errorf("Page() with _count=0 = %d resources, total %d, want only the total", len(page), total)
+	}
+
+	// past MaxTotal the matches are no longer read
+	many := make([]*Patient, 0, 2*MaxTotal)
+	for range 2 * MaxTotal {
+		many = append(many, searchPatients()[0])
+	}
+	read := 0
+	counted := func(yield func(*Patient, error) bool) {
+		for _, patient := range many {
+			read++
+			if !yield(patient, nil) {
+				return
+			}
+		}
+	}
+	search.Count = 10
+	if _, total, _ := search.Page(counted); total != MaxTotal+1 || read != MaxTotal+1 {
+		t.Errorf("Page() counted %d matches reading %d, want %d", total, read, MaxTotal+1)
+	}
+	search.Offset = 2 * MaxTotal
+	if page, total, _ := search.Page(seqOf(many)); len(page) != 0 || total != 2*MaxTotal {
+		t.Errorf("Page() past the matches = %d resources, total %d, want none of %d", len(page), total, 2*MaxTotal)
+	}
+}
+
+func TestParseSearchIndex(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		conditions int
+		indexed    bool
+	}{
+		{name: "identifier", query: "identifier=urn:mrn|123", conditions: 1, indexed: true},
+		{name: "identifier of a system", query: "identifier=" + url.QueryEscape(CodiceFiscaleSystem+"|"), conditions: 1, indexed: true},
+		{name: "identifier alternatives", query: "identifier=123,urn:mrn|456", conditions: 1, indexed: true},
+		{name: "codice fiscale in any writing", query: "codice-fiscale=bnclra90a41h501f", conditions: 1, indexed: true},
+		{name: "date", query: "birthdate=1990", conditions: 1},
+		{name: "date after", query: "birthdate=gt1985-12-09", conditions: 1},
+		{name: "date before", query: "birthdate=lt1990-01-01", conditions: 1},
+		{name: "date from", query: "birthdate=ge1990-01-01", conditions: 1},
+		{name: "date until", query: "birthdate=le1985-12-10", conditions: 1},
+		{name: "date starts after", query: "birthdate=sa1989", conditions: 1},
+		{name: "date ends before", query: "birthdate=eb1990-01-01T00:00:00Z", conditions: 1},
+		{name: "date range", query: "birthdate=ge1985-01-01&birthdate=le1989-12-31", conditions: 2},
+		{name: "token and date", query: "gender=female&birthdate=ge1990-01-01", conditions: 2},
+		{name: "negated token", query: "gender:not=female", conditions: 0},
+		{name: "date not equal", query: "birthdate=ne1990", conditions: 0},
+		{name: "string", query: "family=ros", conditions: 1, indexed: true},
+		{name: "string ignoring accents", query: "name=niccolo", conditions: 1, indexed: true},
+		{name: "string contained", query: "family:contains=ss", conditions: 1, indexed: true},
+		{name: "exact string", query: "family:exact=Rossi", conditions: 1},
+		{name: "string and token", query: "family=ros&gender=male", conditions: 2, indexed: true},
+		{name: "no parameter", query: "_count=10", conditions: 0, indexed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			search, err := ParseSearch(query, PatientSearchParams)
+			if err != nil {
+				t.Fatalf("ParseSearch() error = %v", err)
+			}
+			if len(search.Index) != tt.conditions || search.Indexed != tt.indexed {
+				t.Errorf("ParseSearch(%q) has %d index conditions, indexed %v, want %d, %v", tt.query, len(search.Index),
+					search.Indexed, tt.conditions, tt.indexed)
+			}
+			// the conditions are necessary, every match satisfying them, and sufficient when the search is indexed
+			matches := 0
+			for _, patient := range searchPatients() {
+				entries := IndexEntries(patient, PatientSearchParams)
+				satisfied := true
+				for _, condition := range search.Index {
+					satisfied = satisfied && satisfies(entries, condition)
+				}
+				if search.Match(patient) {
+					matches++
+					if !satisfied {
+						t.Errorf("%s matches %q but not its index conditions", patient.ID, tt.query)
+					}
+				} else if satisfied && search.Indexed {
+					t.Errorf("%s satisfies the index conditions of %q without matching it", patient.ID, tt.query)
+				}
+			}
+			if matches == 0 {
+				t.Errorf("Expected %q to match a patient", tt.query)
+			}
+		})
+	}
+}
+
+func TestReferenceParamIndex(t *testing.T) {
+	encounter := &Encounter{Base: Base{ResourceType: EncounterType, ID: "e1"}, Subject: &Reference{Reference: "Patient/p1"},
+		Period: &Period{Start: "2024-03-01T08:00:00Z"}}
+	entries := IndexEntries(encounter, EncounterSearchParams)
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "subject=p1", want: true},
+		{query: "subject=Patient/p1", want: true},
+		{query: "subject:Patient=p1", want: true},
+		{query: "subject=p2", want: false},
+		{query: "date=ge2024-03-01", want: true},
+		{query: "date=ge2030-01-01", want: true},
+		{query: "date=lt2024-01-01", want: false},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		search, err := ParseSearch(query, EncounterSearchParams)
+		if err != nil || len(search.Index) != 1 {
+			t.Fatalf("ParseSearch(%q) = %d index conditions, %v", tt.query, len(search.Index), err)
+		}
+		if got := satisfies(entries, search.Index[0]); got != tt.want || (search.Match(encounter) && !got) {
+			t.Errorf("index condition of %q satisfied = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// satisfies evaluates condition on entries as the SQL store does, comparing ranges in milliseconds
+func satisfies(entries []IndexEntry, condition IndexCondition) bool {
+	within := func(value int64, min, max time.Time) bool {
+		return (min.IsZero() || value >= min.UnixMilli()) && (max.IsZero() || value <= max.UnixMilli())
+	}
+	for _, term := range condition {
+		for _, entry := range entries {
+			if entry.Param != term.Param {
+				continue
+			}
+			if term.Text != "" {
+				if entry.Text != "" && (term.Contains && strings.Contains(entry.Text, term.Text) ||
+					!term.Contains && strings.HasPrefix(entry.Text, term.Text)) {
+					return true
+				}
+				continue
+			}
+			if bounds := term.Bounds; bounds != nil {
+				if entry.Range != nil && within(entry.Range.Start.UnixMilli(), bounds.MinStart, bounds.MaxStart) &&
+					within(entry.Range.End.UnixMilli(), bounds.MinEnd, bounds.MaxEnd) {
+					return true
+				}
+				continue
+			}
+			if entry.Range == nil && entry.Text == "" && (term.Token.Code == "" || entry.Token.Code == term.Token.Code) &&
+				(term.AnySystem || entry.Token.System == term.Token.System) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package fhir
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// UCUMSystem is the system of quantities whose code is a UCUM unit
+const UCUMSystem = "http://unitsofmeasure.org"
+
+// dimension holds the exponents of the base quantities of a unit: mass, length, time, amount of substance and
+// temperature
+type dimension [5]int
+
+// ucumAtom is a unit symbol, its factor converting to the base units (g, m, s, mol, K)
+type ucumAtom struct {
+	factor float64
+	dim    dimension
+	// metric atoms take prefixes
+	metric bool
+	// offset is added after the factor, only temperatures have one
+	offset float64
+}
+
+// ucumAtoms are the units of the clinical measurements the server records, a subset of UCUM
+var ucumAtoms = map[string]ucumAtom{
+	"g":       {factor: 1, dim: dimension{1, 0, 0, 0, 0}, metric: true},
+	"m":       {factor: 1, dim: dimension{0, 1, 0, 0, 0}, metric: true},
+	"s":       {factor: 1, dim: dimension{0, 0, 1, 0, 0}, metric: true},
+	"mol":     {factor: 1, dim: dimension{0, 0, 0, 1, 0}, metric: true},
+	"eq":      {factor: 1, dim: dimension{0, 0, 0, 1, 0}, metric: true},
+	"K":       {factor: 1, dim: dimension{0, 0, 0, 0, 1}, metric: true},
+	"Cel":     {factor: 1, dim: dimension{0, 0, 0, 0, 1}, offset: 273.15},
+	"[degF]":  {factor: 5.0 / 9, dim: dimension{0, 0, 0, 0, 1}, offset: 459.67 * 5 / 9},
+	"L":       {factor: 1e-3, dim: dimension{0, 3, 0, 0, 0}, metric: true},
+	"l":       {factor: 1e-3, dim: dimension{0, 3, 0, 0, 0}, metric: true},
+	"Pa":      {factor: 1e3, dim: dimension{1, -1, -2, 0, 0}, metric: true},
+	"bar":     {factor: 1e8, dim: dimension{1, -1, -2, 0, 0}, metric: true},
+	"m[Hg]":   {factor: 133_322_387.415, dim: dimension{1, -1, -2, 0, 0}, metric: true},
+	"cm[H2O]": {factor: 98_066.5, dim: dimension{1, -1, -2, 0, 0}},
+	"U":       {factor: 1e-6 / 60, dim: dimension{0, 0, -1, 1, 0}, metric: true},
+	"min":     {factor: 60, dim: dimension{0, 0, 1, 0, 0}},
+	"h":       {factor: 3600, dim: dimension{0, 0, 1, 0, 0}},
+	"d":       {factor: 86_400, dim: dimension{0, 0, 1, 0, 0}},
+	"wk":      {factor: 604_800, dim: dimension{0, 0, 1, 0, 0}},
+	"a":       {factor: 31_557_600, dim: dimension{0, 0, 1, 0, 0}},
+	"[lb_av]": {factor: 453.59237, dim: dimension{1, 0, 0, 0, 0}},
+	"[oz_av]": {factor: 28.349523125, dim: dimension{1, 0, 0, 0, 0}},
+	"[in_i]":  {factor: 0.0254, dim: dimension{0, 1, 0, 0, 0}},
+	"[ft_i]":  {factor: 0.3048, dim: dimension{0, 1, 0, 0, 0}},
+	"%":       {factor: 0.01},
+	"1":       {factor: 1},
+}
+
+// ucumPrefixes are the metric prefixes, by factor
+var ucumPrefixes = map[string]float64{
+	"k": 1e3, "h": 1e2, "da": 1e1, "d": 1e-1, "c": 1e-2, "m": 1e-3, "u": 1e-6, "n": 1e-9, "p": 1e-12, "f": 1e-15,
+}
+
+// Unit is a parsed UCUM unit
+type Unit struct {
+	Code   string
+	factor float64
+	dim    dimension
+	offset float64
+}
+
+// ParseUnit parses a UCUM unit made of the atoms the server knows, with metric prefixes, integer exponents, the
+// '.' and '/' operators, 10*n factors and {annotations}: mg/dL, mm[Hg], kg/m2, 10*3/uL or {beats}/min
+func ParseUnit(code string) (Unit, error) {
+	unit := Unit{Code: code, factor: 1}
+	if code == "" {
+		return Unit{}, fmt.Errorf("must be a UCUM unit, got an empty code")
+	}
+	if strings.ContainsAny(code, "() ") {
+		return Unit{}, fmt.Errorf("UCUM unit %q is not supported", code)
+	}
+
+	terms := 0
+	divide := false
+	rest := code
+	if strings.HasPrefix(rest, "/") {
+		divide, rest = true, rest[1:]
+	}
+	for {
+		end := strings.IndexAny(rest, "./")
+		term := rest
+		if end >= 0 {
+			term = rest[:end]
+		}
+		atom, exponent, err := parseTerm(term)
+		if err != nil {
+			return Unit{}, fmt.Errorf("UCUM unit %q: %w", code, err)
+		}
+		if divide {
+			exponent = -exponent
+		}
+		if atom.offset != 0 {
+			unit.offset = atom.offset
+		}
+		unit.factor *= math.Pow(atom.factor, float64(exponent))
+		for i := range unit.dim {
+			unit.dim[i] += atom.dim[i] * exponent
+		}
+		terms++
+
+		if end < 0 {
+			break
+		}
+		divide, rest = rest[end] == '/', rest[end+1:]
+	}
+	// a temperature scale with an offset cannot be combined with other units
+	if unit.offset != 0 && (terms > 1 || unit.dim != (dimension{0, 0, 0, 0, 1})) {
+		return Unit{}, fmt.Errorf("UCUM unit %q combines a temperature scale with other units", code)
+	}
+	return unit, nil
+}
+
+// parseTerm parses an atom, possibly prefixed, followed by an optional exponent
+func parseTerm(term string) (ucumAtom, int, error) {
+	if term == "" {
+		return ucumAtom{}, 0, fmt.Errorf("missing unit around an operator")
+	}
+	// annotations stand for the unit 1, so that {beats}/min is /min
+	if strings.HasPrefix(term, "{") && strings.HasSuffix(term, "}") {
+		return ucumAtoms["1"], 1, nil
+	}
+	if base, power, ok := strings.Cut(term, "*"); ok && base == "10" {
+		n, err := strconv.Atoi(power)
+		if err != nil {
+			return ucumAtom{}, 0, fmt.Errorf("invalid power of ten %q", term)
+		}
+		return ucumAtom{factor: math.Pow10(n)}, 1, nil
+	}
+
+	// the exponent is the trailing integer, unless the whole term is a number
+	symbol, exponent := term, 1
+	if i := strings.LastIndexFunc(term, func(r rune) bool { return (r < '0' || r > '9') && r != '-' && r != '+' }); i >= 0 && i < len(term)-1 {
+		n, err := strconv.Atoi(term[i+1:])
+		if err != nil {
+			return ucumAtom{}, 0, fmt.Errorf("invalid exponent in %q", term)
+		}
+		symbol, exponent = term[:i+1], n
+	}
+
+	if atom, ok := ucumAtoms[symbol]; ok {
+		return atom, exponent, nil
+	}
+	for prefix, factor := range ucumPrefixes {
+		atom, ok := ucumAtoms[strings.TrimPrefix(symbol, prefix)]
+		if ok && strings.HasPrefix(symbol, prefix) && atom.metric {
+			atom.factor *= factor
+			return atom, exponent, nil
+		}
+	}
+	return ucumAtom{}, 0, fmt.Errorf("unknown unit %q", symbol)
+}
+
+// Commensurable tells whether values in u can be converted to other
+func (u Unit) Commensurable(other Unit) bool {
+	return u.dim == other.dim
+}
+
+// Convert converts value from u to the commensurable unit to
+func (u Unit) Convert(value float64, to Unit) (float64, error) {
+	if !u.Commensurable(to) {
+		return 0, fmt.Errorf("%s cannot be converted to %s", u.Code, to.Code)
+	}
+	return (value*u.factor + u.offset - to.offset) / to.factor, nil
+}
+
+// ConvertUnit converts value between two UCUM units
+func ConvertUnit(value float64, from, to string) (float64, error) {
+	fromUnit, err := ParseUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	toUnit, err := ParseUnit(to)
+	if err != nil {
+		return 0, err
+	}
+	return fromUnit.Convert(value, toUnit)
+}
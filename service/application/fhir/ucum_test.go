@@ -0,0 +1,57 @@
+package fhir
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvertUnit(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   float64
+		from    string
+		to      string
+		want    float64
+		wantErr bool
+	}{
+		{name: "prefixed mass", value: 1.5, from: "kg", to: "g", want: 1500},
+		{name: "customary mass", value: 154, from: "[lb_av]", to: "kg", want: 69.853},
+		{name: "customary length", value: 70, from: "[in_i]", to: "cm", want: 177.8},
+		{name: "temperature scales", value: 98.6, from: "[degF]", to: "Cel", want: 37},
+		{name: "pressure", value: 120, from: "mm[Hg]", to: "kPa", want: 15.999},
+		{name: "concentration", value: 90, from: "mg/dL", to: "g/L", want: 0.9},
+		{name: "annotated rate", value: 72, from: "{beats}/min", to: "/s", want: 1.2},
+		{name: "exponent", value: 22.5, from: "kg/m2", to: "g/cm2", want: 2.25},
+		{name: "power of ten", value: 7.2, from: "10*3/uL", to: "10*9/L", want: 7.2},
+		{name: "percent", value: 98, from: "%", to: "1", want: 0.98},
+		{name: "incommensurable", value: 1, from: "kg", to: "mm[Hg]", wantErr: true},
+		{name: "unknown unit", value: 1, from: "stone", to: "kg", wantErr: true},
+		{name: "temperature in a compound unit", value: 1, from: "Cel/min", to: "K/min", wantErr: true},
+		{name: "prefixed non metric unit", value: 1, from: "k[lb_av]", to: "kg", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertUnit(tt.value, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConvertUnit(%v, %q, %q) error = %v, wantErr %v", tt.value, tt.from, tt.to, err, tt.wantErr)
+			}
+			if !tt.wantErr && math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("ConvertUnit(%v, %q, %q) = %v, want %v", tt.value, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLOINC(t *testing.T) {
+	for _, code := range []string{LOINCBloodPressure, LOINCSystolic, "8867-4", "718-7"} {
+		if err := ValidateLOINC(code); err != nil {
+			t.Errorf("ValidateLOINC(%q) error = %v", code, err)
+		}
+	}
+	for _, code := range []string{"8480-7", "8480", "84806", "x480-6"} {
+		if err := ValidateLOINC(code); err == nil {
+			t.Errorf("ValidateLOINC(%q) accepted an invalid code", code)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package hl7
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// AckCode is the acknowledgment code of MSA-1, in original acknowledgment mode
+type AckCode string
+
+const (
+	// AckAccept tells the sender the message was processed
+	AckAccept AckCode = "AA"
+	// AckError tells the sender the message could not be processed, as its content broke a rule or the service
+	// failed; it may be sent again once corrected
+	AckError AckCode = "AE"
+	// AckReject tells the sender the message cannot be processed at all, being malformed or of an unsupported type
+	AckReject AckCode = "AR"
+)
+
+// ErrorCode is a message error condition code of HL7 table 0357, reported in ERR-3
+type ErrorCode string
+
+const (
+	ErrorSegmentSequence    ErrorCode = "100"
+	ErrorRequiredField      ErrorCode = "101"
+	ErrorDataType           ErrorCode = "102"
+	ErrorTableValue         ErrorCode = "103"
+	ErrorUnsupportedMessage ErrorCode = "200"
+	ErrorUnsupportedEvent   ErrorCode = "201"
+	ErrorUnsupportedVersion ErrorCode = "203"
+	ErrorApplication        ErrorCode = "207"
+)
+
+// errorTexts are the descriptions of the error codes, sent along them in ERR-3
+var errorTexts = map[ErrorCode]string{
+	ErrorSegmentSequence:    "Segment sequence error",
+	ErrorRequiredField:      "Required field missing",
+	ErrorDataType:           "Data type error",
+	ErrorTableValue:         "Table value not found",
+	ErrorUnsupportedMessage: "Unsupported message type",
+	ErrorUnsupportedEvent:   "Unsupported event code",
+	ErrorUnsupportedVersion: "Unsupported version id",
+	ErrorApplication:        "Application internal error",
+}
+
+// Issue is an error reported to the sender in an ERR segment of the ACK
+type Issue struct {
+	// Location is the field in error as segment^sequence^field, such as PID^1^3, or the whole segment
+	Location string
+	Code     ErrorCode
+	// Text tells the sender what to correct
+	Text string
+}
+
+// Ack builds the ACK answering message, an MSA acknowledging its control ID with code followed by an ERR segment
+// for each issue. The sender and receiver of the message are swapped in the MSH of the ACK. message may be nil
+// when it could not be parsed, the ACK then acknowledges no control ID.
+func Ack(message *Message, code AckCode, issues ...Issue) []byte {
+	e := DefaultEncoding
+	var header Segment
+	if message != nil {
+		header = message.Header()
+	}
+	field := func(n int) string {
+		if n < 1 || n >= len(header.fields) {
+			return ""
+		}
+		// the fields are echoed as they are, rewritten with the delimiters of the ACK when the message has others
+		return reencode(header.fields[n], message.Encoding, e)
+	}
+
+	messageType := "ACK"
+	if message != nil {
+		if event := header.Field(9).Component(2); event != "" {
+			messageType += string(e.Component) + e.Encode(event) + string(e.Component) + "ACK"
+		}
+	}
+	version := field(12)
+	if version == "" {
+		version = "2.5"
+	}
+	processingID := field(11)
+	if processingID == "" {
+		processingID = "P"
+	}
+
+	msh := []string{"MSH", "^~\\&", field(5), field(6), field(3), field(4), time.Now().Format("20060102150405-0700"), "",
+		messageType, newControlID(), processingID, version}
+	var controlID string
+	if message != nil {
+		controlID = e.Encode(message.ControlID())
+	}
+	segments := []string{strings.Join(msh, string(e.Field)), strings.Join([]string{"MSA", string(code), controlID}, string(e.Field))}
+	for _, issue := range issues {
+		err := []string{"ERR", "", issue.Location,
+			string(issue.Code) + string(e.Component) + e.Encode(errorTexts[issue.Code]) + string(e.Component) + "HL70357",
+			"E", "", "", "", e.Encode(issue.Text)}
+		segments = append(segments, strings.Join(err, string(e.Field)))
+	}
+	return []byte(strings.Join(segments, "\r") + "\r")
+}
+
+// reencode rewrites a raw value escaped with the delimiters of from with those of to
+func reencode(raw string, from, to Encoding) string {
+	if from == to {
+		return raw
+	}
+	var b strings.Builder
+	for i, component := range strings.Split(raw, string(from.Component)) {
+		if i > 0 {
+			b.WriteByte(to.Component)
+		}
+		for j, subcomponent := range strings.Split(component, string(from.Subcomponent)) {
+			if j > 0 {
+				b.WriteByte(to.Subcomponent)
+			}
+			b.WriteString(to.Encode(from.Decode(subcomponent)))
+		}
+	}
+	return b.String()
+}
+
+// newControlID returns a random MSH-10 of 20 characters, the length HL7 v2.5 allows
+func newControlID() string {
+	var b [10]byte
+	_, _ = rand.Read(b[:])
+	return strings.ToUpper(hex.EncodeToString(b[:]))
+}
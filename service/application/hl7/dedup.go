@@ -0,0 +1,89 @@
+package hl7
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// dedup remembers the ACKs of the accepted messages by sender and control ID, for ttl and at most size of them,
+// the oldest being forgotten first. A message being processed is remembered as in flight, so that a copy sent
+// meanwhile waits for its outcome rather than being processed twice.
+type dedup struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+	// accepted orders the entries of the accepted messages by acceptance, which is also their expiry order
+	accepted *list.List
+}
+
+type dedupEntry struct {
+	// done is closed once the message is processed, ack being set when it was accepted
+	done    chan struct{}
+	ack     []byte
+	expires time.Time
+}
+
+func newDedup(ttl time.Duration, size int) *dedup {
+	return &dedup{ttl: ttl, size: size, now: time.Now, entries: map[string]*dedupEntry{}, accepted: list.New()}
+}
+
+// begin returns the ACK of the message of key when it was accepted. Otherwise the caller processes the message
+// and must call finish with its ACK, nil when it was not accepted and may be processed again.
+func (d *dedup) begin(ctx context.Context, key string) (ack []byte, finish func(ack []byte), err error) {
+	for {
+		d.mu.Lock()
+		d.expire()
+		entry, ok := d.entries[key]
+		if !ok {
+			entry = &dedupEntry{done: make(chan struct{})}
+			d.entries[key] = entry
+			d.mu.Unlock()
+			return nil, func(ack []byte) { d.finish(key, entry, ack) }, nil
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-entry.done:
+			if entry.ack != nil {
+				return entry.ack, nil, nil
+			}
+			// the message was not accepted, the copy is processed in turn
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+func (d *dedup) finish(key string, entry *dedupEntry, ack []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ack == nil {
+		delete(d.entries, key)
+	} else {
+		entry.ack = ack
+		entry.expires = d.now().Add(d.ttl)
+		d.accepted.PushBack(key)
+		for d.accepted.Len() > d.size {
+			delete(d.entries, d.accepted.Remove(d.accepted.Front()).(string))
+		}
+	}
+	close(entry.done)
+}
+
+// expire forgets the accepted messages whose ttl elapsed, d.mu being held
+func (d *dedup) expire() {
+	now := d.now()
+	for front := d.accepted.Front(); front != nil; front = d.accepted.Front() {
+		key := front.Value.(string)
+		if d.entries[key].expires.After(now) {
+			return
+		}
+		d.accepted.Remove(front)
+		delete(d.entries, key)
+	}
+}
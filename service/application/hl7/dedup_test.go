@@ -0,0 +1,80 @@
+package hl7
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	d := newDedup(time.Hour, 2)
+	d.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	accept := func(key string) {
+		t.Helper()
+		ack, finish, err := d.begin(ctx, key)
+		if err != nil || ack != nil {
+			t.Fatalf("begin(%s) = %q, %v, want to process the message", key, ack, err)
+		}
+		finish([]byte("ACK " + key))
+	}
+	remembered := func(key string) bool {
+		t.Helper()
+		ack, finish, err := d.begin(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack == nil {
+			finish(nil)
+		}
+		return ack != nil
+	}
+
+	accept("a")
+	if !remembered("a") {
+		t.Error("an accepted message must be remembered")
+	}
+
+	// a message that was not accepted may be processed again
+	_, finish, _ := d.begin(ctx, "failed")
+	finish(nil)
+	if remembered("failed") {
+		t.Error("a message that was not accepted must not be remembered")
+	}
+
+	// the oldest message is forgotten beyond size
+	accept("b")
+	accept("c")
+	if remembered("a") || !remembered("b") || !remembered("c") {
+		t.Error("only the 2 latest accepted messages must be remembered")
+	}
+
+	now = now.Add(time.Hour)
+	if remembered("b") {
+		t.Error("a message must be forgotten once its ttl elapsed")
+	}
+}
+
+func TestDedupWaitsForTheMessageInFlight(t *testing.T) {
+	d := newDedup(time.Hour, 10)
+	_, finish, _ := d.begin(context.Background(), "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := d.begin(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("begin() error = %v, want the copy to wait for the message in flight", err)
+	}
+
+	acks := make(chan []byte)
+	go func() {
+		ack, _, _ := d.begin(context.Background(), "a")
+		acks <- ack
+	}()
+	finish([]byte("ACK"))
+	if ack := <-acks; string(ack) != "ACK" {
+		t.Errorf("the copy got %q, want the ACK of the message", ack)
+	}
+}
@@ -0,0 +1,856 @@
+package hl7
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"service/application/clinical"
+	"service/application/fhir"
+)
+
+// Code systems of the resources mapped from messages
+const (
+	identifierTypeSystem    = "http://terminology.hl7.org/CodeSystem/v2-0203"
+	actCodeSystem           = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	participationTypeSystem = "http://terminology.hl7.org/CodeSystem/v3-ParticipationType"
+	snomedSystem            = "http://snomed.info/sct"
+	// codiceFiscaleOID is the assigning authority of the codici fiscali in the Italian HL7 profiles
+	codiceFiscaleOID = "2.16.840.1.113883.2.9.4.3.2"
+	// localSystem prefixes the systems of the identifiers and codes of authorities without OID
+	localSystem = "urn:cce:hl7v2:"
+)
+
+// adtEvent is how an ADT trigger event changes the encounter of the visit of PV1
+type adtEvent struct {
+	// visit tells whether the event concerns a visit, rather than only the patient
+	visit bool
+	// status is the status the encounter moves to, the current one being kept when empty
+	status string
+}
+
+// adtEvents are the ADT trigger events processed. A registered outpatient (A04) is being seen, so that its
+// encounter is in progress and its discharge (A03) may finish it.
+var adtEvents = map[string]adtEvent{
+	"A01": {visit: true, status: "in-progress"}, // admit
+	"A02": {visit: true, status: "in-progress"}, // transfer
+	"A03": {visit: true, status: "finished"},    // discharge
+	"A04": {visit: true, status: "in-progress"}, // register an outpatient
+	"A05": {visit: true, status: "planned"},     // pre-admit
+	"A08": {visit: true},                        // update patient information
+	"A28": {},                                   // add person information
+	"A31": {},                                   // update person information
+}
+
+// patientClasses map PV1-2 to the class of the encounter
+var patientClasses = map[string]string{"I": "IMP", "O": "AMB", "E": "EMER", "P": "PRENC"}
+
+// administrativeSexes map PID-8 to the gender of the patient
+var administrativeSexes = map[string]string{"M": "male", "F": "female", "O": "other", "A": "other", "U": "unknown", "N": "unknown"}
+
+// nameUses map the name type code of PID-5 to the use of the name
+var nameUses = map[string]string{"L": "official", "D": "usual", "M": "maiden", "N": "nickname"}
+
+// addressUses map the address type of PID-11 to the use of the address
+var addressUses = map[string]string{"H": "home", "B": "work", "O": "work", "C": "temp", "BA": "old"}
+
+// resultStatuses map OBX-11 to the status of the observation
+var resultStatuses = map[string]string{
+	"R": "registered", "I": "registered", "P": "preliminary", "S": "preliminary", "F": "final", "C": "corrected",
+	"X": "cancelled", "W": "entered-in-error", "D": "entered-in-error",
+}
+
+// numericRange matches the reference ranges of OBX-7 such as 3.5-5.0
+var numericRange = regexp.MustCompile(`^\s*(-?\d+(?:\.\d+)?)\s*-\s*(-?\d+(?:\.\d+)?)\s*$`)
+
+// handler returns the processing of the messages of messageType
+func handler(messageType string) (func(*mapper) error, bool) {
+	if messageType == "ORU^R01" {
+		return (*mapper).oru, true
+	}
+	code, event, _ := strings.Cut(messageType, "^")
+	if e, ok := adtEvents[event]; code == "ADT" && ok {
+		return func(m *mapper) error { return m.adt(e) }, true
+	}
+	return nil, false
+}
+
+// Supported tells whether messages of messageType, such as "ADT^A01", are processed
+func Supported(messageType string) bool {
+	_, ok := handler(messageType)
+	return ok
+}
+
+// Change is a resource written while processing a message
+type Change struct {
+	Resource fhir.Resource
+	Created  bool
+}
+
+// Error is an error of the content of a message, reported to its sender in the ERR segments of an AE
+type Error struct {
+	// Location is the segment or field in error, as Segment.Location returns it
+	Location string
+	Code     ErrorCode
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Location + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Issues returns the issues reported for e: one per issue of an OperationOutcome, its error otherwise
+func (e *Error) Issues() []Issue {
+	var outcome *fhir.OperationOutcome
+	if !errors.As(e.Err, &outcome) {
+		return []Issue{{Location: e.Location, Code: e.Code, Text: e.Err.Error()}}
+	}
+	issues := make([]Issue, 0, len(outcome.Issue))
+	for _, issue := range outcome.Issue {
+		issues = append(issues, Issue{Location: e.Location, Code: e.Code, Text: issue.Diagnostics})
+	}
+	return issues
+}
+
+func fieldError(segment Segment, n int, code ErrorCode, format string, args ...any) *Error {
+	return &Error{Location: segment.Location(n), Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// writeError reports the rules and transitions a write broke as an Error located at segment, other errors being
+// failures of the service
+func writeError(segment Segment, err error) error {
+	var outcome *fhir.OperationOutcome
+	if errors.As(err, &outcome) || errors.Is(err, fhir.ErrInvalidTransition) || errors.Is(err, fhir.ErrVersionConflict) {
+		return &Error{Location: segment.Location(0), Code: ErrorApplication, Err: err}
+	}
+	return err
+}
+
+/* === Messages === */
+
+// mapper writes the resources carried by a message within a clinical transaction
+type mapper struct {
+	ctx      context.Context
+	tx       *clinical.Tx
+	message  *Message
+	location *time.Location
+	changes  []Change
+}
+
+// adt upserts the patient of PID and, for the events concerning a visit, the encounter of PV1
+func (m *mapper) adt(event adtEvent) error {
+	pid, ok := m.message.First("PID")
+	if !ok {
+		return &Error{Location: "PID", Code: ErrorSegmentSequence, Err: errors.New("the message has no PID segment")}
+	}
+	patient, err := m.patient(pid)
+	if err != nil || !event.visit {
+		return err
+	}
+	pv1, ok := m.message.First("PV1")
+	if !ok {
+		return &Error{Location: "PV1", Code: ErrorSegmentSequence, Err: errors.New("the message has no PV1 segment")}
+	}
+	return m.encounter(pv1, patient, event.status)
+}
+
+// oru upserts the patient of each PID and the observation of each OBX, made in the known encounter of the PV1 of
+// the patient when there is one. The NTE segments following an OBX are notes of its observation.
+func (m *mapper) oru() error {
+	var patient *fhir.Patient
+	var encounter *fhir.Encounter
+	var order, result Segment
+	var observation *fhir.Observation
+	flush := func() error {
+		if observation == nil {
+			return nil
+		}
+		err := m.writeObservation(result, observation)
+		observation = nil
+		return err
+	}
+
+	for _, segment := range m.message.Segments[1:] {
+		var err error
+		switch segment.Name {
+		case "PID":
+			if err = flush(); err == nil {
+				patient, err = m.patient(segment)
+				encounter, order = nil, Segment{}
+			}
+		case "PV1":
+			if patient != nil {
+				encounter, err = m.visit(segment)
+			}
+		case "OBR":
+			if patient == nil {
+				return &Error{Location: segment.Location(0), Code: ErrorSegmentSequence, Err: errors.New("an OBR must follow a PID")}
+			}
+			err = flush()
+			order = segment
+		case "OBX":
+			if order.Name == "" {
+				return &Error{Location: segment.Location(0), Code: ErrorSegmentSequence, Err: errors.New("an OBX must follow an OBR")}
+			}
+			if err = flush(); err == nil {
+				result = segment
+				observation, err = m.observation(segment, order, patient, encounter)
+			}
+		case "NTE":
+			if observation != nil {
+				observation.Note = append(observation.Note, fhir.Annotation{Text: text(segment.Repetitions(3))})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if patient == nil {
+		return &Error{Location: "PID", Code: ErrorSegmentSequence, Err: errors.New("the message has no PID segment")}
+	}
+	return flush()
+}
+
+/* === Patients === */
+
+// patient upserts the patient of pid, found by any of the identifiers of PID-3: the demographics the segment
+// carries replace those of the patient, whose other identifiers are kept
+func (m *mapper) patient(pid Segment) (*fhir.Patient, error) {
+	mapped := &fhir.Patient{Base: fhir.Base{ResourceType: fhir.PatientType}}
+	for _, cx := range pid.Repetitions(3) {
+		if cx.Value() == "" {
+			continue
+		}
+		identifier := fhir.Identifier{
+			System: m.system(cx.Subcomponent(4, 1), cx.Subcomponent(4, 2), cx.Subcomponent(4, 3), cx.Component(5)),
+			Value:  cx.Value(),
+		}
+		if typeCode := cx.Component(5); typeCode != "" {
+			identifier.Type = &fhir.CodeableConcept{Coding: []fhir.Coding{{System: identifierTypeSystem, Code: typeCode}}}
+		}
+		if identifier.System == fhir.CodiceFiscaleSystem {
+			identifier.Use, identifier.Value = "official", fhir.NormalizeCodiceFiscale(identifier.Value)
+		}
+		mapped.Identifier = append(mapped.Identifier, identifier)
+	}
+	if len(mapped.Identifier) == 0 {
+		return nil, fieldError(pid, 3, ErrorRequiredField, "the patient identifier list is required")
+	}
+
+	for _, xpn := range pid.Repetitions(5) {
+		name := fhir.HumanName{Use: nameUses[xpn.Component(7)], Family: xpn.Component(1)}
+		for _, given := range []string{xpn.Component(2), xpn.Component(3)} {
+			if given != "" {
+				name.Given = append(name.Given, given)
+			}
+		}
+		if suffix := xpn.Component(4); suffix != "" {
+			name.Suffix = []string{suffix}
+		}
+		if prefix := xpn.Component(5); prefix != "" {
+			name.Prefix = []string{prefix}
+		}
+		mapped.Name = append(mapped.Name, name)
+	}
+	if birth := pid.Field(7).Value(); birth != "" {
+		birthDate, err := date(birth)
+		if err != nil {
+			return nil, fieldError(pid, 7, ErrorDataType, "the date of birth %v", err)
+		}
+		mapped.BirthDate = birthDate
+	}
+	if sex := pid.Field(8).Value(); sex != "" {
+		gender, ok := administrativeSexes[sex]
+		if !ok {
+			return nil, fieldError(pid, 8, ErrorTableValue, "unknown administrative sex %q", sex)
+		}
+		mapped.Gender = gender
+	}
+	for _, xad := range pid.Repetitions(11) {
+		address := fhir.Address{Use: addressUses[xad.Component(7)], City: xad.Component(3), State: xad.Component(4),
+			PostalCode: xad.Component(5), Country: xad.Component(6)}
+		for _, line := range []string{xad.Component(1), xad.Component(2)} {
+			if line != "" {
+				address.Line = append(address.Line, line)
+			}
+		}
+		mapped.Address = append(mapped.Address, address)
+	}
+	// PID-13 holds the home numbers, PID-14 the business ones
+	for _, numbers := range []struct {
+		n   int
+		use string
+	}{{13, "home"}, {14, "work"}} {
+		for _, xtn := range pid.Repetitions(numbers.n) {
+			if telecom, ok := contactPoint(xtn, numbers.use); ok {
+				mapped.Telecom = append(mapped.Telecom, telecom)
+			}
+		}
+	}
+	deceased, err := m.dateTimeField(pid, 29)
+	if err != nil {
+		return nil, err
+	}
+	if deceased != "" {
+		mapped.DeceasedDateTime = deceased
+	} else if indicator := pid.Field(30).Value(); indicator == "Y" || indicator == "N" {
+		deceased := indicator == "Y"
+		mapped.DeceasedBoolean = &deceased
+	}
+
+	patient, err := m.findPatient(pid, mapped.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	if patient == nil {
+		patient = mapped
+	} else {
+		mergePatient(patient, mapped)
+	}
+	if err := patient.Validate(); err != nil {
+		return nil, &Error{Location: pid.Location(0), Code: ErrorDataType, Err: err}
+	}
+
+	var created bool
+	if patient.ID == "" {
+		patient, err = m.tx.Patients().Create(m.ctx, patient)
+		created = true
+	} else {
+		patient, _, err = m.tx.Patients().Update(m.ctx, patient, "")
+	}
+	if err != nil {
+		return nil, writeError(pid, err)
+	}
+	m.changes = append(m.changes, Change{Resource: patient, Created: created})
+	return patient, nil
+}
+
+// findPatient returns the patient having one of identifiers, nil when there is none
+func (m *mapper) findPatient(pid Segment, identifiers []fhir.Identifier) (*fhir.Patient, error) {
+	var found *fhir.Patient
+	match := func(p *fhir.Patient) bool { return anyIdentifier(p.Identifier, identifiers) }
+	for patient, err := range m.tx.Patients().Search(m.ctx, match, identifierCondition(identifiers, true)...) {
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			return nil, fieldError(pid, 3, ErrorApplication, "the identifiers match several patients, %s and %s", found.ID, patient.ID)
+		}
+		found = patient
+	}
+	return found, nil
+}
+
+// mergePatient replaces the demographics of patient with those mapped, adding the identifiers it does not have
+func mergePatient(patient, mapped *fhir.Patient) {
+	for _, identifier := range mapped.Identifier {
+		if !anyIdentifier(patient.Identifier, []fhir.Identifier{identifier}) {
+			patient.Identifier = append(patient.Identifier, identifier)
+		}
+	}
+	if len(mapped.Name) > 0 {
+		patient.Name = mapped.Name
+	}
+	if mapped.BirthDate != "" {
+		patient.BirthDate = mapped.BirthDate
+	}
+	if mapped.Gender != "" {
+		patient.Gender = mapped.Gender
+	}
+	if len(mapped.Address) > 0 {
+		patient.Address = mapped.Address
+	}
+	if len(mapped.Telecom) > 0 {
+		patient.Telecom = mapped.Telecom
+	}
+	if mapped.DeceasedDateTime != "" || mapped.DeceasedBoolean != nil {
+		patient.DeceasedDateTime, patient.DeceasedBoolean = mapped.DeceasedDateTime, mapped.DeceasedBoolean
+	}
+}
+
+// contactPoint maps an XTN, use being the one of its field unless the XTN tells otherwise
+func contactPoint(xtn Field, use string) (fhir.ContactPoint, bool) {
+	telecom := fhir.ContactPoint{System: "phone", Use: use, Value: xtn.Component(1)}
+	switch xtn.Component(3) {
+	case "FX":
+		telecom.System = "fax"
+	case "BP":
+		telecom.System = "pager"
+	case "CP":
+		telecom.Use = "mobile"
+	case "Internet", "X.400":
+		telecom.System, telecom.Value = "email", xtn.Component(4)
+	}
+	if xtn.Component(2) == "WPN" {
+		telecom.Use = "work"
+	}
+	if telecom.Value == "" && telecom.System != "email" {
+		telecom.Value = strings.TrimSpace(xtn.Component(6) + " " + xtn.Component(7))
+	}
+	return telecom, telecom.Value != ""
+}
+
+/* === Encounters === */
+
+// encounter upserts the encounter of the visit number of pv1, moving it to status unless empty. An encounter
+// created without status, by an update of a visit that is not known, is finished when it has a discharge time.
+func (m *mapper) encounter(pv1 Segment, patient *fhir.Patient, status string) error {
+	visit := pv1.Field(19)
+	if visit.Value() == "" {
+		return fieldError(pv1, 19, ErrorRequiredField, "the visit number is required to identify the encounter")
+	}
+	identifier := fhir.Identifier{
+		System: m.system(visit.Subcomponent(4, 1), visit.Subcomponent(4, 2), visit.Subcomponent(4, 3), ""),
+		Value:  visit.Value(),
+	}
+	class, ok := patientClasses[pv1.Field(2).Value()]
+	if !ok {
+		return fieldError(pv1, 2, ErrorTableValue, "unknown patient class %q, expected I, O, E or P", pv1.Field(2).Value())
+	}
+
+	encounter, err := m.findEncounter(identifier)
+	if err != nil {
+		return err
+	}
+	subject := &fhir.Reference{Reference: fhir.PatientType + "/" + patient.ID}
+	if encounter == nil {
+		encounter = &fhir.Encounter{Base: fhir.Base{ResourceType: fhir.EncounterType}, Identifier: []fhir.Identifier{identifier}}
+	} else if encounter.Subject == nil || encounter.Subject.Reference != subject.Reference {
+		return fieldError(pv1, 19, ErrorApplication, "the visit %s is the encounter %s of another patient", identifier.Value, encounter.ID)
+	}
+	encounter.Subject = subject
+	encounter.Class = &fhir.Coding{System: actCodeSystem, Code: class}
+
+	start, err := m.dateTimeField(pv1, 44)
+	if err != nil {
+		return err
+	}
+	end, err := m.dateTimeField(pv1, 45)
+	if err != nil {
+		return err
+	}
+	if start != "" || end != "" {
+		if encounter.Period == nil {
+			encounter.Period = &fhir.Period{}
+		}
+		if start != "" {
+			encounter.Period.Start = start
+		}
+		if end != "" {
+			encounter.Period.End = end
+		}
+	}
+	switch {
+	case status != "":
+		encounter.Status = status
+	case encounter.Status == "" && encounter.Period != nil && encounter.Period.End != "":
+		encounter.Status = "finished"
+	case encounter.Status == "":
+		encounter.Status = "in-progress"
+	}
+
+	if location := pointOfCare(pv1.Field(3)); location != "" {
+		moveTo(encounter, location)
+	}
+	if encounter.Status == "finished" {
+		for i := range encounter.Location {
+			if encounter.Location[i].Status == "active" {
+				encounter.Location[i].Status = "completed"
+			}
+		}
+	}
+	if xcn := pv1.Field(7); xcn.Value() != "" || xcn.Component(2) != "" {
+		m.attend(encounter, xcn)
+	}
+
+	if err := encounter.Validate(); err != nil {
+		return &Error{Location: pv1.Location(0), Code: ErrorDataType, Err: err}
+	}
+	created := encounter.ID == ""
+	if created {
+		encounter, err = m.tx.CreateEncounter(m.ctx, encounter)
+	} else {
+		encounter, _, err = m.tx.UpdateEncounter(m.ctx, encounter, "")
+	}
+	if err != nil {
+		return writeError(pv1, err)
+	}
+	m.changes = append(m.changes, Change{Resource: encounter, Created: created})
+	return nil
+}
+
+// visit returns the encounter of the visit number of pv1, nil when it has none or the encounter is not known
+func (m *mapper) visit(pv1 Segment) (*fhir.Encounter, error) {
+	visit := pv1.Field(19)
+	if visit.Value() == "" {
+		return nil, nil
+	}
+	return m.findEncounter(fhir.Identifier{
+		System: m.system(visit.Subcomponent(4, 1), visit.Subcomponent(4, 2), visit.Subcomponent(4, 3), ""),
+		Value:  visit.Value(),
+	})
+}
+
+// findEncounter returns the encounter having identifier, nil when there is none
+func (m *mapper) findEncounter(identifier fhir.Identifier) (*fhir.Encounter, error) {
+	match := func(e *fhir.Encounter) bool { return anyIdentifier(e.Identifier, []fhir.Identifier{identifier}) }
+	for encounter, err := range m.tx.Encounters().Search(m.ctx, match, identifierCondition([]fhir.Identifier{identifier}, false)...) {
+		return encounter, err
+	}
+	return nil, nil
+}
+
+// pointOfCare describes the location of a PL as point of care/room/bed
+func pointOfCare(pl Field) string {
+	var parts []string
+	for n := 1; n <= 3; n++ {
+		if part := pl.Component(n); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// moveTo records that the patient is at the location described by display, completing the earlier locations
+func moveTo(encounter *fhir.Encounter, display string) {
+	for i := range encounter.Location {
+		location := &encounter.Location[i]
+		if location.Status == "active" && location.Location.Display == display {
+			return
+		}
+		if location.Status == "active" {
+			location.Status = "completed"
+		}
+	}
+	encounter.Location = append(encounter.Location, fhir.EncounterLocation{Location: fhir.Reference{Display: display}, Status: "active"})
+}
+
+// attend makes the doctor of an XCN the attender of the encounter, replacing the previous one
+func (m *mapper) attend(encounter *fhir.Encounter, xcn Field) {
+	var names []string
+	for _, n := range []int{6, 3, 2} {
+		if name := xcn.Component(n); name != "" {
+			names = append(names, name)
+		}
+	}
+	individual := &fhir.Reference{Type: "Practitioner", Display: strings.Join(names, " ")}
+	if id := xcn.Value(); id != "" {
+		individual.Identifier = &fhir.Identifier{
+			System: m.system(xcn.Subcomponent(9, 1), xcn.Subcomponent(9, 2), xcn.Subcomponent(9, 3), ""),
+			Value:  id,
+		}
+	}
+	attender := fhir.EncounterParticipant{
+		Type:       []fhir.CodeableConcept{{Coding: []fhir.Coding{{System: participationTypeSystem, Code: "ATND", Display: "attender"}}}},
+		Individual: individual,
+	}
+
+	participants := encounter.Participant[:0]
+	for _, participant := range encounter.Participant {
+		if !isAttender(participant) {
+			participants = append(participants, participant)
+		}
+	}
+	encounter.Participant = append(participants, attender)
+}
+
+func isAttender(participant fhir.EncounterParticipant) bool {
+	for _, concept := range participant.Type {
+		for _, coding := range concept.Coding {
+			if coding.System == participationTypeSystem && coding.Code == "ATND" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/* === Observations === */
+
+// observation maps the result of obx, reported for the order of obr. It is identified by the filler order number,
+// or the placer one, the code of the result and its sub-ID.
+func (m *mapper) observation(obx, obr Segment, patient *fhir.Patient, encounter *fhir.Encounter) (*fhir.Observation, error) {
+	order := obr.Field(3)
+	if order.Value() == "" {
+		order = obr.Field(2)
+	}
+	if order.Value() == "" {
+		return nil, fieldError(obr, 3, ErrorRequiredField, "the filler or placer order number is required to identify the results")
+	}
+	code := obx.Field(3)
+	if code.Value() == "" {
+		return nil, fieldError(obx, 3, ErrorRequiredField, "the observation identifier is required")
+	}
+	value := order.Value() + "-" + code.Value()
+	if sub := obx.Field(4).Value(); sub != "" {
+		value += "-" + sub
+	}
+	statusCode := obx.Field(11).Value()
+	status, ok := resultStatuses[statusCode]
+	if !ok {
+		return nil, fieldError(obx, 11, ErrorTableValue, "unknown result status %q", statusCode)
+	}
+
+	observation := &fhir.Observation{
+		Base:       fhir.Base{ResourceType: fhir.ObservationType},
+		Identifier: []fhir.Identifier{{System: m.system(order.Component(2), order.Component(3), order.Component(4), ""), Value: value}},
+		Status:     status,
+		Category: []fhir.CodeableConcept{{Coding: []fhir.Coding{{
+			System: fhir.ObservationCategorySystem, Code: "laboratory", Display: "Laboratory",
+		}}}},
+		Code:    concept(code),
+		Subject: &fhir.Reference{Reference: fhir.PatientType + "/" + patient.ID},
+	}
+	if encounter != nil {
+		observation.Encounter = &fhir.Reference{Reference: fhir.EncounterType + "/" + encounter.ID}
+	}
+
+	effective, err := m.dateTimeField(obx, 14)
+	if err == nil && effective == "" {
+		effective, err = m.dateTimeField(obr, 7)
+	}
+	if err != nil {
+		return nil, err
+	}
+	observation.EffectiveDateTime = effective
+	if err := m.value(obx, observation); err != nil {
+		return nil, err
+	}
+	for _, flag := range obx.Repetitions(8) {
+		if flag.Value() != "" {
+			observation.Interpretation = append(observation.Interpretation, fhir.CodeableConcept{
+				Coding: []fhir.Coding{{System: fhir.ObservationInterpretationSystem, Code: flag.Value()}},
+			})
+		}
+	}
+	if referenceRange := obx.Field(7).Value(); referenceRange != "" {
+		observation.ReferenceRange = []fhir.ObservationReferenceRange{rangeOf(referenceRange, observation.ValueQuantity)}
+	}
+	return observation, nil
+}
+
+// value maps OBX-5 as the value type of OBX-2 tells
+func (m *mapper) value(obx Segment, observation *fhir.Observation) error {
+	result := obx.Field(5)
+	if result.Empty() {
+		return nil
+	}
+	switch valueType := obx.Field(2).Value(); valueType {
+	case "NM":
+		number, err := strconv.ParseFloat(strings.TrimSpace(result.Value()), 64)
+		if err != nil {
+			return fieldError(obx, 5, ErrorDataType, "%q is not a number", result.Value())
+		}
+		observation.ValueQuantity = quantity(number, "", obx.Field(6))
+	case "SN":
+		comparator, separator := result.Component(1), result.Component(3)
+		low, err := strconv.ParseFloat(result.Component(2), 64)
+		if err != nil || !slices.Contains([]string{"", "<", "<=", ">=", ">"}, comparator) || !slices.Contains([]string{"", "-"}, separator) {
+			return fieldError(obx, 5, ErrorDataType, "unsupported structured numeric %q", result.raw)
+		}
+		if separator == "" {
+			observation.ValueQuantity = quantity(low, comparator, obx.Field(6))
+			break
+		}
+		high, err := strconv.ParseFloat(result.Component(4), 64)
+		if err != nil || comparator != "" {
+			return fieldError(obx, 5, ErrorDataType, "unsupported structured numeric %q", result.raw)
+		}
+		observation.ValueRange = &fhir.Range{Low: quantity(low, "", obx.Field(6)), High: quantity(high, "", obx.Field(6))}
+	case "ST", "TX", "FT":
+		observation.ValueString = text(obx.Repetitions(5))
+	case "CE", "CWE", "CNE":
+		value := concept(result)
+		observation.ValueCodeableConcept = &value
+	case "DT", "TS", "DTM":
+		converted, err := m.dateTimeField(obx, 5)
+		if err != nil {
+			return err
+		}
+		observation.ValueDateTime = converted
+	default:
+		return fieldError(obx, 2, ErrorDataType, "unsupported value type %q", valueType)
+	}
+	return nil
+}
+
+// writeObservation creates or updates the observation mapped from obx, found by its identifier
+func (m *mapper) writeObservation(obx Segment, observation *fhir.Observation) error {
+	if err := observation.Validate(); err != nil {
+		return &Error{Location: obx.Location(0), Code: ErrorDataType, Err: err}
+	}
+	match := func(o *fhir.Observation) bool { return anyIdentifier(o.Identifier, observation.Identifier) }
+	for existing, err := range m.tx.Observations().Search(m.ctx, match, identifierCondition(observation.Identifier, false)...) {
+		if err != nil {
+			return err
+		}
+		observation.ID = existing.ID
+		break
+	}
+
+	created := observation.ID == ""
+	var err error
+	if created {
+		observation, err = m.tx.CreateObservation(m.ctx, observation)
+	} else {
+		observation, _, err = m.tx.UpdateObservation(m.ctx, observation, "")
+	}
+	if err != nil {
+		return writeError(obx, err)
+	}
+	m.changes = append(m.changes, Change{Resource: observation, Created: created})
+	return nil
+}
+
+// quantity maps a number in the units of a CWE, coded in UCUM when the unit is a UCUM code
+func quantity(value float64, comparator string, units Field) *fhir.Quantity {
+	q := &fhir.Quantity{Value: &value, Comparator: comparator, Unit: units.Component(2)}
+	if code := units.Value(); code != "" {
+		if _, err := fhir.ParseUnit(code); err == nil {
+			q.System, q.Code = fhir.UCUMSystem, code
+		}
+		if q.Unit == "" {
+			q.Unit = code
+		}
+	}
+	return q
+}
+
+// rangeOf maps the reference range of OBX-7: bounds in the units of the value when it is a quantity, text otherwise
+func rangeOf(value string, unit *fhir.Quantity) fhir.ObservationReferenceRange {
+	bound := func(number string) *fhir.Quantity {
+		parsed, _ := strconv.ParseFloat(number, 64)
+		return &fhir.Quantity{Value: &parsed, Unit: unit.Unit, System: unit.System, Code: unit.Code}
+	}
+	if unit != nil {
+		trimmed := strings.TrimSpace(value)
+		if parts := numericRange.FindStringSubmatch(trimmed); parts != nil {
+			return fhir.ObservationReferenceRange{Low: bound(parts[1]), High: bound(parts[2])}
+		}
+		for _, prefix := range []string{"<=", "<", ">=", ">"} {
+			number := strings.TrimSpace(strings.TrimPrefix(trimmed, prefix))
+			if _, err := strconv.ParseFloat(number, 64); err != nil || !strings.HasPrefix(trimmed, prefix) {
+				continue
+			}
+			if strings.HasPrefix(prefix, "<") {
+				return fhir.ObservationReferenceRange{High: bound(number)}
+			}
+			return fhir.ObservationReferenceRange{Low: bound(number)}
+		}
+	}
+	return fhir.ObservationReferenceRange{Text: value}
+}
+
+/* === Data types === */
+
+// dateTimeField converts the timestamp of field n of segment into a FHIR dateTime, "" when it is empty
+func (m *mapper) dateTimeField(segment Segment, n int) (string, error) {
+	value := segment.Field(n).Value()
+	if value == "" {
+		return "", nil
+	}
+	converted, err := dateTime(value, m.location)
+	if err != nil {
+		return "", fieldError(segment, n, ErrorDataType, "%v", err)
+	}
+	return converted, nil
+}
+
+// system returns the identifier system of an assigning authority: CodiceFiscaleSystem for codici fiscali, the OID
+// of the authority when it has one, otherwise a URN of its namespace or, lacking one, of the sending application
+func (m *mapper) system(namespace, universalID, universalIDType, typeCode string) string {
+	switch {
+	case typeCode == "NNITA" || universalID == codiceFiscaleOID:
+		return fhir.CodiceFiscaleSystem
+	case universalID != "" && strings.EqualFold(universalIDType, "ISO"):
+		return "urn:oid:" + universalID
+	case namespace != "":
+		return localSystem + url.PathEscape(namespace)
+	}
+	return localSystem + url.PathEscape(m.message.Header().Field(3).Value())
+}
+
+// concept maps a CWE, its identifier and alternate identifier becoming codings
+func concept(cwe Field) fhir.CodeableConcept {
+	var c fhir.CodeableConcept
+	for _, n := range []int{1, 4} {
+		if code := cwe.Component(n); code != "" {
+			c.Coding = append(c.Coding, fhir.Coding{System: codeSystem(cwe.Component(n + 2)), Code: code, Display: cwe.Component(n + 1)})
+		}
+	}
+	if len(c.Coding) == 0 {
+		c.Text = cwe.Component(2)
+	}
+	return c
+}
+
+// codeSystem returns the system of a coding system of HL7 table 0396
+func codeSystem(name string) string {
+	switch name {
+	case "":
+		return ""
+	case "LN":
+		return fhir.LOINCSystem
+	case "UCUM":
+		return fhir.UCUMSystem
+	case "SCT", "SNM":
+		return snomedSystem
+	}
+	return localSystem + "codesystem:" + url.PathEscape(name)
+}
+
+// text joins the repetitions of a text field as lines
+func text(repetitions []Field) string {
+	lines := make([]string, 0, len(repetitions))
+	for _, repetition := range repetitions {
+		lines = append(lines, repetition.Value())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// identifierCondition narrows a search to the resources having one of identifiers, as anyIdentifier matches them.
+// Codici fiscali match in any writing, which only the codice-fiscale parameter of patients indexes: without it
+// the search is not narrowed.
+func identifierCondition(identifiers []fhir.Identifier, codiceFiscale bool) []fhir.IndexCondition {
+	condition := make(fhir.IndexCondition, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		term := fhir.IndexTerm{Param: "identifier", Token: fhir.Token{System: identifier.System, Code: identifier.Value}}
+		if identifier.System == fhir.CodiceFiscaleSystem {
+			if !codiceFiscale {
+				return nil
+			}
+			term = fhir.IndexTerm{Param: "codice-fiscale", Token: fhir.Token{System: identifier.System, Code: fhir.NormalizeCodiceFiscale(identifier.Value)}}
+		}
+		condition = append(condition, term)
+	}
+	if len(condition) == 0 {
+		return nil
+	}
+	return []fhir.IndexCondition{condition}
+}
+
+// anyIdentifier tells whether identifiers holds one of wanted, codici fiscali being compared normalized
+func anyIdentifier(identifiers, wanted []fhir.Identifier) bool {
+	for _, identifier := range identifiers {
+		for _, w := range wanted {
+			if identifier.System != w.System {
+				continue
+			}
+			if identifier.Value == w.Value ||
+				identifier.System == fhir.CodiceFiscaleSystem && fhir.NormalizeCodiceFiscale(identifier.Value) == fhir.NormalizeCodiceFiscale(w.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+// Package hl7 ingests HL7 v2 messages: it parses their pipe-delimited segments, maps the ADT and ORU messages to
+// the patients, encounters and observations of the service and builds the ACK answering each of them.
+package hl7
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrMalformed is returned for data that is not an HL7 v2 message in ER7, the pipe-delimited encoding
+var ErrMalformed = errors.New("malformed HL7 v2 message")
+
+// Encoding holds the delimiters of a message, declared by MSH-1 and MSH-2
+type Encoding struct {
+	Field, Component, Repetition, Escape, Subcomponent byte
+}
+
+// DefaultEncoding is |^~\&, the delimiters of the messages built by this package
+var DefaultEncoding = Encoding{Field: '|', Component: '^', Repetition: '~', Escape: '\\', Subcomponent: '&'}
+
+// Message is a parsed HL7 v2 message, its first segment being MSH
+type Message struct {
+	Encoding Encoding
+	Segments []Segment
+}
+
+// Segment is a segment of a message. Its fields are numbered from 1 as in the standard, MSH-1 being the field
+// separator itself and MSH-2 the other delimiters.
+type Segment struct {
+	Name string
+	// Sequence numbers the segments of the same name from 1, in the order of the message
+	Sequence int
+	fields   []string
+	encoding *Encoding
+}
+
+// Field is a field of a segment, holding its components and subcomponents escaped as received
+type Field struct {
+	raw      string
+	encoding *Encoding
+}
+
+// Parse reads a message in ER7. Segments may be terminated by carriage returns, as the standard requires, or by
+// line feeds; blank lines are ignored.
+func Parse(data []byte) (*Message, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\r")
+	text = strings.ReplaceAll(text, "\n", "\r")
+	text = strings.Trim(text, "\r")
+	if !strings.HasPrefix(text, "MSH") || len(text) < 8 {
+		return nil, fmt.Errorf("%w: it must start with an MSH segment", ErrMalformed)
+	}
+
+	separator := text[3]
+	delimiters, _, _ := strings.Cut(text[4:], string(separator))
+	// HL7 v2.7 adds a fifth delimiter, the truncation character, which is not needed to read the fields
+	if len(delimiters) != 4 && len(delimiters) != 5 {
+		return nil, fmt.Errorf("%w: MSH-2 must hold the 4 encoding characters, got %q", ErrMalformed, delimiters)
+	}
+	encoding := &Encoding{Field: separator, Component: delimiters[0], Repetition: delimiters[1], Escape: delimiters[2], Subcomponent: delimiters[3]}
+	seen := map[byte]bool{}
+	for _, d := range []byte{separator, delimiters[0], delimiters[1], delimiters[2], delimiters[3]} {
+		if seen[d] || isAlphanumeric(d) || d == '\r' {
+			return nil, fmt.Errorf("%w: the delimiters %q must be distinct and not letters or digits", ErrMalformed, string(separator)+delimiters)
+		}
+		seen[d] = true
+	}
+
+	message := &Message{Encoding: *encoding}
+	sequences := map[string]int{}
+	for _, line := range strings.Split(text, "\r") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, string(separator))
+		name := fields[0]
+		if !validSegmentName(name) {
+			return nil, fmt.Errorf("%w: %q is not a segment name", ErrMalformed, name)
+		}
+		if name == "MSH" {
+			if len(message.Segments) > 0 {
+				return nil, fmt.Errorf("%w: a message holds a single MSH segment", ErrMalformed)
+			}
+			// MSH-1 is the separator the line was split on, so that fields[n] is MSH-n as for the other segments
+			fields = append([]string{name, string(separator)}, fields[1:]...)
+		}
+		sequences[name]++
+		message.Segments = append(message.Segments, Segment{Name: name, Sequence: sequences[name], fields: fields, encoding: &message.Encoding})
+	}
+	return message, nil
+}
+
+func validSegmentName(name string) bool {
+	if len(name) != 3 || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isAlphanumeric(name[i]) || (name[i] >= 'a' && name[i] <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
+
+/* === Message === */
+
+// Header returns the MSH segment
+func (m *Message) Header() Segment {
+	return m.Segments[0]
+}
+
+// Type returns the message code and trigger event of MSH-9, such as "ADT^A01", or only the code when the message
+// has no event
+func (m *Message) Type() string {
+	messageType := m.Header().Field(9)
+	if event := messageType.Component(2); event != "" {
+		return messageType.Component(1) + "^" + event
+	}
+	return messageType.Component(1)
+}
+
+// ControlID returns MSH-10, the identifier the sender assigned to the message
+func (m *Message) ControlID() string {
+	return m.Header().Field(10).Value()
+}
+
+// Sender returns the sending application and facility of MSH-3 and MSH-4, joined by "|"
+func (m *Message) Sender() string {
+	header := m.Header()
+	return header.Field(3).Value() + "|" + header.Field(4).Value()
+}
+
+// All returns the segments named name, in their order
+func (m *Message) All(name string) []Segment {
+	var segments []Segment
+	for _, segment := range m.Segments {
+		if segment.Name == name {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// First returns the first segment named name, ok being false when the message has none
+func (m *Message) First(name string) (segment Segment, ok bool) {
+	for _, segment := range m.Segments {
+		if segment.Name == name {
+			return segment, true
+		}
+	}
+	return Segment{}, false
+}
+
+/* === Segments and fields === */
+
+// Field returns the first repetition of field n, empty when the segment does not have it
+func (s Segment) Field(n int) Field {
+	repetitions := s.Repetitions(n)
+	if len(repetitions) == 0 {
+		return Field{encoding: s.encoding}
+	}
+	return repetitions[0]
+}
+
+// Repetitions returns the repetitions of field n, none when it is empty. MSH-1 and MSH-2 are returned as they are.
+func (s Segment) Repetitions(n int) []Field {
+	if n < 1 || n >= len(s.fields) || s.fields[n] == "" {
+		return nil
+	}
+	if s.Name == "MSH" && n <= 2 {
+		return []Field{{raw: s.fields[n]}}
+	}
+	var repetitions []Field
+	for _, raw := range strings.Split(s.fields[n], string(s.encoding.Repetition)) {
+		repetitions = append(repetitions, Field{raw: raw, encoding: s.encoding})
+	}
+	return repetitions
+}
+
+// Location locates field n of the segment as ERR-2 does, segment^sequence^field, the whole segment when n is 0
+func (s Segment) Location(n int) string {
+	location := s.Name + "^" + strconv.Itoa(s.Sequence)
+	if n > 0 {
+		location += "^" + strconv.Itoa(n)
+	}
+	return location
+}
+
+// Empty tells whether the field has no value
+func (f Field) Empty() bool {
+	return f.raw == ""
+}
+
+// Value returns the first subcomponent of the first component, the whole value of fields of primitive types
+func (f Field) Value() string {
+	return f.Subcomponent(1, 1)
+}
+
+// Component returns the first subcomponent of component n, numbered from 1
+func (f Field) Component(n int) string {
+	return f.Subcomponent(n, 1)
+}
+
+// Subcomponent returns subcomponent sub of component n, both numbered from 1, unescaped
+func (f Field) Subcomponent(n, sub int) string {
+	if f.encoding == nil {
+		if n == 1 && sub == 1 {
+			return f.raw
+		}
+		return ""
+	}
+	components := strings.Split(f.raw, string(f.encoding.Component))
+	if n < 1 || n > len(components) {
+		return ""
+	}
+	subcomponents := strings.Split(components[n-1], string(f.encoding.Subcomponent))
+	if sub < 1 || sub > len(subcomponents) {
+		return ""
+	}
+	return f.encoding.Decode(subcomponents[sub-1])
+}
+
+/* === Escaping === */
+
+// Decode replaces the escape sequences of a value with the characters they stand for: \F\, \S\, \T\, \R\ and \E\
+// for the delimiters, \Xhh..\ for the bytes hh, and \.br\ for a line break. Formatting sequences such as \H\ are
+// dropped.
+func (e Encoding) Decode(value string) string {
+	escape := string(e.Escape)
+	if !strings.Contains(value, escape) {
+		return value
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(value, escape)
+		if start < 0 {
+			b.WriteString(value)
+			return b.String()
+		}
+		end := strings.Index(value[start+1:], escape)
+		if end < 0 {
+			// an escape character without its closing one is kept as it is
+			b.WriteString(value)
+			return b.String()
+		}
+		b.WriteString(value[:start])
+		sequence := value[start+1 : start+1+end]
+		value = value[start+2+end:]
+		switch {
+		case sequence == "F":
+			b.WriteByte(e.Field)
+		case sequence == "S":
+			b.WriteByte(e.Component)
+		case sequence == "T":
+			b.WriteByte(e.Subcomponent)
+		case sequence == "R":
+			b.WriteByte(e.Repetition)
+		case sequence == "E":
+			b.WriteByte(e.Escape)
+		case sequence == ".br":
+			b.WriteByte('\n')
+		case strings.HasPrefix(sequence, "X"):
+			if decoded, err := hex.DecodeString(sequence[1:]); err == nil {
+				b.Write(decoded)
+			}
+		}
+	}
+}
+
+// Encode replaces the delimiters in value with their escape sequences, and line breaks with \.br\
+func (e Encoding) Encode(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case e.Field:
+			b.WriteString(e.sequence("F"))
+		case e.Component:
+			b.WriteString(e.sequence("S"))
+		case e.Subcomponent:
+			b.WriteString(e.sequence("T"))
+		case e.Repetition:
+			b.WriteString(e.sequence("R"))
+		case e.Escape:
+			b.WriteString(e.sequence("E"))
+		case '\r':
+		case '\n':
+			b.WriteString(e.sequence(".br"))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (e Encoding) sequence(code string) string {
+	return string(e.Escape) + code + string(e.Escape)
+}
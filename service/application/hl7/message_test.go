@@ -0,0 +1,200 @@
+package hl7
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const admission = "MSH|^~\\&|ADT|OSP_RAVENNA|CCE|AUSL|20240501083000||ADT^A01^ADT_A01|MSG0001|P|2.5\r" +
+	"EVN|A01|20240501083000\r" +
+	"PID|1||RSSMRA85T10A562S^^^MEF&2.16.840.1.113883.2.9.4.3.2&ISO^NNITA~12345^^^OSP_RAVENNA^MR||Rossi^Mario^^^Dott.||19851210|M|||Via Roma 1^^Ravenna^RA^48121^ITA^H||0544 123456^PRN^PH\r" +
+	"PV1|1|I|MED1^101^A|||||D001^Bianchi^Anna|||||||||||V2024-0001^^^OSP_RAVENNA|||||||||||||||||||||||||20240501080000\r"
+
+func TestParse(t *testing.T) {
+	message, err := Parse([]byte(admission))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got := message.Type(); got != "ADT^A01" {
+		t.Errorf("Type() = %q, want ADT^A01", got)
+	}
+	if got := message.ControlID(); got != "MSG0001" {
+		t.Errorf("ControlID() = %q, want MSG0001", got)
+	}
+	if got := message.Sender(); got != "ADT|OSP_RAVENNA" {
+		t.Errorf("Sender() = %q", got)
+	}
+	header := message.Header()
+	if got := header.Field(1).Value(); got != "|" {
+		t.Errorf("MSH-1 = %q, want the field separator", got)
+	}
+	if got := header.Field(2).Value(); got != "^~\\&" {
+		t.Errorf("MSH-2 = %q, want the encoding characters", got)
+	}
+
+	pid, ok := message.First("PID")
+	if !ok {
+		t.Fatal("First(PID) found no segment")
+	}
+	identifiers := pid.Repetitions(3)
+	if len(identifiers) != 2 {
+		t.Fatalf("PID-3 has %d repetitions, want 2", len(identifiers))
+	}
+	if got := identifiers[0].Subcomponent(4, 2); got != "2.16.840.1.113883.2.9.4.3.2" {
+		t.Errorf("PID-3.4.2 = %q", got)
+	}
+	if got := identifiers[1].Component(5); got != "MR" {
+		t.Errorf("PID-3.5 of the second repetition = %q, want MR", got)
+	}
+	if got := pid.Field(5).Component(5); got != "Dott." {
+		t.Errorf("PID-5.5 = %q", got)
+	}
+	if got := pid.Field(99).Value(); got != "" {
+		t.Errorf("a missing field = %q, want it empty", got)
+	}
+	if got := pid.Location(3); got != "PID^1^3" {
+		t.Errorf("Location(3) = %q, want PID^1^3", got)
+	}
+}
+
+func TestParseLineEndings(t *testing.T) {
+	for name, separator := range map[string]string{"line feeds": "\n", "carriage return line feeds": "\r\n"} {
+		t.Run(name, func(t *testing.T) {
+			message, err := Parse([]byte(strings.ReplaceAll(admission, "\r", separator) + separator))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(message.Segments) != 4 {
+				t.Errorf("Parse() found %d segments, want 4", len(message.Segments))
+			}
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := map[string]string{
+		"empty":                "",
+		"no header":            "PID|1||123\r",
+		"short encoding":       "MSH|^~|ADT\r",
+		"repeated delimiter":   "MSH|^^\\&|ADT\r",
+		"invalid segment name": "MSH|^~\\&|ADT\rpid|1\r",
+		"second header":        "MSH|^~\\&|ADT\rMSH|^~\\&|ADT\r",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(data)); !errors.Is(err, ErrMalformed) {
+				t.Errorf("Parse() error = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	tests := []struct {
+		escaped, value string
+	}{
+		{escaped: `Rossi \T\ Figli`, value: "Rossi & Figli"},
+		{escaped: `a\F\b\S\c\R\d\E\e`, value: `a|b^c~d\e`},
+		{escaped: `riga 1\.br\riga 2`, value: "riga 1\nriga 2"},
+		{escaped: `\X4869\`, value: "Hi"},
+		{escaped: `\H\grassetto\N\`, value: "grassetto"},
+		{escaped: `senza\chiusura`, value: `senza\chiusura`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := DefaultEncoding.Decode(tt.escaped); got != tt.value {
+				t.Errorf("Decode(%q) = %q, want %q", tt.escaped, got, tt.value)
+			}
+		})
+	}
+
+	value := "a|b^c~d\\e&f\ng"
+	if got := DefaultEncoding.Decode(DefaultEncoding.Encode(value)); got != value {
+		t.Errorf("Decode(Encode(%q)) = %q", value, got)
+	}
+}
+
+func TestAck(t *testing.T) {
+	message, err := Parse([]byte(admission))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ack, err := Parse(Ack(message, AckError, Issue{Location: "PID^1^7", Code: ErrorDataType, Text: "data di nascita | errata"}))
+	if err != nil {
+		t.Fatalf("the ACK does not parse: %v", err)
+	}
+	header := ack.Header()
+	if got := ack.Type(); got != "ACK^A01" {
+		t.Errorf("ACK type = %q, want ACK^A01", got)
+	}
+	if header.Field(3).Value() != "CCE" || header.Field(5).Value() != "ADT" || header.Field(6).Value() != "OSP_RAVENNA" {
+		t.Errorf("the ACK must swap the sender and the receiver, got MSH-3..6 %q %q %q %q",
+			header.Field(3).Value(), header.Field(4).Value(), header.Field(5).Value(), header.Field(6).Value())
+	}
+	if got := len(ack.ControlID()); got != 20 {
+		t.Errorf("the ACK control ID has %d characters, want 20", got)
+	}
+	msa, _ := ack.First("MSA")
+	if msa.Field(1).Value() != "AE" || msa.Field(2).Value() != "MSG0001" {
+		t.Errorf("MSA = %q^%q, want AE^MSG0001", msa.Field(1).Value(), msa.Field(2).Value())
+	}
+	errSegment, ok := ack.First("ERR")
+	if !ok {
+		t.Fatal("the ACK has no ERR segment")
+	}
+	if got := errSegment.Field(2).raw; got != "PID^1^7" {
+		t.Errorf("ERR-2 = %q, want PID^1^7", got)
+	}
+	if got := errSegment.Field(3).Value(); got != string(ErrorDataType) {
+		t.Errorf("ERR-3 = %q, want %s", got, ErrorDataType)
+	}
+	if got := errSegment.Field(8).Value(); got != "data di nascita | errata" {
+		t.Errorf("ERR-8 = %q, want the text unescaped", got)
+	}
+
+	rejected, err := Parse(Ack(nil, AckReject))
+	if err != nil {
+		t.Fatalf("the ACK of an unparsable message does not parse: %v", err)
+	}
+	if msa, _ := rejected.First("MSA"); msa.Field(1).Value() != "AR" || msa.Field(2).Value() != "" {
+		t.Errorf("MSA = %q^%q, want AR and no control ID", msa.Field(1).Value(), msa.Field(2).Value())
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	tests := []struct {
+		value, want string
+		wantErr     bool
+	}{
+		{value: "2024", want: "2024"},
+		{value: "202405", want: "2024-05"},
+		{value: "20240501", want: "2024-05-01"},
+		{value: "202405010830", want: "2024-05-01T08:30:00+02:00"},
+		{value: "20240501083015", want: "2024-05-01T08:30:15+02:00"},
+		{value: "20240501083015.25", want: "2024-05-01T08:30:15.25+02:00"},
+		{value: "20240101083015+0000", want: "2024-01-01T08:30:15Z"},
+		{value: "2024050108", want: "2024-05-01T08:00:00+02:00"},
+		{value: "20240231", wantErr: true},
+		{value: "2024-05-01", wantErr: true},
+		{value: "2024051", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := dateTime(tt.value, rome)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dateTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("dateTime() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
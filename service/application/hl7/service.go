@@ -0,0 +1,157 @@
+package hl7
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"service/application/clinical"
+)
+
+// errAccepted rolls back the transaction of a message that another instance of the service accepted already
+var errAccepted = errors.New("message accepted already")
+
+// Outcome is how a message was processed
+type Outcome string
+
+const (
+	OutcomeAccepted  Outcome = "accepted"
+	OutcomeError     Outcome = "error"
+	OutcomeRejected  Outcome = "rejected"
+	OutcomeDuplicate Outcome = "duplicate"
+)
+
+// Options configure the processing of messages
+type Options struct {
+	// DedupTTL bounds how long accepted messages are remembered by control ID, in the message log of the store;
+	// DedupSize bounds how many of them each instance keeps in memory as well
+	DedupTTL  time.Duration
+	DedupSize int
+	// Location is the zone of the timestamps without offset, time.Local when nil
+	Location *time.Location
+}
+
+// Result is the processing of a message
+type Result struct {
+	// ACK answers the message
+	ACK     []byte
+	Outcome Outcome
+	// MessageType, Sender and ControlID identify the message, they are empty when it could not be parsed
+	MessageType string
+	Sender      string
+	ControlID   string
+	// Changes are the resources written, there are none unless the message was accepted
+	Changes []Change
+	// Err is why the message was not accepted: an *Error for its content, any other error for a failure of the
+	// service
+	Err error
+}
+
+// Service processes HL7 v2 messages, writing the resources they carry through the clinical rules
+type Service struct {
+	clinical *clinical.Service
+	location *time.Location
+	// accepted remembers the messages accepted by this instance, the message log of the store those of every one
+	accepted *dedup
+	dedupTTL time.Duration
+}
+
+// NewService returns a service writing through clinicalService
+func NewService(clinicalService *clinical.Service, opts Options) *Service {
+	location := opts.Location
+	if location == nil {
+		location = time.Local
+	}
+	return &Service{
+		clinical: clinicalService, location: location,
+		accepted: newDedup(opts.DedupTTL, opts.DedupSize), dedupTTL: opts.DedupTTL,
+	}
+}
+
+// Process parses a message, writes the resources it carries in one transaction and returns the ACK answering it.
+// A message accepted earlier, by sender and control ID, is answered with the same ACK without being processed
+// again, whichever instance of the service accepted it; a copy sent while the message is processed waits for its
+// outcome.
+func (s *Service) Process(ctx context.Context, data []byte) Result {
+	message, err := Parse(data)
+	if err != nil {
+		return Result{ACK: Ack(nil, AckReject, Issue{Location: "MSH", Code: ErrorSegmentSequence, Text: err.Error()}), Outcome: OutcomeRejected, Err: err}
+	}
+	result := Result{MessageType: message.Type(), Sender: message.Sender(), ControlID: message.ControlID()}
+	header := message.Header()
+
+	if result.ControlID == "" {
+		return result.reject(message, fieldError(header, 10, ErrorRequiredField, "the message control ID is required"))
+	}
+	if version := header.Field(12).Value(); version != "" && !strings.HasPrefix(version, "2.") {
+		return result.reject(message, fieldError(header, 12, ErrorUnsupportedVersion, "unsupported version %q, messages must be HL7 v2", version))
+	}
+	process, ok := handler(result.MessageType)
+	if !ok {
+		code := ErrorUnsupportedMessage
+		if messageCode := header.Field(9).Component(1); messageCode == "ADT" || messageCode == "ORU" {
+			code = ErrorUnsupportedEvent
+		}
+		return result.reject(message, fieldError(header, 9, code, "unsupported message type %q", result.MessageType))
+	}
+
+	key := result.Sender + "|" + result.ControlID
+	ack, finish, err := s.accepted.begin(ctx, key)
+	if err != nil {
+		return result.fail(message, err)
+	}
+	if ack != nil {
+		result.ACK, result.Outcome = ack, OutcomeDuplicate
+		return result
+	}
+
+	var accepted []byte
+	// deferred so that the copies waiting for the message are released even if its processing panics
+	defer func() { finish(accepted) }()
+
+	// the acceptance is recorded in the transaction writing the resources, so that another instance of the
+	// service receiving a copy waits for it and answers with its ACK
+	ack = Ack(message, AckAccept)
+	m := &mapper{ctx: ctx, message: message, location: s.location}
+	err = s.clinical.Transact(ctx, func(tx *clinical.Tx) error {
+		earlier, err := tx.Messages().Accept(ctx, key, ack, s.dedupTTL)
+		if err != nil {
+			return err
+		}
+		if earlier != nil {
+			ack = earlier
+			return errAccepted
+		}
+		m.tx, m.changes = tx, nil
+		return process(m)
+	})
+	if errors.Is(err, errAccepted) {
+		accepted, result.ACK, result.Outcome = ack, ack, OutcomeDuplicate
+		return result
+	}
+	if err != nil {
+		return result.fail(message, err)
+	}
+	accepted = ack
+	result.ACK, result.Outcome, result.Changes = accepted, OutcomeAccepted, m.changes
+	return result
+}
+
+// reject answers AR to a message that cannot be processed as it is
+func (r Result) reject(message *Message, err *Error) Result {
+	r.ACK, r.Outcome, r.Err = Ack(message, AckReject, err.Issues()...), OutcomeRejected, err
+	return r
+}
+
+// fail answers AE to a message that could not be processed: the issues of its content, or a failure of the
+// service without its details, the message being sent again later
+func (r Result) fail(message *Message, err error) Result {
+	var contentErr *Error
+	issues := []Issue{{Code: ErrorApplication, Text: "the message could not be processed, send it again later"}}
+	if errors.As(err, &contentErr) {
+		issues = contentErr.Issues()
+	}
+	r.ACK, r.Outcome, r.Err = Ack(message, AckError, issues...), OutcomeError, err
+	return r
+}
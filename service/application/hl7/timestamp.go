@@ -0,0 +1,63 @@
+package hl7
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// timestampPattern matches an HL7 DTM: YYYY[MM[DD[HH[MM[SS[.S[S[S[S]]]]]]]]][+/-ZZZZ]
+var timestampPattern = regexp.MustCompile(`^(\d{4}(?:\d{2}(?:\d{2})?)?)(\d{2}(?:\d{2}(?:\d{2}(?:\.\d{1,4})?)?)?)?([+-]\d{4})?$`)
+
+// dateTime converts an HL7 timestamp into a FHIR dateTime: dates keep their precision, times are given to the
+// second with their offset, location being the zone of those that have none
+func dateTime(value string, location *time.Location) (string, error) {
+	parts := timestampPattern.FindStringSubmatch(value)
+	if parts == nil {
+		return "", fmt.Errorf("must be a timestamp as YYYYMMDDHHMMSS, got %q", value)
+	}
+	day, clock, offset := parts[1], parts[2], parts[3]
+	if clock == "" {
+		return date(day)
+	}
+	if len(day) != len("20060102") {
+		return "", fmt.Errorf("must have a full date before its time, got %q", value)
+	}
+
+	var layout string
+	if i := strings.IndexByte(clock, '.'); i >= 0 {
+		layout = "20060102150405." + strings.Repeat("0", len(clock)-i-1)
+	} else {
+		layout = "20060102" + "150405"[:len(clock)]
+	}
+	if offset != "" {
+		layout += "-0700"
+	}
+	t, err := time.ParseInLocation(layout, day+clock+offset, location)
+	if err != nil {
+		return "", fmt.Errorf("must be a valid timestamp, got %q", value)
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// date converts the date of an HL7 timestamp into a FHIR date, ignoring its time
+func date(value string) (string, error) {
+	parts := timestampPattern.FindStringSubmatch(value)
+	if parts == nil {
+		return "", fmt.Errorf("must be a date as YYYYMMDD, got %q", value)
+	}
+	day := parts[1]
+	layout := "20060102"[:len(day)]
+	t, err := time.Parse(layout, day)
+	if err != nil {
+		return "", fmt.Errorf("must be a valid date, got %q", value)
+	}
+	switch len(day) {
+	case len("2006"):
+		return t.Format("2006"), nil
+	case len("200601"):
+		return t.Format("2006-01"), nil
+	}
+	return t.Format(time.DateOnly), nil
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned when no blob is stored under a key
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps the content of documents, whatever the backend, as blobs addressed by key. Blobs are never
+// modified once written; keys are made of letters, digits, '-' and '.'.
+type BlobStore interface {
+	// Put stores the content read from r under key. When reading r fails, nothing is stored and the error is
+	// returned, so that a reader checking the content at EOF can refuse it.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the content stored under key for reading, ErrBlobNotFound when there is none; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the content stored under key, deleting a missing key does nothing
+	Delete(ctx context.Context, key string) error
+	// Ping checks that the backend can be reached
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,473 @@
+// Package storagetest checks that a storage.Store behaves as the service expects, every backend running the same
+// tests against its own store.
+package storagetest
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"service/application/fhir"
+	"service/application/storage"
+)
+
+// errRollback makes a transaction fail on purpose
+var errRollback = errors.New("rollback")
+
+// Run runs the store tests, open returning an empty store that the tests close
+func Run(t *testing.T, open func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store storage.Store)
+	}{
+		{name: "versions", test: testVersions},
+		{name: "update creates", test: testUpdateCreates},
+		{name: "search", test: testSearch},
+		{name: "indexed search", test: testIndexedSearch},
+		{name: "page", test: testPage},
+		{name: "transactions", test: testTransactions},
+		{name: "messages", test: testMessages},
+		{name: "resource types", test: testResourceTypes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := open(t)
+			t.Cleanup(func() {
+				if err := store.Close(); err != nil {
+					t.Errorf("Close() error = %v", err)
+				}
+			})
+			if err := store.Ping(t.Context()); err != nil {
+				t.Fatalf("Ping() error = %v", err)
+			}
+			tt.test(t, store)
+		})
+	}
+}
+
+func newPatient(family string) *fhir.Patient {
+	return &fhir.Patient{
+		Base: fhir.Base{ResourceType: fhir.PatientType},
+		Name: []fhir.HumanName{{Family: family}},
+	}
+}
+
+func testVersions(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	patients := store.Patients()
+
+	created, err := patients.Create(ctx, newPatient("Rossi"))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	id := created.ID
+	if !fhir.ValidID(id) || created.Meta.VersionID != "1" || created.Meta.LastUpdated == nil {
+		t.Fatalf("Create() = %+v, want an id, version 1 and lastUpdated", created.Base)
+	}
+
+	update := newPatient("Bianchi")
+	update.ID = id
+	if _, _, err := patients.Update(ctx, update, "2"); !errors.Is(err, fhir.ErrVersionConflict) {
+		t.Errorf("Update() with a stale version error = %v, want ErrVersionConflict", err)
+	}
+	updated, isNew, err := patients.Update(ctx, update, "1")
+	if err != nil || isNew || updated.Meta.VersionID != "2" {
+		t.Fatalf("Update() = %+v, %v, %v, want version 2", updated.Meta, isNew, err)
+	}
+	if update.Meta != nil {
+		t.Errorf("Update() modified the resource passed in")
+	}
+
+	first, err := patients.VRead(ctx, id, "1")
+	if err != nil || first.Name[0].Family != "Rossi" {
+		t.Errorf("VRead(1) = %+v, %v, want the first version", first, err)
+	}
+	current, err := patients.Read(ctx, id)
+	if err != nil || current.Name[0].Family != "Bianchi" || current.Meta.VersionID != "2" {
+		t.Errorf("Read() = %+v, %v, want the second version", current, err)
+	}
+
+	if err := patients.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := patients.Delete(ctx, id); err != nil {
+		t.Errorf("Delete() of a deleted resource error = %v", err)
+	}
+	if _, err := patients.Read(ctx, id); !errors.Is(err, fhir.ErrDeleted) {
+		t.Errorf("Read() after delete error = %v, want ErrDeleted", err)
+	}
+	if _, err := patients.VRead(ctx, id, "3"); !errors.Is(err, fhir.ErrDeleted) {
+		t.Errorf("VRead(3) error = %v, want ErrDeleted", err)
+	}
+	for _, version := range []string{"4", "0", "x"} {
+		if _, err := patients.VRead(ctx, id, version); !errors.Is(err, fhir.ErrNotFound) {
+			t.Errorf("VRead(%s) error = %v, want ErrNotFound", version, err)
+		}
+	}
+
+	// updating a deleted resource brings it back as a new version
+	restored, isNew, err := patients.Update(ctx, update, "")
+	if err != nil || isNew || restored.Meta.VersionID != "4" {
+		t.Errorf("Update() after delete = %+v, %v, %v, want version 4", restored.Meta, isNew, err)
+	}
+}
+
+func testUpdateCreates(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	patients := store.Patients()
+
+	patient := newPatient("Rossi")
+	patient.ID = "chosen-id"
+	if _, _, err := patients.Update(ctx, patient, "1"); !errors.Is(err, fhir.ErrVersionConflict) {
+		t.Errorf("Update() of an unknown id with If-Match error = %v, want ErrVersionConflict", err)
+	}
+	created, isNew, err := patients.Update(ctx, patient, "")
+	if err != nil || !isNew || created.ID != "chosen-id" || created.Meta.VersionID != "1" {
+		t.Errorf("Update() of an unknown id = %+v, %v, %v, want it created", created.Base, isNew, err)
+	}
+	if _, err := patients.Read(ctx, "missing"); !errors.Is(err, fhir.ErrNotFound) {
+		t.Errorf("Read() of an unknown id error = %v, want ErrNotFound", err)
+	}
+	if _, err := patients.VRead(ctx, "missing", "1"); !errors.Is(err, fhir.ErrNotFound) {
+		t.Errorf("VRead() of an unknown id error = %v, want ErrNotFound", err)
+	}
+	if err := patients.Delete(ctx, "missing"); !errors.Is(err, fhir.ErrNotFound) {
+		t.Errorf("Delete() of an unknown id error = %v, want ErrNotFound", err)
+	}
+}
+
+func testSearch(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	patients := store.Patients()
+	for _, family := range []string{"Rossi", "Bianchi", "Rossetti"} {
+		if _, err := patients.Create(ctx, newPatient(family)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, err := patients.Create(ctx, newPatient("Rossini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patients.Delete(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if families := searchFamilies(t, patients, 0); !slices.Equal(families, []string{"Rossi", "Rossetti"}) {
+		t.Errorf("Search() = %v, want the live matches in creation order", families)
+	}
+	if families := searchFamilies(t, patients, 1); !slices.Equal(families, []string{"Rossi"}) {
+		t.Errorf("Search() stopped after one = %v, want the first match", families)
+	}
+}
+
+// searchFamilies returns the families of the patients whose family starts with "Ros", stopping after limit
+// patients unless it is 0
+func searchFamilies(t *testing.T, patients fhir.Repository[*fhir.Patient], limit int) []string {
+	t.Helper()
+	var families []string
+	for patient, err := range patients.Search(t.Context(), func(p *fhir.Patient) bool { return p.Name[0].Family[:3] == "Ros" }) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		families = append(families, patient.Name[0].Family)
+		if len(families) == limit {
+			break
+		}
+	}
+	return families
+}
+
+func testIndexedSearch(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	patients := store.Patients()
+	var ids []string
+	for _, identifier := range []string{"mrn-1", "mrn-2", "mrn-3"} {
+		patient := newPatient("Rossi")
+		patient.Identifier = []fhir.Identifier{{System: "urn:mrn", Value: identifier}, {System: fhir.CodiceFiscaleSystem, Value: "rssmra85t10a562s"}}
+		patient.BirthDate = "1985-12-10"
+		created, err := patients.Create(ctx, patient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, created.ID)
+	}
+	// the index follows the current version: mrn-1 is replaced and mrn-3 deleted
+	updated := newPatient("Rossi")
+	updated.ID, updated.Identifier, updated.BirthDate = ids[0], []fhir.Identifier{{System: "urn:mrn", Value: "mrn-9"}}, "1990-01-01"
+	if _, _, err := patients.Update(ctx, updated, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := patients.Delete(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "identifier=urn:mrn|mrn-1", want: nil},
+		{query: "identifier=urn:mrn|mrn-9", want: []string{ids[0]}},
+		{query: "identifier=mrn-2,mrn-3", want: []string{ids[1]}},
+		{query: "codice-fiscale=RSSMRA85T10A562S", want: []string{ids[1]}},
+		{query: "birthdate=ge1990", want: []string{ids[0]}},
+		{query: "birthdate=1985-12&identifier=mrn-2", want: []string{ids[1]}},
+		{query: "family=ros&birthdate=lt2000", want: []string{ids[0], ids[1]}},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		search, err := fhir.ParseSearch(query, fhir.PatientSearchParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for patient, err := range patients.Search(ctx, search.Match, search.Index...) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			found = append(found, patient.ID)
+		}
+		if !slices.Equal(found, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, found, tt.want)
+		}
+	}
+
+	// the conditions of a transaction see its own writes
+	err := store.Transact(ctx, func(tx storage.Repositories) error {
+		encounter := &fhir.Encounter{
+			Base:    fhir.Base{ResourceType: fhir.EncounterType},
+			Status:  "in-progress",
+			Class:   &fhir.Coding{Code: "IMP"},
+			Subject: &fhir.Reference{Reference: "Patient/" + ids[1]},
+			Period:  &fhir.Period{Start: "2024-03-01T08:00:00Z"},
+		}
+		if _, err := tx.Encounters().Create(ctx, encounter); err != nil {
+			return err
+		}
+		search, err := fhir.ParseSearch(url.Values{"subject": {"Patient/" + ids[1]}, "date": {"ge2025-01-01"}}, fhir.EncounterSearchParams)
+		if err != nil {
+			return err
+		}
+		found := 0
+		for _, err := range tx.Encounters().Search(ctx, search.Match, search.Index...) {
+			if err != nil {
+				return err
+			}
+			found++
+		}
+		if found != 1 {
+			t.Errorf("Search() of the ongoing encounter in its transaction found %d, want 1", found)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact() error = %v", err)
+	}
+}
+
+func testPage(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	patients := store.Patients()
+	for _, family := range []string{"Rossi", "Bianchi", "Rossetti", "Bi%nchi"} {
+		if _, err := patients.Create(ctx, newPatient(family)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, err := patients.Create(ctx, newPatient("Rossini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patients.Delete(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+		total int
+	}{
+		{query: "family=ros&_count=1&_offset=1", want: []string{"Rossetti"}, total: 2},
+		{query: "family:contains=SS", want: []string{"Rossi", "Rossetti"}, total: 2},
+		{query: "family:contains=%25", want: []string{"Bi%nchi"}, total: 1},
+		{query: "family=bi_", want: nil, total: 0},
+		{query: "name=bianchi&_count=0", want: nil, total: 1},
+		{query: "family:exact=Rossi", want: []string{"Rossi"}, total: 1},
+		{query: "_count=2&_offset=3", want: []string{"Bi%nchi"}, total: 4},
+		{query: "_offset=9", want: nil, total: 4},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		search, err := fhir.ParseSearch(query, fhir.PatientSearchParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, total, err := patients.Page(ctx, search)
+		if err != nil {
+			t.Fatalf("Page(%q) error = %v", tt.query, err)
+		}
+		var families []string
+		for _, patient := range page {
+			families = append(families, patient.Name[0].Family)
+		}
+		if !slices.Equal(families, tt.want) || total != tt.total {
+			t.Errorf("Page(%q) = %v of %d, want %v of %d", tt.query, families, total, tt.want, tt.total)
+		}
+	}
+}
+
+func testTransactions(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	existing, err := store.Patients().Create(ctx, newPatient("Rossi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var committed string
+	err = store.Transact(ctx, func(tx storage.Repositories) error {
+		created, err := tx.Patients().Create(ctx, newPatient("Bianchi"))
+		committed = created.ID
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transact() error = %v", err)
+	}
+	if _, err := store.Patients().Read(ctx, committed); err != nil {
+		t.Errorf("Read() of a committed resource error = %v", err)
+	}
+
+	var discarded string
+	err = store.Transact(ctx, func(tx storage.Repositories) error {
+		created, err := tx.Patients().Create(ctx, newPatient("Verdi"))
+		if err != nil {
+			return err
+		}
+		discarded = created.ID
+		if err := tx.Patients().Delete(ctx, existing.ID); err != nil {
+			return err
+		}
+		// the transaction sees its own writes
+		if _, err := tx.Patients().Read(ctx, discarded); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transact() error = %v, want the error of fn", err)
+	}
+	if _, err := store.Patients().Read(ctx, discarded); !errors.Is(err, fhir.ErrNotFound) {
+		t.Errorf("Read() of a rolled back creation error = %v, want ErrNotFound", err)
+	}
+	if current, err := store.Patients().Read(ctx, existing.ID); err != nil || current.Meta.VersionID != "1" {
+		t.Errorf("Read() of a rolled back deletion = %+v, %v, want version 1", current, err)
+	}
+}
+
+func testMessages(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	messages := store.Messages()
+
+	accepted, err := messages.Accept(ctx, "LAB|1", []byte("ACK 1"), time.Hour)
+	if err != nil || accepted != nil {
+		t.Fatalf("Accept() of a new message = %q, %v, want nil", accepted, err)
+	}
+	accepted, err = messages.Accept(ctx, "LAB|1", []byte("ACK 1 again"), time.Hour)
+	if err != nil || string(accepted) != "ACK 1" {
+		t.Errorf("Accept() of an accepted message = %q, %v, want its ACK", accepted, err)
+	}
+
+	err = store.Transact(ctx, func(tx storage.Repositories) error {
+		if _, err := tx.Messages().Accept(ctx, "LAB|2", []byte("ACK 2"), time.Hour); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transact() error = %v, want the error of fn", err)
+	}
+	if accepted, err := messages.Accept(ctx, "LAB|2", []byte("ACK 2"), time.Hour); err != nil || accepted != nil {
+		t.Errorf("Accept() of a message whose acceptance was rolled back = %q, %v, want nil", accepted, err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if accepted, err := messages.Accept(ctx, "LAB|1", []byte("ACK 1 later"), time.Millisecond); err != nil || accepted != nil {
+		t.Errorf("Accept() once the ttl elapsed = %q, %v, want nil", accepted, err)
+	}
+	if accepted, err := messages.Accept(ctx, "LAB|1", []byte("ACK 1 again"), time.Hour); err != nil || string(accepted) != "ACK 1 later" {
+		t.Errorf("Accept() after the message was accepted again = %q, %v, want its new ACK", accepted, err)
+	}
+}
+
+func testResourceTypes(t *testing.T, store storage.Store) {
+	ctx := t.Context()
+	encounter := &fhir.Encounter{
+		Base:    fhir.Base{ResourceType: fhir.EncounterType, ID: "shared-id"},
+		Status:  "planned",
+		Class:   &fhir.Coding{Code: "AMB"},
+		Subject: &fhir.Reference{Reference: "Patient/p1"},
+	}
+	err := store.Transact(ctx, func(tx storage.Repositories) error {
+		if _, _, err := tx.Encounters().Update(ctx, encounter, ""); err != nil {
+			return err
+		}
+		patient := newPatient("Rossi")
+		patient.ID = "shared-id"
+		_, _, err := tx.Patients().Update(ctx, patient, "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transact() error = %v", err)
+	}
+
+	// the same id names distinct resources in each type
+	stored, err := store.Encounters().Read(ctx, "shared-id")
+	if err != nil || stored.Status != "planned" || stored.Meta.VersionID != "1" {
+		t.Errorf("Read() of the encounter = %+v, %v", stored, err)
+	}
+	if err := store.Patients().Delete(ctx, "shared-id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Encounters().Read(ctx, "shared-id"); err != nil {
+		t.Errorf("Read() of the encounter after deleting the patient error = %v", err)
+	}
+	for episode, err := range store.EpisodesOfCare().Search(ctx, func(*fhir.EpisodeOfCare) bool { return true }) {
+		t.Errorf("Search() of episodes = %+v, %v, want none", episode, err)
+	}
+
+	// the value[x] of observations and their components round trip
+	systolic := 128.5
+	observation, err := store.Observations().Create(ctx, &fhir.Observation{
+		Base:    fhir.Base{ResourceType: fhir.ObservationType},
+		Status:  "final",
+		Code:    fhir.CodeableConcept{Coding: []fhir.Coding{{System: fhir.LOINCSystem, Code: fhir.LOINCBloodPressure}}},
+		Subject: &fhir.Reference{Reference: "Patient/p1"},
+		Component: []fhir.ObservationComponent{{
+			Code:             fhir.CodeableConcept{Coding: []fhir.Coding{{System: fhir.LOINCSystem, Code: fhir.LOINCSystolic}}},
+			ObservationValue: fhir.ObservationValue{ValueQuantity: &fhir.Quantity{Value: &systolic, System: fhir.UCUMSystem, Code: "mm[Hg]"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Create() of an observation error = %v", err)
+	}
+	read, err := store.Observations().Read(ctx, observation.ID)
+	if err != nil || len(read.Component) != 1 || *read.Component[0].ValueQuantity.Value != systolic {
+		t.Errorf("Read() of the observation = %+v, %v", read, err)
+	}
+
+	// the size and hash of document attachments round trip
+	size := int64(1024)
+	hash := []byte("0123456789abcdefghij")
+	document, err := store.DocumentReferences().Create(ctx, &fhir.DocumentReference{
+		Base:    fhir.Base{ResourceType: fhir.DocumentReferenceType},
+		Status:  "current",
+		Subject: &fhir.Reference{Reference: "Patient/p1"},
+		Content: []fhir.DocumentReferenceContent{{Attachment: fhir.Attachment{ContentType: "application/pdf", Size: &size, Hash: hash}}},
+	})
+	if err != nil {
+		t.Fatalf("Create() of a document error = %v", err)
+	}
+	readDocument, err := store.DocumentReferences().Read(ctx, document.ID)
+	if err != nil || *readDocument.Content[0].Attachment.Size != size || string(readDocument.Content[0].Attachment.Hash) != string(hash) {
+		t.Errorf("Read() of the document = %+v, %v", readDocument, err)
+	}
+}
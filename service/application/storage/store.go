@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"service/application/fhir"
+)
+
+// Repositories gives access to the repository of each resource type, and to the log of the accepted messages
+type Repositories interface {
+	Patients() fhir.Repository[*fhir.Patient]
+	Encounters() fhir.Repository[*fhir.Encounter]
+	EpisodesOfCare() fhir.Repository[*fhir.EpisodeOfCare]
+	Observations() fhir.Repository[*fhir.Observation]
+	DocumentReferences() fhir.Repository[*fhir.DocumentReference]
+	Messages() MessageLog
+}
+
+// MessageLog remembers the ACKs of the accepted HL7 messages by key, so that a message sent again is answered the
+// same whichever instance of the service receives it
+type MessageLog interface {
+	// Accept records ack as the answer to the message of key and returns nil, unless a message of key was accepted
+	// less than ttl ago: its ACK is returned and nothing is recorded. Within a transaction, the acceptance is
+	// committed with it and a concurrent one of the same key waits for the transaction to end.
+	Accept(ctx context.Context, key string, ack []byte, ttl time.Duration) (accepted []byte, err error)
+}
+
+// Store keeps the resources of the service, whatever the backend
+type Store interface {
+	Repositories
+	// Transact runs fn with repositories whose writes are committed together when fn returns nil and discarded
+	// when it returns an error, which Transact returns. fn must only use the repositories it is given.
+	Transact(ctx context.Context, fn func(tx Repositories) error) error
+	// Ping checks that the backend can be reached
+	Ping(ctx context.Context) error
+	// Close releases the backend
+	Close() error
+}
@@ -0,0 +1,75 @@
+// Command auditverify checks the hash chain of an audit file written by the service and prints its head.
+// The chain is keyed, the key the service was started with is read from the AUDIT_KEY environment variable.
+//
+// Usage:
+//
+//	AUDIT_KEY=<key> go run ./cmd/auditverify -file audit/audit.log [-head <sequence>:<hash>]
+//
+// It exits with status 1 if any event was modified, removed or reordered, or if the trail does not
+// reach the expected head (which detects truncation when the head was recorded elsewhere).
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"service/application/audit"
+	"service/infrastructure/auditstore"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	path := flag.String("file", "audit/audit.log", "audit file to verify")
+	expected := flag.String("head", "", "expected head of the trail as <sequence>:<hash>")
+	flag.Parse()
+
+	key := []byte(os.Getenv("AUDIT_KEY"))
+	if len(key) == 0 {
+		fmt.Fprintln(os.Stderr, "FAILED:", audit.ErrNoKey)
+		os.Exit(1)
+	}
+
+	head, err := audit.Verify(auditstore.ReadFile(*path), key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "FAILED:", err)
+		os.Exit(1)
+	}
+
+	if *expected != "" {
+		if err := checkHead(*path, head, *expected); err != nil {
+			fmt.Fprintln(os.Stderr, "FAILED:", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("OK: %d events, head %d:%s\n", head.Sequence, head.Sequence, head.Hash)
+}
+
+// checkHead ensures the trail still contains the expected head event unchanged
+func checkHead(path string, head audit.Head, expected string) error {
+	sequence, hash, found := strings.Cut(expected, ":")
+	if !found {
+		return errors.New("head must be formatted as <sequence>:<hash>")
+	}
+	n, err := strconv.ParseUint(sequence, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid head sequence: %w", err)
+	}
+	if head.Sequence < n {
+		return fmt.Errorf("trail ends at event %d, expected at least %d (truncated)", head.Sequence, n)
+	}
+
+	for event, err := range auditstore.ReadFile(path) {
+		if err != nil {
+			return err
+		}
+		if event.Sequence == n {
+			if event.Hash != hash {
+				return fmt.Errorf("event %d has hash %s, expected %s", n, event.Hash, hash)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("event %d not found", n)
+}
@@ -0,0 +1,94 @@
+package auditstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"service/application/audit"
+)
+
+// maxEventSize bounds the length of one JSON line when reading the trail back
+const maxEventSize = 1 << 20
+
+// FileSink appends audit events as JSON lines to a file opened in append-only mode, syncing every write
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileSink opens (or creates) the audit file at path
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+// Append writes the event as one line and flushes it to stable storage
+func (s *FileSink) Append(event audit.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Events reads the file from the beginning, it can be used while events are being appended
+func (s *FileSink) Events() iter.Seq2[audit.Event, error] {
+	return ReadFile(s.path)
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// ReadFile iterates over the events stored in an audit file written by FileSink
+func ReadFile(path string) iter.Seq2[audit.Event, error] {
+	return func(yield func(audit.Event, error) bool) {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			yield(audit.Event{}, err)
+			return
+		}
+		defer func() { _ = file.Close() }()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+		for line := 1; scanner.Scan(); line++ {
+			var event audit.Event
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				yield(audit.Event{}, fmt.Errorf("audit: line %d: %w", line, err))
+				return
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(audit.Event{}, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package auditstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"service/application/audit"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("test-audit-key")
+
+func TestFileSinkRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	trail, err := audit.NewTrail(sink, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"p1", "p2"} {
+		if _, err := trail.Record(context.Background(), audit.Event{Actor: "alice", Action: audit.ActionRead, ResourceType: "Patient", ResourceID: id, Outcome: audit.OutcomeSuccess}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = trail.Close()
+
+	// reopening resumes the chain
+	sink, err = NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail, err = audit.NewTrail(sink, testKey)
+	if err != nil {
+		t.Fatalf("Expected stored trail to verify, got %v", err)
+	}
+	event, err := trail.Record(context.Background(), audit.Event{Actor: "bob", Action: audit.ActionDelete, ResourceType: "Patient", ResourceID: "p1", Outcome: audit.OutcomeSuccess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = trail.Close()
+
+	if event.Sequence != 3 {
+		t.Errorf("Expected sequence 3 after reopening, got %d", event.Sequence)
+	}
+	head, err := audit.Verify(ReadFile(path), testKey)
+	if err != nil || head.Sequence != 3 {
+		t.Errorf("Expected verified head at 3, got %+v (%v)", head, err)
+	}
+}
+
+func TestFileSinkDetectsEditedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, _ := NewFileSink(path)
+	trail, _ := audit.NewTrail(sink, testKey)
+	_, _ = trail.Record(context.Background(), audit.Event{Actor: "alice", Action: audit.ActionRead, ResourceType: "Patient", ResourceID: "p1", Outcome: audit.OutcomeSuccess})
+	_ = trail.Close()
+
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), "alice", "mallory", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := audit.Verify(ReadFile(path), testKey); !errors.Is(err, audit.ErrTampered) {
+		t.Errorf("Expected edited file to fail verification, got %v", err)
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	head, err := audit.Verify(ReadFile(filepath.Join(t.TempDir(), "missing.log")), testKey)
+	if err != nil || head.Sequence != 0 {
+		t.Errorf("Expected an empty trail for a missing file, got %+v (%v)", head, err)
+	}
+}
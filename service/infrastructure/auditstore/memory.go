@@ -0,0 +1,48 @@
+package auditstore
+
+import (
+	"iter"
+	"sync"
+
+	"service/application/audit"
+)
+
+// MemorySink keeps audit events in memory, it is meant for tests and local runs without persistent storage
+type MemorySink struct {
+	mu     sync.RWMutex
+	events []audit.Event
+}
+
+// NewMemorySink returns an empty in-memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Append stores the event
+func (s *MemorySink) Append(event audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events iterates over a snapshot of the stored events
+func (s *MemorySink) Events() iter.Seq2[audit.Event, error] {
+	s.mu.RLock()
+	snapshot := make([]audit.Event, len(s.events))
+	copy(snapshot, s.events)
+	s.mu.RUnlock()
+
+	return func(yield func(audit.Event, error) bool) {
+		for _, event := range snapshot {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Close is a no-op
+func (s *MemorySink) Close() error {
+	return nil
+}
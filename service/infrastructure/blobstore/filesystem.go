@@ -0,0 +1,102 @@
+// Package blobstore implements storage.BlobStore on the local filesystem and on S3-compatible object storage.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"service/application/storage"
+)
+
+// keyPattern matches the keys of blobs, which must not start with '.' so that they never name a temporary file
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9\-.]{0,127}$`)
+
+// checkKey refuses the keys storage.BlobStore does not allow
+func checkKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// Filesystem is a storage.BlobStore keeping each blob in a read-only file of its root directory. Blobs are written
+// to a temporary file renamed once complete, so that a blob is either whole or absent.
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem returns a store keeping its blobs under root, creating the directory
+func NewFilesystem(root string) (*Filesystem, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &Filesystem{root: root}, nil
+}
+
+// Put writes the content of r to a temporary file, synced then renamed to the file of key
+func (f *Filesystem) Put(_ context.Context, key string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.root, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o400); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(f.root, key))
+}
+
+// Get opens the file of key
+func (f *Filesystem) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(f.root, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, storage.ErrBlobNotFound)
+	}
+	return file, err
+}
+
+// Delete removes the file of key
+func (f *Filesystem) Delete(_ context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(f.root, key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Ping checks that the root directory still exists
+func (f *Filesystem) Ping(context.Context) error {
+	info, err := os.Stat(f.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", f.root)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"service/application/storage"
+)
+
+// partSize is the size of the parts uploads are sent in, the smallest S3 accepts, each part being held in memory
+// while it is sent
+const partSize = 5 << 20
+
+// S3Options locate the bucket of an S3-compatible API, AWS S3 or a local stand-in such as MinIO
+type S3Options struct {
+	// Endpoint is the URL of the API, such as http://localhost:9000; objects are addressed path-style under it
+	Endpoint string
+	Region   string
+	Bucket   string
+	// AccessKey and SecretKey sign the requests with AWS Signature Version 4, requests are anonymous without them
+	AccessKey string
+	SecretKey string
+	// Transport sends the requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+}
+
+// S3 is a storage.BlobStore keeping each blob as an object of a bucket, through the MinIO client. Uploads larger
+// than a part are streamed as multipart uploads, aborted when the content cannot be read; downloads stream the
+// response body.
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 returns a store keeping its blobs in the bucket of opts
+func NewS3(opts S3Options) (*S3, error) {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" ||
+		(endpoint.Path != "" && endpoint.Path != "/") {
+		return nil, fmt.Errorf("S3 endpoint must be an absolute http or https URL without a path, got %q", opts.Endpoint)
+	}
+	if opts.Bucket == "" || opts.Region == "" {
+		return nil, fmt.Errorf("S3 bucket and region must be set")
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		// empty keys leave the requests unsigned
+		Creds:        credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       opts.Region,
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    opts.Transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("S3 client for %s: %w", opts.Endpoint, err)
+	}
+	return &S3{client: client, bucket: opts.Bucket}, nil
+}
+
+// Put uploads the content of r in a single request when it fits in a part, otherwise in parts as it is read
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	var first bytes.Buffer
+	if _, err := io.CopyN(&first, r, partSize); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream", PartSize: partSize}
+	if first.Len() < partSize {
+		_, err := s.client.PutObject(ctx, s.bucket, key, &first, int64(first.Len()), opts)
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, io.MultiReader(&first, r), -1, opts)
+	return err
+}
+
+// Get downloads the object of key, the caller reading its body as it arrives
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// the object is requested by the first call, which tells whether it exists
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%s/%s: %w", s.bucket, key, storage.ErrBlobNotFound)
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+// Delete deletes the object of key, S3 answering the same whether it existed or not
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// Ping checks that the bucket exists and can be accessed
+func (s *S3) Ping(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("S3 bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
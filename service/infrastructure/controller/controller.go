@@ -1,62 +1,125 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"service/application/audit"
+	"service/application/clinical"
+	"service/application/documents"
+	"service/application/fhir"
+	"service/application/hl7"
+	"service/application/storage"
+	"strconv"
 	"time"
 
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/admin"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/circuitbreaker"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/identity"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
 	"github.com/sony/gobreaker/v2"
 )
 
 /* === StandardController definition and settings === */
 
+// healthCheck is the health check response of the service, reporting the status of its dependencies by name
+type healthCheck struct {
+	response.HealthCheck
+	Checks map[string]string `json:"checks"`
+}
+
 // StandardController holds dependencies for handling requests
 type StandardController struct {
 	metrics        *metrics.Metrics
 	circuitBreaker *circuitbreaker.CircuitBreaker
+	auditTrail     *audit.Trail
+	store          storage.Store
+	documents      *documents.Service
+	// identityToken authenticates the users forwarded by the API Gateway
+	identityToken string
+	// healthTimeout bounds the storage ping of health checks
+	healthTimeout time.Duration
+	// maxDocumentSize bounds the content of uploaded documents
+	maxDocumentSize int64
+	hl7             *hl7.Service
+	// maxHL7MessageSize bounds the HL7 v2 messages posted over HTTP
+	maxHL7MessageSize int64
+	// the FHIR interactions of each resource type
+	patientAPI       resourceAPI[fhir.Patient, *fhir.Patient]
+	encounterAPI     resourceAPI[fhir.Encounter, *fhir.Encounter]
+	episodeOfCareAPI resourceAPI[fhir.EpisodeOfCare, *fhir.EpisodeOfCare]
+	observationAPI   resourceAPI[fhir.Observation, *fhir.Observation]
+	documentAPI      resourceAPI[fhir.DocumentReference, *fhir.DocumentReference]
 }
 
-// NewController creates a new controller with injected dependencies
-func NewController(m *metrics.Metrics) *StandardController {
+// NewController creates a new controller with injected dependencies, its circuit breaker and the limits of
+// documents configured by cfg; blobs keeps the content of documents
+func NewController(cfg config.Config, m *metrics.Metrics, trail *audit.Trail, store storage.Store, blobs storage.BlobStore) *StandardController {
 	c := &StandardController{
-		metrics: m,
+		metrics:         m,
+		auditTrail:      trail,
+		store:           store,
+		identityToken:   cfg.Identity.Token,
+		healthTimeout:   cfg.Storage.HealthTimeout,
+		maxDocumentSize: int64(cfg.Documents.MaxSizeMB) << 20,
+		// HL7 v2 messages over MLLP are bounded by the server, see MLLPHandler
+		maxHL7MessageSize: int64(cfg.HL7.MaxMessageKB) << 10,
 	}
+	c.patientAPI = newResourceAPI(c, store.Patients(), fhir.PatientSearchParams)
+
+	// encounters, episodes of care and observations are written through the clinical rules
+	clinicalService := clinical.NewService(store)
+	c.encounterAPI = newResourceAPI(c, store.Encounters(), fhir.EncounterSearchParams)
+	c.encounterAPI.create, c.encounterAPI.update = clinicalService.CreateEncounter, clinicalService.UpdateEncounter
+	c.episodeOfCareAPI = newResourceAPI(c, store.EpisodesOfCare(), fhir.EpisodeOfCareSearchParams)
+	c.episodeOfCareAPI.create, c.episodeOfCareAPI.update = clinicalService.CreateEpisodeOfCare, clinicalService.UpdateEpisodeOfCare
+	c.observationAPI = newResourceAPI(c, store.Observations(), fhir.ObservationSearchParams)
+	c.observationAPI.create, c.observationAPI.update = clinicalService.CreateObservation, clinicalService.UpdateObservation
+
+	// documents are created by uploading their content, which their updates cannot change
+	c.documents = documents.NewService(blobs, clinicalService, documents.Options{MaxSize: c.maxDocumentSize, ContentTypes: cfg.Documents.ContentTypes})
+	c.documentAPI = newResourceAPI(c, store.DocumentReferences(), fhir.DocumentReferenceSearchParams)
+	c.documentAPI.update = clinicalService.UpdateDocumentReference
+
+	// HL7 v2 messages write patients, encounters and observations through the clinical rules as well
+	c.hl7 = hl7.NewService(clinicalService, hl7.Options{DedupTTL: cfg.HL7.DedupTTL, DedupSize: cfg.HL7.DedupSize})
 
-	circuitBreakerSettings := getCircuitBreakerDefaultSettings(c)
+	circuitBreakerSettings := getCircuitBreakerSettings(c, cfg)
 	c.circuitBreaker = circuitbreaker.NewCircuitBreaker(circuitBreakerSettings)
 	return c
 }
 
 /* === Handlers === */
 
-// HealthCheckHandler handles health check requests
+// HealthCheckHandler handles health check requests, answering 503 when the storage or the document store cannot be
+// reached
 func (c *StandardController) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	slog.Info("requested health check", "from", r.RemoteAddr)
 
 	// start measuring time for metrics
 	startTime := time.Now()
 
-	msg, err := c.generateHealthCheckMessageResponse()
+	msg, err := c.generateHealthCheckMessageResponse(r.Context())
 	if err != nil {
 		// record health check failure metrics
 		c.recordHealthCheckData(startTime, "failure")
 
 		// send error response
-		response.Error(w, err)
+		response.Error(w, r, err)
 
 		// log the error
 		slog.Error("health check failed, sent response", "content", err, "to", r.RemoteAddr)
 		return
 	}
 	// record health check success metrics
-	c.recordHealthCheckData(startTime, "failure")
+	c.recordHealthCheckData(startTime, "success")
 
 	// send success response
-	response.Ok(w, msg)
+	response.Write(w, r, http.StatusOK, json.RawMessage(msg))
 
 	// log the successful response
 	slog.Debug("successful health check, sent response", "content", msg, "content_as_string", string(msg), "to", r.RemoteAddr)
@@ -67,11 +130,52 @@ func (c *StandardController) MetricsHandler(w http.ResponseWriter, r *http.Reque
 	c.metrics.Handler().ServeHTTP(w, r)
 }
 
+// AuditQueryHandler returns the audit events matching the actor, resource_type, resource_id, from, to (RFC 3339) and limit query parameters
+func (c *StandardController) AuditQueryHandler(w http.ResponseWriter, r *http.Request) {
+	slog.Info("requested audit events", "from", r.RemoteAddr)
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		c.recordAudit(r, audit.ActionSearch, "AuditEvent", "", audit.OutcomeFailure)
+		response.Error(w, r, err)
+		return
+	}
+
+	events, err := c.auditTrail.Query(r.Context(), filter)
+	if err != nil {
+		c.recordAudit(r, audit.ActionSearch, "AuditEvent", "", audit.OutcomeFailure)
+		response.Error(w, r, err)
+		slog.Error("audit query failed, sent response", "content", err, "to", r.RemoteAddr)
+		return
+	}
+	// reading the trail is itself an audited access
+	c.recordAudit(r, audit.ActionSearch, "AuditEvent", "", audit.OutcomeSuccess)
+
+	if events == nil {
+		events = []audit.Event{}
+	}
+	response.Write(w, r, http.StatusOK, events)
+}
+
 /* === Helper Methods === */
 
-func (c *StandardController) generateHealthCheckMessageResponse() ([]byte, error) {
+func (c *StandardController) generateHealthCheckMessageResponse(ctx context.Context) ([]byte, error) {
 	msg, err := c.circuitBreaker.Execute(func() ([]byte, error) {
-		msg := response.HealthCheck{Status: "OK", Service: "service"}
+		ctx, cancel := context.WithTimeout(ctx, c.healthTimeout)
+		defer cancel()
+		if err := c.store.Ping(ctx); err != nil {
+			slog.Error("storage health check failed", "error", err)
+			return nil, response.NewProblem(response.TypeUnavailable, "storage is down")
+		}
+		if err := c.documents.Ping(ctx); err != nil {
+			slog.Error("document store health check failed", "error", err)
+			return nil, response.NewProblem(response.TypeUnavailable, "document store is down")
+		}
+
+		msg := healthCheck{
+			HealthCheck: response.HealthCheck{Status: "OK", Service: "service"},
+			Checks:      map[string]string{"storage": "UP", "documents": "UP"},
+		}
 		return json.Marshal(msg)
 	})
 	return msg, err
@@ -80,7 +184,68 @@ func (c *StandardController) generateHealthCheckMessageResponse() ([]byte, error
 func (c *StandardController) recordHealthCheckData(startTime time.Time, status string) {
 	elapsedTimeSinceStart := time.Since(startTime)
 	c.metrics.RecordCircuitBreakerRequest("healthcheck", status)
-	c.metrics.RecordHealthCheck(status, elapsedTimeSinceStart)
+	c.metrics.Observe("healthcheck", status, elapsedTimeSinceStart)
+}
+
+// recordAudit appends an audit event for the request, failures are logged since the response is already decided
+func (c *StandardController) recordAudit(r *http.Request, action audit.Action, resourceType, resourceID string, outcome audit.Outcome) {
+	c.recordEvent(r.Context(), audit.Event{
+		Actor:        c.actorOf(r),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Outcome:      outcome,
+		RequestID:    requestid.FromRequest(r),
+	})
+}
+
+// recordEvent appends an audit event, failures are logged since the answer is already decided
+func (c *StandardController) recordEvent(ctx context.Context, event audit.Event) {
+	if _, err := c.auditTrail.Record(ctx, event); err != nil {
+		slog.Error("failed to record audit event", "error", err, "action", event.Action, "resource_type", event.ResourceType)
+	}
+}
+
+// actorOf identifies who performed the request: the user forwarded by the API Gateway with the identity token or the
+// principal authenticated by the admin listener, since any other header or credential naming a user is set by the
+// client and not verified
+func (c *StandardController) actorOf(r *http.Request) string {
+	if user := identity.User(r, c.identityToken); user != "" {
+		return user
+	}
+	if principal := admin.Principal(r.Context()); principal != "" {
+		return "admin:" + principal
+	}
+	return "anonymous"
+}
+
+// parseAuditFilter reads the query parameters, reporting every invalid one
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:        query.Get("actor"),
+		ResourceType: query.Get("resource_type"),
+		ResourceID:   query.Get("resource_id"),
+	}
+
+	invalid := &response.ValidationError{}
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			invalid.Add("from", "must be an RFC 3339 time, got %q", from)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			invalid.Add("to", "must be an RFC 3339 time, got %q", to)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			invalid.Add("limit", "must be a non-negative integer, got %q", limit)
+		}
+	}
+	return filter, invalid.OrNil()
 }
 
 /* === Getters === */
@@ -103,19 +268,11 @@ func (c *StandardController) GetCircuitBreakerMetrics() map[string]interface{} {
 	}
 }
 
-func getCircuitBreakerDefaultSettings(c *StandardController) gobreaker.Settings {
-	circuitBreakerSettings := gobreaker.Settings{
-		Name:     "service",
-		Timeout:  time.Second * 30,
-		Interval: time.Second * 60,
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-			return counts.Requests >= 5 && failureRatio >= 0.8
-		},
-		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-			c.metrics.RecordCircuitBreakerStateChange(name, to)
-			slog.Info("circuit breaker state changed", "name", name, "from", from, "to", to)
-		},
+func getCircuitBreakerSettings(c *StandardController, cfg config.Config) gobreaker.Settings {
+	circuitBreakerSettings := cfg.CircuitBreakerSettings(cfg.Service)
+	circuitBreakerSettings.OnStateChange = func(name string, from gobreaker.State, to gobreaker.State) {
+		c.metrics.RecordCircuitBreakerStateChange(name, to)
+		slog.Info("circuit breaker state changed", "name", name, "from", from, "to", to)
 	}
 	return circuitBreakerSettings
 }
@@ -1,16 +1,72 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/admin"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/identity"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
 	"net/http"
 	"net/http/httptest"
+	"service/application/audit"
+	"service/infrastructure/auditstore"
+	"service/infrastructure/blobstore"
+	"service/infrastructure/fhirstore"
+	"strings"
 	"testing"
 )
 
+// testIdentityToken authenticates the users forwarded to the test controllers
+const testIdentityToken = "gateway-secret"
+
+// testConfig is the configuration of the test controllers and of their routers
+func testConfig() config.Config {
+	cfg := config.Default("service")
+	cfg.Identity.Token = testIdentityToken
+	return cfg
+}
+
+func newTestController(t *testing.T) *StandardController {
+	trail, err := audit.NewTrail(auditstore.NewMemorySink(), []byte("test-audit-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewController(testConfig(), metrics.New(), trail, fhirstore.NewMemoryStore(), newTestBlobStore(t))
+}
+
+// newTestRouter returns the routes of the service served by c
+func newTestRouter(c *StandardController) http.Handler {
+	return NewRouter(testConfig(), c)
+}
+
+// forwardedBy returns r as forwarded by the API Gateway for user
+func forwardedBy(r *http.Request, user string) *http.Request {
+	identity.Forward(r, user, testIdentityToken)
+	return r
+}
+
+func newTestBlobStore(t *testing.T) *blobstore.Filesystem {
+	blobs, err := blobstore.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blobs
+}
+
+// downStore is a store that cannot be reached
+type downStore struct {
+	*fhirstore.MemoryStore
+}
+
+func (downStore) Ping(context.Context) error { return errors.New("connection refused") }
+
 func TestHealthCheckHandler_Success(t *testing.T) {
-	metricsInstance := metrics.New()
-	ctrl := NewController(metricsInstance)
+	ctrl := newTestController(t)
 
 	req, err := http.NewRequest("GET", endpoint.Health, nil)
 	if err != nil {
@@ -26,9 +82,135 @@ func TestHealthCheckHandler_Success(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	expected := `{"status":"OK","service":"service"}`
+	expected := `{"status":"OK","service":"service","checks":{"documents":"UP","storage":"UP"}}`
 	if rr.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v",
 			rr.Body.String(), expected)
 	}
 }
+
+func TestHealthCheckHandler_StorageDown(t *testing.T) {
+	trail, err := audit.NewTrail(auditstore.NewMemorySink(), []byte("test-audit-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := NewController(config.Default("service"), metrics.New(), trail, downStore{fhirstore.NewMemoryStore()}, newTestBlobStore(t))
+
+	rr := httptest.NewRecorder()
+	ctrl.HealthCheckHandler(rr, httptest.NewRequest("GET", endpoint.Health, nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rr.Code)
+	}
+	var problem response.Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil || problem.Detail != "storage is down" {
+		t.Errorf("Expected a problem naming the storage, got %s", rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "connection refused") {
+		t.Errorf("Expected the cause not to be exposed, got %s", rr.Body.String())
+	}
+}
+
+func TestAuditQueryHandler(t *testing.T) {
+	ctrl := newTestController(t)
+	for _, actor := range []string{"alice", "bob", "alice"} {
+		req := forwardedBy(httptest.NewRequest("GET", endpoint.Audit, nil), actor)
+		ctrl.recordAudit(req, audit.ActionRead, "Patient", "p1", audit.OutcomeSuccess)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{name: "all events", query: "", expectedStatus: http.StatusOK, expectedCount: 3},
+		{name: "by actor", query: "?actor=alice", expectedStatus: http.StatusOK, expectedCount: 2},
+		{name: "by resource", query: "?resource_type=Patient&resource_id=p2", expectedStatus: http.StatusOK, expectedCount: 0},
+		{name: "limit", query: "?actor=alice&limit=1", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "invalid time", query: "?from=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "invalid limit", query: "?limit=-1", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", endpoint.Audit+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			ctrl.AuditQueryHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				var problem response.Problem
+				if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil || rr.Header().Get("Content-Type") != response.ProblemContentType {
+					t.Fatalf("Expected a problem, got %s", rr.Body.String())
+				}
+				if len(problem.Errors) != 1 {
+					t.Errorf("Expected the invalid parameter in the problem, got %+v", problem.Errors)
+				}
+				return
+			}
+			var events []audit.Event
+			if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+				t.Fatalf("Expected JSON array, got %s", rr.Body.String())
+			}
+			if len(events) != tt.expectedCount {
+				t.Errorf("Expected %d events, got %d", tt.expectedCount, len(events))
+			}
+		})
+	}
+}
+
+func TestAuditQueryIsAudited(t *testing.T) {
+	ctrl := newTestController(t)
+	adminServer := admin.NewServer(admin.Config{Username: "auditor", Password: "pw"})
+	adminServer.Handle("GET "+endpoint.Audit, http.HandlerFunc(ctrl.AuditQueryHandler))
+
+	req := httptest.NewRequest("GET", endpoint.Audit, nil)
+	req.SetBasicAuth("auditor", "pw")
+	req = req.WithContext(requestid.NewContext(req.Context(), "req-1"))
+	adminServer.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	events, err := ctrl.auditTrail.Query(req.Context(), audit.Filter{Actor: "admin:auditor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Action != audit.ActionSearch || events[0].RequestID != "req-1" {
+		t.Errorf("Expected the query to be recorded with its request ID, got %+v", events)
+	}
+}
+
+func TestAuditActorIgnoresForgedIdentity(t *testing.T) {
+	tests := []struct {
+		name   string
+		forge  func(r *http.Request)
+		wanted string
+	}{
+		{name: "basic auth user", forge: func(r *http.Request) { r.SetBasicAuth("mallory", "") }, wanted: "anonymous"},
+		{name: "forwarded user without token", forge: func(r *http.Request) { r.Header.Set(identity.UserHeader, "mallory") }, wanted: "anonymous"},
+		{name: "forwarded user with a guessed token", forge: func(r *http.Request) {
+			r.Header.Set(identity.UserHeader, "mallory")
+			r.Header.Set(identity.TokenHeader, "guessed")
+		}, wanted: "anonymous"},
+		{name: "user forwarded by the gateway", forge: func(r *http.Request) { forwardedBy(r, "alice") }, wanted: "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := newTestController(t)
+			req := httptest.NewRequest("GET", endpoint.Patient+"/p1", nil)
+			tt.forge(req)
+			ctrl.recordAudit(req, audit.ActionRead, "Patient", "p1", audit.OutcomeSuccess)
+
+			events, err := ctrl.auditTrail.Query(req.Context(), audit.Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Actor != tt.wanted {
+				t.Errorf("Expected the access to be recorded for %s, got %+v", tt.wanted, events)
+			}
+		})
+	}
+}
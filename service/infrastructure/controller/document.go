@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"service/application/audit"
+	"service/application/documents"
+	"service/application/fhir"
+	"strconv"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"github.com/gorilla/mux"
+)
+
+/* === DocumentReference handlers === */
+
+// UploadDocumentReferenceHandler stores a new document from a multipart/form-data body: a "resource" part holding
+// the DocumentReference, its single attachment describing the content, followed by a "content" part holding the
+// content. The attachment type defaults to the type of the content part and its title to the file name; the
+// content is verified as it is stored (see documents.Service.Upload) and the DocumentReference answered with 201.
+func (c *StandardController) UploadDocumentReferenceHandler(w http.ResponseWriter, r *http.Request) {
+	slog.Info("requested document upload", "from", r.RemoteAddr)
+
+	created, err := c.uploadDocument(w, r)
+	if err != nil {
+		c.recordAudit(r, audit.ActionCreate, fhir.DocumentReferenceType, "", audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	c.recordAudit(r, audit.ActionCreate, fhir.DocumentReferenceType, created.ID, audit.OutcomeSuccess)
+
+	w.Header().Set("Location", versionURL(r, created))
+	writeResource(w, r, http.StatusCreated, created)
+}
+
+// ReadDocumentReferenceHandler returns the current version of a DocumentReference, 410 once it was deleted
+func (c *StandardController) ReadDocumentReferenceHandler(w http.ResponseWriter, r *http.Request) {
+	c.documentAPI.readHandler(w, r)
+}
+
+// VReadDocumentReferenceHandler returns a version of a DocumentReference
+func (c *StandardController) VReadDocumentReferenceHandler(w http.ResponseWriter, r *http.Request) {
+	c.documentAPI.vreadHandler(w, r)
+}
+
+// UpdateDocumentReferenceHandler stores the next version of a DocumentReference, answering 409 when its status
+// cannot move to the new one (see fhir.DocumentReferenceLifecycle); its content cannot change, a new document
+// replacing it is uploaded instead
+func (c *StandardController) UpdateDocumentReferenceHandler(w http.ResponseWriter, r *http.Request) {
+	c.documentAPI.updateHandler(w, r)
+}
+
+// DeleteDocumentReferenceHandler deletes a DocumentReference, the content of its versions staying readable
+func (c *StandardController) DeleteDocumentReferenceHandler(w http.ResponseWriter, r *http.Request) {
+	c.documentAPI.deleteHandler(w, r)
+}
+
+// SearchDocumentReferenceHandler returns a searchset Bundle of the DocumentReferences matching the query (see
+// fhir.DocumentReferenceSearchParams)
+func (c *StandardController) SearchDocumentReferenceHandler(w http.ResponseWriter, r *http.Request) {
+	c.documentAPI.searchHandler(w, r)
+}
+
+// DocumentContentHandler streams the content of the current version of a document, or of the version of the
+// vid route variable, as an attachment download. Its hash is the strong ETag, answering 304 to clients holding
+// the content already; content no longer matching its hash aborts the response before its end.
+func (c *StandardController) DocumentContentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var document *fhir.DocumentReference
+	var err error
+	if vid, ok := vars["vid"]; ok {
+		document, err = c.documentAPI.repository.VRead(r.Context(), id, vid)
+	} else {
+		document, err = c.documentAPI.repository.Read(r.Context(), id)
+	}
+	var content io.ReadCloser
+	if err == nil {
+		content, err = c.documents.Open(r.Context(), document)
+	}
+	if err != nil {
+		c.recordAudit(r, audit.ActionRead, fhir.DocumentReferenceType, id, audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	defer func() { _ = content.Close() }()
+	c.recordAudit(r, audit.ActionRead, fhir.DocumentReferenceType, id, audit.OutcomeSuccess)
+
+	attachment := document.Content[0].Attachment
+	if response.NotModified(w, r, `"`+base64.StdEncoding.EncodeToString(attachment.Hash)+`"`, lastUpdated(document)) {
+		return
+	}
+	filename := attachment.Title
+	if filename == "" {
+		filename = id
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	if attachment.Size != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*attachment.Size, 10))
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, content); err != nil {
+		if errors.Is(err, documents.ErrContentCorrupted) {
+			slog.Error("document content does not match its hash", "id", id, "request_id", requestid.FromRequest(r))
+		} else {
+			slog.Warn("document download failed", "error", err, "id", id, "request_id", requestid.FromRequest(r))
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
+/* === Helper Methods === */
+
+// uploadDocument reads the parts of an upload request, streaming the content part to the document service
+func (c *StandardController) uploadDocument(w http.ResponseWriter, r *http.Request) (*fhir.DocumentReference, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, response.NewProblem(response.TypeUnsupportedMedia, "documents must be uploaded as multipart/form-data")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, c.maxDocumentSize+maxResourceSize)
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return nil, response.NewProblem(response.TypeValidation, err.Error())
+	}
+
+	part, err := parts.NextPart()
+	if err != nil || part.FormName() != "resource" {
+		return nil, uploadPartError("resource", err)
+	}
+	document, err := fhir.Decode[fhir.DocumentReference](http.MaxBytesReader(w, part, maxResourceSize))
+	if err != nil {
+		return nil, err
+	}
+
+	part, err = parts.NextPart()
+	if err != nil || part.FormName() != "content" {
+		return nil, uploadPartError("content", err)
+	}
+	if len(document.Content) == 1 {
+		attachment := &document.Content[0].Attachment
+		if partType := part.Header.Get("Content-Type"); attachment.ContentType == "" && partType != "application/octet-stream" {
+			attachment.ContentType = partType
+		}
+		if attachment.Title == "" {
+			attachment.Title = part.FileName()
+		}
+	}
+	return c.documents.Upload(r.Context(), document, part)
+}
+
+// uploadPartError is the error of an upload whose next part is not the named one
+func uploadPartError(name string, err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	detail := "the upload must have a " + name + " part"
+	if err != nil && !errors.Is(err, io.EOF) {
+		detail += ": " + err.Error()
+	}
+	return response.NewProblem(response.TypeValidation, detail)
+}
+
+// lastUpdated returns when a version of a resource was stored, the zero time when it is unknown
+func lastUpdated(resource fhir.Resource) (t time.Time) {
+	if meta := resource.GetBase().Meta; meta != nil && meta.LastUpdated != nil {
+		t = *meta.LastUpdated
+	}
+	return t
+}
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"service/application/audit"
+	"service/application/fhir"
+	"service/application/storage"
+	"service/infrastructure/auditstore"
+	"service/infrastructure/blobstore"
+	"service/infrastructure/fhirstore"
+	"strings"
+	"testing"
+)
+
+// testLetter is the content of a discharge letter, sniffed as a PDF
+var testLetter = "%PDF-1.7\n" + strings.Repeat("lettera di dimissione\n", 100)
+
+// newDocumentController returns a controller keeping documents of at most maxSizeMB in blobs
+func newDocumentController(t *testing.T, blobs storage.BlobStore, maxSizeMB int) *StandardController {
+	trail, err := audit.NewTrail(auditstore.NewMemorySink(), []byte("test-audit-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig()
+	cfg.Documents.MaxSizeMB = maxSizeMB
+	return NewController(cfg, metrics.New(), trail, fhirstore.NewMemoryStore(), blobs)
+}
+
+func documentBody(patientID, attachment, extra string) string {
+	return `{"resourceType":"DocumentReference","status":"current",` +
+		`"type":{"coding":[{"system":"http://loinc.org","code":"18842-5"}]},` +
+		`"subject":{"reference":"Patient/` + patientID + `"},` +
+		`"content":[{"attachment":{` + attachment + `}}]` + extra + `}`
+}
+
+// uploadDocument posts resource and content as the parts of a multipart upload
+func uploadDocument(router http.Handler, resource, contentType, filename, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	resourcePart, _ := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="resource"`},
+		"Content-Type":        {response.MediaFHIRJSON},
+	})
+	_, _ = io.WriteString(resourcePart, resource)
+	contentPart, _ := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="content"; filename="` + filename + `"`},
+		"Content-Type":        {contentType},
+	})
+	_, _ = io.WriteString(contentPart, content)
+	_ = parts.Close()
+
+	req := httptest.NewRequest("POST", endpoint.DocumentReference, &body)
+	req.Header.Set("Content-Type", parts.FormDataContentType())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func decodeDocument(t *testing.T, rr *httptest.ResponseRecorder) fhir.DocumentReference {
+	t.Helper()
+	var document fhir.DocumentReference
+	if err := json.Unmarshal(rr.Body.Bytes(), &document); err != nil || len(document.Content) != 1 {
+		t.Fatalf("Expected a DocumentReference, got %d: %s", rr.Code, rr.Body.String())
+	}
+	return document
+}
+
+func TestDocumentUploadAndDownload(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+
+	rr := uploadDocument(router, documentBody(patientID, "", ""), "application/pdf", "lettera.pdf", testLetter)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	document := decodeDocument(t, rr)
+	attachment := document.Content[0].Attachment
+	sum := sha1.Sum([]byte(testLetter))
+	if attachment.ContentType != "application/pdf" || attachment.Size == nil || *attachment.Size != int64(len(testLetter)) ||
+		!bytes.Equal(attachment.Hash, sum[:]) || attachment.Title != "lettera.pdf" || attachment.URL != "DocumentReference/"+document.ID+"/content" {
+		t.Errorf("Expected the attachment to describe the content, got %+v", attachment)
+	}
+
+	for _, target := range []string{endpoint.DocumentReference + "/" + document.ID + "/content",
+		endpoint.DocumentReference + "/" + document.ID + "/_history/1/content"} {
+		rr = servePatient(router, "GET", target, "")
+		if rr.Code != http.StatusOK || rr.Body.String() != testLetter {
+			t.Fatalf("Expected the content from %s, got %d with %d bytes", target, rr.Code, rr.Body.Len())
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/pdf" {
+			t.Errorf("Expected Content-Type application/pdf, got %q", got)
+		}
+		if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename=lettera.pdf` {
+			t.Errorf("Expected the download to be named after the title, got %q", got)
+		}
+	}
+
+	etag := `"` + base64.StdEncoding.EncodeToString(sum[:]) + `"`
+	if got := rr.Header().Get("ETag"); got != etag {
+		t.Errorf("Expected ETag %s, got %s", etag, got)
+	}
+	rr = servePatient(router, "GET", endpoint.DocumentReference+"/"+document.ID+"/content", "", "If-None-Match", etag)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected status 304 for the content held already, got %d", rr.Code)
+	}
+}
+
+func TestDocumentUploadErrors(t *testing.T) {
+	blobDir := t.TempDir()
+	blobs, err := blobstore.NewFilesystem(blobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(newDocumentController(t, blobs, 1))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	wrongHash := sha1.Sum([]byte("another letter"))
+
+	tests := []struct {
+		name           string
+		resource       string
+		contentType    string
+		content        string
+		expectedStatus int
+	}{
+		{name: "content not matching its type", resource: documentBody(patientID, "", ""), contentType: "application/pdf",
+			content: "plain text", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "type not allowed", resource: documentBody(patientID, "", ""), contentType: "image/png",
+			content: "\x89PNG\r\n\x1a\n", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "hash mismatch", resource: documentBody(patientID, `"hash":"`+base64.StdEncoding.EncodeToString(wrongHash[:])+`"`, ""),
+			contentType: "application/pdf", content: testLetter, expectedStatus: http.StatusBadRequest},
+		{name: "size mismatch", resource: documentBody(patientID, `"size":12`, ""), contentType: "application/pdf",
+			content: testLetter, expectedStatus: http.StatusBadRequest},
+		{name: "too large", resource: documentBody(patientID, "", ""), contentType: "application/pdf",
+			content: "%PDF-1.7\n" + strings.Repeat("x", 1<<20), expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "content with a url", resource: documentBody(patientID, `"url":"http://example.org/letter.pdf"`, ""),
+			contentType: "application/pdf", content: testLetter, expectedStatus: http.StatusBadRequest},
+		{name: "unknown patient", resource: documentBody("missing", "", ""), contentType: "application/pdf",
+			content: testLetter, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := uploadDocument(router, tt.resource, tt.contentType, "letter.pdf", tt.content)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			decodeOutcome(t, rr)
+		})
+	}
+
+	rr := servePatient(router, "POST", endpoint.DocumentReference, documentBody(patientID, "", ""))
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 for a body that is not multipart, got %d", rr.Code)
+	}
+	if entries, _ := os.ReadDir(blobDir); len(entries) != 0 {
+		t.Errorf("Expected refused uploads to store nothing, found %d files", len(entries))
+	}
+}
+
+func TestDocumentVersions(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	first := decodeDocument(t, uploadDocument(router, documentBody(patientID, "", ""), "application/pdf", "v1.pdf", testLetter))
+
+	replaces := `,"relatesTo":[{"code":"replaces","target":{"reference":"DocumentReference/` + first.ID + `"}}]`
+	rr := uploadDocument(router, documentBody(patientID, "", replaces), "application/pdf", "v2.pdf", testLetter+"addendum\n")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected the new version to be created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	second := decodeDocument(t, rr)
+	if got := decodeDocument(t, servePatient(router, "GET", endpoint.DocumentReference+"/"+first.ID, "")); got.Status != "superseded" {
+		t.Errorf("Expected the replaced document to be superseded, got %s", got.Status)
+	}
+	if ids := searchIDs(t, router, endpoint.DocumentReference+"?relatesto=DocumentReference/"+first.ID); len(ids) != 1 || ids[0] != second.ID {
+		t.Errorf("Expected the new version to be found by relatesto, got %v", ids)
+	}
+
+	// a superseded document cannot be replaced again
+	rr = uploadDocument(router, documentBody(patientID, "", replaces), "application/pdf", "v3.pdf", testLetter)
+	if rr.Code != http.StatusBadRequest || decodeOutcome(t, rr).Issue[0].Code != fhir.IssueBusinessRule {
+		t.Errorf("Expected status 400 replacing a superseded document, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// updates change the metadata, not the content
+	updated := second
+	updated.Description = "lettera di dimissione, con addendum"
+	rr = servePatient(router, "PUT", endpoint.DocumentReference+"/"+second.ID, mustJSON(t, updated))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the description to be updated, got %d: %s", rr.Code, rr.Body.String())
+	}
+	updated.Content[0].Attachment.Title = "other.pdf"
+	rr = servePatient(router, "PUT", endpoint.DocumentReference+"/"+second.ID, mustJSON(t, updated))
+	if rr.Code != http.StatusBadRequest || decodeOutcome(t, rr).Issue[0].Code != fhir.IssueBusinessRule {
+		t.Errorf("Expected status 400 changing the content, got %d: %s", rr.Code, rr.Body.String())
+	}
+	updated.ID = "unknown"
+	rr = servePatient(router, "PUT", endpoint.DocumentReference+"/unknown", mustJSON(t, updated))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 creating a document without upload, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = servePatient(router, "PUT", endpoint.DocumentReference+"/"+first.ID,
+		strings.Replace(mustJSON(t, first), `"status":"current"`, `"status":"current","description":"reopened"`, 1))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 making a superseded document current again, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// tamperedBlobs is a blob store whose content is altered once tampered is set
+type tamperedBlobs struct {
+	storage.BlobStore
+	tampered bool
+}
+
+func (b *tamperedBlobs) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !b.tampered {
+		return b.BlobStore.Get(ctx, key)
+	}
+	return io.NopCloser(strings.NewReader(strings.Replace(testLetter, "dimissione", "dimissioni", 1))), nil
+}
+
+func TestDocumentDownloadOfTamperedContent(t *testing.T) {
+	blobs := &tamperedBlobs{BlobStore: newTestBlobStore(t)}
+	router := newTestRouter(newDocumentController(t, blobs, 1))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	document := decodeDocument(t, uploadDocument(router, documentBody(patientID, "", ""), "application/pdf", "lettera.pdf", testLetter))
+
+	blobs.tampered = true
+	defer func() {
+		if recovered := recover(); recovered == nil || !errors.Is(recovered.(error), http.ErrAbortHandler) {
+			t.Errorf("Expected the download to be aborted, recovered %v", recovered)
+		}
+	}()
+	servePatient(router, "GET", endpoint.DocumentReference+"/"+document.ID+"/content", "")
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+)
+
+/* === Encounter handlers === */
+
+// CreateEncounterHandler stores the Encounter of the request body under a new id, its subject being an existing
+// Patient and its episodes of care existing ones of that patient
+func (c *StandardController) CreateEncounterHandler(w http.ResponseWriter, r *http.Request) {
+	c.encounterAPI.createHandler(w, r)
+}
+
+// ReadEncounterHandler returns the current version of an Encounter, 410 once it was deleted
+func (c *StandardController) ReadEncounterHandler(w http.ResponseWriter, r *http.Request) {
+	c.encounterAPI.readHandler(w, r)
+}
+
+// VReadEncounterHandler returns a version of an Encounter
+func (c *StandardController) VReadEncounterHandler(w http.ResponseWriter, r *http.Request) {
+	c.encounterAPI.vreadHandler(w, r)
+}
+
+// UpdateEncounterHandler stores the next version of an Encounter, answering 409 when its status cannot move to
+// the new one (see fhir.EncounterLifecycle)
+func (c *StandardController) UpdateEncounterHandler(w http.ResponseWriter, r *http.Request) {
+	c.encounterAPI.updateHandler(w, r)
+}
+
+// DeleteEncounterHandler deletes an Encounter
+func (c *StandardController) DeleteEncounterHandler(w http.ResponseWriter, r *http.Request) {
+	c.encounterAPI.deleteHandler(w, r)
+}
+
+// SearchEncounterHandler returns a searchset Bundle of the Encounters matching the query (see
+// fhir.EncounterSearchParams), such as those of a patient with a status within a date range
+func (c *StandardController) SearchEncounterHandler(w http.ResponseWriter, r *http.Request) {
+	c.encounterAPI.searchHandler(w, r)
+}
+
+/* === EpisodeOfCare handlers === */
+
+// CreateEpisodeOfCareHandler stores the EpisodeOfCare of the request body under a new id, its patient being an
+// existing Patient
+func (c *StandardController) CreateEpisodeOfCareHandler(w http.ResponseWriter, r *http.Request) {
+	c.episodeOfCareAPI.createHandler(w, r)
+}
+
+// ReadEpisodeOfCareHandler returns the current version of an EpisodeOfCare, 410 once it was deleted
+func (c *StandardController) ReadEpisodeOfCareHandler(w http.ResponseWriter, r *http.Request) {
+	c.episodeOfCareAPI.readHandler(w, r)
+}
+
+// VReadEpisodeOfCareHandler returns a version of an EpisodeOfCare
+func (c *StandardController) VReadEpisodeOfCareHandler(w http.ResponseWriter, r *http.Request) {
+	c.episodeOfCareAPI.vreadHandler(w, r)
+}
+
+// UpdateEpisodeOfCareHandler stores the next version of an EpisodeOfCare, answering 409 when its status cannot
+// move to the new one (see fhir.EpisodeOfCareLifecycle)
+func (c *StandardController) UpdateEpisodeOfCareHandler(w http.ResponseWriter, r *http.Request) {
+	c.episodeOfCareAPI.updateHandler(w, r)
+}
+
+// DeleteEpisodeOfCareHandler deletes an EpisodeOfCare
+func (c *StandardController) DeleteEpisodeOfCareHandler(w http.ResponseWriter, r *http.Request) {
+	c.episodeOfCareAPI.deleteHandler(w, r)
+}
+
+// SearchEpisodeOfCareHandler returns a searchset Bundle of the EpisodeOfCares matching the query (see
+// fhir.EpisodeOfCareSearchParams)
+func (c *StandardController) SearchEpisodeOfCareHandler(w http.ResponseWriter, r *http.Request) {
+	c.episodeOfCareAPI.searchHandler(w, r)
+}
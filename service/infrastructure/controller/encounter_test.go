@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"net/http"
+	"service/application/fhir"
+	"strings"
+	"testing"
+)
+
+// createResource posts body to target, returning the id of the created resource
+func createResource(t *testing.T, router http.Handler, target, body string) string {
+	t.Helper()
+	rr := servePatient(router, "POST", target, body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating %s, got %d: %s", target, rr.Code, rr.Body.String())
+	}
+	var base fhir.Base
+	if err := json.Unmarshal(rr.Body.Bytes(), &base); err != nil {
+		t.Fatal(err)
+	}
+	return base.ID
+}
+
+func encounterBody(id, status, patientID, extra string) string {
+	body := `{"resourceType":"Encounter","status":"` + status + `",` +
+		`"class":{"system":"http://terminology.hl7.org/CodeSystem/v3-ActCode","code":"AMB"},` +
+		`"subject":{"reference":"Patient/` + patientID + `"},` +
+		`"participant":[{"individual":{"reference":"Practitioner/dr-bianchi"}}]` + extra + `}`
+	if id != "" {
+		body = strings.Replace(body, `"resourceType":"Encounter",`, `"resourceType":"Encounter","id":"`+id+`",`, 1)
+	}
+	return body
+}
+
+func TestEncounterLifecycle(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	id := createResource(t, router, endpoint.Encounter, encounterBody("", "planned", patientID, ""))
+	path := endpoint.Encounter + "/" + id
+
+	for _, status := range []string{"arrived", "in-progress", "finished"} {
+		rr := servePatient(router, "PUT", path, encounterBody(id, status, patientID, ""))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected the encounter to move to %s, got %d: %s", status, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := servePatient(router, "PUT", path, encounterBody(id, "in-progress", patientID, ""))
+	if rr.Code != http.StatusConflict || decodeOutcome(t, rr).Issue[0].Code != fhir.IssueConflict {
+		t.Errorf("Expected status 409 reopening a finished encounter, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = servePatient(router, "PUT", path, encounterBody(id, "finished", patientID, ""), "If-Match", `W/"1"`)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for a stale version, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = servePatient(router, "GET", path, "")
+	var encounter fhir.Encounter
+	if err := json.Unmarshal(rr.Body.Bytes(), &encounter); err != nil || encounter.Status != "finished" || encounter.Meta.VersionID != "4" {
+		t.Errorf("Expected the finished encounter at version 4, got %s", rr.Body.String())
+	}
+}
+
+func TestEncounterReferences(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	otherID := createResource(t, router, endpoint.Patient, strings.Replace(testPatient, "Rossi", "Verdi", 1))
+	episodeID := createResource(t, router, endpoint.EpisodeOfCare,
+		`{"resourceType":"EpisodeOfCare","status":"active","patient":{"reference":"Patient/`+otherID+`"}}`)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedIssue  fhir.IssueType
+	}{
+		{name: "unknown patient", body: encounterBody("", "planned", "missing", ""),
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueBusinessRule},
+		{name: "episode of another patient", body: encounterBody("", "planned", patientID, `,"episodeOfCare":[{"reference":"EpisodeOfCare/`+episodeID+`"}]`),
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueBusinessRule},
+		{name: "subject not a patient", body: `{"resourceType":"Encounter","status":"planned","class":{"code":"AMB"},"subject":{"reference":"Group/g1"}}`,
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueValue},
+		{name: "unknown status", body: encounterBody("", "onleave", patientID, ""),
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueCodeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := servePatient(router, "POST", endpoint.Encounter, tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if issue := decodeOutcome(t, rr).Issue[0]; issue.Code != tt.expectedIssue {
+				t.Errorf("Expected a %s issue, got %+v", tt.expectedIssue, issue)
+			}
+		})
+	}
+}
+
+func TestSearchEncounterHandler(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	otherID := createResource(t, router, endpoint.Patient, strings.Replace(testPatient, "Rossi", "Verdi", 1))
+	for _, encounter := range []struct{ patient, status, period string }{
+		{patientID, "finished", `{"start":"2024-03-01","end":"2024-03-02"}`},
+		{patientID, "in-progress", `{"start":"2024-05-10"}`},
+		{patientID, "planned", `{"start":"2024-05-20"}`},
+		{otherID, "in-progress", `{"start":"2024-05-12"}`},
+	} {
+		createResource(t, router, endpoint.Encounter,
+			encounterBody("", encounter.status, encounter.patient, `,"period":`+encounter.period))
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{name: "by patient", query: "patient=" + patientID, expected: 3},
+		{name: "by patient and status", query: "patient=Patient/" + patientID + "&status=in-progress,planned", expected: 2},
+		{name: "by date range", query: "date=ge2024-05-01&date=lt2024-05-15", expected: 2},
+		{name: "by practitioner", query: "practitioner=Practitioner/dr-bianchi&status=finished", expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := servePatient(router, "GET", endpoint.Encounter+"?"+tt.query, "")
+			var bundle fhir.Bundle
+			if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil || rr.Code != http.StatusOK {
+				t.Fatalf("Expected a Bundle, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if bundle.Total == nil || *bundle.Total != tt.expected {
+				t.Errorf("Expected %d encounters, got %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestEpisodeOfCareLifecycle(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	episode := `{"resourceType":"EpisodeOfCare","status":"active","patient":{"reference":"Patient/` + patientID + `"}}`
+	id := createResource(t, router, endpoint.EpisodeOfCare, episode)
+	path := endpoint.EpisodeOfCare + "/" + id
+	withID := strings.Replace(episode, `"resourceType":"EpisodeOfCare",`, `"resourceType":"EpisodeOfCare","id":"`+id+`",`, 1)
+
+	if rr := servePatient(router, "PUT", path, strings.Replace(withID, "active", "onhold", 1)); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the episode to be put on hold, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := servePatient(router, "PUT", path, strings.Replace(withID, "active", "planned", 1)); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 moving an episode back to planned, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
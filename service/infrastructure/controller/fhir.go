@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"service/application/documents"
+	"service/application/fhir"
+	"service/application/storage"
+	"strings"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+)
+
+// maxResourceSize bounds the FHIR resources accepted in request bodies
+const maxResourceSize = 1 << 20
+
+// fhirMediaTypes are the media types FHIR responses are written in, FHIR JSON being the default
+var fhirMediaTypes = []string{response.MediaFHIRJSON, response.MediaJSON}
+
+func init() {
+	response.DefaultRegistry.Register(fhir.ErrNotFound, response.TypeNotFound)
+	response.DefaultRegistry.Register(fhir.ErrDeleted, response.TypeGone)
+	response.DefaultRegistry.Register(fhir.ErrVersionConflict, response.TypePreconditionFailed)
+	response.DefaultRegistry.Register(fhir.ErrInvalidTransition, response.TypeConflict)
+	response.RegisterAs[*fhir.OperationOutcome](response.DefaultRegistry, response.TypeValidation)
+	response.DefaultRegistry.Register(documents.ErrUnsupportedContent, response.TypeUnsupportedMedia)
+	response.DefaultRegistry.Register(documents.ErrTooLarge, response.TypePayloadTooLarge)
+	response.DefaultRegistry.Register(storage.ErrBlobNotFound, response.TypeNotFound)
+}
+
+// decodeResource reads the FHIR JSON resource of the request body, bounded to maxResourceSize
+func decodeResource[T any, PT interface {
+	*T
+	fhir.Resource
+}](w http.ResponseWriter, r *http.Request) (PT, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != response.MediaFHIRJSON && mediaType != response.MediaJSON) {
+		return nil, response.NewProblem(response.TypeUnsupportedMedia,
+			"resources must be sent as "+response.MediaFHIRJSON+" or "+response.MediaJSON)
+	}
+	return fhir.Decode[T, PT](http.MaxBytesReader(w, r.Body, maxResourceSize))
+}
+
+// writeResource writes a version of a resource with its version as weak ETag and its lastUpdated as
+// Last-Modified, answering 304 to GET requests whose client holds that version already
+func writeResource(w http.ResponseWriter, r *http.Request, status int, resource fhir.Resource) {
+	var etag string
+	var lastModified time.Time
+	if meta := resource.GetBase().Meta; meta != nil {
+		etag = `W/"` + meta.VersionID + `"`
+		if meta.LastUpdated != nil {
+			lastModified = *meta.LastUpdated
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if response.NotModified(w, r, etag, lastModified) {
+			return
+		}
+	} else {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	writeFHIR(w, r, status, resource)
+}
+
+// writeFHIR writes v in the FHIR media type negotiated from the Accept header, answering 406 with an
+// OperationOutcome when the client accepts none
+func writeFHIR(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok := response.Negotiate(r.Header.Get("Accept"), fhirMediaTypes...)
+	if !ok {
+		mediaType, status = response.MediaFHIRJSON, http.StatusNotAcceptable
+		v = fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueNotSupported,
+			"supported media types are "+strings.Join(fhirMediaTypes, ", "))
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to encode FHIR response", "error", err, "path", r.URL.Path, "request_id", requestid.FromRequest(r))
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueException, response.TypeInternal.Title))
+	}
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		slog.Debug("failed to write response", "error", err)
+	}
+}
+
+// fhirError writes err as an OperationOutcome, its status coming from response.DefaultRegistry. As with problems,
+// server errors only expose their title and are logged.
+func fhirError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := response.ProblemFor(response.DefaultRegistry, err)
+	if problem.Status >= http.StatusInternalServerError {
+		slog.Error("request failed", "error", err, "status", problem.Status, "path", r.URL.Path, "request_id", requestid.FromRequest(r))
+	}
+
+	var outcome *fhir.OperationOutcome
+	if !errors.As(err, &outcome) {
+		diagnostics := problem.Detail
+		if diagnostics == "" {
+			diagnostics = problem.Title
+		}
+		outcome = fhir.NewOperationOutcome(fhir.SeverityError, issueTypeFor(problem.Status), diagnostics)
+	}
+	writeFHIR(w, r, problem.Status, outcome)
+}
+
+// issueTypeFor returns the OperationOutcome issue type matching an error status
+func issueTypeFor(status int) fhir.IssueType {
+	switch status {
+	case http.StatusNotFound:
+		return fhir.IssueNotFound
+	case http.StatusGone:
+		return fhir.IssueDeleted
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return fhir.IssueConflict
+	case http.StatusRequestEntityTooLarge:
+		return fhir.IssueTooLong
+	case http.StatusUnsupportedMediaType, http.StatusNotAcceptable:
+		return fhir.IssueNotSupported
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fhir.IssueSecurity
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fhir.IssueTransient
+	}
+	if status >= http.StatusInternalServerError {
+		return fhir.IssueException
+	}
+	return fhir.IssueInvalid
+}
+
+// ifMatchVersion returns the version of a weak or strong If-Match entity tag, "" when the header is absent
+func ifMatchVersion(r *http.Request) string {
+	etag := strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/")
+	return strings.Trim(etag, `"`)
+}
+
+// baseURL is the URL the client reached the FHIR endpoints at, through the gateway when it forwarded the request
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+	}
+	return scheme + "://" + host + strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/")
+}
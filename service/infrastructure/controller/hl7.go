@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"service/application/audit"
+	"service/application/hl7"
+	"slices"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+)
+
+// MediaHL7 is the media type of HL7 v2 messages in their pipe-delimited (ER7) encoding
+const MediaHL7 = "application/hl7-v2"
+
+// hl7MediaTypes are the media types accepted for posted HL7 v2 messages
+var hl7MediaTypes = []string{MediaHL7, "x-application/hl7-v2+er7", "text/plain"}
+
+/* === HL7 v2 handlers === */
+
+// HL7MessageHandler processes an HL7 v2 message posted as application/hl7-v2, answering 200 with its ACK whatever
+// the outcome: AA when it was accepted, AE when its content is invalid and AR when it cannot be processed as it is.
+// A message accepted earlier is answered with the same ACK without being processed again.
+func (c *StandardController) HL7MessageHandler(w http.ResponseWriter, r *http.Request) {
+	slog.Info("received HL7 message", "from", r.RemoteAddr)
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !slices.Contains(hl7MediaTypes, mediaType) {
+		response.Error(w, r, response.NewProblem(response.TypeUnsupportedMedia, "HL7 messages must be posted as "+MediaHL7))
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c.maxHL7MessageSize))
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	result := c.processHL7(r.Context(), "http", data, c.actorOf(r), requestid.FromRequest(r))
+	slog.Debug("answered HL7 message", "outcome", result.Outcome, "control_id", result.ControlID, "to", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", MediaHL7)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(result.ACK)
+}
+
+// MLLPHandler processes an HL7 v2 message received over MLLP, returning its ACK, see HL7MessageHandler
+func (c *StandardController) MLLPHandler(ctx context.Context, remote net.Addr, message []byte) []byte {
+	slog.Info("received HL7 message over MLLP", "from", remote)
+	// MLLP has no authentication, the peer address is all that is known of the sender
+	host, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		host = remote.String()
+	}
+	result := c.processHL7(ctx, "mllp", message, "mllp:"+host, "")
+	slog.Debug("answered HL7 message", "outcome", result.Outcome, "control_id", result.ControlID, "to", remote)
+	return result.ACK
+}
+
+/* === Helper Methods === */
+
+// processHL7 processes a message received over transport, recording its metrics and auditing the resources it wrote
+// with actor, who sent the message as far as the transport verified it
+func (c *StandardController) processHL7(ctx context.Context, transport string, data []byte, actor, requestID string) hl7.Result {
+	startTime := time.Now()
+	result := c.hl7.Process(ctx, data)
+
+	// unsupported types are counted together, the label values being chosen by the senders
+	messageType := result.MessageType
+	if !hl7.Supported(messageType) {
+		messageType = "unsupported"
+	}
+	c.metrics.Observe("hl7."+messageType, string(result.Outcome), time.Since(startTime))
+
+	var contentErr *hl7.Error
+	switch {
+	case result.Err == nil:
+	case errors.As(result.Err, &contentErr), result.Outcome == hl7.OutcomeRejected:
+		slog.Warn("HL7 message not accepted", "error", result.Err, "outcome", result.Outcome, "type", result.MessageType,
+			"control_id", result.ControlID, "transport", transport)
+	default:
+		slog.Error("failed to process HL7 message", "error", result.Err, "type", result.MessageType, "control_id", result.ControlID,
+			"transport", transport)
+	}
+
+	// the sending application named by the message is only recorded as its claimed source
+	source := ""
+	if result.Sender != "" {
+		source = "hl7:" + result.Sender
+	}
+	for _, change := range result.Changes {
+		action := audit.ActionUpdate
+		if change.Created {
+			action = audit.ActionCreate
+		}
+		c.recordEvent(ctx, audit.Event{
+			Actor:        actor,
+			Action:       action,
+			ResourceType: change.Resource.TypeName(),
+			ResourceID:   change.Resource.GetBase().ID,
+			Outcome:      audit.OutcomeSuccess,
+			RequestID:    requestID,
+			Source:       source,
+		})
+	}
+	return result
+}
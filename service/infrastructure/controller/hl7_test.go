@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"service/application/audit"
+	"service/application/hl7"
+	"service/infrastructure/auditstore"
+	"service/infrastructure/fhirstore"
+	"strings"
+	"testing"
+)
+
+// hl7Interface is the user posting the HL7 messages of the tests
+const hl7Interface = "adt-interface"
+
+const (
+	hl7Patient = "PID|1||RSSMRA85T10A562S^^^MEF&2.16.840.1.113883.2.9.4.3.2&ISO^NNITA~12345^^^OSP_RAVENNA^MR||Rossi^Mario||19851210|M\r"
+	hl7Visit   = "PV1|1|I|MED1^101^A|||||D001^Bianchi^Anna|||||||||||V2024-0001^^^OSP_RAVENNA|||||||||||||||||||||||||20240501080000\r"
+)
+
+// hl7Message is a message of messageType with the control ID id and the segments following its header
+func hl7Message(messageType, id string, segments ...string) string {
+	return "MSH|^~\\&|ADT|OSP_RAVENNA|CCE|AUSL|20240501083000||" + messageType + "|" + id + "|P|2.5\r" + strings.Join(segments, "")
+}
+
+// postHL7 posts message as forwarded for the hl7Interface user, returning the response and its MSA segment
+func postHL7(t *testing.T, router http.Handler, message string) (*httptest.ResponseRecorder, hl7.Segment) {
+	t.Helper()
+	req := forwardedBy(httptest.NewRequest("POST", endpoint.HL7, strings.NewReader(message)), hl7Interface)
+	req.Header.Set("Content-Type", MediaHL7)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != MediaHL7 {
+		t.Fatalf("Expected status 200 with an ACK, got %d %s: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	ack, err := hl7.Parse(rr.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Expected an ACK, got %q: %v", rr.Body.String(), err)
+	}
+	msa, ok := ack.First("MSA")
+	if !ok {
+		t.Fatalf("Expected an MSA segment, got %q", rr.Body.String())
+	}
+	return rr, msa
+}
+
+// searchOne returns the single resource of the searchset answered to target
+func searchOne(t *testing.T, router http.Handler, target string) map[string]any {
+	t.Helper()
+	rr := servePatient(router, "GET", target, "")
+	var bundle struct {
+		Entry []struct {
+			Resource map[string]any `json:"resource"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil || len(bundle.Entry) != 1 {
+		t.Fatalf("Expected one resource searching %s, got %d: %s", target, rr.Code, rr.Body.String())
+	}
+	return bundle.Entry[0].Resource
+}
+
+func TestHL7AdmissionAndDischarge(t *testing.T) {
+	c := newTestController(t)
+	router := newTestRouter(c)
+
+	if _, msa := postHL7(t, router, hl7Message("ADT^A01^ADT_A01", "MSG0001", "EVN|A01|20240501083000\r", hl7Patient, hl7Visit)); msa.Field(1).Value() != "AA" {
+		t.Fatalf("Expected the admission to be accepted, got %s", msa.Field(1).Value())
+	}
+	patient := searchOne(t, router, endpoint.Patient+"?identifier=RSSMRA85T10A562S")
+	encounter := searchOne(t, router, endpoint.Encounter+"?patient="+patient["id"].(string))
+	if encounter["status"] != "in-progress" {
+		t.Errorf("Expected the admitted encounter in-progress, got %v", encounter["status"])
+	}
+
+	discharge := strings.Replace(hl7Visit, "||20240501080000\r", "||20240501080000|20240503120000\r", 1)
+	if _, msa := postHL7(t, router, hl7Message("ADT^A03^ADT_A03", "MSG0002", "EVN|A03|20240503120000\r", hl7Patient, discharge)); msa.Field(1).Value() != "AA" {
+		t.Fatalf("Expected the discharge to be accepted, got %s", msa.Field(1).Value())
+	}
+	encounter = searchOne(t, router, endpoint.Encounter+"?patient="+patient["id"].(string))
+	if encounter["status"] != "finished" {
+		t.Errorf("Expected the discharged encounter finished, got %v", encounter["status"])
+	}
+
+	// the writes are audited with the user who posted the messages, the sender they name being unverified
+	events, err := c.auditTrail.Query(context.Background(), audit.Filter{Actor: hl7Interface})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Errorf("Expected the writes of both messages to be audited, got %+v", events)
+	}
+	for _, event := range events {
+		if event.Source != "hl7:ADT|OSP_RAVENNA" {
+			t.Errorf("Expected the sender of the message as the source, got %+v", event)
+		}
+	}
+}
+
+func TestMLLPActor(t *testing.T) {
+	c := newTestController(t)
+	remote := &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 49152}
+	c.MLLPHandler(context.Background(), remote, []byte(hl7Message("ADT^A28^ADT_A05", "MSG0001", "EVN|A28|20240501083000\r", hl7Patient)))
+
+	events, err := c.auditTrail.Query(context.Background(), audit.Filter{Actor: "mllp:10.1.2.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Source != "hl7:ADT|OSP_RAVENNA" {
+		t.Errorf("Expected the write audited with the peer address as actor, got %+v", events)
+	}
+}
+
+func TestHL7LaboratoryResult(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+
+	result := hl7Message("ORU^R01^ORU_R01", "LAB0001", hl7Patient,
+		"OBR|1||ORD-77^LAB|24323-8^Metabolic panel^LN|||20240501090000\r",
+		"OBX|1|NM|2345-7^Glucose^LN||132|mg/dL^^UCUM|70-99|H|||F\r")
+	if _, msa := postHL7(t, router, result); msa.Field(1).Value() != "AA" {
+		t.Fatalf("Expected the result to be accepted, got %s", msa.Field(1).Value())
+	}
+
+	observation := searchOne(t, router, endpoint.Observation+"?code=2345-7")
+	quantity, _ := observation["valueQuantity"].(map[string]any)
+	if quantity["value"] != 132.0 || quantity["code"] != "mg/dL" {
+		t.Errorf("Expected 132 mg/dL, got %v", observation["valueQuantity"])
+	}
+	if observation["effectiveDateTime"] == nil || observation["interpretation"] == nil {
+		t.Errorf("Expected the time of the order and the interpretation of the result, got %v", observation)
+	}
+}
+
+func TestHL7Duplicate(t *testing.T) {
+	c := newTestController(t)
+	router := newTestRouter(c)
+	message := hl7Message("ADT^A28^ADT_A05", "MSG0001", "EVN|A28|20240501083000\r", hl7Patient)
+
+	first, _ := postHL7(t, router, message)
+	second, _ := postHL7(t, router, message)
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("Expected the copy to be answered with the same ACK, got %q and %q", first.Body.String(), second.Body.String())
+	}
+	rr := servePatient(router, "GET", endpoint.Patient, "")
+	if strings.Count(rr.Body.String(), `"fullUrl"`) != 1 {
+		t.Errorf("Expected a single patient, got %s", rr.Body.String())
+	}
+
+	metrics := httptest.NewRecorder()
+	c.MetricsHandler(metrics, httptest.NewRequest("GET", endpoint.Metrics, nil))
+	for _, outcome := range []string{"accepted", "duplicate"} {
+		want := `operations_total{operation="hl7.ADT^A28",outcome="` + outcome + `"} 1`
+		if !strings.Contains(metrics.Body.String(), want) {
+			t.Errorf("Expected the metrics to hold %s", want)
+		}
+	}
+}
+
+func TestHL7DuplicateAcrossInstances(t *testing.T) {
+	trail, err := audit.NewTrail(auditstore.NewMemorySink(), []byte("test-audit-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, blobs := fhirstore.NewMemoryStore(), newTestBlobStore(t)
+	first := newTestRouter(NewController(testConfig(), metrics.New(), trail, store, blobs))
+	other := NewController(testConfig(), metrics.New(), trail, store, blobs)
+	message := hl7Message("ADT^A28^ADT_A05", "MSG0001", "EVN|A28|20240501083000\r", hl7Patient)
+
+	accepted, _ := postHL7(t, first, message)
+	copied, _ := postHL7(t, newTestRouter(other), message)
+	if accepted.Body.String() != copied.Body.String() {
+		t.Errorf("Expected the copy sent to another instance to be answered with the same ACK, got %q and %q", accepted.Body.String(), copied.Body.String())
+	}
+	rr := servePatient(first, "GET", endpoint.Patient, "")
+	if strings.Count(rr.Body.String(), `"fullUrl"`) != 1 {
+		t.Errorf("Expected a single patient, got %s", rr.Body.String())
+	}
+
+	recorded := httptest.NewRecorder()
+	other.MetricsHandler(recorded, httptest.NewRequest("GET", endpoint.Metrics, nil))
+	if want := `operations_total{operation="hl7.ADT^A28",outcome="duplicate"} 1`; !strings.Contains(recorded.Body.String(), want) {
+		t.Errorf("Expected the metrics of the other instance to hold %s", want)
+	}
+}
+
+func TestHL7Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+		wantErr string
+	}{
+		{name: "invalid birth date", want: "AE", wantErr: "PID^1^7",
+			message: hl7Message("ADT^A28^ADT_A05", "MSG0001", strings.Replace(hl7Patient, "19851210", "19851310", 1))},
+		{name: "visit without number", want: "AE", wantErr: "PV1^1^19",
+			message: hl7Message("ADT^A01^ADT_A01", "MSG0002", hl7Patient, "PV1|1|I\r")},
+		{name: "unsupported message type", want: "AR", wantErr: "MSH^1^9",
+			message: hl7Message("SIU^S12^SIU_S12", "MSG0003")},
+		{name: "unparsable message", want: "AR",
+			message: "PID|1||12345\r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, msa := postHL7(t, newTestRouter(newTestController(t)), tt.message)
+			if got := msa.Field(1).Value(); got != tt.want {
+				t.Errorf("Expected %s, got %s: %q", tt.want, got, rr.Body.String())
+			}
+			if tt.wantErr != "" && !strings.Contains(rr.Body.String(), "ERR||"+tt.wantErr+"|") {
+				t.Errorf("Expected an ERR segment at %s, got %q", tt.wantErr, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHL7UnsupportedMediaType(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	rr := servePatient(router, "POST", endpoint.HL7, hl7Message("ADT^A28^ADT_A05", "MSG0001", hl7Patient))
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 for a FHIR body, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"service/application/audit"
+	"service/application/fhir"
+	"strconv"
+)
+
+/* === Observation handlers === */
+
+// CreateObservationHandler stores the Observation of the request body under a new id, its subject being an
+// existing Patient; quantities without interpretation are flagged against their reference ranges
+func (c *StandardController) CreateObservationHandler(w http.ResponseWriter, r *http.Request) {
+	c.observationAPI.createHandler(w, r)
+}
+
+// ReadObservationHandler returns the current version of an Observation, 410 once it was deleted
+func (c *StandardController) ReadObservationHandler(w http.ResponseWriter, r *http.Request) {
+	c.observationAPI.readHandler(w, r)
+}
+
+// VReadObservationHandler returns a version of an Observation
+func (c *StandardController) VReadObservationHandler(w http.ResponseWriter, r *http.Request) {
+	c.observationAPI.vreadHandler(w, r)
+}
+
+// UpdateObservationHandler stores the next version of an Observation, answering 409 when its status cannot move
+// to the new one (see fhir.ObservationLifecycle)
+func (c *StandardController) UpdateObservationHandler(w http.ResponseWriter, r *http.Request) {
+	c.observationAPI.updateHandler(w, r)
+}
+
+// DeleteObservationHandler deletes an Observation
+func (c *StandardController) DeleteObservationHandler(w http.ResponseWriter, r *http.Request) {
+	c.observationAPI.deleteHandler(w, r)
+}
+
+// SearchObservationHandler returns a searchset Bundle of the Observations matching the query (see
+// fhir.ObservationSearchParams): the readings of a patient and code between two dates, or the last ones with
+// _sort=-date and _count
+func (c *StandardController) SearchObservationHandler(w http.ResponseWriter, r *http.Request) {
+	c.observationAPI.searchHandler(w, r)
+}
+
+// LastNObservationHandler implements the $lastn operation: the max (1 by default) most recent Observations of each
+// code among those of a patient matching the other search parameters, such as the last 3 blood pressure readings
+func (c *StandardController) LastNObservationHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	n, err := lastNMax(query)
+	var search fhir.Search[*fhir.Observation]
+	if err == nil {
+		search, err = fhir.ParseSearch(query, fhir.ObservationSearchParams)
+	}
+	if err != nil {
+		c.recordAudit(r, audit.ActionSearch, fhir.ObservationType, "", audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+
+	var matches []*fhir.Observation
+	for observation, err := range c.observationAPI.repository.Search(r.Context(), search.Match, search.Index...) {
+		if err != nil {
+			c.recordAudit(r, audit.ActionSearch, fhir.ObservationType, "", audit.OutcomeFailure)
+			fhirError(w, r, err)
+			return
+		}
+		matches = append(matches, observation)
+	}
+	c.recordAudit(r, audit.ActionSearch, fhir.ObservationType, "", audit.OutcomeSuccess)
+
+	last := fhir.LastN(matches, n)
+	self := []fhir.BundleLink{{Relation: "self", URL: baseURL(r) + r.URL.RequestURI()}}
+	writeFHIR(w, r, http.StatusOK, c.observationAPI.searchset(r, last, len(last), self))
+}
+
+// lastNMax takes the max parameter out of a $lastn query, checking that the query searches the observations of a
+// patient
+func lastNMax(query url.Values) (int, error) {
+	n := 1
+	if values, ok := query["max"]; ok {
+		var err error
+		if n, err = strconv.Atoi(values[len(values)-1]); err != nil || n < 1 {
+			return 0, fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueValue,
+				fmt.Sprintf("max must be a positive integer, got %q", values[len(values)-1]), "max")
+		}
+		query.Del("max")
+	}
+	if !query.Has("patient") && !query.Has("subject") {
+		return 0, fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueRequired, "$lastn requires the patient or subject parameter")
+	}
+	return n, nil
+}
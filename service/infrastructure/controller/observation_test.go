@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"net/http"
+	"net/url"
+	"service/application/fhir"
+	"slices"
+	"testing"
+)
+
+func bloodPressureBody(patientID, effective string, systolic, diastolic int) string {
+	return fmt.Sprintf(`{"resourceType":"Observation","status":"final",
+		"category":[{"coding":[{"system":"http://terminology.hl7.org/CodeSystem/observation-category","code":"vital-signs"}]}],
+		"code":{"coding":[{"system":"http://loinc.org","code":"85354-9"}]},"subject":{"reference":"Patient/%s"},"effectiveDateTime":%q,
+		"component":[
+			{"code":{"coding":[{"system":"http://loinc.org","code":"8480-6"}]},"valueQuantity":{"value":%d,"system":"http://unitsofmeasure.org","code":"mm[Hg]"},
+				"referenceRange":[{"high":{"value":140,"system":"http://unitsofmeasure.org","code":"mm[Hg]"}}]},
+			{"code":{"coding":[{"system":"http://loinc.org","code":"8462-4"}]},"valueQuantity":{"value":%d,"system":"http://unitsofmeasure.org","code":"mm[Hg]"}}]}`,
+		patientID, effective, systolic, diastolic)
+}
+
+// searchIDs returns the ids of the Observations of the searchset answered to target
+func searchIDs(t *testing.T, router http.Handler, target string) []string {
+	t.Helper()
+	rr := servePatient(router, "GET", target, "")
+	var bundle struct {
+		fhir.Bundle
+		Entry []struct {
+			Resource fhir.Observation `json:"resource"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Expected a Bundle, got %d: %s", rr.Code, rr.Body.String())
+	}
+	ids := make([]string, 0, len(bundle.Entry))
+	for _, entry := range bundle.Entry {
+		ids = append(ids, entry.Resource.ID)
+	}
+	return ids
+}
+
+func TestObservationTimeSeries(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	var readings []string
+	for day, systolic := range []int{118, 146, 131, 125} {
+		effective := fmt.Sprintf("2024-05-0%dT08:00:00+02:00", day+1)
+		readings = append(readings, createResource(t, router, endpoint.Observation, bloodPressureBody(patientID, effective, systolic, 80)))
+	}
+	weight := `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"29463-7"}]},
+		"subject":{"reference":"Patient/` + patientID + `"},"effectiveDateTime":"2024-05-02","valueQuantity":{"value":154,"system":"http://unitsofmeasure.org","code":"[lb_av]"}}`
+	weightID := createResource(t, router, endpoint.Observation, weight)
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{name: "last readings", target: endpoint.Observation + "?patient=" + patientID + "&code=85354-9&_sort=-date&_count=2",
+			want: []string{readings[3], readings[2]}},
+		{name: "between dates", target: endpoint.Observation + "?code=85354-9&date=ge2024-05-02&date=le2024-05-03",
+			want: []string{readings[1], readings[2]}},
+		{name: "high systolic", target: endpoint.Observation + "?component-code=8480-6&component-value-quantity=gt140",
+			want: []string{readings[1]}},
+		{name: "weight converted to kilograms", target: endpoint.Observation + "?value-quantity=" + url.QueryEscape("ge69|"+fhir.UCUMSystem+"|kg"),
+			want: []string{weightID}},
+		{name: "last of each code", target: endpoint.LastN + "?patient=Patient/" + patientID + "&max=2",
+			want: []string{weightID, readings[3], readings[2]}},
+		{name: "last of a category", target: endpoint.LastN + "?patient=" + patientID + "&category=vital-signs",
+			want: []string{readings[3]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchIDs(t, router, tt.target); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestObservationInterpretation(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	id := createResource(t, router, endpoint.Observation, bloodPressureBody(patientID, "2024-05-01T08:00:00Z", 152, 90))
+
+	rr := servePatient(router, "GET", endpoint.Observation+"/"+id, "")
+	var observation fhir.Observation
+	if err := json.Unmarshal(rr.Body.Bytes(), &observation); err != nil {
+		t.Fatal(err)
+	}
+	systolic, diastolic := observation.Component[0], observation.Component[1]
+	if len(systolic.Interpretation) != 1 || systolic.Interpretation[0].Coding[0].Code != "H" {
+		t.Errorf("Expected the systolic pressure flagged high, got %+v", systolic.Interpretation)
+	}
+	if len(diastolic.Interpretation) != 0 {
+		t.Errorf("Expected no flag without reference range, got %+v", diastolic.Interpretation)
+	}
+}
+
+func TestObservationErrors(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	patientID := createResource(t, router, endpoint.Patient, testPatient)
+	id := createResource(t, router, endpoint.Observation, bloodPressureBody(patientID, "2024-05-01T08:00:00Z", 120, 80))
+	preliminary := `{"resourceType":"Observation","id":"` + id + `","status":"preliminary","code":{"text":"Blood pressure"},"subject":{"reference":"Patient/` + patientID + `"}}`
+	wrongUnit := `{"resourceType":"Observation","status":"final","code":{"coding":[{"system":"http://loinc.org","code":"8310-5"}]},
+		"subject":{"reference":"Patient/` + patientID + `"},"valueQuantity":{"value":37,"system":"http://unitsofmeasure.org","code":"mm[Hg]"}}`
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedIssue  fhir.IssueType
+	}{
+		{name: "unit of another dimension", method: "POST", target: endpoint.Observation, body: wrongUnit,
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueValue},
+		{name: "unknown patient", method: "POST", target: endpoint.Observation, body: bloodPressureBody("missing", "2024-05-01", 120, 80),
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueBusinessRule},
+		{name: "final back to preliminary", method: "PUT", target: endpoint.Observation + "/" + id, body: preliminary,
+			expectedStatus: http.StatusConflict, expectedIssue: fhir.IssueConflict},
+		{name: "lastn without patient", method: "GET", target: endpoint.LastN + "?code=85354-9",
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueRequired},
+		{name: "lastn with an invalid max", method: "GET", target: endpoint.LastN + "?patient=" + patientID + "&max=0",
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueValue},
+		{name: "sort by an unsortable parameter", method: "GET", target: endpoint.Observation + "?_sort=code",
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := servePatient(router, tt.method, tt.target, tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if issue := decodeOutcome(t, rr).Issue[0]; issue.Code != tt.expectedIssue {
+				t.Errorf("Expected a %s issue, got %+v", tt.expectedIssue, issue)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"net/http"
+)
+
+/* === Patient handlers === */
+
+// CreatePatientHandler stores the Patient of the request body under a new id, answering 201 with its first version
+func (c *StandardController) CreatePatientHandler(w http.ResponseWriter, r *http.Request) {
+	c.patientAPI.createHandler(w, r)
+}
+
+// ReadPatientHandler returns the current version of a Patient, 410 once it was deleted
+func (c *StandardController) ReadPatientHandler(w http.ResponseWriter, r *http.Request) {
+	c.patientAPI.readHandler(w, r)
+}
+
+// VReadPatientHandler returns a version of a Patient
+func (c *StandardController) VReadPatientHandler(w http.ResponseWriter, r *http.Request) {
+	c.patientAPI.vreadHandler(w, r)
+}
+
+// UpdatePatientHandler stores the Patient of the request body as the next version of its id, or creates it with
+// that id. An If-Match header makes the update conditional on the current version, answering 412 when it moved on.
+func (c *StandardController) UpdatePatientHandler(w http.ResponseWriter, r *http.Request) {
+	c.patientAPI.updateHandler(w, r)
+}
+
+// DeletePatientHandler deletes a Patient, its versions staying readable through VReadPatientHandler
+func (c *StandardController) DeletePatientHandler(w http.ResponseWriter, r *http.Request) {
+	c.patientAPI.deleteHandler(w, r)
+}
+
+// SearchPatientHandler returns a searchset Bundle of the Patients matching the search parameters of the query
+// (see fhir.PatientSearchParams), paged by _count and _offset
+func (c *StandardController) SearchPatientHandler(w http.ResponseWriter, r *http.Request) {
+	c.patientAPI.searchHandler(w, r)
+}
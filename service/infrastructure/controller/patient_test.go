@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"net/http"
+	"net/http/httptest"
+	"service/application/audit"
+	"service/application/fhir"
+	"strings"
+	"testing"
+)
+
+const testPatient = `{"resourceType":"Patient",
+	"identifier":[{"system":"http://hl7.it/sid/codiceFiscale","value":"RSSMRA85T10A562S"}],
+	"name":[{"family":"Rossi","given":["Mario"]}],"gender":"male","birthDate":"1985-12-10"}`
+
+func servePatient(router http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", response.MediaFHIRJSON)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func decodePatient(t *testing.T, rr *httptest.ResponseRecorder) fhir.Patient {
+	t.Helper()
+	var patient fhir.Patient
+	if err := json.Unmarshal(rr.Body.Bytes(), &patient); err != nil {
+		t.Fatalf("Expected a Patient, got %s", rr.Body.String())
+	}
+	return patient
+}
+
+func decodeOutcome(t *testing.T, rr *httptest.ResponseRecorder) fhir.OperationOutcome {
+	t.Helper()
+	var outcome fhir.OperationOutcome
+	if err := json.Unmarshal(rr.Body.Bytes(), &outcome); err != nil || outcome.ResourceType != "OperationOutcome" || len(outcome.Issue) == 0 {
+		t.Fatalf("Expected an OperationOutcome, got %s", rr.Body.String())
+	}
+	return outcome
+}
+
+func TestPatientLifecycle(t *testing.T) {
+	ctrl := newTestController(t)
+	router := newTestRouter(ctrl)
+
+	rr := servePatient(router, "POST", endpoint.Patient, testPatient, "X-Forwarded-Prefix", endpoint.Service)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	created := decodePatient(t, rr)
+	location := "http://example.com" + endpoint.Service + endpoint.Patient + "/" + created.ID + "/_history/1"
+	if rr.Header().Get("Location") != location || rr.Header().Get("ETag") != `W/"1"` {
+		t.Errorf("Expected the location %s and version 1, got %v", location, rr.Header())
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), response.MediaFHIRJSON) {
+		t.Errorf("Expected FHIR JSON, got %s", rr.Header().Get("Content-Type"))
+	}
+	path := endpoint.Patient + "/" + created.ID
+
+	rr = servePatient(router, "GET", path, "")
+	if rr.Code != http.StatusOK || decodePatient(t, rr).Name[0].Family != "Rossi" {
+		t.Fatalf("Expected the created patient, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = servePatient(router, "GET", path, "", "If-None-Match", `W/"1"`); rr.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304 for the current version, got %d", rr.Code)
+	}
+
+	updated := strings.Replace(testPatient, `"resourceType":"Patient",`, `"resourceType":"Patient","id":"`+created.ID+`",`, 1)
+	updated = strings.Replace(updated, "Rossi", "Rossini", 1)
+	if rr = servePatient(router, "PUT", path, updated, "If-Match", `W/"2"`); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for a stale version, got %d", rr.Code)
+	}
+	rr = servePatient(router, "PUT", path, updated, "If-Match", `W/"1"`)
+	if rr.Code != http.StatusOK || decodePatient(t, rr).Meta.VersionID != "2" {
+		t.Fatalf("Expected version 2, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = servePatient(router, "GET", path+"/_history/1", "")
+	if rr.Code != http.StatusOK || decodePatient(t, rr).Name[0].Family != "Rossi" {
+		t.Errorf("Expected the first version, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr = servePatient(router, "DELETE", path, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", rr.Code)
+	}
+	rr = servePatient(router, "GET", path, "")
+	if rr.Code != http.StatusGone || decodeOutcome(t, rr).Issue[0].Code != fhir.IssueDeleted {
+		t.Errorf("Expected status 410 with a deleted issue, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	events, err := ctrl.auditTrail.Query(t.Context(), audit.Filter{ResourceType: fhir.PatientType, ResourceID: created.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 8 {
+		t.Errorf("Expected every access to the patient audited, got %d events", len(events))
+	}
+}
+
+func TestPatientErrors(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		headers        []string
+		expectedStatus int
+		expectedIssue  fhir.IssueType
+	}{
+		{name: "invalid resource", method: "POST", target: endpoint.Patient, body: `{"resourceType":"Patient","gender":"M"}`,
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueCodeInvalid},
+		{name: "malformed JSON", method: "POST", target: endpoint.Patient, body: `{"resourceType":`,
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueStructure},
+		{name: "unsupported media type", method: "POST", target: endpoint.Patient, body: testPatient,
+			headers: []string{"Content-Type", "text/plain"}, expectedStatus: http.StatusUnsupportedMediaType, expectedIssue: fhir.IssueNotSupported},
+		{name: "body too large", method: "POST", target: endpoint.Patient, body: `{"resourceType":"Patient","id":"` + strings.Repeat("a", maxResourceSize) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge, expectedIssue: fhir.IssueTooLong},
+		{name: "update without id", method: "PUT", target: endpoint.Patient + "/p1", body: testPatient,
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueInvalid},
+		{name: "unknown patient", method: "GET", target: endpoint.Patient + "/missing",
+			expectedStatus: http.StatusNotFound, expectedIssue: fhir.IssueNotFound},
+		{name: "unknown version", method: "GET", target: endpoint.Patient + "/missing/_history/1",
+			expectedStatus: http.StatusNotFound, expectedIssue: fhir.IssueNotFound},
+		{name: "unknown search parameter", method: "GET", target: endpoint.Patient + "?color=red",
+			expectedStatus: http.StatusBadRequest, expectedIssue: fhir.IssueNotSupported},
+		{name: "not acceptable", method: "GET", target: endpoint.Patient, headers: []string{"Accept", "application/xml"},
+			expectedStatus: http.StatusNotAcceptable, expectedIssue: fhir.IssueNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := servePatient(router, tt.method, tt.target, tt.body, tt.headers...)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if issue := decodeOutcome(t, rr).Issue[0]; issue.Code != tt.expectedIssue {
+				t.Errorf("Expected a %s issue, got %+v", tt.expectedIssue, issue)
+			}
+		})
+	}
+}
+
+func TestSearchPatientHandler(t *testing.T) {
+	router := newTestRouter(newTestController(t))
+	for _, family := range []string{"Rossi", "Rossetti", "Bianchi"} {
+		body := strings.Replace(testPatient, "Rossi", family, 1)
+		if rr := servePatient(router, "POST", endpoint.Patient, body); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := servePatient(router, "GET", endpoint.Patient+"?family=ross&codice-fiscale=RSSMRA85T10A562S&_count=1", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var bundle struct {
+		fhir.Bundle
+		Entry []struct {
+			FullURL  string       `json:"fullUrl"`
+			Resource fhir.Patient `json:"resource"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Type != "searchset" || bundle.Total == nil || *bundle.Total != 2 || len(bundle.Entry) != 1 || bundle.Entry[0].Resource.Name[0].Family != "Rossi" {
+		t.Errorf("Expected the first of 2 matches, got %s", rr.Body.String())
+	}
+	var next string
+	for _, link := range bundle.Link {
+		if link.Relation == "next" {
+			next = link.URL
+		}
+	}
+	if !strings.Contains(next, "_offset=1") {
+		t.Errorf("Expected a link to the next page, got %+v", bundle.Link)
+	}
+}
@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"service/application/audit"
+	"service/application/fhir"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+/* === FHIR interactions === */
+
+// resourceAPI implements the FHIR interactions of one resource type, the handlers of each type delegating to it.
+// Every interaction is audited.
+type resourceAPI[T any, PT interface {
+	*T
+	fhir.Resource
+}] struct {
+	c            *StandardController
+	typeName     string
+	repository   fhir.Repository[PT]
+	searchParams []fhir.SearchParam[PT]
+	// create and update write the resources, through the repository unless rules spanning several resources apply
+	create func(ctx context.Context, resource PT) (PT, error)
+	update func(ctx context.Context, resource PT, ifMatch string) (PT, bool, error)
+}
+
+// newResourceAPI returns the interactions of the resources of repository, written straight to it
+func newResourceAPI[T any, PT interface {
+	*T
+	fhir.Resource
+}](c *StandardController, repository fhir.Repository[PT], searchParams []fhir.SearchParam[PT]) resourceAPI[T, PT] {
+	return resourceAPI[T, PT]{
+		c:            c,
+		typeName:     PT(new(T)).TypeName(),
+		repository:   repository,
+		searchParams: searchParams,
+		create:       repository.Create,
+		update:       repository.Update,
+	}
+}
+
+// createHandler stores the resource of the request body under a new id, answering 201 with its first version
+func (a resourceAPI[T, PT]) createHandler(w http.ResponseWriter, r *http.Request) {
+	slog.Info("requested resource creation", "type", a.typeName, "from", r.RemoteAddr)
+
+	resource, err := decodeResource[T, PT](w, r)
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionCreate, a.typeName, "", audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	created, err := a.create(r.Context(), resource)
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionCreate, a.typeName, "", audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	a.c.recordAudit(r, audit.ActionCreate, a.typeName, created.GetBase().ID, audit.OutcomeSuccess)
+
+	w.Header().Set("Location", versionURL(r, created))
+	writeResource(w, r, http.StatusCreated, created)
+}
+
+// readHandler returns the current version of a resource, 410 once it was deleted
+func (a resourceAPI[T, PT]) readHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	resource, err := a.repository.Read(r.Context(), id)
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionRead, a.typeName, id, audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	a.c.recordAudit(r, audit.ActionRead, a.typeName, id, audit.OutcomeSuccess)
+	writeResource(w, r, http.StatusOK, resource)
+}
+
+// vreadHandler returns a version of a resource
+func (a resourceAPI[T, PT]) vreadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resource, err := a.repository.VRead(r.Context(), vars["id"], vars["vid"])
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionRead, a.typeName, vars["id"], audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	a.c.recordAudit(r, audit.ActionRead, a.typeName, vars["id"], audit.OutcomeSuccess)
+	writeResource(w, r, http.StatusOK, resource)
+}
+
+// updateHandler stores the resource of the request body as the next version of its id, or creates it with that
+// id. An If-Match header makes the update conditional on the current version, answering 412 when it moved on.
+func (a resourceAPI[T, PT]) updateHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Info("requested resource update", "type", a.typeName, "id", id, "from", r.RemoteAddr)
+
+	resource, err := decodeResource[T, PT](w, r)
+	if err == nil && resource.GetBase().ID != id {
+		err = fhir.NewOperationOutcome(fhir.SeverityError, fhir.IssueInvalid,
+			fmt.Sprintf("%s.id %q must be the id of the URL, %q", a.typeName, resource.GetBase().ID, id), a.typeName+".id")
+	}
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionUpdate, a.typeName, id, audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+
+	updated, created, err := a.update(r.Context(), resource, ifMatchVersion(r))
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionUpdate, a.typeName, id, audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	a.c.recordAudit(r, audit.ActionUpdate, a.typeName, id, audit.OutcomeSuccess)
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		w.Header().Set("Location", versionURL(r, updated))
+	}
+	writeResource(w, r, status, updated)
+}
+
+// deleteHandler deletes a resource, its versions staying readable through vreadHandler
+func (a resourceAPI[T, PT]) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	slog.Info("requested resource deletion", "type", a.typeName, "id", id, "from", r.RemoteAddr)
+
+	if err := a.repository.Delete(r.Context(), id); err != nil {
+		a.c.recordAudit(r, audit.ActionDelete, a.typeName, id, audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	a.c.recordAudit(r, audit.ActionDelete, a.typeName, id, audit.OutcomeSuccess)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// searchHandler returns a searchset Bundle of the resources matching the search parameters of the query, paged
+// by _count and _offset
+func (a resourceAPI[T, PT]) searchHandler(w http.ResponseWriter, r *http.Request) {
+	search, err := fhir.ParseSearch(r.URL.Query(), a.searchParams)
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionSearch, a.typeName, "", audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	page, total, err := a.repository.Page(r.Context(), search)
+	if err != nil {
+		a.c.recordAudit(r, audit.ActionSearch, a.typeName, "", audit.OutcomeFailure)
+		fhirError(w, r, err)
+		return
+	}
+	a.c.recordAudit(r, audit.ActionSearch, a.typeName, "", audit.OutcomeSuccess)
+	writeFHIR(w, r, http.StatusOK, a.searchset(r, page, total, pageLinks(r, search, total)))
+}
+
+// searchset returns the searchset Bundle of the matches of a search, total of them matching in all; a total over
+// fhir.MaxTotal is left out, the search having stopped counting
+func (a resourceAPI[T, PT]) searchset(r *http.Request, matches []PT, total int, links []fhir.BundleLink) fhir.Bundle {
+	bundle := fhir.Bundle{ResourceType: "Bundle", Type: "searchset", Link: links}
+	if total <= fhir.MaxTotal {
+		bundle.Total = &total
+	}
+	for _, resource := range matches {
+		bundle.Entry = append(bundle.Entry, fhir.BundleEntry{
+			FullURL:  baseURL(r) + "/" + a.typeName + "/" + resource.GetBase().ID,
+			Resource: resource,
+			Search:   &fhir.EntrySearch{Mode: "match"},
+		})
+	}
+	return bundle
+}
+
+/* === Helper Methods === */
+
+// versionURL is the absolute URL of the version of resource, as sent in Location headers
+func versionURL(r *http.Request, resource fhir.Resource) string {
+	base := resource.GetBase()
+	return baseURL(r) + "/" + base.ResourceType + "/" + base.ID + "/_history/" + base.Meta.VersionID
+}
+
+// pageLinks returns the self link of a search and the links to its previous and next pages
+func pageLinks[T any](r *http.Request, search fhir.Search[T], total int) []fhir.BundleLink {
+	link := func(relation string, offset int) fhir.BundleLink {
+		query := r.URL.Query()
+		query.Set("_count", strconv.Itoa(search.Count))
+		query.Set("_offset", strconv.Itoa(offset))
+		pageURL := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		return fhir.BundleLink{Relation: relation, URL: baseURL(r) + pageURL.String()}
+	}
+
+	links := []fhir.BundleLink{link("self", search.Offset)}
+	if search.Offset > 0 && search.Count > 0 {
+		links = append(links, link("previous", max(search.Offset-search.Count, 0)))
+	}
+	if search.Count > 0 && search.Offset+search.Count < total {
+		links = append(links, link("next", search.Offset+search.Count))
+	}
+	return links
+}
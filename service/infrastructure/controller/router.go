@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/accesslog"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/identity"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+	"github.com/gorilla/mux"
+)
+
+// NewRouter returns the public routes of the service served by c, behind the middlewares configured in cfg
+func NewRouter(cfg config.Config, c *StandardController) *mux.Router {
+	r := mux.NewRouter()
+
+	// assign or propagate the request ID used to correlate logs and audit events
+	r.Use(requestid.Middleware)
+
+	// apply metrics middleware to all routes
+	r.Use(c.GetMetricsMiddleware())
+
+	// apply access log middleware to all routes, logging the user forwarded by the API Gateway
+	accessLogOptions := cfg.AccessLogOptions()
+	accessLogOptions.Principal = func(r *http.Request, _ bool) string { return identity.User(r, cfg.Identity.Token) }
+	r.Use(accesslog.Middleware(accessLogOptions))
+
+	// compress responses and answer conditional requests with 304
+	if cfg.HTTP.Compression {
+		r.Use(response.Compress(cfg.CompressOptions()))
+	}
+	r.Use(response.Conditional)
+
+	// health check endpoint
+	r.HandleFunc(endpoint.Health, c.HealthCheckHandler).Methods("GET")
+
+	// FHIR Patient endpoints
+	r.HandleFunc(endpoint.Patient, c.CreatePatientHandler).Methods("POST")
+	r.HandleFunc(endpoint.Patient, c.SearchPatientHandler).Methods("GET")
+	r.HandleFunc(endpoint.Patient+"/{id}", c.ReadPatientHandler).Methods("GET")
+	r.HandleFunc(endpoint.Patient+"/{id}", c.UpdatePatientHandler).Methods("PUT")
+	r.HandleFunc(endpoint.Patient+"/{id}", c.DeletePatientHandler).Methods("DELETE")
+	r.HandleFunc(endpoint.Patient+"/{id}/_history/{vid}", c.VReadPatientHandler).Methods("GET")
+
+	// FHIR Encounter endpoints
+	r.HandleFunc(endpoint.Encounter, c.CreateEncounterHandler).Methods("POST")
+	r.HandleFunc(endpoint.Encounter, c.SearchEncounterHandler).Methods("GET")
+	r.HandleFunc(endpoint.Encounter+"/{id}", c.ReadEncounterHandler).Methods("GET")
+	r.HandleFunc(endpoint.Encounter+"/{id}", c.UpdateEncounterHandler).Methods("PUT")
+	r.HandleFunc(endpoint.Encounter+"/{id}", c.DeleteEncounterHandler).Methods("DELETE")
+	r.HandleFunc(endpoint.Encounter+"/{id}/_history/{vid}", c.VReadEncounterHandler).Methods("GET")
+
+	// FHIR EpisodeOfCare endpoints
+	r.HandleFunc(endpoint.EpisodeOfCare, c.CreateEpisodeOfCareHandler).Methods("POST")
+	r.HandleFunc(endpoint.EpisodeOfCare, c.SearchEpisodeOfCareHandler).Methods("GET")
+	r.HandleFunc(endpoint.EpisodeOfCare+"/{id}", c.ReadEpisodeOfCareHandler).Methods("GET")
+	r.HandleFunc(endpoint.EpisodeOfCare+"/{id}", c.UpdateEpisodeOfCareHandler).Methods("PUT")
+	r.HandleFunc(endpoint.EpisodeOfCare+"/{id}", c.DeleteEpisodeOfCareHandler).Methods("DELETE")
+	r.HandleFunc(endpoint.EpisodeOfCare+"/{id}/_history/{vid}", c.VReadEpisodeOfCareHandler).Methods("GET")
+
+	// FHIR Observation endpoints, $lastn before the read of an id
+	r.HandleFunc(endpoint.Observation, c.CreateObservationHandler).Methods("POST")
+	r.HandleFunc(endpoint.Observation, c.SearchObservationHandler).Methods("GET")
+	r.HandleFunc(endpoint.LastN, c.LastNObservationHandler).Methods("GET")
+	r.HandleFunc(endpoint.Observation+"/{id}", c.ReadObservationHandler).Methods("GET")
+	r.HandleFunc(endpoint.Observation+"/{id}", c.UpdateObservationHandler).Methods("PUT")
+	r.HandleFunc(endpoint.Observation+"/{id}", c.DeleteObservationHandler).Methods("DELETE")
+	r.HandleFunc(endpoint.Observation+"/{id}/_history/{vid}", c.VReadObservationHandler).Methods("GET")
+
+	// FHIR DocumentReference endpoints, documents being created by a multipart upload of their content
+	r.HandleFunc(endpoint.DocumentReference, c.UploadDocumentReferenceHandler).Methods("POST")
+	r.HandleFunc(endpoint.DocumentReference, c.SearchDocumentReferenceHandler).Methods("GET")
+	r.HandleFunc(endpoint.DocumentReference+"/{id}", c.ReadDocumentReferenceHandler).Methods("GET")
+	r.HandleFunc(endpoint.DocumentReference+"/{id}", c.UpdateDocumentReferenceHandler).Methods("PUT")
+	r.HandleFunc(endpoint.DocumentReference+"/{id}", c.DeleteDocumentReferenceHandler).Methods("DELETE")
+	r.HandleFunc(endpoint.DocumentReference+"/{id}/_history/{vid}", c.VReadDocumentReferenceHandler).Methods("GET")
+	r.HandleFunc(endpoint.DocumentReference+"/{id}/content", c.DocumentContentHandler).Methods("GET", "HEAD")
+	r.HandleFunc(endpoint.DocumentReference+"/{id}/_history/{vid}/content", c.DocumentContentHandler).Methods("GET", "HEAD")
+
+	// HL7 v2 message ingestion endpoint, answering with the ACK of the message
+	r.HandleFunc(endpoint.HL7, c.HL7MessageHandler).Methods("POST")
+
+	return r
+}
@@ -0,0 +1,220 @@
+package fhirstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"service/application/fhir"
+)
+
+// Memory keeps the versions of the resources in memory, it is meant for tests and local runs without a database.
+// Versions are stored encoded, so that the resources returned never share memory with the stored ones.
+type Memory[T fhir.Resource] struct {
+	// mu is shared by the repositories of a MemoryStore, it is nil for the repositories handed to a transaction,
+	// which runs holding it
+	mu       *sync.RWMutex
+	typeName string
+	data     *memoryData
+	now      func() time.Time
+}
+
+// memoryData is the content of a Memory repository
+type memoryData struct {
+	resources map[string]*history
+	// order holds the ids by creation, searches return the resources in that order
+	order []string
+}
+
+// history is the versions of one resource, versions[i] being version i+1 and nil for a deletion
+type history struct {
+	versions [][]byte
+}
+
+func (h *history) current() []byte {
+	return h.versions[len(h.versions)-1]
+}
+
+// NewMemory returns an empty in-memory repository of the resources of type T
+func NewMemory[T fhir.Resource]() *Memory[T] {
+	return newMemory[T](&sync.RWMutex{})
+}
+
+func newMemory[T fhir.Resource](mu *sync.RWMutex) *Memory[T] {
+	var zero T
+	return &Memory[T]{mu: mu, typeName: zero.TypeName(), data: &memoryData{resources: map[string]*history{}}, now: time.Now}
+}
+
+// Create stores resource under a new id as version 1
+func (m *Memory[T]) Create(_ context.Context, resource T) (T, error) {
+	defer m.lock()()
+
+	id := fhir.NewID()
+	for m.data.resources[id] != nil {
+		id = fhir.NewID()
+	}
+	h := &history{}
+	m.data.resources[id] = h
+	m.data.order = append(m.data.order, id)
+	return m.appendVersion(h, id, resource)
+}
+
+// Read returns the current version of the resource
+func (m *Memory[T]) Read(_ context.Context, id string) (T, error) {
+	defer m.rlock()()
+
+	var zero T
+	h, ok := m.data.resources[id]
+	if !ok {
+		return zero, fmt.Errorf("%s/%s: %w", m.typeName, id, fhir.ErrNotFound)
+	}
+	if h.current() == nil {
+		return zero, fmt.Errorf("%s/%s: %w", m.typeName, id, fhir.ErrDeleted)
+	}
+	return decode[T](h.current())
+}
+
+// VRead returns a version of the resource
+func (m *Memory[T]) VRead(_ context.Context, id, versionID string) (T, error) {
+	defer m.rlock()()
+
+	var zero T
+	h, ok := m.data.resources[id]
+	version, err := strconv.Atoi(versionID)
+	if !ok || err != nil || version < 1 || version > len(h.versions) {
+		return zero, fmt.Errorf("%s/%s/_history/%s: %w", m.typeName, id, versionID, fhir.ErrNotFound)
+	}
+	if h.versions[version-1] == nil {
+		return zero, fmt.Errorf("%s/%s/_history/%s: %w", m.typeName, id, versionID, fhir.ErrDeleted)
+	}
+	return decode[T](h.versions[version-1])
+}
+
+// Update stores resource as the next version of its id, creating the resource when the id is unknown
+func (m *Memory[T]) Update(_ context.Context, resource T, ifMatch string) (T, bool, error) {
+	defer m.lock()()
+
+	var zero T
+	id := resource.GetBase().ID
+	h, ok := m.data.resources[id]
+	if ifMatch != "" && (!ok || ifMatch != strconv.Itoa(len(h.versions))) {
+		return zero, false, fmt.Errorf("%s/%s is not at version %s: %w", m.typeName, id, ifMatch, fhir.ErrVersionConflict)
+	}
+	if !ok {
+		h = &history{}
+		m.data.resources[id] = h
+		m.data.order = append(m.data.order, id)
+	}
+	updated, err := m.appendVersion(h, id, resource)
+	return updated, !ok, err
+}
+
+// Delete records the deletion of the resource as a new version
+func (m *Memory[T]) Delete(_ context.Context, id string) error {
+	defer m.lock()()
+
+	h, ok := m.data.resources[id]
+	if !ok {
+		return fmt.Errorf("%s/%s: %w", m.typeName, id, fhir.ErrNotFound)
+	}
+	if h.current() != nil {
+		h.versions = append(h.versions, nil)
+	}
+	return nil
+}
+
+// Search iterates over a snapshot of the current versions matching match, in creation order; the conditions are
+// not needed since every resource is at hand
+func (m *Memory[T]) Search(_ context.Context, match func(T) bool, _ ...fhir.IndexCondition) iter.Seq2[T, error] {
+	unlock := m.rlock()
+	snapshot := make([][]byte, 0, len(m.data.order))
+	for _, id := range m.data.order {
+		if current := m.data.resources[id].current(); current != nil {
+			snapshot = append(snapshot, current)
+		}
+	}
+	unlock()
+
+	return func(yield func(T, error) bool) {
+		for _, encoded := range snapshot {
+			resource, err := decode[T](encoded)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			if match(resource) && !yield(resource, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Page pages the matches of search, read as Search does
+func (m *Memory[T]) Page(ctx context.Context, search fhir.Search[T]) ([]T, int, error) {
+	return search.Page(m.Search(ctx, search.Match))
+}
+
+// appendVersion stamps a copy of resource with the id and the next version of h and stores it, m.mu being held
+func (m *Memory[T]) appendVersion(h *history, id string, resource T) (T, error) {
+	var zero T
+	stored, err := fhir.Clone(resource)
+	if err != nil {
+		return zero, err
+	}
+	fhir.SetVersion(stored, id, len(h.versions)+1, m.now())
+
+	encoded, err := json.Marshal(stored)
+	if err != nil {
+		return zero, fmt.Errorf("encode %s/%s: %w", m.typeName, id, err)
+	}
+	h.versions = append(h.versions, encoded)
+	return stored, nil
+}
+
+// lock write-locks the repository unless it runs in a transaction, returning the unlock function
+func (m *Memory[T]) lock() func() {
+	if m.mu == nil {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// rlock read-locks the repository unless it runs in a transaction, returning the unlock function
+func (m *Memory[T]) rlock() func() {
+	if m.mu == nil {
+		return func() {}
+	}
+	m.mu.RLock()
+	return m.mu.RUnlock
+}
+
+// unlocked returns a view of the repository for a transaction holding its lock
+func (m *Memory[T]) unlocked() *Memory[T] {
+	view := *m
+	view.mu = nil
+	return &view
+}
+
+// snapshot copies the content of the repository, the returned function restoring it; the lock must be held
+func (m *Memory[T]) snapshot() (restore func()) {
+	resources := make(map[string]*history, len(m.data.resources))
+	for id, h := range m.data.resources {
+		resources[id] = &history{versions: slices.Clone(h.versions)}
+	}
+	saved := memoryData{resources: resources, order: slices.Clone(m.data.order)}
+	return func() { *m.data = saved }
+}
+
+// decode allocates a new resource, T being a pointer type
+func decode[T fhir.Resource](encoded []byte) (T, error) {
+	var resource T
+	err := json.Unmarshal(encoded, &resource)
+	return resource, err
+}
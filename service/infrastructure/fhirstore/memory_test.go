@@ -0,0 +1,124 @@
+package fhirstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"service/application/fhir"
+	"service/application/storage"
+	"service/application/storage/storagetest"
+)
+
+func newPatient(family string) *fhir.Patient {
+	return &fhir.Patient{
+		Base: fhir.Base{ResourceType: fhir.PatientType},
+		Name: []fhir.HumanName{{Family: family}},
+	}
+}
+
+func TestMemoryVersions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory[*fhir.Patient]()
+
+	created, err := store.Create(ctx, newPatient("Rossi"))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	id := created.ID
+	if !fhir.ValidID(id) || created.Meta.VersionID != "1" || created.Meta.LastUpdated == nil {
+		t.Fatalf("Create() = %+v, want an id, version 1 and lastUpdated", created.Base)
+	}
+
+	update := newPatient("Bianchi")
+	update.ID = id
+	if _, _, err := store.Update(ctx, update, "2"); !errors.Is(err, fhir.ErrVersionConflict) {
+		t.Errorf("Update() with a stale version error = %v, want ErrVersionConflict", err)
+	}
+	updated, created2, err := store.Update(ctx, update, "1")
+	if err != nil || created2 || updated.Meta.VersionID != "2" {
+		t.Fatalf("Update() = %+v, %v, %v, want version 2", updated.Meta, created2, err)
+	}
+
+	first, err := store.VRead(ctx, id, "1")
+	if err != nil || first.Name[0].Family != "Rossi" {
+		t.Errorf("VRead(1) = %+v, %v, want the first version", first, err)
+	}
+	current, err := store.Read(ctx, id)
+	if err != nil || current.Name[0].Family != "Bianchi" {
+		t.Errorf("Read() = %+v, %v, want the second version", current, err)
+	}
+
+	// the returned resources are copies
+	current.Name[0].Family = "Verdi"
+	if again, _ := store.Read(ctx, id); again.Name[0].Family != "Bianchi" {
+		t.Errorf("modifying a read resource changed the stored one")
+	}
+
+	if err := store.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Delete(ctx, id); err != nil {
+		t.Errorf("Delete() of a deleted resource error = %v", err)
+	}
+	if _, err := store.Read(ctx, id); !errors.Is(err, fhir.ErrDeleted) {
+		t.Errorf("Read() after delete error = %v, want ErrDeleted", err)
+	}
+	if _, err := store.VRead(ctx, id, "3"); !errors.Is(err, fhir.ErrDeleted) {
+		t.Errorf("VRead(3) error = %v, want ErrDeleted", err)
+	}
+	if _, err := store.VRead(ctx, id, "4"); !errors.Is(err, fhir.ErrNotFound) {
+		t.Errorf("VRead(4) error = %v, want ErrNotFound", err)
+	}
+
+	// updating a deleted resource brings it back as a new version
+	restored, _, err := store.Update(ctx, update, "")
+	if err != nil || restored.Meta.VersionID != "4" {
+		t.Errorf("Update() after delete = %+v, %v, want version 4", restored.Meta, err)
+	}
+}
+
+func TestMemoryUpdateCreates(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory[*fhir.Patient]()
+
+	patient := newPatient("Rossi")
+	patient.ID = "chosen-id"
+	created, isNew, err := store.Update(ctx, patient, "")
+	if err != nil || !isNew || created.ID != "chosen-id" || created.Meta.VersionID != "1" {
+		t.Errorf("Update() of an unknown id = %+v, %v, %v, want it created", created.Base, isNew, err)
+	}
+	if _, err := store.Read(ctx, "missing"); !errors.Is(err, fhir.ErrNotFound) {
+		t.Errorf("Read() of an unknown id error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing"); !errors.Is(err, fhir.ErrNotFound) {
+		t.Errorf("Delete() of an unknown id error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemorySearch(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory[*fhir.Patient]()
+	for _, family := range []string{"Rossi", "Bianchi", "Rossetti"} {
+		if _, err := store.Create(ctx, newPatient(family)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, _ := store.Create(ctx, newPatient("Rossini"))
+	_ = store.Delete(ctx, deleted.ID)
+
+	var families []string
+	for patient, err := range store.Search(ctx, func(p *fhir.Patient) bool { return p.Name[0].Family[:3] == "Ros" }) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		families = append(families, patient.Name[0].Family)
+	}
+	if len(families) != 2 || families[0] != "Rossi" || families[1] != "Rossetti" {
+		t.Errorf("Search() = %v, want the live matches in creation order", families)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) storage.Store { return NewMemoryStore() })
+}
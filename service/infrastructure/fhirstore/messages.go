@@ -0,0 +1,56 @@
+package fhirstore
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// MessageLog is a storage.MessageLog kept in memory, it only spans the instance it runs in
+type MessageLog struct {
+	// mu is shared with the repositories of a MemoryStore, it is nil for the log handed to a transaction, which
+	// runs holding it
+	mu       *sync.RWMutex
+	accepted *map[string]acceptedMessage
+	now      func() time.Time
+}
+
+type acceptedMessage struct {
+	ack []byte
+	at  time.Time
+}
+
+func newMessageLog(mu *sync.RWMutex) *MessageLog {
+	return &MessageLog{mu: mu, accepted: &map[string]acceptedMessage{}, now: time.Now}
+}
+
+// Accept records ack unless the message of key was accepted less than ttl ago, forgetting the messages accepted
+// earlier than that
+func (l *MessageLog) Accept(_ context.Context, key string, ack []byte, ttl time.Duration) ([]byte, error) {
+	if l.mu != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+
+	now := l.now()
+	maps.DeleteFunc(*l.accepted, func(_ string, m acceptedMessage) bool { return !m.at.After(now.Add(-ttl)) })
+	if m, ok := (*l.accepted)[key]; ok {
+		return m.ack, nil
+	}
+	(*l.accepted)[key] = acceptedMessage{ack: ack, at: now}
+	return nil, nil
+}
+
+// unlocked returns a view of the log for a transaction holding its lock
+func (l *MessageLog) unlocked() *MessageLog {
+	view := *l
+	view.mu = nil
+	return &view
+}
+
+// snapshot copies the content of the log, the returned function restoring it; the lock must be held
+func (l *MessageLog) snapshot() (restore func()) {
+	saved := maps.Clone(*l.accepted)
+	return func() { *l.accepted = saved }
+}
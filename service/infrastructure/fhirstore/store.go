@@ -0,0 +1,85 @@
+package fhirstore
+
+import (
+	"context"
+	"sync"
+
+	"service/application/fhir"
+	"service/application/storage"
+)
+
+// MemoryStore is a storage.Store keeping every repository in memory, its transactions run one at a time
+type MemoryStore struct {
+	mu sync.RWMutex
+	memoryRepositories
+}
+
+// memoryRepositories are the repositories of a store, or those handed to a transaction
+type memoryRepositories struct {
+	patients       *Memory[*fhir.Patient]
+	encounters     *Memory[*fhir.Encounter]
+	episodesOfCare *Memory[*fhir.EpisodeOfCare]
+	observations   *Memory[*fhir.Observation]
+	documents      *Memory[*fhir.DocumentReference]
+	messages       *MessageLog
+}
+
+func (r memoryRepositories) Patients() fhir.Repository[*fhir.Patient]     { return r.patients }
+func (r memoryRepositories) Encounters() fhir.Repository[*fhir.Encounter] { return r.encounters }
+func (r memoryRepositories) EpisodesOfCare() fhir.Repository[*fhir.EpisodeOfCare] {
+	return r.episodesOfCare
+}
+func (r memoryRepositories) Observations() fhir.Repository[*fhir.Observation] { return r.observations }
+func (r memoryRepositories) DocumentReferences() fhir.Repository[*fhir.DocumentReference] {
+	return r.documents
+}
+func (r memoryRepositories) Messages() storage.MessageLog { return r.messages }
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.memoryRepositories = memoryRepositories{
+		patients:       newMemory[*fhir.Patient](&s.mu),
+		encounters:     newMemory[*fhir.Encounter](&s.mu),
+		episodesOfCare: newMemory[*fhir.EpisodeOfCare](&s.mu),
+		observations:   newMemory[*fhir.Observation](&s.mu),
+		documents:      newMemory[*fhir.DocumentReference](&s.mu),
+		messages:       newMessageLog(&s.mu),
+	}
+	return s
+}
+
+// Transact runs fn holding the store lock, restoring the content of every repository when fn fails
+func (s *MemoryStore) Transact(ctx context.Context, fn func(tx storage.Repositories) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	restores := []func(){
+		s.patients.snapshot(), s.encounters.snapshot(), s.episodesOfCare.snapshot(), s.observations.snapshot(),
+		s.documents.snapshot(), s.messages.snapshot(),
+	}
+	tx := memoryRepositories{
+		patients:       s.patients.unlocked(),
+		encounters:     s.encounters.unlocked(),
+		episodesOfCare: s.episodesOfCare.unlocked(),
+		observations:   s.observations.unlocked(),
+		documents:      s.documents.unlocked(),
+		messages:       s.messages.unlocked(),
+	}
+	if err := fn(tx); err != nil {
+		for _, restore := range restores {
+			restore()
+		}
+		return err
+	}
+	return nil
+}
+
+// Ping always succeeds
+func (s *MemoryStore) Ping(context.Context) error { return nil }
+
+// Close does nothing, the content is lost with the process
+func (s *MemoryStore) Close() error { return nil }
@@ -0,0 +1,239 @@
+// Package mllp serves HL7 v2 messages over MLLP, the Minimal Lower Layer Protocol, which frames each message of a
+// TCP connection between a start block (0x0B) and an end block followed by a carriage return (0x1C 0x0D)
+package mllp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Framing bytes of MLLP
+const (
+	StartBlock     byte = 0x0B
+	EndBlock       byte = 0x1C
+	CarriageReturn byte = 0x0D
+)
+
+var (
+	// ErrFraming is returned for data that is not framed as MLLP requires
+	ErrFraming = errors.New("invalid MLLP framing")
+	// ErrTooLarge is returned for a message exceeding the maximum size
+	ErrTooLarge = errors.New("MLLP message too large")
+	// ErrServerClosed is returned by Serve once the server is closed
+	ErrServerClosed = errors.New("mllp: server closed")
+)
+
+// Handler answers a message received from remote with its acknowledgment
+type Handler func(ctx context.Context, remote net.Addr, message []byte) []byte
+
+// Server answers the messages of MLLP connections, those of a connection in order and connections concurrently
+type Server struct {
+	Handler Handler
+	// ReadTimeout closes the connections sending no message for that long, and bounds the write of an answer
+	ReadTimeout time.Duration
+	// MaxMessageSize bounds a message, the connection being closed when a message exceeds it
+	MaxMessageSize int
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// ListenAndServe listens on the TCP address addr and serves its connections, see Serve
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts the connections of listener until the server is closed, returning ErrServerClosed then
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.conns = map[net.Conn]struct{}{}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				slog.Warn("failed to accept MLLP connection", "error", err)
+				continue
+			}
+			return err
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Addr returns the address the server listens on, nil before Serve
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close stops accepting connections, closes those open, cancelling the messages being handled, and waits for
+// their handling to end
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+		s.cancel()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// track registers an accepted connection, false once the server is closed
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	remote := conn.RemoteAddr()
+	slog.Debug("MLLP connection opened", "from", remote)
+	r := bufio.NewReader(conn)
+	for {
+		if s.ReadTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		message, err := ReadMessage(r, s.MaxMessageSize)
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+				slog.Debug("MLLP connection closed", "from", remote)
+			case errors.As(err, &netErr) && netErr.Timeout():
+				slog.Debug("idle MLLP connection closed", "from", remote, "timeout", s.ReadTimeout)
+			default:
+				slog.Warn("failed to read MLLP message, closing the connection", "error", err, "from", remote)
+			}
+			return
+		}
+
+		ack := s.Handler(s.ctx, remote, message)
+		if s.ReadTimeout > 0 {
+			_ = conn.SetWriteDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		if err := WriteMessage(conn, ack); err != nil {
+			slog.Warn("failed to write MLLP acknowledgment, closing the connection", "error", err, "from", remote)
+			return
+		}
+	}
+}
+
+/* === Framing === */
+
+// ReadMessage reads the next framed message of r, without its framing bytes. Whitespace between messages is
+// skipped; io.EOF is returned when r ends before a message starts. A message over maxSize bytes fails with
+// ErrTooLarge, maxSize 0 meaning unlimited.
+func ReadMessage(r *bufio.Reader, maxSize int) ([]byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == StartBlock {
+			break
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return nil, fmt.Errorf("%w: expected a start block, got 0x%02X", ErrFraming, b)
+		}
+	}
+
+	var message []byte
+	for {
+		chunk, err := r.ReadSlice(EndBlock)
+		message = append(message, chunk...)
+		if maxSize > 0 && len(message) > maxSize+1 {
+			return nil, fmt.Errorf("%w: the maximum is %d bytes", ErrTooLarge, maxSize)
+		}
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			if errors.Is(err, io.EOF) {
+				err = fmt.Errorf("%w: the connection ended within a message", ErrFraming)
+			}
+			return nil, err
+		}
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("%w: the connection ended after an end block", ErrFraming)
+	}
+	if b != CarriageReturn {
+		return nil, fmt.Errorf("%w: expected a carriage return after the end block, got 0x%02X", ErrFraming, b)
+	}
+	return message[:len(message)-1], nil
+}
+
+// WriteMessage writes message to w framed as MLLP requires
+func WriteMessage(w io.Writer, message []byte) error {
+	framed := make([]byte, 0, len(message)+3)
+	framed = append(framed, StartBlock)
+	framed = append(framed, message...)
+	framed = append(framed, EndBlock, CarriageReturn)
+	_, err := w.Write(framed)
+	return err
+}
@@ -0,0 +1,189 @@
+package mllp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		maxSize int
+		want    []string
+		wantErr error
+	}{
+		{name: "one message", data: "\x0bMSH|^~\\&\r\x1c\r", want: []string{"MSH|^~\\&\r"}},
+		{name: "messages separated by line feeds", data: "\x0bA\x1c\r\n\x0bB\x1c\r", want: []string{"A", "B"}},
+		{name: "message at the maximum size", data: "\x0bABCD\x1c\r", maxSize: 4, want: []string{"ABCD"}},
+		{name: "message over the maximum size", data: "\x0bABCDE\x1c\r", maxSize: 4, wantErr: ErrTooLarge},
+		{name: "data before the start block", data: "MSH\x0bA\x1c\r", wantErr: ErrFraming},
+		{name: "end block without carriage return", data: "\x0bA\x1cX", wantErr: ErrFraming},
+		{name: "connection ended within a message", data: "\x0bMSH|", wantErr: ErrFraming},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tt.data), 16)
+			var got []string
+			for {
+				message, err := ReadMessage(r, tt.maxSize)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					if tt.wantErr == nil || !errors.Is(err, tt.wantErr) {
+						t.Fatalf("ReadMessage() error = %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				got = append(got, string(message))
+			}
+			if tt.wantErr != nil {
+				t.Fatalf("ReadMessage() read %q, want error %v", got, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ReadMessage() read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMessageLargerThanBuffer(t *testing.T) {
+	message := strings.Repeat("OBX|1|ST|||valore\r", 100)
+	var framed bytes.Buffer
+	if err := WriteMessage(&framed, []byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadMessage(bufio.NewReaderSize(&framed, 16), 0)
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if string(got) != message {
+		t.Errorf("ReadMessage() read %d bytes, want %d", len(got), len(message))
+	}
+}
+
+// startServer serves the MLLP connections of a local listener with server until the test ends
+func startServer(t *testing.T, server *Server) net.Addr {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	t.Cleanup(func() {
+		if err := server.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+		}
+	})
+	return listener.Addr()
+}
+
+func dial(t *testing.T, addr net.Addr) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestServerAnswersEachMessageInOrder(t *testing.T) {
+	addr := startServer(t, &Server{
+		Handler: func(_ context.Context, _ net.Addr, message []byte) []byte {
+			return append([]byte("ACK "), message...)
+		},
+		ReadTimeout:    time.Second,
+		MaxMessageSize: 1024,
+	})
+	conn, r := dial(t, addr)
+
+	for _, message := range []string{"first", "second"} {
+		if err := WriteMessage(conn, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"ACK first", "ACK second"} {
+		ack, err := ReadMessage(r, 0)
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		if string(ack) != want {
+			t.Errorf("ack = %q, want %q", ack, want)
+		}
+	}
+}
+
+func TestServerClosesConnections(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(conn net.Conn)
+	}{
+		{name: "message too large", send: func(conn net.Conn) {
+			_ = WriteMessage(conn, bytes.Repeat([]byte("A"), 64))
+		}},
+		{name: "invalid framing", send: func(conn net.Conn) {
+			_, _ = conn.Write([]byte("MSH|^~\\&\r"))
+		}},
+		{name: "idle connection", send: func(net.Conn) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startServer(t, &Server{
+				Handler:        func(context.Context, net.Addr, []byte) []byte { return []byte("ACK") },
+				ReadTimeout:    50 * time.Millisecond,
+				MaxMessageSize: 16,
+			})
+			conn, r := dial(t, addr)
+			tt.send(conn)
+			if _, err := ReadMessage(r, 0); !errors.Is(err, io.EOF) {
+				t.Errorf("ReadMessage() error = %v, want the server to close the connection", err)
+			}
+		})
+	}
+}
+
+func TestCloseCancelsMessagesInFlight(t *testing.T) {
+	handling := make(chan struct{})
+	server := &Server{Handler: func(ctx context.Context, _ net.Addr, _ []byte) []byte {
+		close(handling)
+		<-ctx.Done()
+		return []byte("ACK")
+	}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(listener) }()
+	conn, _ := dial(t, listener.Addr())
+	if err := WriteMessage(conn, []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	<-handling
+
+	closed := make(chan error)
+	go func() { closed <- server.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not return while a message was handled")
+	}
+}
@@ -1,35 +1,94 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/admin"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
-	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/port"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
 	"github.com/gorilla/mux"
 	"log/slog"
 	"net/http"
 	"service/infrastructure/controller"
-	"strconv"
+	"service/infrastructure/mllp"
 )
 
-func StartServer(controller *controller.StandardController) {
-	r := mux.NewRouter()
+// StartServer serves the service routes on the public listener configured in cfg and the operational ones on adminServer
+// until ctx is done, returning once the listeners are shut down
+func StartServer(ctx context.Context, cfg config.Config, c *controller.StandardController, adminServer *admin.Server) {
+	startAdmin(c, adminServer)
+	mllpServer := startMLLP(cfg, c)
 
-	// apply metrics middleware to all routes
-	r.Use(controller.GetMetricsMiddleware())
+	startServing(ctx, cfg, controller.NewRouter(cfg, c))
 
-	// health check endpoint
-	r.HandleFunc(endpoint.Health, controller.HealthCheckHandler).Methods("GET")
+	// the public listener is drained, stop the other ones before the stores are closed
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if mllpServer != nil {
+		if err := mllpServer.Close(); err != nil {
+			slog.Warn("failed to stop MLLP listener", "error", err)
+		}
+	}
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("failed to stop admin listener", "error", err)
+	}
+}
 
+// startAdmin serves the operational endpoints on the admin port, they are not registered on the public router
+func startAdmin(controller *controller.StandardController, adminServer *admin.Server) {
 	// metrics endpoint
-	r.HandleFunc(endpoint.Metrics, controller.MetricsHandler).Methods("GET")
+	adminServer.Handle("GET "+endpoint.Metrics, http.HandlerFunc(controller.MetricsHandler))
 
-	startServing(r)
+	// runtime log level endpoint
+	adminServer.Handle(endpoint.LogLevel, log.LevelHandler())
+
+	// audit trail query endpoint, itself audited with the admin principal as actor
+	adminServer.Handle("GET "+endpoint.Audit, requestid.Middleware(http.HandlerFunc(controller.AuditQueryHandler)))
+
+	adminServer.Start()
 }
 
-func startServing(r *mux.Router) {
-	portString := ":" + strconv.Itoa(port.Http)
-	slog.Info("Service listening on " + portString)
-	err := http.ListenAndServe(portString, r)
-	if err != nil {
+// startMLLP serves HL7 v2 messages over MLLP on the address configured in cfg, unless it is empty
+func startMLLP(cfg config.Config, controller *controller.StandardController) *mllp.Server {
+	if cfg.HL7.MLLPAddr == "" {
+		return nil
+	}
+	server := &mllp.Server{
+		Handler:        controller.MLLPHandler,
+		ReadTimeout:    cfg.HL7.ReadTimeout,
+		MaxMessageSize: cfg.HL7.MaxMessageKB << 10,
+	}
+	go func() {
+		slog.Info("MLLP listening on " + cfg.HL7.MLLPAddr)
+		if err := server.ListenAndServe(cfg.HL7.MLLPAddr); err != nil && !errors.Is(err, mllp.ErrServerClosed) {
+			slog.Error("MLLP server stopped", "error", err)
+		}
+	}()
+	return server
+}
+
+// startServing serves r until ctx is done, then stops accepting connections and waits for the requests in flight
+// up to the configured shutdown timeout
+func startServing(ctx context.Context, cfg config.Config, r *mux.Router) {
+	server := &http.Server{Addr: cfg.Addr(), Handler: r, ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout}
+	stopped := make(chan error, 1)
+	go func() {
+		slog.Info("Service listening on " + cfg.Addr())
+		stopped <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-stopped:
+		slog.Error("Service listener stopped", "error", err)
 		return
+	case <-ctx.Done():
+		slog.Info("shutting down, waiting for the requests in flight", "timeout", cfg.HTTP.ShutdownTimeout.String())
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still in flight at shutdown were interrupted", "error", err)
 	}
 }
@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect holds what differs between the SQL databases, the queries themselves using $n placeholders which
+// both drivers understand
+type dialect struct {
+	// name is also the directory of the migrations of the database
+	name   string
+	driver string
+	// forUpdate ends the queries reading a row that the transaction is about to write
+	forUpdate string
+	// skipLocked ends the queries reading the rows to write that no other transaction is writing
+	skipLocked string
+	// lockMigrations keeps other instances from migrating the database until unlock is called
+	lockMigrations func(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+	// isConflict tells whether err is a write failing because of a concurrent one
+	isConflict func(err error) bool
+}
+
+// migrationLockKey identifies the PostgreSQL advisory lock held while migrating
+const migrationLockKey = 4_640_017_046
+
+var sqliteDialect = dialect{
+	name:   "sqlite",
+	driver: "sqlite",
+	// transactions begin immediate, holding the write lock of the whole database already
+	lockMigrations: func(context.Context, *sql.Conn) (func(), error) { return func() {}, nil },
+	isConflict: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) {
+			return false
+		}
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	},
+}
+
+var postgresDialect = dialect{
+	name:       "postgres",
+	driver:     "pgx",
+	forUpdate:  " FOR UPDATE",
+	skipLocked: " FOR UPDATE SKIP LOCKED",
+	lockMigrations: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return nil, err
+		}
+		return func() {
+			_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		}, nil
+	},
+	isConflict: func(err error) bool {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) {
+			return false
+		}
+		// unique_violation, serialization_failure and deadlock_detected
+		return pgErr.Code == "23505" || pgErr.Code == "40001" || pgErr.Code == "40P01"
+	},
+}
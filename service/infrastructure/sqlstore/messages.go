@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// pruneBatch is how many expired messages an acceptance forgets at most, keeping the table from growing
+const pruneBatch = 100
+
+// messageLog is the storage.MessageLog of a store, in a transaction of its own unless it belongs to one
+type messageLog struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect dialect
+	now     func() time.Time
+}
+
+// Accept inserts the acceptance of key, replacing one older than ttl; when another one holds the key, its ACK is
+// read instead
+func (l *messageLog) Accept(ctx context.Context, key string, ack []byte, ttl time.Duration) ([]byte, error) {
+	if l.tx != nil {
+		return l.accept(ctx, l.tx, key, ack, ttl)
+	}
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	accepted, err := l.accept(ctx, tx, key, ack, ttl)
+	if err != nil {
+		return nil, errors.Join(err, ignoreDone(tx.Rollback()))
+	}
+	return accepted, tx.Commit()
+}
+
+func (l *messageLog) accept(ctx context.Context, q querier, key string, ack []byte, ttl time.Duration) ([]byte, error) {
+	now := l.now()
+	expired := now.Add(-ttl).UnixMilli()
+	// the rows that concurrent transactions are forgetting are left to them
+	if _, err := q.ExecContext(ctx, `DELETE FROM accepted_messages WHERE message_key IN (
+		SELECT message_key FROM accepted_messages WHERE accepted_at < $1 LIMIT $2`+l.dialect.skipLocked+`)`,
+		expired, pruneBatch); err != nil {
+		return nil, err
+	}
+
+	// a transaction inserting the same key makes this one wait for it to end
+	result, err := q.ExecContext(ctx, `INSERT INTO accepted_messages (message_key, ack, accepted_at) VALUES ($1, $2, $3)
+		ON CONFLICT (message_key) DO UPDATE SET ack = excluded.ack, accepted_at = excluded.accepted_at
+		WHERE accepted_messages.accepted_at < $4`, key, ack, now.UnixMilli(), expired)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 1 {
+		return nil, err
+	}
+	var accepted []byte
+	err = q.QueryRowContext(ctx, "SELECT ack FROM accepted_messages WHERE message_key = $1", key).Scan(&accepted)
+	return accepted, err
+}
@@ -0,0 +1,5 @@
+-- text_value holds the folded values of the string search parameters, matched by prefix or containment; the
+-- pattern operator class lets LIKE prefixes use the index whatever the collation of the database
+ALTER TABLE search_index ADD COLUMN text_value TEXT;
+
+CREATE INDEX search_index_by_text ON search_index (resource_type, param, text_value text_pattern_ops);
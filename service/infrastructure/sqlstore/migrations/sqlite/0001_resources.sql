@@ -0,0 +1,22 @@
+-- resources holds the current version of every resource, content being NULL once it is deleted
+CREATE TABLE resources (
+    position      INTEGER PRIMARY KEY AUTOINCREMENT,
+    resource_type TEXT      NOT NULL,
+    id            TEXT      NOT NULL,
+    version_id    INTEGER   NOT NULL,
+    last_updated  TIMESTAMP NOT NULL,
+    content       BLOB,
+    UNIQUE (resource_type, id)
+);
+
+-- resource_versions holds every version, including the current one, content being NULL for a deletion
+CREATE TABLE resource_versions (
+    resource_type TEXT      NOT NULL,
+    id            TEXT      NOT NULL,
+    version_id    INTEGER   NOT NULL,
+    last_updated  TIMESTAMP NOT NULL,
+    content       BLOB,
+    PRIMARY KEY (resource_type, id, version_id)
+);
+
+CREATE INDEX resources_by_type ON resources (resource_type, position);
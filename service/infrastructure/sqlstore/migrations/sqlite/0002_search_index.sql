@@ -0,0 +1,20 @@
+-- search_index holds the indexed search parameter values of the current version of every resource: tokens,
+-- references being indexed as Type|id, or time ranges in Unix milliseconds, so that searches read only the
+-- resources that may match
+CREATE TABLE search_index (
+    resource_type TEXT   NOT NULL,
+    id            TEXT   NOT NULL,
+    param         TEXT   NOT NULL,
+    token_system  TEXT,
+    token_code    TEXT,
+    start_at      BIGINT,
+    end_at        BIGINT
+);
+
+CREATE INDEX search_index_by_token ON search_index (resource_type, param, token_code, token_system);
+CREATE INDEX search_index_by_start ON search_index (resource_type, param, start_at);
+CREATE INDEX search_index_by_end ON search_index (resource_type, param, end_at);
+CREATE INDEX search_index_by_resource ON search_index (resource_type, id);
+
+-- index_version is the version of the index entries of the resource, older ones being indexed again on startup
+ALTER TABLE resources ADD COLUMN index_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- text_value holds the folded values of the string search parameters, matched by prefix or containment
+ALTER TABLE search_index ADD COLUMN text_value TEXT;
+
+CREATE INDEX search_index_by_text ON search_index (resource_type, param, text_value);
@@ -0,0 +1,9 @@
+-- accepted_messages holds the ACKs of the accepted HL7 messages by sender and control ID, accepted_at in Unix
+-- milliseconds, so that a message sent again to any instance is answered the same without being processed
+CREATE TABLE accepted_messages (
+    message_key TEXT   PRIMARY KEY,
+    ack         BLOB   NOT NULL,
+    accepted_at BIGINT NOT NULL
+);
+
+CREATE INDEX accepted_messages_by_time ON accepted_messages (accepted_at);
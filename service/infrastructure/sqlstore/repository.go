@@ -0,0 +1,495 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"service/application/fhir"
+)
+
+// querier runs queries on the pool or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// indexVersion is the version of the search index entries, to be increased when the indexed search parameters
+// change so that the resources are indexed again on startup
+const indexVersion = 2
+
+// reindexBatch is how many resources are indexed again per transaction
+const reindexBatch = 500
+
+// repository stores the resources of type T in the shared tables, each write running in a transaction of its own
+// unless the repository belongs to one. The values of the indexed search parameters are kept in search_index.
+type repository[T fhir.Resource] struct {
+	db       *sql.DB
+	tx       *sql.Tx
+	dialect  dialect
+	typeName string
+	params   []fhir.SearchParam[T]
+	now      func() time.Time
+}
+
+func newRepository[T fhir.Resource](db *sql.DB, tx *sql.Tx, d dialect, params []fhir.SearchParam[T]) *repository[T] {
+	var zero T
+	return &repository[T]{db: db, tx: tx, dialect: d, typeName: zero.TypeName(), params: params, now: time.Now}
+}
+
+// Create stores resource under a new id as version 1
+func (r *repository[T]) Create(ctx context.Context, resource T) (T, error) {
+	var created T
+	err := r.write(ctx, func(q querier) error {
+		var err error
+		created, err = r.insert(ctx, q, fhir.NewID(), resource)
+		return err
+	})
+	return created, err
+}
+
+// Read returns the current version of the resource
+func (r *repository[T]) Read(ctx context.Context, id string) (T, error) {
+	var zero T
+	var content []byte
+	err := r.querier().QueryRowContext(ctx, "SELECT content FROM resources WHERE resource_type = $1 AND id = $2",
+		r.typeName, id).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return zero, fmt.Errorf("%s/%s: %w", r.typeName, id, fhir.ErrNotFound)
+	}
+	if err != nil {
+		return zero, err
+	}
+	if content == nil {
+		return zero, fmt.Errorf("%s/%s: %w", r.typeName, id, fhir.ErrDeleted)
+	}
+	return decode[T](content)
+}
+
+// VRead returns a version of the resource
+func (r *repository[T]) VRead(ctx context.Context, id, versionID string) (T, error) {
+	var zero T
+	version, err := strconv.Atoi(versionID)
+	if err != nil || version < 1 {
+		return zero, fmt.Errorf("%s/%s/_history/%s: %w", r.typeName, id, versionID, fhir.ErrNotFound)
+	}
+	var content []byte
+	err = r.querier().QueryRowContext(ctx, "SELECT content FROM resource_versions WHERE resource_type = $1 AND id = $2 AND version_id = $3",
+		r.typeName, id, version).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return zero, fmt.Errorf("%s/%s/_history/%s: %w", r.typeName, id, versionID, fhir.ErrNotFound)
+	}
+	if err != nil {
+		return zero, err
+	}
+	if content == nil {
+		return zero, fmt.Errorf("%s/%s/_history/%s: %w", r.typeName, id, versionID, fhir.ErrDeleted)
+	}
+	return decode[T](content)
+}
+
+// Update stores resource as the next version of its id, creating the resource when the id is unknown
+func (r *repository[T]) Update(ctx context.Context, resource T, ifMatch string) (T, bool, error) {
+	var updated T
+	var created bool
+	id := resource.GetBase().ID
+	err := r.write(ctx, func(q querier) error {
+		current, found, err := r.currentVersion(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		if ifMatch != "" && (!found || ifMatch != strconv.Itoa(current)) {
+			return fmt.Errorf("%s/%s is not at version %s: %w", r.typeName, id, ifMatch, fhir.ErrVersionConflict)
+		}
+		if !found {
+			created = true
+			updated, err = r.insert(ctx, q, id, resource)
+			return err
+		}
+		updated, err = r.appendVersion(ctx, q, id, current+1, resource)
+		return err
+	})
+	return updated, created, err
+}
+
+// Delete records the deletion of the resource as a new version
+func (r *repository[T]) Delete(ctx context.Context, id string) error {
+	return r.write(ctx, func(q querier) error {
+		var current int
+		var content []byte
+		err := q.QueryRowContext(ctx, "SELECT version_id, content FROM resources WHERE resource_type = $1 AND id = $2"+r.dialect.forUpdate,
+			r.typeName, id).Scan(&current, &content)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s/%s: %w", r.typeName, id, fhir.ErrNotFound)
+		}
+		if err != nil || content == nil {
+			return err
+		}
+		err = r.store(ctx, q, "UPDATE resources SET version_id = $3, last_updated = $4, content = $5 WHERE resource_type = $1 AND id = $2",
+			id, current+1, r.now().UTC(), nil)
+		if err != nil {
+			return err
+		}
+		return r.writeIndex(ctx, q, id, nil)
+	})
+}
+
+// Search iterates over the current versions matching match, in creation order. Only the rows satisfying the
+// conditions on indexed parameters are read, the matching being done while they are, holding a connection until
+// the iteration ends.
+func (r *repository[T]) Search(ctx context.Context, match func(T) bool, conditions ...fhir.IndexCondition) iter.Seq2[T, error] {
+	where, args := r.where(conditions)
+	return r.query(ctx, match, "SELECT content FROM resources WHERE "+where+" ORDER BY "+order(args), args...)
+}
+
+// Page pages the matches of search. When the index alone selects them and they are not sorted, the page and the
+// total, counted up to the limit of the search, are read in SQL without decoding the other matches.
+func (r *repository[T]) Page(ctx context.Context, search fhir.Search[T]) ([]T, int, error) {
+	if search.Sort != nil || !search.Indexed {
+		return search.Page(r.Search(ctx, search.Match, search.Index...))
+	}
+	where, args := r.where(search.Index)
+	var total int
+	err := r.querier().QueryRowContext(ctx, "SELECT COUNT(*) FROM (SELECT 1 FROM resources WHERE "+where+" LIMIT "+
+		strconv.Itoa(search.TotalLimit())+") AS matches", args...).Scan(&total)
+	if err != nil || total <= search.Offset || search.Count == 0 {
+		return nil, total, err
+	}
+
+	var page []T
+	query := "SELECT content FROM resources WHERE " + where + " ORDER BY " + order(args) +
+		" LIMIT " + strconv.Itoa(search.Count) + " OFFSET " + strconv.Itoa(search.Offset)
+	for resource, err := range r.query(ctx, search.Match, query, args...) {
+		if err != nil {
+			return nil, 0, err
+		}
+		page = append(page, resource)
+	}
+	return page, total, nil
+}
+
+// order is the ORDER BY of the resources selected with args, in creation order
+func order(args []any) string {
+	if len(args) > 1 {
+		// sorting by an expression keeps SQLite from scanning every resource of the type in order, the query
+		// being driven by the index entries instead and only the candidates sorted
+		return "+position"
+	}
+	return "position"
+}
+
+// query iterates over the resources whose content query selects that match, holding a connection until the
+// iteration ends
+func (r *repository[T]) query(ctx context.Context, match func(T) bool, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := r.querier().QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var content []byte
+			if err := rows.Scan(&content); err != nil {
+				yield(zero, err)
+				return
+			}
+			resource, err := decode[T](content)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if match(resource) && !yield(resource, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// where returns the condition selecting the rows of the resources that satisfy conditions, and its arguments.
+// Conditions naming a parameter that is not indexed are left to match.
+func (r *repository[T]) where(conditions []fhir.IndexCondition) (string, []any) {
+	args := []any{r.typeName}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := "resource_type = $1 AND content IS NOT NULL"
+	for _, condition := range conditions {
+		if len(condition) == 0 || !r.indexes(condition) {
+			continue
+		}
+		terms := make([]string, 0, len(condition))
+		for _, term := range condition {
+			clause := "param = " + arg(term.Param)
+			// the bounds are compared in milliseconds and inclusively, so that no matching range is left out
+			switch bounds := term.Bounds; {
+			case term.Text != "":
+				// the text is folded, so that SQLite matching ASCII letters in any case makes no difference
+				pattern := likeEscaper.Replace(term.Text) + "%"
+				if term.Contains {
+					pattern = "%" + pattern
+				}
+				clause += " AND text_value LIKE " + arg(pattern) + ` ESCAPE '\'`
+			case bounds != nil:
+				if !bounds.MinStart.IsZero() {
+					clause += " AND start_at >= " + arg(bounds.MinStart.UnixMilli())
+				}
+				if !bounds.MaxStart.IsZero() {
+					clause += " AND start_at <= " + arg(bounds.MaxStart.UnixMilli())
+				}
+				if !bounds.MinEnd.IsZero() {
+					clause += " AND end_at >= " + arg(bounds.MinEnd.UnixMilli())
+				}
+				if !bounds.MaxEnd.IsZero() {
+					clause += " AND end_at <= " + arg(bounds.MaxEnd.UnixMilli())
+				}
+			default:
+				if term.Token.Code != "" {
+					clause += " AND token_code = " + arg(term.Token.Code)
+				}
+				if !term.AnySystem {
+					clause += " AND token_system = " + arg(term.Token.System)
+				}
+			}
+			terms = append(terms, "("+clause+")")
+		}
+		where += " AND id IN (SELECT id FROM search_index WHERE resource_type = $1 AND (" + strings.Join(terms, " OR ") + "))"
+	}
+	return where, args
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// indexes tells whether every parameter of condition is indexed
+func (r *repository[T]) indexes(condition fhir.IndexCondition) bool {
+	for _, term := range condition {
+		indexed := false
+		for _, param := range r.params {
+			if param.Name == term.Param && param.Index != nil {
+				indexed = true
+				break
+			}
+		}
+		if !indexed {
+			return false
+		}
+	}
+	return true
+}
+
+// writeIndex replaces the index entries of the resource id by entries, none for a deleted resource
+func (r *repository[T]) writeIndex(ctx context.Context, q querier, id string, entries []fhir.IndexEntry) error {
+	if _, err := q.ExecContext(ctx, "DELETE FROM search_index WHERE resource_type = $1 AND id = $2", r.typeName, id); err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		var query strings.Builder
+		query.WriteString("INSERT INTO search_index (resource_type, id, param, token_system, token_code, start_at, end_at, text_value) VALUES ")
+		args := make([]any, 0, 8*len(entries))
+		for i, entry := range entries {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			n := len(args)
+			_, _ = fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+			var system, code, start, end, text any
+			switch {
+			case entry.Range != nil:
+				start, end = entry.Range.Start.UnixMilli(), entry.Range.End.UnixMilli()
+			case entry.Text != "":
+				text = entry.Text
+			default:
+				system, code = entry.Token.System, entry.Token.Code
+			}
+			args = append(args, r.typeName, id, entry.Param, system, code, start, end, text)
+		}
+		if _, err := q.ExecContext(ctx, query.String(), args...); err != nil {
+			return err
+		}
+	}
+	_, err := q.ExecContext(ctx, "UPDATE resources SET index_version = $3 WHERE resource_type = $1 AND id = $2", r.typeName, id, indexVersion)
+	return err
+}
+
+// reindex indexes the resources whose entries are older than indexVersion, as after the index was created. Each row is claimed before being indexed from the content it then has, so that
+// concurrent instances and writes never index a resource twice or from a stale version.
+func (r *repository[T]) reindex(ctx context.Context) error {
+	indexed := 0
+	for {
+		ids, err := r.staleIDs(ctx)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			if indexed > 0 {
+				slog.Info("indexed stored resources for search", "resource_type", r.typeName, "count", indexed)
+			}
+			return nil
+		}
+		err = r.write(ctx, func(q querier) error {
+			for _, id := range ids {
+				var content []byte
+				err := q.QueryRowContext(ctx, "UPDATE resources SET index_version = $3 WHERE resource_type = $1 AND id = $2 AND index_version < $3 RETURNING content",
+					r.typeName, id, indexVersion).Scan(&content)
+				if errors.Is(err, sql.ErrNoRows) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				var entries []fhir.IndexEntry
+				if content != nil {
+					resource, err := decode[T](content)
+					if err != nil {
+						return fmt.Errorf("index %s/%s: %w", r.typeName, id, err)
+					}
+					entries = fhir.IndexEntries(resource, r.params)
+				}
+				if err := r.writeIndex(ctx, q, id, entries); err != nil {
+					return err
+				}
+				indexed++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// staleIDs returns a batch of the resources whose index entries are older than indexVersion
+func (r *repository[T]) staleIDs(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id FROM resources WHERE resource_type = $1 AND index_version < $2 ORDER BY position LIMIT $3",
+		r.typeName, indexVersion, reindexBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// write runs fn in the transaction of the repository, or in a new one committed when fn succeeds
+func (r *repository[T]) write(ctx context.Context, fn func(q querier) error) error {
+	if r.tx != nil {
+		return r.conflict(fn(r.tx))
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return errors.Join(r.conflict(err), ignoreDone(tx.Rollback()))
+	}
+	return r.conflict(tx.Commit())
+}
+
+// conflict wraps in fhir.ErrVersionConflict the errors of writes that lost a race against another one
+func (r *repository[T]) conflict(err error) error {
+	if err != nil && r.dialect.isConflict(err) {
+		return fmt.Errorf("%s: concurrent write: %w: %w", r.typeName, fhir.ErrVersionConflict, err)
+	}
+	return err
+}
+
+func (r *repository[T]) querier() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// currentVersion returns the current version of the resource, locking its row until the transaction ends
+func (r *repository[T]) currentVersion(ctx context.Context, q querier, id string) (version int, found bool, err error) {
+	err = q.QueryRowContext(ctx, "SELECT version_id FROM resources WHERE resource_type = $1 AND id = $2"+r.dialect.forUpdate,
+		r.typeName, id).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, err == nil, err
+}
+
+// insert stores resource as version 1 of a new id
+func (r *repository[T]) insert(ctx context.Context, q querier, id string, resource T) (T, error) {
+	stored, content, err := r.stamp(id, 1, resource)
+	if err != nil {
+		return stored, err
+	}
+	err = r.store(ctx, q, "INSERT INTO resources (resource_type, id, version_id, last_updated, content) VALUES ($1, $2, $3, $4, $5)",
+		id, 1, *stored.GetBase().Meta.LastUpdated, content)
+	if err != nil {
+		return stored, err
+	}
+	return stored, r.writeIndex(ctx, q, id, fhir.IndexEntries(stored, r.params))
+}
+
+// appendVersion stores resource as the given version of an existing id
+func (r *repository[T]) appendVersion(ctx context.Context, q querier, id string, version int, resource T) (T, error) {
+	stored, content, err := r.stamp(id, version, resource)
+	if err != nil {
+		return stored, err
+	}
+	err = r.store(ctx, q, "UPDATE resources SET version_id = $3, last_updated = $4, content = $5 WHERE resource_type = $1 AND id = $2",
+		id, version, *stored.GetBase().Meta.LastUpdated, content)
+	if err != nil {
+		return stored, err
+	}
+	return stored, r.writeIndex(ctx, q, id, fhir.IndexEntries(stored, r.params))
+}
+
+// store runs query, which writes the current version, and records that version in the history; a nil content
+// records a deletion
+func (r *repository[T]) store(ctx context.Context, q querier, query, id string, version int, lastUpdated time.Time, content []byte) error {
+	if _, err := q.ExecContext(ctx, query, r.typeName, id, version, lastUpdated, content); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, "INSERT INTO resource_versions (resource_type, id, version_id, last_updated, content) VALUES ($1, $2, $3, $4, $5)",
+		r.typeName, id, version, lastUpdated, content)
+	return err
+}
+
+// stamp returns a copy of resource carrying the id and version, and its encoding
+func (r *repository[T]) stamp(id string, version int, resource T) (T, []byte, error) {
+	stored, err := fhir.Clone(resource)
+	if err != nil {
+		return stored, nil, err
+	}
+	fhir.SetVersion(stored, id, version, r.now())
+	content, err := json.Marshal(stored)
+	if err != nil {
+		return stored, nil, fmt.Errorf("encode %s/%s: %w", r.typeName, id, err)
+	}
+	return stored, content, nil
+}
+
+// decode allocates a new resource, T being a pointer type
+func decode[T fhir.Resource](content []byte) (T, error) {
+	var resource T
+	err := json.Unmarshal(content, &resource)
+	return resource, err
+}
@@ -0,0 +1,148 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"service/application/fhir"
+	"service/application/storage"
+)
+
+// Options configure the connection pool of a Store
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Store is a storage.Store keeping the resources in a SQL database, SQLite or PostgreSQL. Every resource type
+// shares the same tables, the current version of each resource being kept apart from its history.
+type Store struct {
+	db      *sql.DB
+	dialect dialect
+	sqlRepositories
+}
+
+// sqlRepositories are the repositories of a store, or those of a transaction when tx is set
+type sqlRepositories struct {
+	patients       *repository[*fhir.Patient]
+	encounters     *repository[*fhir.Encounter]
+	episodesOfCare *repository[*fhir.EpisodeOfCare]
+	observations   *repository[*fhir.Observation]
+	documents      *repository[*fhir.DocumentReference]
+	messages       *messageLog
+}
+
+func newRepositories(db *sql.DB, tx *sql.Tx, d dialect) sqlRepositories {
+	return sqlRepositories{
+		patients:       newRepository(db, tx, d, fhir.PatientSearchParams),
+		encounters:     newRepository(db, tx, d, fhir.EncounterSearchParams),
+		episodesOfCare: newRepository(db, tx, d, fhir.EpisodeOfCareSearchParams),
+		observations:   newRepository(db, tx, d, fhir.ObservationSearchParams),
+		documents:      newRepository(db, tx, d, fhir.DocumentReferenceSearchParams),
+		messages:       &messageLog{db: db, tx: tx, dialect: d, now: time.Now},
+	}
+}
+
+// reindex indexes the resources of every type whose index entries are out of date
+func (r sqlRepositories) reindex(ctx context.Context) error {
+	for _, reindex := range []func(context.Context) error{
+		r.patients.reindex, r.encounters.reindex, r.episodesOfCare.reindex, r.observations.reindex, r.documents.reindex,
+	} {
+		if err := reindex(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r sqlRepositories) Patients() fhir.Repository[*fhir.Patient]     { return r.patients }
+func (r sqlRepositories) Encounters() fhir.Repository[*fhir.Encounter] { return r.encounters }
+func (r sqlRepositories) EpisodesOfCare() fhir.Repository[*fhir.EpisodeOfCare] {
+	return r.episodesOfCare
+}
+func (r sqlRepositories) Observations() fhir.Repository[*fhir.Observation] { return r.observations }
+func (r sqlRepositories) DocumentReferences() fhir.Repository[*fhir.DocumentReference] {
+	return r.documents
+}
+func (r sqlRepositories) Messages() storage.MessageLog { return r.messages }
+
+// OpenSQLite opens (or creates) the SQLite database file at path and migrates its schema
+func OpenSQLite(ctx context.Context, path string, opts Options) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	// writers wait for each other instead of failing, and take the write lock when their transaction begins so
+	// that reading a row before updating it cannot deadlock
+	params := url.Values{"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)", "synchronous(NORMAL)"}, "_txlock": {"immediate"}}
+	return open(ctx, sqliteDialect, "file:"+path+"?"+params.Encode(), opts)
+}
+
+// OpenPostgres connects to the PostgreSQL database of dsn, a URL or key=value connection string, and migrates
+// its schema
+func OpenPostgres(ctx context.Context, dsn string, opts Options) (*Store, error) {
+	return open(ctx, postgresDialect, dsn, opts)
+}
+
+func open(ctx context.Context, d dialect, dsn string, opts Options) (*Store, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("connect to %s: %w", d.name, err)
+	}
+	if err := migrate(ctx, db, d); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", d.name, err)
+	}
+	store := &Store{db: db, dialect: d, sqlRepositories: newRepositories(db, nil, d)}
+	if err := store.reindex(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("index %s: %w", d.name, err)
+	}
+	return store, nil
+}
+
+// Transact runs fn in a database transaction, committed when fn returns nil
+func (s *Store) Transact(ctx context.Context, fn func(tx storage.Repositories) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(newRepositories(s.db, tx, s.dialect)); err != nil {
+		return errors.Join(err, ignoreDone(tx.Rollback()))
+	}
+	return tx.Commit()
+}
+
+// Ping checks that a connection to the database can be established
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the connections of the pool
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// ignoreDone drops the error of rolling back a transaction that already ended, as when its context was canceled
+func ignoreDone(err error) error {
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,233 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"service/application/fhir"
+	"service/application/storage"
+	"service/application/storage/storagetest"
+)
+
+// postgresDSNEnv names the PostgreSQL database the tests run against, they are skipped when it is unset. The
+// database is emptied by every test.
+const postgresDSNEnv = "STORAGE_TEST_POSTGRES_DSN"
+
+var testOptions = Options{MaxOpenConns: 4, MaxIdleConns: 2}
+
+func TestSQLiteStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		store, err := OpenSQLite(t.Context(), filepath.Join(t.TempDir(), "data", "service.db"), testOptions)
+		if err != nil {
+			t.Fatalf("OpenSQLite() error = %v", err)
+		}
+		return store
+	})
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		store, err := OpenPostgres(t.Context(), dsn, testOptions)
+		if err != nil {
+			t.Fatalf("OpenPostgres() error = %v", err)
+		}
+		if _, err := store.db.ExecContext(t.Context(), "TRUNCATE resources, resource_versions, search_index"); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestMigrationsReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "service.db")
+	store, err := OpenSQLite(ctx, path, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := store.Patients().Create(ctx, &fhir.Patient{Base: fhir.Base{ResourceType: fhir.PatientType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+
+	// opening the database again applies nothing and keeps the resources
+	store, err = OpenSQLite(ctx, path, testOptions)
+	if err != nil {
+		t.Fatalf("OpenSQLite() of a migrated database error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if _, err := store.Patients().Read(ctx, created.ID); err != nil {
+		t.Errorf("Read() after reopening error = %v", err)
+	}
+	var applied int
+	if err := store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := loadMigrations(sqliteDialect.name); applied != len(want) {
+		t.Errorf("schema_migrations has %d rows, want %d", applied, len(want))
+	}
+}
+
+func TestSearchReadsOnlyIndexedCandidates(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "service.db"), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+	for i := range 50 {
+		patient := &fhir.Patient{Base: fhir.Base{ResourceType: fhir.PatientType}, Identifier: []fhir.Identifier{{System: "urn:mrn", Value: fmt.Sprint(i)}}}
+		if _, err := store.Patients().Create(ctx, patient); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search, err := fhir.ParseSearch(url.Values{"identifier": {"urn:mrn|7,urn:mrn|42"}}, fhir.PatientSearchParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, found := 0, 0
+	match := func(p *fhir.Patient) bool {
+		read++
+		return search.Match(p)
+	}
+	for _, err := range store.Patients().Search(ctx, match, search.Index...) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		found++
+	}
+	if found != 2 || read != 2 {
+		t.Errorf("Search() found %d reading %d resources, want 2 read from the index", found, read)
+	}
+}
+
+func TestPageReadsOnlyThePage(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "service.db"), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+	for i := range 50 {
+		patient := &fhir.Patient{Base: fhir.Base{ResourceType: fhir.PatientType}, Name: []fhir.HumanName{{Family: fmt.Sprint("Rossi ", i)}}}
+		if _, err := store.Patients().Create(ctx, patient); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search, err := fhir.ParseSearch(url.Values{"family": {"ross"}, "_count": {"5"}, "_offset": {"10"}}, fhir.PatientSearchParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := 0
+	match := search.Match
+	search.Match = func(p *fhir.Patient) bool {
+		read++
+		return match(p)
+	}
+	page, total, err := store.Patients().Page(ctx, search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 5 || page[0].Name[0].Family != "Rossi 10" || total != 50 || read != 5 {
+		t.Errorf("Page() = %d resources of %d reading %d, want the 5 of the page read from the index", len(page), total, read)
+	}
+}
+
+func TestReindexOnOpen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "service.db")
+	store, err := OpenSQLite(ctx, path, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patient := &fhir.Patient{Base: fhir.Base{ResourceType: fhir.PatientType}, Identifier: []fhir.Identifier{{System: "urn:mrn", Value: "123"}}}
+	created, err := store.Patients().Create(ctx, patient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as in a database written before the index existed
+	if _, err := store.db.ExecContext(ctx, "DELETE FROM search_index"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.db.ExecContext(ctx, "UPDATE resources SET index_version = 0"); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+
+	store, err = OpenSQLite(ctx, path, testOptions)
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	search, _ := fhir.ParseSearch(url.Values{"identifier": {"urn:mrn|123"}}, fhir.PatientSearchParams)
+	var found []string
+	for patient, err := range store.Patients().Search(ctx, search.Match, search.Index...) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, patient.ID)
+	}
+	if len(found) != 1 || found[0] != created.ID {
+		t.Errorf("Search() after reopening = %v, want the resource indexed again", found)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, d := range []dialect{sqliteDialect, postgresDialect} {
+		loaded, err := loadMigrations(d.name)
+		if err != nil || len(loaded) == 0 {
+			t.Fatalf("loadMigrations(%s) = %d migrations, %v", d.name, len(loaded), err)
+		}
+		for i, m := range loaded {
+			if m.version != i+1 {
+				t.Errorf("migration %s/%s has version %d, want %d", d.name, m.name, m.version, i+1)
+			}
+		}
+	}
+}
+
+func TestConcurrentCreateByUpdate(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "service.db"), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() {
+			patient := &fhir.Patient{Base: fhir.Base{ResourceType: fhir.PatientType, ID: "shared"}}
+			_, _, err := store.Patients().Update(ctx, patient, "")
+			errs <- err
+		}()
+	}
+	for range cap(errs) {
+		// the writers wait for each other instead of failing
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent Update() error = %v", err)
+		}
+	}
+	current, err := store.Patients().Read(ctx, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions int
+	if err := store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM resource_versions WHERE id = 'shared'").Scan(&versions); err != nil {
+		t.Fatal(err)
+	}
+	if current.Meta.VersionID != "8" || versions != 8 {
+		t.Errorf("after 8 updates the version is %s with %d stored, want 8", current.Meta.VersionID, versions)
+	}
+}
@@ -1,20 +1,186 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/admin"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/config"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/diagnostics"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/common/metrics"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/buildinfo"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/endpoint"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/log"
 	"log/slog"
+	"os"
+	"os/signal"
+	"service/application/audit"
+	"service/application/storage"
+	"service/infrastructure/auditstore"
+	"service/infrastructure/blobstore"
 	"service/infrastructure/controller"
+	"service/infrastructure/fhirstore"
 	"service/infrastructure/server"
+	"service/infrastructure/sqlstore"
+	"syscall"
+	"time"
 )
 
 func main() {
-	log.InitAsJson()
+	configFile := flag.String("config", os.Getenv(config.FileEnv), "YAML configuration file, its values are overridden by the environment")
+	printConfig := flag.Bool("print-config", false, "print the resolved configuration, the source of each value and the build information, then exit")
+	flag.Parse()
+
+	cfg, err := config.Load("service", *configFile)
+	if *printConfig {
+		_ = cfg.Effective().WriteText(os.Stdout)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		slog.Error("invalid configuration, refusing to start", "error", err)
+		os.Exit(1)
+	}
+	if err := log.InitWithFallback(cfg.LogConfig()); err != nil {
+		slog.Error("invalid logging configuration, logging to stdout", "error", err)
+	}
+	stopWatchingSignals := log.WatchSignals()
+	defer stopWatchingSignals()
 	slog.Debug("service module started", "module", "service")
 
-	metricsInstance := metrics.New()
+	metricsInstance := metrics.New(append(cfg.MetricsOptions(), metrics.WithRuntimeMetrics())...)
+	log.SetRedactionObserver(metricsInstance.RecordLogRedaction)
+
+	stopPushingMetrics, err := metricsInstance.StartPushWithConfig(cfg.PushConfig())
+	if err != nil {
+		slog.Error("invalid metrics push configuration, refusing to start", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := stopPushingMetrics(ctx); err != nil {
+			slog.Warn("failed to push final metrics", "error", err)
+		}
+	}()
+
+	auditTrail, err := newAuditTrail(cfg.Audit)
+	if err != nil {
+		slog.Error("failed to open audit trail, refusing to start", "error", err)
+		os.Exit(1)
+	}
+	defer func() { _ = auditTrail.Close() }()
+
+	store, err := newStore(cfg.Storage)
+	if err != nil {
+		slog.Error("failed to open storage, refusing to start", "error", err, "backend", cfg.Storage.Backend)
+		os.Exit(1)
+	}
+	defer func() { _ = store.Close() }()
+
+	blobs, err := newBlobStore(cfg.Documents)
+	if err != nil {
+		slog.Error("failed to open document store, refusing to start", "error", err, "backend", cfg.Documents.Backend)
+		os.Exit(1)
+	}
+
+	ctrl := controller.NewController(cfg, metricsInstance, auditTrail, store, blobs)
+
+	adminServer := newAdminServer(cfg)
+
+	stopDiagnostics, err := startDiagnostics(cfg, adminServer)
+	if err != nil {
+		slog.Error("invalid diagnostics configuration, refusing to start", "error", err)
+		os.Exit(1)
+	}
+	defer stopDiagnostics()
+
+	// serve until SIGTERM or SIGINT, the deferred calls then push the last metrics and close the stores
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server.StartServer(ctx, cfg, ctrl, adminServer)
+}
+
+// newAuditTrail opens the audit sink selected by cfg, "file" or "memory"
+func newAuditTrail(cfg config.Audit) (*audit.Trail, error) {
+	var sink audit.Sink = auditstore.NewMemorySink()
+	if cfg.Sink != "memory" {
+		fileSink, err := auditstore.NewFileSink(cfg.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		sink = fileSink
+	}
+	return audit.NewTrail(sink, []byte(cfg.Key))
+}
+
+// newStore opens the storage backend selected by cfg, "sqlite", "postgres" or "memory", migrating its schema
+func newStore(cfg config.Storage) (storage.Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	opts := sqlstore.Options{
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+	}
+	open := sqlstore.OpenSQLite
+	location := cfg.Path
+	switch cfg.Backend {
+	case "memory":
+		return fhirstore.NewMemoryStore(), nil
+	case "postgres":
+		open, location = sqlstore.OpenPostgres, cfg.DSN
+	}
+	store, err := open(ctx, location, opts)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// newBlobStore opens the store of document contents selected by cfg, "filesystem" or "s3"
+func newBlobStore(cfg config.Documents) (storage.BlobStore, error) {
+	if cfg.Backend == "s3" {
+		return blobstore.NewS3(blobstore.S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+		})
+	}
+	return blobstore.NewFilesystem(cfg.Path)
+}
+
+// newAdminServer configures the admin listener, exposing the effective configuration with secrets masked and the build information
+func newAdminServer(cfg config.Config) *admin.Server {
+	adminServer := admin.NewServer(cfg.AdminConfig())
+	adminServer.SetConfig("config", func() any { return cfg })
+	adminServer.SetConfig("build", func() any { return buildinfo.Get() })
+	adminServer.Handle("GET "+endpoint.Effective, cfg.Handler())
+	adminServer.SetConfig("log_level", func() any { return log.State() })
+	return adminServer
+}
 
-	ctrl := controller.NewController(metricsInstance)
+// startDiagnostics mounts the token-guarded profiling endpoints on the admin listener, or on their own address,
+// and starts continuous profiling when an interval is configured
+func startDiagnostics(cfg config.Config, adminServer *admin.Server) (stop func(), err error) {
+	diag := diagnostics.New(cfg.DiagnosticsConfig())
+	diag.Mount(adminServer.Handle)
+	if err := diag.StartProfiling(); err != nil {
+		return nil, err
+	}
 
-	server.StartServer(ctrl)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := diag.Stop(ctx); err != nil {
+			slog.Warn("failed to stop diagnostics", "error", err)
+		}
+	}, nil
 }
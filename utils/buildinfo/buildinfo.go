@@ -0,0 +1,57 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/buildinfo.version=1.4.0
+//	  -X github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/buildinfo.commit=$(git rev-parse HEAD)
+//	  -X github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/buildinfo.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info describes the running binary
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	// BuildDate falls back to the commit time when not set at build time
+	BuildDate string `json:"build_date,omitempty"`
+	// Modified reports uncommitted changes in the tree the binary was built from, when known
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information set with -ldflags, completed with the version control information
+// stamped by the go tool when the binary was built inside a git checkout
+func Get() Info {
+	info := Info{Version: version, Commit: commit, BuildDate: date, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
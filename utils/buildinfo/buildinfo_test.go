@@ -0,0 +1,36 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name            string
+		version, commit string
+		expectedVersion string
+		expectedCommit  string
+	}{
+		{"not set at build time", "", "", "dev", ""},
+		{"set with ldflags", "1.4.0", "0123abc", "1.4.0", "0123abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, commit = tt.version, tt.commit
+			defer func() { version, commit = "", "" }()
+
+			info := Get()
+			if info.Version != tt.expectedVersion {
+				t.Errorf("Expected version %q, got %q", tt.expectedVersion, info.Version)
+			}
+			if tt.expectedCommit != "" && info.Commit != tt.expectedCommit {
+				t.Errorf("Expected commit %q, got %q", tt.expectedCommit, info.Commit)
+			}
+			if info.GoVersion != runtime.Version() {
+				t.Errorf("Expected Go version %q, got %q", runtime.Version(), info.GoVersion)
+			}
+		})
+	}
+}
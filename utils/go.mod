@@ -2,7 +2,12 @@ module github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal
 
 go 1.24
 
-require github.com/sony/gobreaker/v2 v2.1.0
+require (
+	github.com/andybalholm/brotli v1.2.0
+	github.com/fxamacker/cbor/v2 v2.9.2
+	github.com/klauspost/compress v1.18.0
+	github.com/sony/gobreaker/v2 v2.1.0
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
@@ -11,4 +16,5 @@ require (
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/redis/go-redis/v9 v9.7.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 )
@@ -1,18 +1,54 @@
 package endpoint
 
 const (
-	Root    string = "/"
-	Health  string = "/health"
-	Route   string = "/route"
-	Service string = "/service"
-	Metrics string = "/metrics"
+	Root              string = "/"
+	Health            string = "/health"
+	Route             string = "/route"
+	Service           string = "/service"
+	Metrics           string = "/metrics"
+	LogLevel          string = "/log/level"
+	Audit             string = "/audit"
+	Patient           string = "/Patient"
+	Encounter         string = "/Encounter"
+	EpisodeOfCare     string = "/EpisodeOfCare"
+	Observation       string = "/Observation"
+	LastN             string = "/Observation/$lastn"
+	DocumentReference string = "/DocumentReference"
+	HL7               string = "/hl7"
+	SLO               string = "/slo"
+	Config            string = "/config"
+	Effective         string = "/config/effective"
+	Debug             string = "/debug/"
+	Pprof             string = "/debug/pprof/"
+	Goroutines        string = "/debug/goroutines"
+	Heap              string = "/debug/heap"
+	Trace             string = "/debug/trace"
 )
 
+// All lists the routes served by the public listeners
 var All = []string{
 	Root,
 	Health,
 	Route,
-	Metrics,
 	Service + Health,
-	Service + Metrics,
+	Service + Patient,
+	Service + Encounter,
+	Service + EpisodeOfCare,
+	Service + Observation,
+	Service + DocumentReference,
+	Service + HL7,
+}
+
+// Admin lists the routes served only by the admin listeners (see port.Admin)
+var Admin = []string{
+	Metrics,
+	LogLevel,
+	Audit,
+	SLO,
+	Config,
+	Effective,
+	Pprof,
+	Goroutines,
+	Heap,
+	Trace,
 }
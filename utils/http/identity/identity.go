@@ -0,0 +1,50 @@
+// Package identity forwards the user authenticated in front of the API Gateway to the services. The user is sent
+// with a token shared by the gateway and the services, so that a service can tell it from a header set by a client.
+package identity
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+const (
+	// UserHeader carries the forwarded user
+	UserHeader = "X-Forwarded-User"
+	// TokenHeader carries the token proving that the gateway forwarded the user
+	TokenHeader = "X-Gateway-Token"
+	// AuthRequestUserHeader carries the user authenticated by an auth request proxy such as oauth2-proxy
+	AuthRequestUserHeader = "X-Auth-Request-User"
+)
+
+// clientHeaders are the headers a client could set to claim an identity
+var clientHeaders = []string{UserHeader, TokenHeader, AuthRequestUserHeader}
+
+// ProxyUser returns the user asserted by an authenticating proxy in front of the gateway. It must only be called
+// for requests coming from a trusted proxy, since any client can set the headers it reads.
+func ProxyUser(r *http.Request) string {
+	if user := r.Header.Get(UserHeader); user != "" {
+		return user
+	}
+	return r.Header.Get(AuthRequestUserHeader)
+}
+
+// Forward replaces the identity headers of r by user sent with token; only the headers are removed when user or
+// token is empty
+func Forward(r *http.Request, user, token string) {
+	for _, header := range clientHeaders {
+		r.Header.Del(header)
+	}
+	if user != "" && token != "" {
+		r.Header.Set(UserHeader, user)
+		r.Header.Set(TokenHeader, token)
+	}
+}
+
+// User returns the user forwarded with r, empty unless it was sent with token
+func User(r *http.Request, token string) string {
+	sent := r.Header.Get(TokenHeader)
+	if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		return ""
+	}
+	return r.Header.Get(UserHeader)
+}
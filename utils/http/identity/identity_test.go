@@ -0,0 +1,66 @@
+package identity
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForward(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  string
+		token string
+		want  map[string]string
+	}{
+		{name: "user forwarded with the token", user: "alice", token: "secret",
+			want: map[string]string{UserHeader: "alice", TokenHeader: "secret", AuthRequestUserHeader: ""}},
+		{name: "no user", token: "secret",
+			want: map[string]string{UserHeader: "", TokenHeader: "", AuthRequestUserHeader: ""}},
+		{name: "no token", user: "alice",
+			want: map[string]string{UserHeader: "", TokenHeader: "", AuthRequestUserHeader: ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(UserHeader, "mallory")
+			req.Header.Set(TokenHeader, "guessed")
+			req.Header.Set(AuthRequestUserHeader, "mallory")
+
+			Forward(req, tt.user, tt.token)
+
+			for header, want := range tt.want {
+				if got := req.Header.Get(header); got != want {
+					t.Errorf("Expected %s %q, got %q", header, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		sentToken string
+		token     string
+		want      string
+	}{
+		{name: "token matches", sentToken: "secret", token: "secret", want: "alice"},
+		{name: "forged token", sentToken: "guessed", token: "secret"},
+		{name: "no token sent", token: "secret"},
+		{name: "no token configured", sentToken: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(UserHeader, "alice")
+			if tt.sentToken != "" {
+				req.Header.Set(TokenHeader, tt.sentToken)
+			}
+			if got := User(req, tt.token); got != tt.want {
+				t.Errorf("Expected user %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
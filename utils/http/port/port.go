@@ -1,5 +1,6 @@
 package port
 
 const (
-	Http int = 8080
+	Http  int = 8080
+	Admin int = 8081
 )
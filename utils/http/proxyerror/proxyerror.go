@@ -0,0 +1,69 @@
+package proxyerror
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/sony/gobreaker/v2"
+)
+
+// Type is the class of failure of a request forwarded to an upstream, used as a low-cardinality metric label
+type Type string
+
+const (
+	None              Type = ""
+	Canceled          Type = "canceled"
+	Timeout           Type = "timeout"
+	DNS               Type = "dns"
+	ConnectionRefused Type = "connection_refused"
+	ConnectionReset   Type = "connection_reset"
+	TLS               Type = "tls"
+	UnexpectedEOF     Type = "unexpected_eof"
+	CircuitOpen       Type = "circuit_open"
+	Other             Type = "other"
+)
+
+// Classify returns the class of err, None when err is nil
+func Classify(err error) Type {
+	if err == nil {
+		return None
+	}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, gobreaker.ErrTooManyRequests):
+		return CircuitOpen
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return Timeout
+		}
+		return DNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ConnectionReset
+	case errors.As(err, &recordErr), errors.As(err, &certErr), errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr):
+		return TLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return Timeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return UnexpectedEOF
+	default:
+		return Other
+	}
+}
@@ -0,0 +1,45 @@
+package proxyerror
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/sony/gobreaker/v2"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected Type
+	}{
+		{"nil", nil, None},
+		{"canceled", fmt.Errorf("proxy: %w", context.Canceled), Canceled},
+		{"deadline", &url.Error{Op: "Get", URL: "http://service", Err: context.DeadlineExceeded}, Timeout},
+		{"dns", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "service", IsNotFound: true}}, DNS},
+		{"dns timeout", &net.DNSError{Err: "timeout", Name: "service", IsTimeout: true}, Timeout},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ConnectionRefused},
+		{"reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, ConnectionReset},
+		{"tls", &tls.CertificateVerificationError{Err: errors.New("bad certificate")}, TLS},
+		{"circuit open", &url.Error{Op: "Get", URL: "http://service", Err: gobreaker.ErrOpenState}, CircuitOpen},
+		{"half open", gobreaker.ErrTooManyRequests, CircuitOpen},
+		{"eof", fmt.Errorf("read: %w", io.EOF), UnexpectedEOF},
+		{"other", errors.New("boom"), Other},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carries the request ID between clients, the gateway and the services
+const Header = "X-Request-ID"
+
+// maxLength bounds request IDs accepted from clients
+const maxLength = 128
+
+type contextKey struct{}
+
+// Middleware reuses a well-formed incoming request ID or generates a new one, stores it in the request
+// context and header (so proxies forward it) and echoes it in the response
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = New()
+			r.Header.Set(Header, id)
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// New returns a random 128-bit request ID in hex
+func New() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a context carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored by Middleware, or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// FromRequest returns the request ID of the request, from its context or its header
+func FromRequest(r *http.Request) string {
+	if id := FromContext(r.Context()); id != "" {
+		return id
+	}
+	if id := r.Header.Get(Header); valid(id) {
+		return id
+	}
+	return ""
+}
+
+// valid accepts printable ASCII IDs without spaces, so they can be safely logged and forwarded
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
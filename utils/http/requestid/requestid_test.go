@@ -0,0 +1,68 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keepsID  bool
+	}{
+		{name: "generates id when missing", incoming: "", keepsID: false},
+		{name: "keeps valid incoming id", incoming: "abc-123", keepsID: true},
+		{name: "replaces id with spaces", incoming: "abc 123", keepsID: false},
+		{name: "replaces overlong id", incoming: strings.Repeat("a", maxLength+1), keepsID: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen, forwarded string
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = FromContext(r.Context())
+				forwarded = r.Header.Get(Header)
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(Header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if seen == "" {
+				t.Fatal("Expected request ID in context")
+			}
+			if tt.keepsID && seen != tt.incoming {
+				t.Errorf("Expected incoming ID %s to be kept, got %s", tt.incoming, seen)
+			}
+			if !tt.keepsID && (seen == tt.incoming || len(seen) != 32) {
+				t.Errorf("Expected a generated 32 character ID, got %s", seen)
+			}
+			if forwarded != seen || w.Header().Get(Header) != seen {
+				t.Errorf("Expected request and response headers to carry %s, got %s and %s", seen, forwarded, w.Header().Get(Header))
+			}
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if FromRequest(req) != "" {
+		t.Error("Expected no request ID")
+	}
+
+	req.Header.Set(Header, "from-header")
+	if FromRequest(req) != "from-header" {
+		t.Error("Expected request ID from header")
+	}
+
+	req = req.WithContext(NewContext(req.Context(), "from-context"))
+	if FromRequest(req) != "from-context" {
+		t.Error("Expected request ID from context to take precedence")
+	}
+}
@@ -0,0 +1,237 @@
+package response
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Content codings Compress can apply
+const (
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// CompressOptions configures the Compress middleware
+type CompressOptions struct {
+	// MinSize is the body size from which responses are compressed, smaller ones are not worth the CPU
+	MinSize int
+	// Encodings lists the codings offered, in order of preference when the client weighs them equally
+	Encodings []string
+}
+
+// DefaultCompressOptions compresses bodies of at least 1 KiB with zstd, brotli or gzip
+func DefaultCompressOptions() CompressOptions {
+	return CompressOptions{MinSize: 1024, Encodings: []string{EncodingZstd, EncodingBrotli, EncodingGzip}}
+}
+
+// compressor is the part of gzip.Writer, brotli.Writer and zstd.Encoder the middleware uses
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// compressors pools the writers of each coding, they are costly to allocate
+var compressors = map[string]*sync.Pool{
+	EncodingZstd: {New: func() any {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return encoder
+	}},
+	EncodingBrotli: {New: func() any { return brotli.NewWriterLevel(nil, 5) }},
+	EncodingGzip:   {New: func() any { return gzip.NewWriter(nil) }},
+}
+
+// Compress encodes the responses of compressible media types with the coding the Accept-Encoding header prefers
+// among opts.Encodings, once their body reaches opts.MinSize. Responses already encoded, to HEAD requests, without
+// body or marked no-transform are left alone; strong ETags of compressed responses are made weak.
+func Compress(opts CompressOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: opts.MinSize}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the offered coding with the highest weight in header, "" for the identity coding
+func negotiateEncoding(header string, offers []string) string {
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		if _, ok := compressors[offer]; !ok {
+			continue
+		}
+		quality, specificity := 0.0, -1
+		for _, r := range parseAccept(header) {
+			match := -1
+			switch r.value {
+			case offer:
+				match = 1
+			case "*":
+				match = 0
+			}
+			if match > specificity {
+				quality, specificity = r.quality, match
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status     int
+	buf        bytes.Buffer
+	decided    bool
+	compressor compressor
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	// these responses have no body to compress
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		if cw.buf.Len()+len(b) < cw.minSize {
+			return cw.buf.Write(b)
+		}
+		cw.buf.Write(b)
+		cw.decide(cw.compressible())
+		return len(b), cw.flushBuffer()
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush compresses what was buffered, whatever its size, since the client waits for it
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(cw.compressible())
+		if err := cw.flushBuffer(); err != nil {
+			slog.Debug("failed to write response", "error", err)
+		}
+	}
+	if cw.compressor != nil {
+		if err := cw.compressor.Flush(); err != nil {
+			slog.Debug("failed to flush compressed response", "error", err)
+		}
+	}
+	if err := http.NewResponseController(cw.ResponseWriter).Flush(); err != nil {
+		slog.Debug("failed to flush response", "error", err)
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible tells whether the response is worth compressing once it is large enough
+func (cw *compressWriter) compressible() bool {
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || strings.Contains(header.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(cw.buf.Bytes())
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") || mediaType == MediaJSON || mediaType == MediaXML ||
+		mediaType == MediaCBOR || mediaType == MediaNDJSON || mediaType == "application/javascript"
+}
+
+// decide writes the headers, with the coding when compress is set
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	if compress {
+		header := cw.Header()
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.compressor = compressors[cw.encoding].Get().(compressor)
+		cw.compressor.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) flushBuffer() error {
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.compressor != nil {
+		_, err = cw.compressor.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// close sends a response that stayed below the threshold as is, or ends the compressed stream
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			// the handler wrote nothing, the server answers 200 with an empty body
+			return
+		}
+		cw.decide(false)
+	}
+	if err := cw.flushBuffer(); err != nil {
+		slog.Debug("failed to write response", "error", err)
+	}
+	if cw.compressor != nil {
+		if err := cw.compressor.Close(); err != nil {
+			slog.Debug("failed to close compressed response", "error", err)
+		}
+		cw.compressor.Reset(nil)
+		compressors[cw.encoding].Put(cw.compressor)
+	}
+}
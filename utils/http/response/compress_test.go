@@ -0,0 +1,119 @@
+package response
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	offers := DefaultCompressOptions().Encodings
+
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"gzip", EncodingGzip},
+		{"gzip, deflate, br, zstd", EncodingZstd},
+		{"gzip;q=1, br;q=0.8", EncodingGzip},
+		{"*", EncodingZstd},
+		{"*, zstd;q=0", EncodingBrotli},
+		{"identity", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header, offers); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := `{"items":"` + strings.Repeat("patient ", 512) + `"}`
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		EncodingGzip:   func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		EncodingBrotli: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		EncodingZstd:   func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		contentType      string
+		body             string
+		expectedEncoding string
+	}{
+		{"gzip", "gzip", MediaJSON, large, EncodingGzip},
+		{"brotli", "br", MediaJSON, large, EncodingBrotli},
+		{"zstd", "zstd, gzip", MediaJSON, large, EncodingZstd},
+		{"below threshold", "gzip", MediaJSON, `{"status":"OK"}`, ""},
+		{"incompressible", "gzip", "image/png", large, ""},
+		{"identity", "", MediaJSON, large, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Compress(DefaultCompressOptions())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("ETag", `"v1"`)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/patients", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if encoding := rr.Header().Get("Content-Encoding"); encoding != tt.expectedEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.expectedEncoding, encoding)
+			}
+			var reader io.Reader = rr.Body
+			if tt.expectedEncoding != "" {
+				if rr.Header().Get("ETag") != `W/"v1"` {
+					t.Errorf("Expected a weak ETag, got %s", rr.Header().Get("ETag"))
+				}
+				var err error
+				if reader, err = decoders[tt.expectedEncoding](rr.Body); err != nil {
+					t.Fatal(err)
+				}
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil || string(body) != tt.body {
+				t.Errorf("Expected the body to round trip, got %d bytes (%v)", len(body), err)
+			}
+		})
+	}
+}
+
+func TestCompressAndConditional(t *testing.T) {
+	large := strings.Repeat("patient ", 512)
+	handler := Compress(DefaultCompressOptions())(Conditional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, large)
+	})))
+
+	first := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/patients", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(first, req)
+	etag := first.Header().Get("ETag")
+	if first.Header().Get("Content-Encoding") != EncodingGzip || !strings.HasPrefix(etag, "W/") {
+		t.Fatalf("Expected a gzip response with a weak ETag, got %q %q", first.Header().Get("Content-Encoding"), etag)
+	}
+
+	second := httptest.NewRecorder()
+	req.Header.Set("If-None-Match", etag)
+	handler.ServeHTTP(second, req)
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 || second.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected an empty 304, got %d with %d bytes", second.Code, second.Body.Len())
+	}
+}
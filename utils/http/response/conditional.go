@@ -0,0 +1,185 @@
+package response
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxConditionalBuffer bounds the bodies Conditional hashes, larger or streamed responses are sent untagged
+const maxConditionalBuffer = 1 << 20
+
+// ETag returns a strong entity tag derived from body
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified sets the ETag and Last-Modified validators of the representation about to be written, either may be
+// empty, and answers 304 when the conditional headers of r show the client holds it already, in which case the
+// handler must not write the body. It lets handlers knowing the version of a resource skip building it.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if !isNotModified(r, etag, lastModified) {
+		return false
+	}
+	writeNotModified(w)
+	return true
+}
+
+// Conditional tags successful GET and HEAD responses with an ETag computed from their body, unless the handler set
+// one, and answers 304 instead of the body when If-None-Match, or If-Modified-Since against the Last-Modified set
+// by the handler, shows that the client holds the current representation. Bodies are buffered to be hashed, up to
+// 1 MiB: larger responses, including those whose Content-Length announces it, and responses flushed by the
+// handler are streamed untouched.
+func Conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &conditionalWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		cw.finish(r)
+	})
+}
+
+type conditionalWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (cw *conditionalWriter) WriteHeader(status int) {
+	if cw.status != 0 || cw.passthrough {
+		return
+	}
+	// informational responses are not the final one
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	if status != http.StatusOK || cw.announcesLargeBody() {
+		cw.startPassthrough()
+	}
+}
+
+func (cw *conditionalWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(b)
+	}
+	if cw.buf.Len()+len(b) > maxConditionalBuffer {
+		cw.startPassthrough()
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.buf.Write(b)
+}
+
+// announcesLargeBody tells whether the handler set a Content-Length over the buffer, the body is then sent as it
+// is written instead of once the buffer overflows
+func (cw *conditionalWriter) announcesLargeBody() bool {
+	length, err := strconv.ParseInt(cw.Header().Get("Content-Length"), 10, 64)
+	return err == nil && length > maxConditionalBuffer
+}
+
+// Flush gives up on tagging the response: a handler flushing wants its client to see the bytes now
+func (cw *conditionalWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.startPassthrough()
+	if err := http.NewResponseController(cw.ResponseWriter).Flush(); err != nil {
+		slog.Debug("failed to flush response", "error", err)
+	}
+}
+
+func (cw *conditionalWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// startPassthrough writes the status and what was buffered, the next writes going straight to the client
+func (cw *conditionalWriter) startPassthrough() {
+	if cw.passthrough {
+		return
+	}
+	cw.passthrough = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() > 0 {
+		if _, err := cw.ResponseWriter.Write(cw.buf.Bytes()); err != nil {
+			slog.Debug("failed to write response", "error", err)
+		}
+		cw.buf.Reset()
+	}
+}
+
+// finish tags and sends the buffered response, or a 304 when the client holds it already
+func (cw *conditionalWriter) finish(r *http.Request) {
+	if cw.passthrough {
+		return
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	header := cw.Header()
+	etag := header.Get("ETag")
+	if etag == "" && (cw.buf.Len() > 0 || r.Method == http.MethodGet) {
+		etag = ETag(cw.buf.Bytes())
+		header.Set("ETag", etag)
+	}
+	lastModified, _ := http.ParseTime(header.Get("Last-Modified"))
+	if isNotModified(r, etag, lastModified) {
+		writeNotModified(cw.ResponseWriter)
+		return
+	}
+
+	cw.startPassthrough()
+}
+
+// isNotModified evaluates If-None-Match, or If-Modified-Since when it is absent, as RFC 9110 section 13.2.2 orders
+func isNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etag != "" && matchesETag(ifNoneMatch, etag)
+	}
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// matchesETag compares the entity tags of an If-None-Match header with etag using the weak comparison
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified answers 304, keeping the validators and caching headers but not those describing the body
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	for _, name := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+		header.Del(name)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,109 @@
+package response
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditional(t *testing.T) {
+	body := `{"status":"OK"}`
+	lastModified := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	handler := Conditional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("Content-Type", MediaJSON)
+		_, _ = io.WriteString(w, body)
+	}))
+	etag := ETag([]byte(body))
+
+	tests := []struct {
+		name           string
+		method         string
+		header         map[string]string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"unconditional", http.MethodGet, nil, http.StatusOK, body},
+		{"matching etag", http.MethodGet, map[string]string{"If-None-Match": `"other", ` + etag}, http.StatusNotModified, ""},
+		{"weak etag", http.MethodGet, map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified, ""},
+		{"stale etag", http.MethodGet, map[string]string{"If-None-Match": `"other"`}, http.StatusOK, body},
+		{"etag wins over date", http.MethodGet, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified.Format(http.TimeFormat)}, http.StatusOK, body},
+		{"not modified since", http.MethodGet, map[string]string{"If-Modified-Since": lastModified.Add(time.Hour).Format(http.TimeFormat)}, http.StatusNotModified, ""},
+		{"modified since", http.MethodGet, map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK, body},
+		{"unsafe method", http.MethodPost, map[string]string{"If-None-Match": "*"}, http.StatusOK, body},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/health", nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if tt.method == http.MethodGet && rr.Header().Get("ETag") != etag {
+				t.Errorf("Expected ETag %s, got %s", etag, rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestConditionalStreamsLargeAndFlushedResponses(t *testing.T) {
+	large := strings.Repeat("a", maxConditionalBuffer+1)
+	handlers := map[string]http.HandlerFunc{
+		"large": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, large)
+		},
+		"announced as large": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(maxConditionalBuffer+1))
+			_, _ = io.WriteString(w, "first chunk")
+		},
+		"flushed": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "first\n")
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, "second\n")
+		},
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+			req.Header.Set("If-None-Match", "*")
+			rr := httptest.NewRecorder()
+
+			Conditional(handler).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK || rr.Header().Get("ETag") != "" {
+				t.Errorf("Expected an untagged 200, got %d with ETag %q", rr.Code, rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/Patient/1", nil)
+	req.Header.Set("If-None-Match", `W/"3"`)
+	rr := httptest.NewRecorder()
+
+	if !NotModified(rr, req, `W/"3"`, time.Time{}) {
+		t.Fatal("Expected the current version to be not modified")
+	}
+	if rr.Code != http.StatusNotModified || rr.Header().Get("ETag") != `W/"3"` {
+		t.Errorf("Expected a 304 with the ETag, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+	if NotModified(httptest.NewRecorder(), req, `W/"4"`, time.Time{}) {
+		t.Error("Expected a newer version to be modified")
+	}
+}
@@ -0,0 +1,237 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types the response helpers can encode, JSON being the default when the client accepts anything
+const (
+	MediaJSON     = "application/json"
+	MediaFHIRJSON = "application/fhir+json"
+	MediaXML      = "application/xml"
+	MediaCBOR     = "application/cbor"
+)
+
+// TypeNotAcceptable is returned when none of the media types of the Accept header can be produced
+var TypeNotAcceptable = ProblemType{URI: TypeBase + "not-acceptable", Title: "Not acceptable", Status: http.StatusNotAcceptable}
+
+// encoders lists the supported media types in order of preference
+var encoders = []struct {
+	mediaType   string
+	contentType string
+	encode      func(v any) ([]byte, error)
+}{
+	{MediaJSON, MediaJSON, json.Marshal},
+	{MediaFHIRJSON, MediaFHIRJSON + "; charset=utf-8", json.Marshal},
+	{MediaXML, MediaXML + "; charset=utf-8", encodeXML},
+	{MediaCBOR, MediaCBOR, encodeCBOR},
+}
+
+// Offers lists the media types Write can produce, in order of preference
+func Offers() []string {
+	offers := make([]string, 0, len(encoders))
+	for _, e := range encoders {
+		offers = append(offers, e.mediaType)
+	}
+	return offers
+}
+
+// Write encodes v in the media type negotiated from the Accept header of r and writes it with status, answering
+// 406 when the client accepts none of Offers. A json.RawMessage is written as is to JSON clients.
+func Write(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok := Negotiate(r.Header.Get("Accept"), Offers()...)
+	if !ok {
+		problem := NewProblem(TypeNotAcceptable, "supported media types are "+strings.Join(Offers(), ", "))
+		WriteProblem(w, r, problem)
+		return
+	}
+
+	for _, e := range encoders {
+		if e.mediaType != mediaType {
+			continue
+		}
+		body, err := e.encode(v)
+		if err != nil {
+			Error(w, r, fmt.Errorf("encode %s response: %w", mediaType, err))
+			return
+		}
+		w.Header().Set("Content-Type", e.contentType)
+		w.WriteHeader(status)
+		if _, err := w.Write(body); err != nil {
+			slog.Debug("failed to write response", "error", err)
+		}
+		return
+	}
+}
+
+// Negotiate returns the offer the Accept header prefers, ties going to the earlier offer. An empty header
+// accepts the first offer; false means no offer is acceptable.
+func Negotiate(accept string, offers ...string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		if quality := acceptQuality(ranges, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// acceptRange is one media range of an Accept header with its weight
+type acceptRange struct {
+	value   string
+	quality float64
+}
+
+// parseAccept parses the comma separated values of Accept or Accept-Encoding, dropping their parameters but q
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			name, q, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(q, 64); err == nil && parsed >= 0 && parsed <= 1 {
+					quality = parsed
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{value: value, quality: quality})
+	}
+	return ranges
+}
+
+// acceptQuality returns the weight of the most specific range matching mediaType, 0 when none does
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		match := -1
+		switch {
+		case r.value == mediaType:
+			match = 2
+		case r.value == mainType+"/*":
+			match = 1
+		case r.value == "*/*":
+			match = 0
+		}
+		if match > specificity {
+			quality, specificity = r.quality, match
+		}
+	}
+	return quality
+}
+
+func encodeCBOR(v any) ([]byte, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		var decoded any
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return nil, err
+		}
+		v = decoded
+	}
+	return cbor.Marshal(v)
+}
+
+// encodeXML writes the JSON form of v as XML under a <response> root: objects become elements named after their
+// keys, sorted, and array items repeated <item> elements, so that every value the JSON encoder accepts is accepted
+func encodeXML(v any) ([]byte, error) {
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if err := writeXMLElement(encoder, "response", decoded); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(encoder *xml.Encoder, name string, v any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch value := v.(type) {
+	case nil:
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "nil"}, Value: "true"})
+		return encoder.EncodeElement("", start)
+	case map[string]any:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXMLElement(encoder, xmlName(key), value[key]); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case []any:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, item := range value {
+			if err := writeXMLElement(encoder, "item", item); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	default:
+		return encoder.EncodeElement(fmt.Sprint(value), start)
+	}
+}
+
+// xmlName replaces the characters of a JSON key that are not allowed in an XML element name
+func xmlName(key string) string {
+	name := []rune(key)
+	for i, c := range name {
+		valid := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			i > 0 && (c == '-' || c == '.' || c >= '0' && c <= '9')
+		if !valid {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
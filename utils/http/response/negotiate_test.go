@@ -0,0 +1,95 @@
+package response
+
+import (
+	"encoding/json"
+	"github.com/fxamacker/cbor/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"no header", "", MediaJSON, true},
+		{"anything", "*/*", MediaJSON, true},
+		{"exact", MediaCBOR, MediaCBOR, true},
+		{"fhir", "application/fhir+json;fhirVersion=4.0", MediaFHIRJSON, true},
+		{"weights", "application/json;q=0.5, application/xml", MediaXML, true},
+		{"specific range wins over wildcard", "application/*;q=0.1, application/cbor;q=0.9", MediaCBOR, true},
+		{"excluded", "application/json;q=0, */*;q=0.2", MediaFHIRJSON, true},
+		{"unsupported", "text/html", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Negotiate(tt.accept, Offers()...)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("Expected %q %v, got %q %v", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	health := HealthCheck{Status: "OK", Service: "service"}
+
+	tests := []struct {
+		name                string
+		accept              string
+		value               any
+		expectedStatus      int
+		expectedContentType string
+		check               func(t *testing.T, body []byte)
+	}{
+		{"json", "", health, http.StatusOK, MediaJSON, func(t *testing.T, body []byte) {
+			var got HealthCheck
+			if err := json.Unmarshal(body, &got); err != nil || got != health {
+				t.Errorf("Expected %+v, got %s", health, body)
+			}
+		}},
+		{"raw json", MediaJSON, json.RawMessage(`{"status":"OK"}`), http.StatusOK, MediaJSON, func(t *testing.T, body []byte) {
+			if string(body) != `{"status":"OK"}` {
+				t.Errorf("Expected the raw message, got %s", body)
+			}
+		}},
+		{"xml", MediaXML, []HealthCheck{health}, http.StatusOK, MediaXML + "; charset=utf-8", func(t *testing.T, body []byte) {
+			if !strings.Contains(string(body), "<response><item><service>service</service><status>OK</status></item></response>") {
+				t.Errorf("Unexpected XML %s", body)
+			}
+		}},
+		{"cbor", MediaCBOR, health, http.StatusOK, MediaCBOR, func(t *testing.T, body []byte) {
+			var got map[string]string
+			if err := cbor.Unmarshal(body, &got); err != nil || got["status"] != "OK" {
+				t.Errorf("Expected the JSON field names in CBOR, got %v", got)
+			}
+		}},
+		{"not acceptable", "text/html", health, http.StatusNotAcceptable, ProblemContentType, func(t *testing.T, body []byte) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+
+			Write(rr, req, http.StatusOK, tt.value)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectedContentType, contentType)
+			}
+			if vary := rr.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", vary)
+			}
+			tt.check(t, rr.Body.Bytes())
+		})
+	}
+}
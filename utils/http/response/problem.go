@@ -0,0 +1,167 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details
+const ProblemContentType = "application/problem+json"
+
+// TypeBase prefixes the URIs identifying the problem types of the platform
+const TypeBase = "urn:cce:problem:"
+
+// ProblemType is a class of problems sharing a type URI, a title and a status code
+type ProblemType struct {
+	URI    string
+	Title  string
+	Status int
+}
+
+// Problem types returned by the platform, domain errors are mapped to them through a Registry
+var (
+	TypeInternal           = ProblemType{URI: TypeBase + "internal", Title: "Internal server error", Status: http.StatusInternalServerError}
+	TypeValidation         = ProblemType{URI: TypeBase + "validation", Title: "Invalid request", Status: http.StatusBadRequest}
+	TypeUnauthorized       = ProblemType{URI: TypeBase + "unauthorized", Title: "Authentication required", Status: http.StatusUnauthorized}
+	TypeForbidden          = ProblemType{URI: TypeBase + "forbidden", Title: "Access denied", Status: http.StatusForbidden}
+	TypeNotFound           = ProblemType{URI: TypeBase + "not-found", Title: "Resource not found", Status: http.StatusNotFound}
+	TypeConflict           = ProblemType{URI: TypeBase + "conflict", Title: "Conflicting resource state", Status: http.StatusConflict}
+	TypeGone               = ProblemType{URI: TypeBase + "gone", Title: "Resource deleted", Status: http.StatusGone}
+	TypePreconditionFailed = ProblemType{URI: TypeBase + "precondition-failed", Title: "Precondition failed", Status: http.StatusPreconditionFailed}
+	TypePayloadTooLarge    = ProblemType{URI: TypeBase + "payload-too-large", Title: "Request body too large", Status: http.StatusRequestEntityTooLarge}
+	TypeUnsupportedMedia   = ProblemType{URI: TypeBase + "unsupported-media-type", Title: "Unsupported media type", Status: http.StatusUnsupportedMediaType}
+	TypeUnavailable        = ProblemType{URI: TypeBase + "unavailable", Title: "Service unavailable", Status: http.StatusServiceUnavailable}
+	TypeBadGateway         = ProblemType{URI: TypeBase + "bad-gateway", Title: "Upstream service failed", Status: http.StatusBadGateway}
+	TypeGatewayTimeout     = ProblemType{URI: TypeBase + "gateway-timeout", Title: "Upstream service timed out", Status: http.StatusGatewayTimeout}
+)
+
+// FieldError is a validation failure of one request field, query parameter or body member
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 9457 problem details object, it is also an error so that handlers can return it as is
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// RequestID correlates the problem with the logs and audit events of the request
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem returns a problem of type t with detail, which is shown to clients
+func NewProblem(t ProblemType, detail string) *Problem {
+	return &Problem{Type: t.URI, Title: t.Title, Status: t.Status, Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// ValidationError reports invalid request fields, it is mapped to TypeValidation
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// NewValidationError returns a validation error for a single field
+func NewValidationError(field, format string, args ...any) *ValidationError {
+	return &ValidationError{Errors: []FieldError{{Field: field, Message: fmt.Sprintf(format, args...)}}}
+}
+
+// Add appends a field error
+func (e *ValidationError) Add(field, format string, args ...any) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// OrNil returns e when it holds field errors and nil otherwise, for validations collecting several errors
+func (e *ValidationError) OrNil() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+// Error writes err as a problem: its type and status come from DefaultRegistry, the detail is the error
+// message for client errors while server errors only expose the title, the error being logged instead
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	WriteProblem(w, r, ProblemFor(DefaultRegistry, err))
+	if status := DefaultRegistry.Lookup(err).Status; status >= http.StatusInternalServerError {
+		slog.Error("request failed", "error", err, "status", status, "path", r.URL.Path, "request_id", requestid.FromRequest(r))
+	}
+}
+
+// ProblemFor converts err into a problem through registry, a *Problem in the chain is returned unchanged
+func ProblemFor(registry *Registry, err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		copied := *problem
+		return &copied
+	}
+
+	t := registry.Lookup(err)
+	problem = NewProblem(t, "")
+	if t.Status < http.StatusInternalServerError {
+		problem.Detail = err.Error()
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		problem.Detail = ""
+		problem.Errors = validationErr.Errors
+	}
+	return problem
+}
+
+// WriteProblem writes p as application/problem+json, filling in the instance and request ID from r
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Type == "" {
+		p.Type = TypeInternal.URI
+	}
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if r != nil {
+		if p.Instance == "" {
+			p.Instance = r.URL.Path
+		}
+		if p.RequestID == "" {
+			p.RequestID = requestid.FromRequest(r)
+		}
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		slog.Error("failed to encode problem", "error", err)
+		body = []byte(`{"type":"` + TypeInternal.URI + `","title":"` + TypeInternal.Title + `","status":500}`)
+		p.Status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if _, err := w.Write(body); err != nil {
+		slog.Debug("failed to write problem", "error", err)
+	}
+}
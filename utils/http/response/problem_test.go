@@ -0,0 +1,99 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"github.com/sony/gobreaker/v2"
+)
+
+func TestError(t *testing.T) {
+	validation := NewValidationError("limit", "must be a positive integer")
+	validation.Add("from", "must be an RFC 3339 time")
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedType   string
+		expectedDetail string
+		expectedErrors int
+	}{
+		{"unmapped error hides detail", errors.New("pq: connection reset"), http.StatusInternalServerError, TypeInternal.URI, "", 0},
+		{"breaker open", fmt.Errorf("health check: %w", gobreaker.ErrOpenState), http.StatusServiceUnavailable, TypeUnavailable.URI, "", 0},
+		{"wrapped not found", fmt.Errorf("patient 42: %w", ErrNotFound), http.StatusNotFound, TypeNotFound.URI, "patient 42: not found", 0},
+		{"validation errors", validation, http.StatusBadRequest, TypeValidation.URI, "", 2},
+		{"deadline", context.DeadlineExceeded, http.StatusGatewayTimeout, TypeGatewayTimeout.URI, "", 0},
+		{"problem returned as is", NewProblem(TypeConflict, "version 3 is stale"), http.StatusConflict, TypeConflict.URI, "version 3 is stale", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/audit?limit=-1", nil)
+			req = req.WithContext(requestid.NewContext(req.Context(), "req-1"))
+			w := httptest.NewRecorder()
+
+			Error(w, req, tt.err)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != ProblemContentType {
+				t.Errorf("Expected Content-Type %s, got %s", ProblemContentType, contentType)
+			}
+
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("Expected a JSON problem: %v", err)
+			}
+			if problem.Type != tt.expectedType || problem.Status != tt.expectedStatus || problem.Title == "" {
+				t.Errorf("Unexpected problem %+v", problem)
+			}
+			if problem.Detail != tt.expectedDetail {
+				t.Errorf("Expected detail %q, got %q", tt.expectedDetail, problem.Detail)
+			}
+			if problem.Instance != "/audit" || problem.RequestID != "req-1" {
+				t.Errorf("Expected instance and request ID from the request, got %q and %q", problem.Instance, problem.RequestID)
+			}
+			if len(problem.Errors) != tt.expectedErrors {
+				t.Errorf("Expected %d field errors, got %d", tt.expectedErrors, len(problem.Errors))
+			}
+		})
+	}
+}
+
+type quotaError struct{ patient string }
+
+func (e quotaError) Error() string { return "quota exceeded for " + e.patient }
+
+func TestRegistry(t *testing.T) {
+	tooMany := ProblemType{URI: TypeBase + "quota", Title: "Quota exceeded", Status: http.StatusTooManyRequests}
+	registry := NewRegistry()
+	RegisterAs[quotaError](registry, tooMany)
+	registry.Register(ErrNotFound, TypeNotFound)
+
+	if got := registry.Lookup(fmt.Errorf("export: %w", quotaError{"42"})); got != tooMany {
+		t.Errorf("Expected the registered type for a wrapped typed error, got %+v", got)
+	}
+	if got := registry.Lookup(ErrNotFound); got != TypeNotFound {
+		t.Errorf("Expected TypeNotFound, got %+v", got)
+	}
+	if got := registry.Lookup(ErrConflict); got != TypeInternal {
+		t.Errorf("Expected unregistered errors to be internal, got %+v", got)
+	}
+}
+
+func TestValidationErrorOrNil(t *testing.T) {
+	if err := (&ValidationError{}).OrNil(); err != nil {
+		t.Errorf("Expected nil without field errors, got %v", err)
+	}
+	if err := NewValidationError("id", "required").OrNil(); err == nil {
+		t.Error("Expected an error with field errors")
+	}
+}
@@ -0,0 +1,94 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/sony/gobreaker/v2"
+)
+
+// Domain errors mapped by DefaultRegistry, wrap them (fmt.Errorf("patient %s: %w", id, response.ErrNotFound))
+// to keep the detail specific
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrGone               = errors.New("gone")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// Registry maps errors to problem types, the first matching rule wins
+type Registry struct {
+	mu    sync.RWMutex
+	rules []rule
+}
+
+type rule struct {
+	matches func(error) bool
+	t       ProblemType
+}
+
+// DefaultRegistry is used by Error, packages register their domain errors on it at init
+var DefaultRegistry = NewDefaultRegistry()
+
+// NewRegistry returns an empty registry, every error maps to TypeInternal
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewDefaultRegistry returns a registry mapping the errors of this package, oversized bodies, open circuit breakers
+// and deadlines
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	RegisterAs[*ValidationError](registry, TypeValidation)
+	registry.Register(ErrNotFound, TypeNotFound)
+	registry.Register(ErrConflict, TypeConflict)
+	registry.Register(ErrGone, TypeGone)
+	registry.Register(ErrPreconditionFailed, TypePreconditionFailed)
+	registry.Register(ErrUnauthorized, TypeUnauthorized)
+	registry.Register(ErrForbidden, TypeForbidden)
+	RegisterAs[*http.MaxBytesError](registry, TypePayloadTooLarge)
+	registry.Register(gobreaker.ErrOpenState, TypeUnavailable)
+	registry.Register(gobreaker.ErrTooManyRequests, TypeUnavailable)
+	registry.Register(context.DeadlineExceeded, TypeGatewayTimeout)
+	return registry
+}
+
+// Register maps the errors matching target with errors.Is to t
+func (r *Registry) Register(target error, t ProblemType) {
+	r.add(rule{matches: func(err error) bool { return errors.Is(err, target) }, t: t})
+}
+
+// RegisterAs maps the errors of type T (found with errors.As) to t
+func RegisterAs[T error](r *Registry, t ProblemType) {
+	r.add(rule{matches: func(err error) bool {
+		var target T
+		return errors.As(err, &target)
+	}, t: t})
+}
+
+// Lookup returns the problem type of err, TypeInternal when no rule matches
+func (r *Registry) Lookup(err error) ProblemType {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return ProblemType{URI: problem.Type, Title: problem.Title, Status: problem.Status}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rule := range r.rules {
+		if rule.matches(err) {
+			return rule.t
+		}
+	}
+	return TypeInternal
+}
+
+func (r *Registry) add(rule rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule)
+}
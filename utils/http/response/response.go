@@ -3,7 +3,6 @@ package response
 import (
 	"errors"
 	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils"
-	"github.com/sony/gobreaker/v2"
 	"io"
 	"log/slog"
 	"net/http"
@@ -18,17 +17,6 @@ func Ok(w http.ResponseWriter, jsonByteMsg []byte) {
 	}
 }
 
-func Error(w http.ResponseWriter, err error) {
-	switch {
-	case errors.Is(err, gobreaker.ErrOpenState):
-		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
-		return
-	default:
-		http.Error(w, "Health check failed", http.StatusInternalServerError)
-		return
-	}
-}
-
 // Deprecated: Use Ok to handle http ok responses and Error for error responses.
 func SendResponse(w http.ResponseWriter, r *http.Request, msg interface{}) {
 	err := SendOkResponse(w, r, msg)
@@ -5,6 +5,7 @@ type HealthCheck struct {
 	Service string `json:"service"`
 }
 
+// Deprecated: errors are written as Problem by Error
 type ErrorMsg struct {
 	Error string `json:"error"`
 }
@@ -0,0 +1,90 @@
+package response
+
+import (
+	"errors"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/requestid"
+	"iter"
+	"log/slog"
+	"net/http"
+)
+
+// MediaNDJSON is newline delimited JSON, one value per line
+const MediaNDJSON = "application/x-ndjson"
+
+// Stream writes the values passed by produce to its encoder as a JSON array, or as NDJSON when the Accept header
+// prefers it, encoding each value as it comes so that large collections are never held in memory. An error from
+// produce before any byte reached the client is answered with a problem; afterwards the connection is aborted,
+// so that the client cannot mistake the truncated body for a complete one.
+func Stream(w http.ResponseWriter, r *http.Request, status int, produce func(utils.StreamEncoder) error, opts ...utils.StreamOption) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok := Negotiate(r.Header.Get("Accept"), MediaJSON, MediaNDJSON)
+	if !ok {
+		WriteProblem(w, r, NewProblem(TypeNotAcceptable, "supported media types are "+MediaJSON+", "+MediaNDJSON))
+		return
+	}
+
+	sw := &streamWriter{ResponseWriter: w, status: status, contentType: mediaType}
+	encoder := utils.NewArrayEncoder(sw, opts...)
+	if mediaType == MediaNDJSON {
+		encoder = utils.NewNDJSONEncoder(sw, opts...)
+	}
+
+	err := produce(encoder)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err == nil {
+		return
+	}
+	if !sw.started {
+		Error(w, r, err)
+		return
+	}
+	slog.Error("response stream failed", "error", err, "values", encoder.Count(), "path", r.URL.Path,
+		"request_id", requestid.FromRequest(r))
+	panic(http.ErrAbortHandler)
+}
+
+// StreamSeq streams the values of seq as Stream does, stopping at the first error it yields
+func StreamSeq[T any](w http.ResponseWriter, r *http.Request, status int, seq iter.Seq2[T, error], opts ...utils.StreamOption) {
+	Stream(w, r, status, func(encoder utils.StreamEncoder) error {
+		for value, err := range seq {
+			if err != nil {
+				return err
+			}
+			if err := encoder.Encode(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, opts...)
+}
+
+// streamWriter sends the status and content type with the first bytes of the stream, so that an error met
+// before can still be answered with a problem
+type streamWriter struct {
+	http.ResponseWriter
+	status      int
+	contentType string
+	started     bool
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	if !sw.started {
+		sw.started = true
+		sw.Header().Set("Content-Type", sw.contentType)
+		sw.ResponseWriter.WriteHeader(sw.status)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *streamWriter) Flush() error {
+	if !sw.started {
+		return nil
+	}
+	if err := http.NewResponseController(sw.ResponseWriter).Flush(); !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
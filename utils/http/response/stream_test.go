@@ -0,0 +1,93 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func patients(n int, failAt int) iter.Seq2[HealthCheck, error] {
+	return func(yield func(HealthCheck, error) bool) {
+		for i := 0; i < n; i++ {
+			if i == failAt {
+				yield(HealthCheck{}, fmt.Errorf("read patient %d: %w", i, ErrNotFound))
+				return
+			}
+			if !yield(HealthCheck{Status: "OK", Service: fmt.Sprint(i)}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		check               func(t *testing.T, body string)
+	}{
+		{"json array", "", http.StatusOK, MediaJSON, func(t *testing.T, body string) {
+			var got []HealthCheck
+			if err := json.Unmarshal([]byte(body), &got); err != nil || len(got) != 3 {
+				t.Errorf("Expected an array of 3 values, got %s", body)
+			}
+		}},
+		{"ndjson", MediaNDJSON, http.StatusOK, MediaNDJSON, func(t *testing.T, body string) {
+			if lines := strings.Split(strings.TrimSpace(body), "\n"); len(lines) != 3 {
+				t.Errorf("Expected 3 lines, got %q", body)
+			}
+		}},
+		{"not acceptable", MediaXML, http.StatusNotAcceptable, ProblemContentType, func(t *testing.T, body string) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/Patient", nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+
+			StreamSeq(rr, req, http.StatusOK, patients(3, -1), utils.WithFlushEvery(1))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectedContentType, contentType)
+			}
+			tt.check(t, rr.Body.String())
+		})
+	}
+}
+
+func TestStreamErrorBeforeFirstByte(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	StreamSeq(rr, httptest.NewRequest(http.MethodGet, "/Patient", nil), http.StatusOK, patients(3, 1))
+
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != ProblemContentType {
+		t.Errorf("Expected a not found problem, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStreamErrorAfterFirstByte(t *testing.T) {
+	rr := httptest.NewRecorder()
+	defer func() {
+		if recovered := recover(); !errors.Is(recovered.(error), http.ErrAbortHandler) {
+			t.Errorf("Expected the handler to abort the connection, got %v", recovered)
+		}
+		if rr.Code != http.StatusOK || json.Valid(rr.Body.Bytes()) {
+			t.Errorf("Expected a truncated body, got %d %s", rr.Code, rr.Body.String())
+		}
+	}()
+
+	StreamSeq(rr, httptest.NewRequest(http.MethodGet, "/Patient", nil), http.StatusOK, patients(3, 2), utils.WithFlushEvery(1))
+	t.Error("Expected Stream to abort")
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/MarcoFontana48/AUSL-Romagna-CCE-Microservices-Project-Proposal/utils/http/response"
+)
+
+// LevelState describes the current runtime log levels
+type LevelState struct {
+	Level      string                    `json:"level"`
+	Configured string                    `json:"configured"`
+	ExpiresAt  *time.Time                `json:"expires_at,omitempty"`
+	Components map[string]ComponentState `json:"components,omitempty"`
+}
+
+// ComponentState describes the level override of a single component
+type ComponentState struct {
+	Level     string     `json:"level"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// LevelRequest is the body accepted by LevelHandler to change a level
+type LevelRequest struct {
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+}
+
+// State returns a snapshot of the runtime log levels
+func State() LevelState {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	state := LevelState{
+		Level:      levels.global.Level().String(),
+		Configured: levels.configured.String(),
+	}
+	if levels.globalTTL != nil {
+		state.ExpiresAt = &levels.globalTTL.expiresAt
+	}
+	if len(levels.overrides) > 0 {
+		state.Components = make(map[string]ComponentState, len(levels.overrides))
+		for component, override := range levels.overrides {
+			componentState := ComponentState{Level: override.level.String()}
+			if override.timer != nil {
+				componentState.ExpiresAt = &override.expiresAt
+			}
+			state.Components[component] = componentState
+		}
+	}
+	return state
+}
+
+// LevelHandler serves the runtime log level: GET returns it, PUT/POST change it
+// (JSON body or "level", "component" and "ttl" query parameters) and DELETE reverts it
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			req, err := decodeLevelRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := applyLevelRequest(req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			slog.Warn("log level changed at runtime", "level", req.Level, componentKey, req.Component, "ttl", req.TTL, "from", r.RemoteAddr)
+		case http.MethodDelete:
+			if component := r.URL.Query().Get(componentKey); component != "" {
+				ResetComponentLevel(component)
+			} else {
+				ResetLevel()
+			}
+			slog.Warn("log level reset at runtime", componentKey, r.URL.Query().Get(componentKey), "from", r.RemoteAddr)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		msg, err := json.Marshal(State())
+		if err != nil {
+			http.Error(w, "Failed to encode log level", http.StatusInternalServerError)
+			return
+		}
+		response.Ok(w, msg)
+	})
+}
+
+func decodeLevelRequest(r *http.Request) (LevelRequest, error) {
+	query := r.URL.Query()
+	req := LevelRequest{
+		Level:     query.Get("level"),
+		Component: query.Get(componentKey),
+		TTL:       query.Get("ttl"),
+	}
+	if req.Level == "" && r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<10)).Decode(&req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+func applyLevelRequest(req LevelRequest) error {
+	level, err := ParseLevel(req.Level)
+	if err != nil {
+		return err
+	}
+	ttl := DefaultTTL()
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			return err
+		}
+		if ttl < 0 {
+			return fmt.Errorf("ttl must not be negative, got %s", req.TTL)
+		}
+	}
+
+	if req.Component != "" {
+		SetComponentLevel(req.Component, level, ttl)
+	} else {
+		SetLevel(level, ttl)
+	}
+	return nil
+}
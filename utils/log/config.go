@@ -0,0 +1,144 @@
+package log
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Format selects how records are encoded
+type Format string
+
+const (
+	FormatJSON   Format = "json"   // one JSON object per line
+	FormatText   Format = "text"   // human-readable console lines
+	FormatLogfmt Format = "logfmt" // key=value pairs
+)
+
+// FieldNaming selects the names of the built-in and static fields
+type FieldNaming string
+
+const (
+	NamingDefault FieldNaming = "default" // slog names: time, level, msg, source
+	NamingECS     FieldNaming = "ecs"     // Elastic Common Schema: @timestamp, log.level, message, service.name
+	NamingOTel    FieldNaming = "otel"    // OpenTelemetry log data model: timestamp, severity_text, body, service.name
+)
+
+// SinkType selects where records are written
+type SinkType string
+
+const (
+	SinkStdout SinkType = "stdout"
+	SinkStderr SinkType = "stderr"
+	SinkFile   SinkType = "file"   // rotating file
+	SinkSyslog SinkType = "syslog" // local syslog daemon (unix only)
+)
+
+// SinkConfig configures one log output
+type SinkConfig struct {
+	Type SinkType
+	// Level is the minimum level written to this sink, in addition to the global level (empty means every record)
+	Level string
+	// Format overrides the global format for this sink
+	Format Format
+
+	// Path is the file written by file sinks
+	Path string
+	// MaxSizeMB rotates the file once it grows past this size (0 disables size rotation)
+	MaxSizeMB int
+	// MaxAge rotates the file once it is older than this and removes rotated files older than this (0 disables both)
+	MaxAge time.Duration
+	// MaxBackups limits how many rotated files are kept (0 keeps them all)
+	MaxBackups int
+
+	// Network and Address select the syslog socket, the local default socket is used when empty
+	Network string
+	Address string
+	// Tag is the syslog tag, the service name is used when empty
+	Tag string
+}
+
+// Config holds the logging configuration
+type Config struct {
+	Level       slog.Level
+	LevelTTL    time.Duration
+	AddSource   bool
+	Format      Format
+	FieldNaming FieldNaming
+	Redact      bool
+
+	// Service, Version and Instance are added to every record as static attributes
+	Service  string
+	Version  string
+	Instance string
+	// Attributes are additional static attributes added to every record
+	Attributes map[string]string
+
+	Sinks []SinkConfig
+}
+
+// DefaultConfig returns the configuration used when nothing is set: JSON at info level on stdout, with redaction
+func DefaultConfig() Config {
+	return Config{
+		Level:       slog.LevelInfo,
+		Format:      FormatJSON,
+		FieldNaming: NamingDefault,
+		Redact:      true,
+		Sinks:       []SinkConfig{{Type: SinkStdout}},
+	}
+}
+
+// Validate reports configuration values that cannot be used
+func (c Config) Validate() error {
+	if err := c.Format.validate(); err != nil {
+		return err
+	}
+	switch c.FieldNaming {
+	case NamingDefault, NamingECS, NamingOTel, "":
+	default:
+		return fmt.Errorf("log: unknown field naming %q (expected default, ecs or otel)", c.FieldNaming)
+	}
+	if len(c.Sinks) == 0 {
+		return fmt.Errorf("log: at least one output is required")
+	}
+	for _, sink := range c.Sinks {
+		if err := sink.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f Format) validate() error {
+	switch f {
+	case FormatJSON, FormatText, FormatLogfmt, "":
+		return nil
+	default:
+		return fmt.Errorf("log: unknown format %q (expected json, text or logfmt)", f)
+	}
+}
+
+func (s SinkConfig) validate() error {
+	if err := s.Format.validate(); err != nil {
+		return err
+	}
+	if s.Level != "" {
+		if _, err := ParseLevel(s.Level); err != nil {
+			return fmt.Errorf("log: invalid level %q for %s output: %w", s.Level, s.Type, err)
+		}
+	}
+	switch s.Type {
+	case SinkStdout, SinkStderr, SinkSyslog:
+		return nil
+	case SinkFile:
+		if s.Path == "" {
+			return fmt.Errorf("log: file output requires a path (LOG_FILE_PATH)")
+		}
+		if s.MaxSizeMB < 0 || s.MaxBackups < 0 || s.MaxAge < 0 {
+			return fmt.Errorf("log: file output limits must not be negative")
+		}
+		return nil
+	default:
+		return fmt.Errorf("log: unknown output %q (expected stdout, stderr, file or syslog)", s.Type)
+	}
+}
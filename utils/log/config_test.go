@@ -0,0 +1,328 @@
+package log
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// initToFile configures logging to a single file sink and returns its path
+func initToFile(t *testing.T, cfg Config) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.log")
+	cfg.Sinks = []SinkConfig{{Type: SinkFile, Path: path}}
+	if err := Init(cfg); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	t.Cleanup(func() {
+		_ = Close()
+		levels.configure(slog.LevelInfo, 0)
+	})
+	return path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	output := strings.TrimSpace(string(data))
+	if output == "" {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+func TestInitFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		contains []string
+	}{
+		{
+			name:     "json",
+			format:   FormatJSON,
+			contains: []string{`"msg":"hello"`, `"key":"value"`},
+		},
+		{
+			name:     "logfmt",
+			format:   FormatLogfmt,
+			contains: []string{"msg=hello", "key=value", "level=INFO"},
+		},
+		{
+			name:     "text",
+			format:   FormatText,
+			contains: []string{"INFO  hello", "key=value", "group.nested=\"two words\""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Format = tt.format
+			path := initToFile(t, cfg)
+
+			slog.Info("hello", "key", "value", slog.Group("group", "nested", "two words"))
+
+			lines := readLines(t, path)
+			if len(lines) != 1 {
+				t.Fatalf("Expected 1 line, got %d", len(lines))
+			}
+			for _, expected := range tt.contains {
+				if !strings.Contains(lines[0], expected) {
+					t.Errorf("Expected %q in %s", expected, lines[0])
+				}
+			}
+		})
+	}
+}
+
+func TestInitFieldNaming(t *testing.T) {
+	tests := []struct {
+		naming   FieldNaming
+		expected []string
+	}{
+		{NamingDefault, []string{"time", "level", "msg", "service", "version", "pod", "team"}},
+		{NamingECS, []string{"@timestamp", "log.level", "message", "service.name", "service.version", "service.node.name", "ecs.version", "team"}},
+		{NamingOTel, []string{"timestamp", "severity_text", "body", "service.name", "service.version", "k8s.pod.name", "team"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.naming), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.FieldNaming = tt.naming
+			cfg.Service, cfg.Version, cfg.Instance = "service", "1.2.0", "service-abc"
+			cfg.Attributes = map[string]string{"team": "cce"}
+			path := initToFile(t, cfg)
+
+			slog.Info("hello")
+
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(readLines(t, path)[0]), &record); err != nil {
+				t.Fatalf("Expected JSON record: %v", err)
+			}
+			for _, key := range tt.expected {
+				if _, ok := record[key]; !ok {
+					t.Errorf("Expected field %q in %v", key, record)
+				}
+			}
+		})
+	}
+}
+
+func TestInitSourceNaming(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AddSource = true
+	cfg.FieldNaming = NamingECS
+	path := initToFile(t, cfg)
+
+	slog.Info("hello")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(readLines(t, path)[0]), &record); err != nil {
+		t.Fatalf("Expected JSON record: %v", err)
+	}
+	origin, ok := record["log.origin"].(map[string]interface{})
+	if !ok || origin["file.name"] == nil || origin["file.line"] == nil {
+		t.Errorf("Expected log.origin with file name and line, got %v", record["log.origin"])
+	}
+}
+
+func TestTextFormatAppliesFieldNaming(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Format = FormatText
+	cfg.AddSource = true
+	cfg.FieldNaming = NamingECS
+	path := initToFile(t, cfg)
+
+	slog.Info("hello", "key", "value")
+
+	line := readLines(t, path)[0]
+	for _, expected := range []string{"INFO  hello", "log.origin.file.name=", "log.origin.file.line=", "key=value"} {
+		if !strings.Contains(line, expected) {
+			t.Errorf("Expected %q in %s", expected, line)
+		}
+	}
+	if strings.Contains(line, " source=") {
+		t.Errorf("Expected the source to be named after the naming scheme, got %s", line)
+	}
+}
+
+func TestConsoleHandlerReplaceAttr(t *testing.T) {
+	var b strings.Builder
+	handler := newConsoleHandler(&b, &slog.HandlerOptions{ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+		switch {
+		case attr.Key == slog.TimeKey:
+			return slog.Attr{}
+		case attr.Key == "secret" && strings.Join(groups, ".") == "user":
+			return slog.String("secret", "***")
+		}
+		return attr
+	}})
+	logger := slog.New(handler).WithGroup("user")
+
+	logger.Info("login", "name", "alice", "secret", "hunter2")
+
+	if got, want := b.String(), "INFO  login user.name=alice user.secret=***\n"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestInitPerSinkLevel(t *testing.T) {
+	dir := t.TempDir()
+	all := filepath.Join(dir, "all.log")
+	errorsOnly := filepath.Join(dir, "errors.log")
+
+	cfg := DefaultConfig()
+	cfg.Level = slog.LevelDebug
+	cfg.Sinks = []SinkConfig{
+		{Type: SinkFile, Path: all},
+		{Type: SinkFile, Path: errorsOnly, Level: "error", Format: FormatLogfmt},
+	}
+	if err := Init(cfg); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer func() {
+		_ = Close()
+		levels.configure(slog.LevelInfo, 0)
+	}()
+
+	slog.Debug("debug")
+	slog.Error("failure")
+
+	if lines := readLines(t, all); len(lines) != 2 {
+		t.Errorf("Expected 2 records in unfiltered sink, got %d", len(lines))
+	}
+	lines := readLines(t, errorsOnly)
+	if len(lines) != 1 || !strings.Contains(lines[0], "msg=failure") {
+		t.Errorf("Expected only the error record in logfmt, got %v", lines)
+	}
+}
+
+func TestInitInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(cfg *Config)
+	}{
+		{"unknown format", func(cfg *Config) { cfg.Format = "xml" }},
+		{"unknown naming", func(cfg *Config) { cfg.FieldNaming = "gelf" }},
+		{"no sinks", func(cfg *Config) { cfg.Sinks = nil }},
+		{"unknown sink", func(cfg *Config) { cfg.Sinks = []SinkConfig{{Type: "kafka"}} }},
+		{"file without path", func(cfg *Config) { cfg.Sinks = []SinkConfig{{Type: SinkFile}} }},
+		{"invalid sink level", func(cfg *Config) { cfg.Sinks = []SinkConfig{{Type: SinkStdout, Level: "loud"}} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.cfg(&cfg)
+			if err := Init(cfg); err == nil {
+				t.Error("Expected Init() to reject the configuration")
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	file, err := newRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	current := time.Date(2025, 8, 4, 10, 0, 0, 0, time.UTC)
+	file.now = func() time.Time {
+		current = current.Add(time.Second)
+		return current
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := file.Write([]byte("12345678\n")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 backups to be kept, got %v", backups)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "12345678\n" {
+		t.Errorf("Expected current file to hold the last write, got %q", data)
+	}
+}
+
+func TestRotatingFilePrunesByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	old := filepath.Join(dir, "app-20200101T000000.000.log")
+	// files sharing the prefix of the backups are not backups
+	unrelated := filepath.Join(dir, "app-old.log")
+	past := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{old, unrelated} {
+		if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := newRotatingFile(path, 0, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Expected backup older than max age to be removed")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("Expected a file that is not a backup to be kept, got %v", err)
+	}
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	file, err := newRotatingFile(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := file.Write([]byte("first\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	file.openedAt = file.openedAt.Add(-30 * time.Minute)
+	if _, err := file.Write([]byte("second\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log")); len(backups) != 0 {
+		t.Fatalf("Expected no rotation before max age, got %v", backups)
+	}
+
+	file.openedAt = file.openedAt.Add(-time.Hour)
+	if _, err := file.Write([]byte("third\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(backups) != 1 {
+		t.Fatalf("Expected the active file to be rotated once it is older than max age, got %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != "first\nsecond\n" {
+		t.Errorf("Expected the backup to hold the old lines, got %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "third\n" {
+		t.Errorf("Expected the active file to start over, got %q", data)
+	}
+}
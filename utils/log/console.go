@@ -0,0 +1,168 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// consoleTimeFormat is the layout of the time starting each line
+const consoleTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// consoleHandler writes human-readable lines: "<time> <LEVEL> <message> key=value ...". The ReplaceAttr option
+// applies to the time, level and message, which keep their place in the line, and to the source and other
+// attributes, which are written as keys.
+type consoleHandler struct {
+	opts   slog.HandlerOptions
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	groups []string
+	attrs  string
+}
+
+func newConsoleHandler(w io.Writer, opts *slog.HandlerOptions) *consoleHandler {
+	h := &consoleHandler{mu: &sync.Mutex{}, w: w}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var fields []string
+	if !record.Time.IsZero() {
+		if attr, ok := h.replace(nil, slog.Time(slog.TimeKey, record.Time)); ok {
+			if attr.Value.Kind() == slog.KindTime {
+				fields = append(fields, attr.Value.Time().Format(consoleTimeFormat))
+			} else {
+				fields = append(fields, formatValue(attr.Value))
+			}
+		}
+	}
+	if attr, ok := h.replace(nil, slog.Any(slog.LevelKey, record.Level)); ok {
+		fields = append(fields, fmt.Sprintf("%-5s", formatValue(attr.Value)))
+	}
+	if attr, ok := h.replace(nil, slog.String(slog.MessageKey, record.Message)); ok {
+		fields = append(fields, formatValue(attr.Value))
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(fields, " "))
+	if h.opts.AddSource && record.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{record.PC})
+		frame, _ := frames.Next()
+		source := &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+		// the source is not in a group, whatever the groups of the handler
+		h.appendAttr(&b, "", nil, slog.Any(slog.SourceKey, source))
+	}
+
+	b.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		h.appendAttr(&b, h.prefix, h.groups, attr)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, attr := range attrs {
+		h.appendAttr(&b, h.prefix, h.groups, attr)
+	}
+	clone := *h
+	clone.attrs = b.String()
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	clone.groups = append(slices.Clip(h.groups), name)
+	return &clone
+}
+
+// replace applies the ReplaceAttr option to an attribute that is not a group, false when it removes it
+func (h *consoleHandler) replace(groups []string, attr slog.Attr) (slog.Attr, bool) {
+	attr.Value = attr.Value.Resolve()
+	if h.opts.ReplaceAttr != nil && attr.Value.Kind() != slog.KindGroup {
+		attr = h.opts.ReplaceAttr(groups, attr)
+		attr.Value = attr.Value.Resolve()
+	}
+	return attr, !attr.Equal(slog.Attr{})
+}
+
+func (h *consoleHandler) appendAttr(b *strings.Builder, prefix string, groups []string, attr slog.Attr) {
+	attr, ok := h.replace(groups, attr)
+	if !ok {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix, memberGroups := prefix, groups
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+			memberGroups = append(slices.Clip(groups), attr.Key)
+		}
+		for _, member := range attr.Value.Group() {
+			h.appendAttr(b, groupPrefix, memberGroups, member)
+		}
+		return
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(prefix)
+	b.WriteString(attr.Key)
+	b.WriteByte('=')
+	b.WriteString(quoteIfNeeded(formatValue(attr.Value)))
+}
+
+func formatValue(value slog.Value) string {
+	switch value.Kind() {
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case json.RawMessage:
+			return string(v)
+		case []byte:
+			return string(v)
+		case error:
+			return v.Error()
+		case *slog.Source:
+			return fmt.Sprintf("%s:%d", v.File, v.Line)
+		}
+	}
+	return value.String()
+}
+
+func quoteIfNeeded(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n\r") {
+		return strconv.Quote(s)
+	}
+	return s
+}
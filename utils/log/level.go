@@ -0,0 +1,226 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// allLevels is the level of the innermost handlers, filtering is done by levelHandler
+const allLevels = slog.Level(math.MinInt)
+
+// componentKey is the attribute key that identifies the component a logger belongs to
+const componentKey = "component"
+
+// levels holds the process-wide runtime log level state
+var levels = newLevelRegistry()
+
+// levelOverride is a runtime level that may expire
+type levelOverride struct {
+	level     slog.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+type levelRegistry struct {
+	mu         sync.Mutex
+	configured slog.Level
+	defaultTTL time.Duration
+	global     slog.LevelVar
+	globalTTL  *levelOverride
+	components sync.Map // component name -> *levelOverride
+	overrides  map[string]*levelOverride
+}
+
+func newLevelRegistry() *levelRegistry {
+	return &levelRegistry{
+		configured: slog.LevelInfo,
+		overrides:  make(map[string]*levelOverride),
+	}
+}
+
+// ParseLevel parses a level name (debug, info, warn, error, case-insensitive, with optional offsets like "debug-2")
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.TrimSpace(s)))
+	return level, err
+}
+
+// Level returns the current global log level
+func Level() slog.Level {
+	return levels.global.Level()
+}
+
+// ConfiguredLevel returns the level configured at startup, which runtime changes revert to
+func ConfiguredLevel() slog.Level {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	return levels.configured
+}
+
+// SetLevel changes the global log level, reverting to the configured level after ttl (if ttl > 0)
+func SetLevel(level slog.Level, ttl time.Duration) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	levels.stopGlobalTimer()
+	levels.global.Set(level)
+	if ttl > 0 {
+		override := &levelOverride{level: level, expiresAt: time.Now().Add(ttl)}
+		override.timer = time.AfterFunc(ttl, func() {
+			levels.mu.Lock()
+			defer levels.mu.Unlock()
+			if levels.globalTTL == override {
+				levels.globalTTL = nil
+				levels.global.Set(levels.configured)
+				slog.Info("log level reverted", "level", levels.configured.String())
+			}
+		})
+		levels.globalTTL = override
+	}
+}
+
+// ResetLevel restores the configured global log level
+func ResetLevel() {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.stopGlobalTimer()
+	levels.global.Set(levels.configured)
+}
+
+// SetComponentLevel overrides the log level of a single component, removing the override after ttl (if ttl > 0)
+func SetComponentLevel(component string, level slog.Level, ttl time.Duration) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	levels.removeComponent(component)
+	override := &levelOverride{level: level}
+	if ttl > 0 {
+		override.expiresAt = time.Now().Add(ttl)
+		override.timer = time.AfterFunc(ttl, func() {
+			levels.mu.Lock()
+			defer levels.mu.Unlock()
+			if levels.overrides[component] == override {
+				levels.removeComponent(component)
+				slog.Info("component log level reverted", componentKey, component)
+			}
+		})
+	}
+	levels.overrides[component] = override
+	levels.components.Store(component, override)
+}
+
+// ResetComponentLevel removes the level override of a component, which then follows the global level
+func ResetComponentLevel(component string) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.removeComponent(component)
+}
+
+// Component returns a logger tagged with the given component name, whose level can be overridden at runtime
+func Component(name string) *slog.Logger {
+	return slog.Default().With(componentKey, name)
+}
+
+// DefaultTTL returns how long runtime level changes last when no explicit ttl is given (0 means forever)
+func DefaultTTL() time.Duration {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	return levels.defaultTTL
+}
+
+// configure sets the startup level and drops every runtime override
+func (l *levelRegistry) configure(level slog.Level, defaultTTL time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.configured = level
+	l.defaultTTL = defaultTTL
+	l.stopGlobalTimer()
+	l.global.Set(level)
+	for component := range l.overrides {
+		l.removeComponent(component)
+	}
+}
+
+// enabled reports whether a record at the given level is logged for the component
+func (l *levelRegistry) enabled(component string, level slog.Level) bool {
+	if component != "" {
+		if override, ok := l.components.Load(component); ok {
+			return level >= override.(*levelOverride).level
+		}
+	}
+	return level >= l.global.Level()
+}
+
+func (l *levelRegistry) stopGlobalTimer() {
+	if l.globalTTL != nil {
+		l.globalTTL.timer.Stop()
+		l.globalTTL = nil
+	}
+}
+
+func (l *levelRegistry) removeComponent(component string) {
+	if override, ok := l.overrides[component]; ok {
+		if override.timer != nil {
+			override.timer.Stop()
+		}
+		delete(l.overrides, component)
+		l.components.Delete(component)
+	}
+}
+
+/* === Handler === */
+
+// levelHandler filters records using the runtime level registry, honoring per-component overrides.
+// Only a top-level component attribute selects the override, one inside a group is ordinary data.
+type levelHandler struct {
+	inner     slog.Handler
+	component string
+	grouped   bool
+}
+
+func newLevelHandler(inner slog.Handler) *levelHandler {
+	return &levelHandler{inner: inner}
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return levels.enabled(h.component, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	if !h.grouped {
+		for _, attr := range attrs {
+			if attr.Key == componentKey {
+				component = attr.Value.String()
+			}
+		}
+	}
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), component: component, grouped: h.grouped}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &levelHandler{inner: h.inner.WithGroup(name), component: h.component, grouped: true}
+}
+
+// moreVerbose returns the next more verbose standard level (error -> warn -> info -> debug)
+func moreVerbose(level slog.Level) slog.Level {
+	switch {
+	case level > slog.LevelWarn:
+		return slog.LevelWarn
+	case level > slog.LevelInfo:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
@@ -0,0 +1,247 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCapturingLogger returns a logger filtered by the runtime level registry that writes to a buffer
+func newCapturingLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: allLevels})
+	return slog.New(newLevelHandler(handler)), &buf
+}
+
+func countLines(buf *bytes.Buffer) int {
+	output := strings.TrimSpace(buf.String())
+	if output == "" {
+		return 0
+	}
+	return len(strings.Split(output, "\n"))
+}
+
+func TestSetLevel(t *testing.T) {
+	levels.configure(slog.LevelInfo, 0)
+	defer levels.configure(slog.LevelInfo, 0)
+	logger, buf := newCapturingLogger()
+
+	logger.Debug("hidden")
+	if countLines(buf) != 0 {
+		t.Errorf("Expected debug record to be filtered at info level, got %s", buf.String())
+	}
+
+	SetLevel(slog.LevelDebug, 0)
+	logger.Debug("visible")
+	if countLines(buf) != 1 {
+		t.Errorf("Expected debug record after SetLevel, got %s", buf.String())
+	}
+
+	ResetLevel()
+	if Level() != slog.LevelInfo {
+		t.Errorf("Expected level to be reset to info, got %v", Level())
+	}
+}
+
+func TestSetLevelRevertsAfterTTL(t *testing.T) {
+	levels.configure(slog.LevelWarn, 0)
+	defer levels.configure(slog.LevelInfo, 0)
+
+	SetLevel(slog.LevelDebug, 20*time.Millisecond)
+	if Level() != slog.LevelDebug {
+		t.Fatalf("Expected debug level, got %v", Level())
+	}
+	if State().ExpiresAt == nil {
+		t.Error("Expected expiry to be reported while a ttl is active")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for Level() != slog.LevelWarn && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if Level() != slog.LevelWarn {
+		t.Errorf("Expected level to revert to configured warn, got %v", Level())
+	}
+}
+
+func TestComponentLevel(t *testing.T) {
+	levels.configure(slog.LevelInfo, 0)
+	defer levels.configure(slog.LevelInfo, 0)
+	logger, buf := newCapturingLogger()
+
+	proxy := logger.With(componentKey, "proxy")
+	other := logger.With(componentKey, "other")
+
+	SetComponentLevel("proxy", slog.LevelDebug, 0)
+	proxy.Debug("proxy debug")
+	other.Debug("other debug")
+	if countLines(buf) != 1 || !strings.Contains(buf.String(), "proxy debug") {
+		t.Errorf("Expected only the overridden component to log at debug, got %s", buf.String())
+	}
+
+	SetComponentLevel("other", slog.LevelError, 0)
+	other.Warn("other warn")
+	if strings.Contains(buf.String(), "other warn") {
+		t.Error("Expected component override to also raise the level above the global one")
+	}
+
+	ResetComponentLevel("proxy")
+	proxy.Debug("proxy debug again")
+	if strings.Contains(buf.String(), "proxy debug again") {
+		t.Error("Expected component to follow the global level after reset")
+	}
+}
+
+func TestComponentLevelIgnoresGroupedAttribute(t *testing.T) {
+	levels.configure(slog.LevelInfo, 0)
+	defer levels.configure(slog.LevelInfo, 0)
+	logger, buf := newCapturingLogger()
+
+	SetComponentLevel("proxy", slog.LevelDebug, 0)
+	logger.WithGroup("upstream").With(componentKey, "proxy").Debug("grouped debug")
+	if strings.Contains(buf.String(), "grouped debug") {
+		t.Error("Expected a component attribute inside a group not to select the override")
+	}
+
+	logger.With(componentKey, "proxy").WithGroup("upstream").Debug("top-level debug")
+	if !strings.Contains(buf.String(), "top-level debug") {
+		t.Error("Expected a top-level component to keep its override inside later groups")
+	}
+}
+
+func TestMoreVerbose(t *testing.T) {
+	tests := []struct {
+		level    slog.Level
+		expected slog.Level
+	}{
+		{slog.LevelError, slog.LevelWarn},
+		{slog.LevelWarn, slog.LevelInfo},
+		{slog.LevelInfo, slog.LevelDebug},
+		{slog.LevelDebug, slog.LevelDebug},
+	}
+
+	for _, tt := range tests {
+		if got := moreVerbose(tt.level); got != tt.expected {
+			t.Errorf("moreVerbose(%v) = %v, expected %v", tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	levels.configure(slog.LevelInfo, 0)
+	defer levels.configure(slog.LevelInfo, 0)
+	handler := LevelHandler()
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedLevel  string
+	}{
+		{
+			name:           "get current level",
+			method:         http.MethodGet,
+			target:         "/log/level",
+			expectedStatus: http.StatusOK,
+			expectedLevel:  "INFO",
+		},
+		{
+			name:           "set level from query",
+			method:         http.MethodPut,
+			target:         "/log/level?level=debug",
+			expectedStatus: http.StatusOK,
+			expectedLevel:  "DEBUG",
+		},
+		{
+			name:           "set level from body",
+			method:         http.MethodPost,
+			target:         "/log/level",
+			body:           `{"level":"warn","ttl":"1m"}`,
+			expectedStatus: http.StatusOK,
+			expectedLevel:  "WARN",
+		},
+		{
+			name:           "reset level",
+			method:         http.MethodDelete,
+			target:         "/log/level",
+			expectedStatus: http.StatusOK,
+			expectedLevel:  "INFO",
+		},
+		{
+			name:           "invalid level",
+			method:         http.MethodPut,
+			target:         "/log/level?level=verbose",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid ttl",
+			method:         http.MethodPut,
+			target:         "/log/level?level=debug&ttl=soon",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative ttl",
+			method:         http.MethodPut,
+			target:         "/log/level?level=debug&ttl=-1m",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unsupported method",
+			method:         http.MethodPatch,
+			target:         "/log/level",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d (%s)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedLevel == "" {
+				return
+			}
+
+			var state LevelState
+			if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+				t.Fatalf("Expected JSON body, got %s", w.Body.String())
+			}
+			if state.Level != tt.expectedLevel {
+				t.Errorf("Expected level %s, got %s", tt.expectedLevel, state.Level)
+			}
+		})
+	}
+}
+
+func TestLevelHandlerComponent(t *testing.T) {
+	levels.configure(slog.LevelInfo, 0)
+	defer levels.configure(slog.LevelInfo, 0)
+	handler := LevelHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/log/level?level=debug&component=proxy", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var state LevelState
+	if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+		t.Fatalf("Expected JSON body, got %s", w.Body.String())
+	}
+	if state.Level != "INFO" {
+		t.Errorf("Expected global level to be unchanged, got %s", state.Level)
+	}
+	if state.Components["proxy"].Level != "DEBUG" {
+		t.Errorf("Expected proxy component at debug, got %v", state.Components)
+	}
+}
@@ -1,35 +1,95 @@
 package log
 
 import (
+	"errors"
+	"io"
 	"log/slog"
-	"os"
-	"strconv"
-	"strings"
+	"sync"
 )
 
-func InitAsJson() {
-	addSource, err := strconv.ParseBool(os.Getenv("LOG_ADD_SOURCE"))
-	if err != nil {
-		addSource = false // default to false if parsing fails
+var (
+	outputsMu sync.Mutex
+	outputs   []io.Closer // files and sockets opened by the current configuration
+)
+
+// InitWithFallback installs the logger described by cfg like Init, falling back to stdout and returning the
+// error when the configuration is invalid or its outputs cannot be opened
+func InitWithFallback(cfg Config) error {
+	if err := Init(cfg); err != nil {
+		initFallback(cfg)
+		return err
 	}
+	return nil
+}
 
-	var level slog.Level
-	levelStr := os.Getenv("LOG_LEVEL")
-	switch strings.ToLower(levelStr) {
-	case "debug":
-		level = slog.LevelDebug
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
+// Init installs the default slog logger described by cfg, closing the outputs of any previous configuration
+func Init(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
 	}
 
-	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level:     level,
-		AddSource: addSource, // includes function, file and line number in log entries (default: false)
-	})
+	sinks := make([]sink, 0, len(cfg.Sinks))
+	closers := make([]io.Closer, 0, len(cfg.Sinks))
+	for _, sinkCfg := range cfg.Sinks {
+		s, closer, err := newSink(cfg, sinkCfg)
+		if err != nil {
+			closeAll(closers)
+			return err
+		}
+		sinks = append(sinks, s)
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+	}
 
-	slog.SetDefault(slog.New(handler))
+	var handler slog.Handler = &fanoutHandler{sinks: sinks}
+	if attrs := staticAttrs(cfg); len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	// personal and health data is masked unless redaction is explicitly disabled
+	if cfg.Redact {
+		handler = NewRedactingHandler(handler, DefaultRedactOptions())
+	}
+
+	// the level is kept in a runtime registry so it can be changed without a restart, see SetLevel
+	levels.configure(cfg.Level, cfg.LevelTTL)
+	slog.SetDefault(slog.New(newLevelHandler(handler)))
+
+	outputsMu.Lock()
+	previous := outputs
+	outputs = closers
+	outputsMu.Unlock()
+	closeAll(previous)
+	return nil
+}
+
+// Close releases the outputs opened by Init (files, syslog connections)
+func Close() error {
+	outputsMu.Lock()
+	previous := outputs
+	outputs = nil
+	outputsMu.Unlock()
+	return closeAll(previous)
+}
+
+// initFallback logs to stdout keeping the rest of the configuration when the configured outputs cannot be used
+func initFallback(cfg Config) {
+	cfg.Sinks = []SinkConfig{{Type: SinkStdout}}
+	if cfg.Format.validate() != nil {
+		cfg.Format = FormatJSON
+	}
+	if cfg.FieldNaming != NamingECS && cfg.FieldNaming != NamingOTel {
+		cfg.FieldNaming = NamingDefault
+	}
+	_ = Init(cfg)
+}
+
+func closeAll(closers []io.Closer) error {
+	var errs []error
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -9,148 +9,36 @@ import (
 	"testing"
 )
 
-func TestInitAsJson(t *testing.T) {
-	// Save original environment and restore after tests
-	originalLogAddSource := os.Getenv("LOG_ADD_SOURCE")
-	originalLogLevel := os.Getenv("LOG_LEVEL")
-	defer func() {
-		err := os.Setenv("LOG_ADD_SOURCE", originalLogAddSource)
-		if err != nil {
-			return
-		}
-		err = os.Setenv("LOG_LEVEL", originalLogLevel)
-		if err != nil {
-			return
-		}
-	}()
-
+func TestInitJSON(t *testing.T) {
 	tests := []struct {
 		name           string
-		logAddSource   string
-		logLevel       string
-		expectedLevel  slog.Level
+		addSource      bool
+		level          slog.Level
 		expectedSource bool
 	}{
-		{
-			name:           "default values - no env vars set",
-			logAddSource:   "",
-			logLevel:       "",
-			expectedLevel:  slog.LevelInfo,
-			expectedSource: false,
-		},
-		{
-			name:           "LOG_ADD_SOURCE true, LOG_LEVEL debug",
-			logAddSource:   "true",
-			logLevel:       "debug",
-			expectedLevel:  slog.LevelDebug,
-			expectedSource: true,
-		},
-		{
-			name:           "LOG_ADD_SOURCE false, LOG_LEVEL warn",
-			logAddSource:   "false",
-			logLevel:       "warn",
-			expectedLevel:  slog.LevelWarn,
-			expectedSource: false,
-		},
-		{
-			name:           "LOG_ADD_SOURCE true, LOG_LEVEL error",
-			logAddSource:   "true",
-			logLevel:       "error",
-			expectedLevel:  slog.LevelError,
-			expectedSource: true,
-		},
-		{
-			name:           "LOG_ADD_SOURCE false, LOG_LEVEL info",
-			logAddSource:   "false",
-			logLevel:       "info",
-			expectedLevel:  slog.LevelInfo,
-			expectedSource: false,
-		},
-		{
-			name:           "LOG_ADD_SOURCE invalid, LOG_LEVEL unknown - defaults",
-			logAddSource:   "invalid",
-			logLevel:       "unknown",
-			expectedLevel:  slog.LevelInfo,
-			expectedSource: false,
-		},
-		{
-			name:           "LOG_ADD_SOURCE 1, LOG_LEVEL DEBUG (uppercase)",
-			logAddSource:   "1",
-			logLevel:       "DEBUG",
-			expectedLevel:  slog.LevelDebug,
-			expectedSource: true,
-		},
-		{
-			name:           "LOG_ADD_SOURCE 0, LOG_LEVEL WARN (uppercase)",
-			logAddSource:   "0",
-			logLevel:       "WARN",
-			expectedLevel:  slog.LevelWarn,
-			expectedSource: false,
-		},
-		{
-			name:           "LOG_ADD_SOURCE T, LOG_LEVEL ERROR (uppercase)",
-			logAddSource:   "T",
-			logLevel:       "ERROR",
-			expectedLevel:  slog.LevelError,
-			expectedSource: true,
-		},
-		{
-			name:           "LOG_ADD_SOURCE f, LOG_LEVEL mixed case",
-			logAddSource:   "f",
-			logLevel:       "WaRn",
-			expectedLevel:  slog.LevelWarn,
-			expectedSource: false,
-		},
-		{
-			name:           "LOG_ADD_SOURCE empty string, LOG_LEVEL empty string",
-			logAddSource:   "",
-			logLevel:       "",
-			expectedLevel:  slog.LevelInfo,
-			expectedSource: false,
-		},
+		{name: "default values", level: slog.LevelInfo},
+		{name: "source at debug", addSource: true, level: slog.LevelDebug, expectedSource: true},
+		{name: "no source at warn", level: slog.LevelWarn},
+		{name: "source at error", addSource: true, level: slog.LevelError, expectedSource: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Set environment variables
-			if tt.logAddSource == "" {
-				err := os.Unsetenv("LOG_ADD_SOURCE")
-				if err != nil {
-					return
-				}
-			} else {
-				err := os.Setenv("LOG_ADD_SOURCE", tt.logAddSource)
-				if err != nil {
-					return
-				}
-			}
-
-			if tt.logLevel == "" {
-				err := os.Unsetenv("LOG_LEVEL")
-				if err != nil {
-					return
-				}
-			} else {
-				err := os.Setenv("LOG_LEVEL", tt.logLevel)
-				if err != nil {
-					return
-				}
-			}
-
 			// Capture stdout to verify JSON handler is set up correctly
 			var buf bytes.Buffer
 			originalStdout := os.Stdout
 			r, w, _ := os.Pipe()
 			os.Stdout = w
 
-			// Call the function
-			InitAsJson()
-
-			// Call the function
-			InitAsJson()
+			cfg := DefaultConfig()
+			cfg.AddSource = tt.addSource
+			cfg.Level = tt.level
+			if err := Init(cfg); err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
 
 			// Test that the logger is configured correctly by logging a test message
-			slog.Info("test message", "key", "value")
+			slog.Error("test message", "key", "value")
 
 			// Restore stdout and read the captured output
 			err := w.Close()
@@ -165,21 +53,22 @@ func TestInitAsJson(t *testing.T) {
 			output := buf.String()
 
 			// Verify JSON format
-			if output != "" {
-				var logEntry map[string]interface{}
-				if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &logEntry); err != nil {
-					t.Errorf("Expected JSON output, but got invalid JSON: %v", err)
-				}
+			var logEntry map[string]interface{}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &logEntry); err != nil {
+				t.Errorf("Expected JSON output, but got invalid JSON: %v", err)
+			}
 
-				// Check if source information is included based on expectedSource
-				_, hasSource := logEntry["source"]
-				if hasSource != tt.expectedSource {
-					t.Errorf("Expected source field presence: %v, got: %v", tt.expectedSource, hasSource)
-				}
+			// Check if source information is included based on expectedSource
+			_, hasSource := logEntry["source"]
+			if hasSource != tt.expectedSource {
+				t.Errorf("Expected source field presence: %v, got: %v", tt.expectedSource, hasSource)
+			}
+			if Level() != tt.level {
+				t.Errorf("Expected level %v, got %v", tt.level, Level())
 			}
 
 			// Verify the log level by testing what gets logged
-			testLogLevel(t, tt.expectedLevel)
+			testLogLevel(t, tt.level)
 		})
 	}
 }
@@ -244,121 +133,15 @@ func testLogLevel(t *testing.T, expectedLevel slog.Level) {
 	}
 }
 
-func TestInitAsJsonWithSpecificEnvironmentValues(t *testing.T) {
-	// Test edge cases for LOG_ADD_SOURCE parsing
-	testCases := []struct {
-		value    string
-		expected bool
-	}{
-		{"true", true},
-		{"TRUE", true},
-		{"True", true},
-		{"1", true},
-		{"t", true},
-		{"T", true},
-		{"false", false},
-		{"FALSE", false},
-		{"False", false},
-		{"0", false},
-		{"f", false},
-		{"F", false},
-		{"", false},        // unset
-		{"invalid", false}, // invalid value defaults to false
-		{"yes", false},     // strconv.ParseBool doesn't recognize "yes"
-		{"no", false},      // strconv.ParseBool doesn't recognize "no"
-	}
-
-	originalLogAddSource := os.Getenv("LOG_ADD_SOURCE")
-	originalLogLevel := os.Getenv("LOG_LEVEL")
-	defer func() {
-		err := os.Setenv("LOG_ADD_SOURCE", originalLogAddSource)
-		if err != nil {
-			return
-		}
-		err = os.Setenv("LOG_LEVEL", originalLogLevel)
-		if err != nil {
-			return
-		}
-	}()
-
-	for _, tc := range testCases {
-		t.Run("LOG_ADD_SOURCE_"+tc.value, func(t *testing.T) {
-			if tc.value == "" {
-				err := os.Unsetenv("LOG_ADD_SOURCE")
-				if err != nil {
-					return
-				}
-			} else {
-				err := os.Setenv("LOG_ADD_SOURCE", tc.value)
-				if err != nil {
-					return
-				}
-			}
-			err := os.Setenv("LOG_LEVEL", "info")
-			if err != nil {
-				return
-			}
-
-			// Capture output
-			var buf bytes.Buffer
-			originalStdout := os.Stdout
-			r, w, _ := os.Pipe()
-			os.Stdout = w
-
-			InitAsJson()
-			slog.Info("test", "key", "value")
-
-			err = w.Close()
-			if err != nil {
-				return
-			}
-			os.Stdout = originalStdout
-			_, err = buf.ReadFrom(r)
-			if err != nil {
-				return
-			}
-			output := buf.String()
-
-			// Parse JSON and check source field
-			var logEntry map[string]interface{}
-			if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &logEntry); err != nil {
-				t.Fatalf("Failed to parse JSON: %v", err)
-			}
-
-			_, hasSource := logEntry["source"]
-			if hasSource != tc.expected {
-				t.Errorf("For LOG_ADD_SOURCE=%q, expected source field presence: %v, got: %v", tc.value, tc.expected, hasSource)
-			}
-		})
-	}
-}
-
-// Benchmark the InitAsJson function
-func BenchmarkInitAsJson(b *testing.B) {
-	originalLogAddSource := os.Getenv("LOG_ADD_SOURCE")
-	originalLogLevel := os.Getenv("LOG_LEVEL")
-	defer func() {
-		err := os.Setenv("LOG_ADD_SOURCE", originalLogAddSource)
-		if err != nil {
-			return
-		}
-		err = os.Setenv("LOG_LEVEL", originalLogLevel)
-		if err != nil {
-			return
-		}
-	}()
-
-	err := os.Setenv("LOG_ADD_SOURCE", "true")
-	if err != nil {
-		return
-	}
-	err = os.Setenv("LOG_LEVEL", "info")
-	if err != nil {
-		return
-	}
+// Benchmark the Init function
+func BenchmarkInit(b *testing.B) {
+	cfg := DefaultConfig()
+	cfg.AddSource = true
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		InitAsJson()
+		if err := Init(cfg); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
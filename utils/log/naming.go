@@ -0,0 +1,99 @@
+package log
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// ecsVersion is the Elastic Common Schema version the ECS field names follow
+const ecsVersion = "8.11"
+
+// replaceAttrFunc renames the built-in fields of top-level records for the given naming scheme
+func replaceAttrFunc(naming FieldNaming) func(groups []string, attr slog.Attr) slog.Attr {
+	switch naming {
+	case NamingECS:
+		return func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return attr
+			}
+			switch attr.Key {
+			case slog.TimeKey:
+				attr.Key = "@timestamp"
+			case slog.LevelKey:
+				attr.Key = "log.level"
+			case slog.MessageKey:
+				attr.Key = "message"
+			case slog.SourceKey:
+				return sourceAttr(attr, "log.origin", "file.name", "file.line", "function")
+			}
+			return attr
+		}
+	case NamingOTel:
+		return func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return attr
+			}
+			switch attr.Key {
+			case slog.TimeKey:
+				attr.Key = "timestamp"
+			case slog.LevelKey:
+				attr.Key = "severity_text"
+			case slog.MessageKey:
+				attr.Key = "body"
+			case slog.SourceKey:
+				return sourceAttr(attr, "code", "filepath", "lineno", "function")
+			}
+			return attr
+		}
+	default:
+		return nil
+	}
+}
+
+// sourceAttr flattens the source location into a group with the given member names
+func sourceAttr(attr slog.Attr, key, fileKey, lineKey, functionKey string) slog.Attr {
+	source, ok := attr.Value.Any().(*slog.Source)
+	if !ok {
+		return attr
+	}
+	return slog.Group(key,
+		slog.String(fileKey, source.File),
+		slog.Int(lineKey, source.Line),
+		slog.String(functionKey, source.Function),
+	)
+}
+
+// staticAttrs returns the attributes added to every record, named after the naming scheme
+func staticAttrs(cfg Config) []slog.Attr {
+	serviceKey, versionKey, instanceKey := "service", "version", "pod"
+	switch cfg.FieldNaming {
+	case NamingECS:
+		serviceKey, versionKey, instanceKey = "service.name", "service.version", "service.node.name"
+	case NamingOTel:
+		serviceKey, versionKey, instanceKey = "service.name", "service.version", "k8s.pod.name"
+	}
+
+	var attrs []slog.Attr
+	if cfg.FieldNaming == NamingECS {
+		attrs = append(attrs, slog.String("ecs.version", ecsVersion))
+	}
+	if cfg.Service != "" {
+		attrs = append(attrs, slog.String(serviceKey, cfg.Service))
+	}
+	if cfg.Version != "" {
+		attrs = append(attrs, slog.String(versionKey, cfg.Version))
+	}
+	if cfg.Instance != "" {
+		attrs = append(attrs, slog.String(instanceKey, cfg.Instance))
+	}
+
+	keys := make([]string, 0, len(cfg.Attributes))
+	for key := range cfg.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attrs = append(attrs, slog.String(key, cfg.Attributes[key]))
+	}
+	return attrs
+}
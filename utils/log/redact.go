@@ -0,0 +1,284 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// DefaultMask replaces redacted values
+const DefaultMask = "[REDACTED]"
+
+// RedactPattern masks every match of a regular expression inside string values
+type RedactPattern struct {
+	// Name identifies the rule in redaction metrics
+	Name string
+	// Regexp selects the sensitive text
+	Regexp *regexp.Regexp
+	// Replacement is the regexp template used for matches (e.g. "${1}[REDACTED]"), the mask is used when empty
+	Replacement string
+}
+
+// RedactOptions configures the redacting handler
+type RedactOptions struct {
+	// Keys lists attribute and JSON field names whose values are always masked (case-insensitive)
+	Keys []string
+	// Patterns are applied to every string value, including log messages and JSON strings
+	Patterns []RedactPattern
+	// Mask replaces redacted values, DefaultMask is used when empty
+	Mask string
+	// OnRedact is called once per redaction with the name of the rule that matched ("key" for key rules)
+	OnRedact func(rule string)
+}
+
+// DefaultRedactKeys are attribute names that always carry secrets or personal data
+var DefaultRedactKeys = []string{
+	"password", "passwd", "secret", "token", "access_token", "refresh_token", "id_token",
+	"authorization", "cookie", "set-cookie", "api_key", "apikey", "x-api-key",
+	"codice_fiscale", "codicefiscale", "fiscal_code", "tax_code",
+	"email", "phone", "telecom", "birthdate", "birth_date", "address",
+}
+
+// DefaultRedactPatterns match personal data and credentials that may appear inside free text
+var DefaultRedactPatterns = []RedactPattern{
+	{
+		Name:   "jwt",
+		Regexp: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	{
+		Name:        "bearer",
+		Regexp:      regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/-]+=*`),
+		Replacement: "${1} " + DefaultMask,
+	},
+	{
+		Name:        "api_key",
+		Regexp:      regexp.MustCompile(`(?i)\b((?:api[_-]?key|access[_-]?token|client[_-]?secret|secret|password|token)["']?\s*[:=]\s*["']?)[^\s"'&,;}]+`),
+		Replacement: "${1}" + DefaultMask,
+	},
+	{
+		Name:   "api_key",
+		Regexp: regexp.MustCompile(`\b(?:sk|pk|rk)[-_](?:live[-_]|test[-_])?[A-Za-z0-9]{16,}\b`),
+	},
+	{
+		Name:   "codice_fiscale",
+		Regexp: regexp.MustCompile(`(?i)\b[A-Z]{6}[0-9LMNPQRSTUV]{2}[ABCDEHLMPRST][0-9LMNPQRSTUV]{2}[A-Z][0-9LMNPQRSTUV]{3}[A-Z]\b`),
+	},
+	{
+		Name:   "email",
+		Regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		Name:   "phone",
+		Regexp: regexp.MustCompile(`(?:\+|\b00)\d{2,3}[ .-]?\d{2,4}[ .-]?\d{3,4}[ .-]?\d{0,4}\b|\b3\d{2}[ .-]?\d{6,7}\b|\b0\d{1,3}[ .-]\d{5,8}\b`),
+	},
+}
+
+// DefaultRedactOptions returns the default keys and patterns, reporting redactions to the observer set with SetRedactionObserver
+func DefaultRedactOptions() RedactOptions {
+	return RedactOptions{
+		Keys:     DefaultRedactKeys,
+		Patterns: DefaultRedactPatterns,
+		Mask:     DefaultMask,
+		OnRedact: notifyRedactionObserver,
+	}
+}
+
+var redactionObserver atomic.Pointer[func(rule string)]
+
+// SetRedactionObserver registers a callback (e.g. a metrics counter) notified of every redaction made by the default handler
+func SetRedactionObserver(observer func(rule string)) {
+	redactionObserver.Store(&observer)
+}
+
+func notifyRedactionObserver(rule string) {
+	if observer := redactionObserver.Load(); observer != nil && *observer != nil {
+		(*observer)(rule)
+	}
+}
+
+// redactingHandler masks sensitive attribute values before passing records to the inner handler
+type redactingHandler struct {
+	inner    slog.Handler
+	keys     map[string]struct{}
+	patterns []RedactPattern
+	mask     string
+	onRedact func(rule string)
+}
+
+// NewRedactingHandler wraps a handler so that configured keys and patterns are masked in messages,
+// attributes, nested groups, byte slices and JSON strings
+func NewRedactingHandler(inner slog.Handler, opts RedactOptions) slog.Handler {
+	h := &redactingHandler{
+		inner:    inner,
+		keys:     make(map[string]struct{}, len(opts.Keys)),
+		patterns: opts.Patterns,
+		mask:     opts.Mask,
+		onRedact: opts.OnRedact,
+	}
+	if h.mask == "" {
+		h.mask = DefaultMask
+	}
+	for _, key := range opts.Keys {
+		h.keys[strings.ToLower(key)] = struct{}{}
+	}
+	return h
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.inner.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+	clone := *h
+	clone.inner = h.inner.WithAttrs(redacted)
+	return &clone
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithGroup(name)
+	return &clone
+}
+
+/* === Helper Methods === */
+
+func (h *redactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	if h.isSensitiveKey(attr.Key) && attr.Value.Kind() != slog.KindGroup {
+		h.report("key")
+		return slog.String(attr.Key, h.mask)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactString(attr.Value.String()))
+	case slog.KindGroup:
+		group := attr.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = h.redactAttr(member)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		return slog.Attr{Key: attr.Key, Value: h.redactAny(attr.Value.Any())}
+	default:
+		return attr
+	}
+}
+
+// redactAny redacts values that would otherwise be rendered opaquely (byte slices as base64, errors, structs as JSON)
+func (h *redactingHandler) redactAny(value any) slog.Value {
+	switch v := value.(type) {
+	case []byte:
+		if utf8.Valid(v) {
+			return slog.StringValue(h.redactString(string(v)))
+		}
+		return slog.AnyValue(v)
+	case json.RawMessage:
+		return slog.AnyValue(json.RawMessage(h.redactJSON(v)))
+	case error:
+		return slog.StringValue(h.redactString(v.Error()))
+	case nil, bool, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return slog.AnyValue(v)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return slog.AnyValue(value)
+	}
+	redacted := h.redactJSON(encoded)
+	if bytes.Equal(redacted, encoded) {
+		return slog.AnyValue(value)
+	}
+	return slog.AnyValue(json.RawMessage(redacted))
+}
+
+// redactString masks JSON documents field by field and free text with the configured patterns
+func (h *redactingHandler) redactString(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if len(trimmed) > 1 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return string(h.redactJSON([]byte(trimmed)))
+	}
+	return h.redactText(s)
+}
+
+func (h *redactingHandler) redactText(s string) string {
+	for _, pattern := range h.patterns {
+		replacement := pattern.Replacement
+		if replacement == "" {
+			replacement = h.mask
+		}
+		s = pattern.Regexp.ReplaceAllStringFunc(s, func(match string) string {
+			h.report(pattern.Name)
+			return pattern.Regexp.ReplaceAllString(match, replacement)
+		})
+	}
+	return s
+}
+
+func (h *redactingHandler) redactJSON(data []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return []byte(h.redactText(string(data)))
+	}
+	redacted, err := json.Marshal(h.redactJSONValue(document))
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+func (h *redactingHandler) redactJSONValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, member := range v {
+			if h.isSensitiveKey(key) {
+				h.report("key")
+				v[key] = h.mask
+				continue
+			}
+			v[key] = h.redactJSONValue(member)
+		}
+		return v
+	case []any:
+		for i, member := range v {
+			v[i] = h.redactJSONValue(member)
+		}
+		return v
+	case string:
+		return h.redactText(v)
+	default:
+		return v
+	}
+}
+
+func (h *redactingHandler) isSensitiveKey(key string) bool {
+	_, ok := h.keys[strings.ToLower(key)]
+	return ok
+}
+
+func (h *redactingHandler) report(rule string) {
+	if h.onRedact != nil {
+		h.onRedact(rule)
+	}
+}
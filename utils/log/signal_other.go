@@ -0,0 +1,8 @@
+//go:build !unix
+
+package log
+
+// WatchSignals is a no-op on platforms without SIGUSR1/SIGUSR2, use LevelHandler instead
+func WatchSignals() (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package log
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchSignals lets operators change the log level of a running process:
+// SIGUSR1 makes logging one step more verbose, SIGUSR2 restores the configured level.
+// The returned function stops watching.
+func WatchSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				switch sig {
+				case syscall.SIGUSR1:
+					level := moreVerbose(Level())
+					SetLevel(level, DefaultTTL())
+					slog.Warn("log level raised by signal", "level", level.String(), "ttl", DefaultTTL().String())
+				case syscall.SIGUSR2:
+					ResetLevel()
+					slog.Warn("log level restored by signal", "level", Level().String())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,145 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// sink is one configured output with its own minimum level
+type sink struct {
+	handler  slog.Handler
+	minLevel slog.Level
+}
+
+// fanoutHandler sends every record to each sink whose level allows it
+type fanoutHandler struct {
+	sinks []sink
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, s := range h.sinks {
+		if level >= s.minLevel && s.handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, s := range h.sinks {
+		if record.Level >= s.minLevel && s.handler.Enabled(ctx, record.Level) {
+			if err := s.handler.Handle(ctx, record.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	sinks := make([]sink, len(h.sinks))
+	for i, s := range h.sinks {
+		sinks[i] = sink{handler: s.handler.WithAttrs(attrs), minLevel: s.minLevel}
+	}
+	return &fanoutHandler{sinks: sinks}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	sinks := make([]sink, len(h.sinks))
+	for i, s := range h.sinks {
+		sinks[i] = sink{handler: s.handler.WithGroup(name), minLevel: s.minLevel}
+	}
+	return &fanoutHandler{sinks: sinks}
+}
+
+// newSink opens the output of a sink and builds its formatting handler, the returned closer releases the output
+func newSink(cfg Config, sinkCfg SinkConfig) (sink, io.Closer, error) {
+	minLevel := allLevels
+	if sinkCfg.Level != "" {
+		level, err := ParseLevel(sinkCfg.Level)
+		if err != nil {
+			return sink{}, nil, err
+		}
+		minLevel = level
+	}
+
+	format := sinkCfg.Format
+	if format == "" {
+		format = cfg.Format
+	}
+
+	var closer io.Closer
+	var handler slog.Handler
+	switch sinkCfg.Type {
+	case SinkStdout:
+		handler = newFormatHandler(os.Stdout, format, cfg)
+	case SinkStderr:
+		handler = newFormatHandler(os.Stderr, format, cfg)
+	case SinkFile:
+		file, err := newRotatingFile(sinkCfg.Path, int64(sinkCfg.MaxSizeMB)<<20, sinkCfg.MaxAge, sinkCfg.MaxBackups)
+		if err != nil {
+			return sink{}, nil, err
+		}
+		handler, closer = newFormatHandler(file, format, cfg), file
+	case SinkSyslog:
+		tag := sinkCfg.Tag
+		if tag == "" {
+			tag = cfg.Service
+		}
+		writer, err := newSyslogWriter(sinkCfg.Network, sinkCfg.Address, tag)
+		if err != nil {
+			return sink{}, nil, err
+		}
+		handler, closer = &syslogHandler{inner: newFormatHandler(writer, format, cfg), writer: writer}, writer
+	default:
+		return sink{}, nil, fmt.Errorf("log: unknown output %q", sinkCfg.Type)
+	}
+	return sink{handler: handler, minLevel: minLevel}, closer, nil
+}
+
+// newFormatHandler returns the slog handler encoding records in the given format
+func newFormatHandler(w io.Writer, format Format, cfg Config) slog.Handler {
+	opts := &slog.HandlerOptions{
+		Level:       allLevels,
+		AddSource:   cfg.AddSource,
+		ReplaceAttr: replaceAttrFunc(cfg.FieldNaming),
+	}
+	switch format {
+	case FormatText:
+		return newConsoleHandler(w, opts)
+	case FormatLogfmt:
+		return slog.NewTextHandler(w, opts)
+	default:
+		return slog.NewJSONHandler(w, opts)
+	}
+}
+
+// syslogHandler tells the syslog writer the severity of the record being written
+type syslogHandler struct {
+	inner  slog.Handler
+	writer *syslogWriter
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.writer.mu.Lock()
+	defer h.writer.mu.Unlock()
+	h.writer.level = record.Level
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithAttrs(attrs), writer: h.writer}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithGroup(name), writer: h.writer}
+}
@@ -0,0 +1,27 @@
+//go:build windows || plan9
+
+package log
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// syslogWriter is unavailable on this platform
+type syslogWriter struct {
+	mu    sync.Mutex
+	level slog.Level
+}
+
+func newSyslogWriter(_, _, _ string) (*syslogWriter, error) {
+	return nil, errors.New("log: syslog output is not supported on this platform")
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("log: syslog output is not supported on this platform")
+}
+
+func (w *syslogWriter) Close() error {
+	return nil
+}
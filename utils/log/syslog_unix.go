@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+
+package log
+
+import (
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+// syslogWriter writes each formatted record to syslog with the severity of the record
+type syslogWriter struct {
+	mu     sync.Mutex
+	level  slog.Level
+	writer *syslog.Writer
+}
+
+// newSyslogWriter connects to the syslog daemon, the local socket is used when network and address are empty
+func newSyslogWriter(network, address, tag string) (*syslogWriter, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{writer: writer}, nil
+}
+
+// Write is called by the formatting handler while syslogHandler holds mu
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch {
+	case w.level >= slog.LevelError:
+		err = w.writer.Err(message)
+	case w.level >= slog.LevelWarn:
+		err = w.writer.Warning(message)
+	case w.level >= slog.LevelInfo:
+		err = w.writer.Info(message)
+	default:
+		err = w.writer.Debug(message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *syslogWriter) Close() error {
+	return w.writer.Close()
+}
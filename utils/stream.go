@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrStreamClosed is returned when writing to a stream that was closed
+var ErrStreamClosed = errors.New("stream closed")
+
+const (
+	// defaultFlushSize is how much encoded data a stream buffers before writing it out
+	defaultFlushSize = 32 << 10
+	// maxPooledBuffer keeps the buffers grown by unusually large values out of the pool
+	maxPooledBuffer = 1 << 20
+)
+
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// GetBuffer returns an empty buffer from a shared pool, to give back with PutBuffer once its content is consumed
+func GetBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer returns buf to the pool, buffers grown past 1 MiB are left to the garbage collector
+func PutBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// StreamEncoder encodes a sequence of values as they are produced instead of marshalling them all at once
+type StreamEncoder interface {
+	// Encode appends v to the stream
+	Encode(v any) error
+	// Flush writes out the buffered values, and flushes the underlying writer when it supports it
+	Flush() error
+	// Close ends the stream, flushing it; it does not close the underlying writer
+	Close() error
+	// Count is the number of values encoded so far
+	Count() int
+}
+
+// StreamOption configures a stream encoder
+type StreamOption func(*stream)
+
+// WithFlushEvery flushes the stream, down to the underlying writer, after every n values: a client reading the
+// stream sees the values as they are produced instead of by chunks of 32 KiB
+func WithFlushEvery(n int) StreamOption {
+	return func(s *stream) {
+		s.flushEvery = n
+	}
+}
+
+// WithFlushSize sets how many encoded bytes are buffered before they are written out, 32 KiB by default
+func WithFlushSize(size int) StreamOption {
+	return func(s *stream) {
+		s.flushSize = size
+	}
+}
+
+// NewArrayEncoder returns an encoder writing the values to w as the elements of a single JSON array
+func NewArrayEncoder(w io.Writer, opts ...StreamOption) StreamEncoder {
+	return newStream(w, []byte("["), []byte(","), []byte("]"), opts)
+}
+
+// NewNDJSONEncoder returns an encoder writing the values to w as newline delimited JSON, one value per line
+func NewNDJSONEncoder(w io.Writer, opts ...StreamOption) StreamEncoder {
+	return newStream(w, nil, nil, nil, opts)
+}
+
+// stream encodes values between an opening and a closing delimiter, separated by sep, one line each when sep is nil
+type stream struct {
+	w                  io.Writer
+	open, sep, closing []byte
+
+	buf        *bytes.Buffer
+	encoder    *json.Encoder
+	count      int
+	flushEvery int
+	flushSize  int
+	closed     bool
+}
+
+func newStream(w io.Writer, open, sep, closing []byte, opts []StreamOption) *stream {
+	s := &stream{w: w, open: open, sep: sep, closing: closing, buf: GetBuffer(), flushSize: defaultFlushSize}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.encoder = json.NewEncoder(s.buf)
+	return s
+}
+
+func (s *stream) Encode(v any) error {
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	delimiter := s.sep
+	if s.count == 0 {
+		delimiter = s.open
+	}
+	s.buf.Write(delimiter)
+	if err := s.encoder.Encode(v); err != nil {
+		// drop the delimiter so that the values encoded so far stay a valid stream
+		s.buf.Truncate(s.buf.Len() - len(delimiter))
+		return err
+	}
+	// json.Encoder ends every value with a newline, which only NDJSON wants
+	if s.sep != nil {
+		s.buf.Truncate(s.buf.Len() - 1)
+	}
+	s.count++
+
+	if s.flushEvery > 0 && s.count%s.flushEvery == 0 {
+		return s.Flush()
+	}
+	if s.buf.Len() >= s.flushSize {
+		return s.writeBuffer()
+	}
+	return nil
+}
+
+func (s *stream) Flush() error {
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if err := s.writeBuffer(); err != nil {
+		return err
+	}
+	switch flusher := s.w.(type) {
+	case interface{ Flush() error }:
+		return flusher.Flush()
+	case interface{ Flush() }:
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (s *stream) Close() error {
+	if s.closed {
+		return nil
+	}
+	if s.count == 0 {
+		s.buf.Write(s.open)
+	}
+	s.buf.Write(s.closing)
+	err := s.Flush()
+	s.closed = true
+	PutBuffer(s.buf)
+	s.buf = nil
+	return err
+}
+
+func (s *stream) Count() int {
+	return s.count
+}
+
+func (s *stream) writeBuffer() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.buf.Bytes())
+	s.buf.Reset()
+	return err
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestArrayEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []any
+		expected string
+	}{
+		{"empty", nil, "[]"},
+		{"single", []any{TestStruct{Name: "John", Age: 30}}, `[{"name":"John","age":30}]`},
+		{"several", []any{1, "two", map[string]int{"three": 3}}, `[1,"two",{"three":3}]`},
+		{"invalid value skipped", []any{1, InvalidStruct{Ch: make(chan int)}, 2}, "[1,2]"},
+		{"invalid first value skipped", []any{InvalidStruct{Ch: make(chan int)}, 1}, "[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := NewArrayEncoder(&buf)
+			for _, v := range tt.values {
+				_ = encoder.Encode(v)
+			}
+			if err := encoder.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, buf.String())
+			}
+			if !json.Valid(buf.Bytes()) {
+				t.Errorf("Expected valid JSON, got %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewNDJSONEncoder(&buf)
+	for _, v := range []any{TestStruct{Name: "John", Age: 30}, InvalidStruct{Ch: make(chan int)}, 42} {
+		_ = encoder.Encode(v)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "{\"name\":\"John\",\"age\":30}\n42\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+	if encoder.Count() != 2 {
+		t.Errorf("Expected 2 values, got %d", encoder.Count())
+	}
+}
+
+type flushRecorder struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (f *flushRecorder) Flush() { f.flushes++ }
+
+func TestStreamFlushing(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []StreamOption
+		expectedWrites  bool
+		expectedFlushes int
+	}{
+		{"buffered until close", nil, false, 1},
+		{"flush every value", []StreamOption{WithFlushEvery(1)}, true, 4},
+		{"small flush size", []StreamOption{WithFlushSize(8)}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &flushRecorder{}
+			encoder := NewNDJSONEncoder(w, tt.opts...)
+			for i := 0; i < 3; i++ {
+				_ = encoder.Encode(TestStruct{Name: "John", Age: i})
+			}
+			if wrote := w.Len() > 0; wrote != tt.expectedWrites {
+				t.Errorf("Expected data written before close to be %v, got %v", tt.expectedWrites, wrote)
+			}
+			_ = encoder.Close()
+			if w.flushes != tt.expectedFlushes {
+				t.Errorf("Expected %d flushes, got %d", tt.expectedFlushes, w.flushes)
+			}
+			if strings.Count(w.String(), "\n") != 3 {
+				t.Errorf("Expected every value once, got %q", w.String())
+			}
+		})
+	}
+}
+
+func TestStreamClosed(t *testing.T) {
+	encoder := NewArrayEncoder(io.Discard)
+	_ = encoder.Close()
+
+	if err := encoder.Encode(1); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("Expected ErrStreamClosed, got %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Errorf("Expected closing twice to succeed, got %v", err)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	buf := GetBuffer()
+	buf.WriteString("patient")
+	PutBuffer(buf)
+
+	if reused := GetBuffer(); reused.Len() != 0 {
+		t.Errorf("Expected an empty buffer from the pool, got %q", reused.String())
+	}
+}
+
+// benchmarks comparing marshalling a whole collection with streaming it
+
+func benchmarkCollection(n int) []TestStruct {
+	values := make([]TestStruct, n)
+	for i := range values {
+		values[i] = TestStruct{Name: "BenchmarkTest", Age: i}
+	}
+	return values
+}
+
+func BenchmarkToJsonByteCollection(b *testing.B) {
+	data := benchmarkCollection(10_000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg, _ := ToJsonByte(data)
+		_, _ = io.Discard.Write(msg)
+	}
+}
+
+func BenchmarkToJsonStringCollection(b *testing.B) {
+	data := benchmarkCollection(10_000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg, _ := ToJsonString(data)
+		_, _ = io.WriteString(io.Discard, msg)
+	}
+}
+
+func BenchmarkArrayEncoderCollection(b *testing.B) {
+	data := benchmarkCollection(10_000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encoder := NewArrayEncoder(io.Discard)
+		for _, v := range data {
+			_ = encoder.Encode(v)
+		}
+		_ = encoder.Close()
+	}
+}
+
+func BenchmarkNDJSONEncoderCollection(b *testing.B) {
+	data := benchmarkCollection(10_000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encoder := NewNDJSONEncoder(io.Discard)
+		for _, v := range data {
+			_ = encoder.Encode(v)
+		}
+		_ = encoder.Close()
+	}
+}